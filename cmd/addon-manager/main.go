@@ -8,6 +8,7 @@ import (
 	"github.com/oam-dev/cluster-gateway/pkg/addon/agent"
 	"github.com/oam-dev/cluster-gateway/pkg/addon/controllers"
 	proxyv1alpha1 "github.com/oam-dev/cluster-gateway/pkg/apis/proxy/v1alpha1"
+	"github.com/oam-dev/cluster-gateway/pkg/health"
 	"github.com/oam-dev/cluster-gateway/pkg/util"
 	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -43,6 +44,7 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var signerSecretName string
+	var healthProbeConfig string
 
 	logger := klogr.New()
 	klog.SetOutput(os.Stdout)
@@ -54,6 +56,9 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&signerSecretName, "signer-secret-name", "cluster-gateway-signer",
 		"The name of the secret to store the signer CA")
+	flag.StringVar(&healthProbeConfig, "health-probe-config", "",
+		"The path to the file declaring the probes of the managed clusters, which can be overridden "+
+			"by the \""+health.AnnotationKeyHealthProbeConfiguration+"\" annotation of the cluster gateway")
 
 	flag.Parse()
 	ctrl.SetLogger(logger)
@@ -102,7 +107,12 @@ func main() {
 		setupLog.Error(err, "unable to setup installer")
 		os.Exit(1)
 	}
-	if err := controllers.SetupClusterGatewayHealthProberWithManager(mgr); err != nil {
+	probeConfig, err := health.LoadProbeConfiguration(healthProbeConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to load health probe config")
+		os.Exit(1)
+	}
+	if err := controllers.SetupClusterGatewayHealthProberWithManager(mgr, probeConfig); err != nil {
 		setupLog.Error(err, "unable to setup health prober")
 		os.Exit(1)
 	}
@@ -24,7 +24,9 @@ import (
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/apiserver-runtime/pkg/builder"
 
+	"github.com/oam-dev/cluster-gateway/pkg/audit"
 	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/health"
 	"github.com/oam-dev/cluster-gateway/pkg/metrics"
 	"github.com/oam-dev/cluster-gateway/pkg/options"
 	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
@@ -40,6 +42,7 @@ func main() {
 
 	// registering metrics
 	metrics.Register()
+	metrics.SetClusterCredentialExpirationsFunc(clusterv1alpha1.ListClusterCredentialExpirations)
 
 	cmd, err := builder.APIServer.
 		// +kubebuilder:scaffold:resource-register
@@ -54,6 +57,13 @@ func main() {
 				if requestInfo.Resource == "clustergateways" && requestInfo.Subresource == "proxy" {
 					return true
 				}
+				// the fanout watches multiplex the watches of the clusters in one request,
+				// while the fanout lists are bounded by the request timeout and counted
+				// by the max-in-flight as the other reads
+				if requestInfo.Resource == "clustergateways" && requestInfo.Subresource == "fanout" {
+					watch := r.URL.Query().Get("watch")
+					return watch == "true" || watch == "1"
+				}
 				return genericfilters.BasicLongRunningRequestCheck(sets.NewString("watch"), sets.NewString())(r, requestInfo)
 			}
 			return config
@@ -68,6 +78,12 @@ func main() {
 			if err := clusterv1alpha1.LoadGlobalClusterGatewayProxyConfig(); err != nil {
 				klog.Fatal(err)
 			}
+			if err := clusterv1alpha1.LoadProxyAuthorizationWebhook(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := audit.Init(); err != nil {
+				klog.Fatal(err)
+			}
 			return options
 		}).
 		WithServerFns(func(server *builder.GenericAPIServer) *builder.GenericAPIServer {
@@ -75,6 +91,11 @@ func main() {
 			return server
 		}).
 		WithPostStartHook("init-master-loopback-client", singleton.InitLoopbackClient).
+		WithPostStartHook("watch-cluster-gateway-proxy-config", func(ctx server.PostStartHookContext) error {
+			return clusterv1alpha1.WatchGlobalClusterGatewayProxyConfig(ctx)
+		}).
+		WithPostStartHook("start-cluster-health-prober", health.RunHealthProber).
+		WithPostStartHook("start-proxy-audit-backend", audit.Run).
 		WithOpenAPIDefinitions("Cluster Gateway", "1.0.0", generated.GetOpenAPIDefinitions).
 		Build()
 	if err != nil {
@@ -87,6 +108,13 @@ func main() {
 	config.AddProxyAuthorizationFlags(cmd.Flags())
 	config.AddUserAgentFlags(cmd.Flags())
 	config.AddClusterGatewayProxyConfig(cmd.Flags())
+	config.AddClusterTransportFlags(cmd.Flags())
+	config.AddDynamicCredentialFlags(cmd.Flags())
+	config.AddProxyCircuitBreakerFlags(cmd.Flags())
+	config.AddProxyRateLimitFlags(cmd.Flags())
+	config.AddProxyAuditFlags(cmd.Flags())
+	config.AddProxyFanoutFlags(cmd.Flags())
+	config.AddHealthProbeFlags(cmd.Flags())
 	cmd.Flags().BoolVarP(&options.OCMIntegration, "ocm-integration", "", false,
 		"Enabling OCM integration, reading cluster CA and api endpoint from managed "+
 			"cluster.")
@@ -0,0 +1,113 @@
+package authorization
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/oam-dev/cluster-gateway/e2e/framework"
+	multicluster "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/transport"
+	clusterv1alpha1 "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+)
+
+const (
+	authorizationTestBasename = "authorization"
+)
+
+var _ = Describe("Proxy Subpath Authorization Test", func() {
+	f := framework.NewE2EFramework(authorizationTestBasename)
+	name := "e2e-proxy-authorization-" + framework.RunID
+	userName := "e2e-proxy-user-" + framework.RunID
+
+	// the client proxying to the test cluster as the test user
+	newUserClient := func() kubernetes.Interface {
+		cfg := f.HubRESTConfig()
+		cfg.Impersonate.UserName = userName
+		cfg.WrapTransport = multicluster.NewClusterGatewayRoundTripper
+		c, err := kubernetes.NewForConfig(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		return c
+	}
+	clusterCtx := func() context.Context {
+		return multicluster.WithMultiClusterContext(context.TODO(), f.TestClusterName())
+	}
+
+	BeforeEach(func() {
+		if !f.IsProxyAuthorizationClusterScoped() {
+			Skip("the cluster-scoped proxy subpath authorization is not enabled")
+		}
+		By("Granting the test user to list pods only in the test cluster")
+		c := f.HubNativeClient()
+		_, err := c.RbacV1().ClusterRoles().Create(context.TODO(), &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Rules: []rbacv1.PolicyRule{{
+				APIGroups: []string{"cluster.core.oam.dev"},
+				Resources: []string{"clustergateways/proxy"},
+				Verbs:     []string{"*"},
+			}, {
+				APIGroups: []string{clusterv1alpha1.ClusterScopedAPIGroup(f.TestClusterName(), "")},
+				Resources: []string{"pods"},
+				Verbs:     []string{"list"},
+			}},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = c.RbacV1().ClusterRoleBindings().Create(context.TODO(), &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     name,
+			},
+			Subjects: []rbacv1.Subject{{
+				APIGroup: rbacv1.GroupName,
+				Kind:     rbacv1.UserKind,
+				Name:     userName,
+			}},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if !f.IsProxyAuthorizationClusterScoped() {
+			return
+		}
+		c := f.HubNativeClient()
+		Expect(c.RbacV1().ClusterRoleBindings().Delete(context.TODO(), name, metav1.DeleteOptions{})).To(Succeed())
+		Expect(c.RbacV1().ClusterRoles().Delete(context.TODO(), name, metav1.DeleteOptions{})).To(Succeed())
+	})
+
+	It("Granted resources in the cluster can be proxied",
+		func() {
+			By("Listing pods in the test cluster")
+			Eventually(func() error {
+				_, err := newUserClient().CoreV1().Pods("default").List(clusterCtx(), metav1.ListOptions{})
+				return err
+			}).Should(Succeed())
+		})
+
+	It("Resources not granted in the cluster are forbidden",
+		func() {
+			By("Listing deployments in the test cluster")
+			_, err := newUserClient().AppsV1().Deployments("default").List(clusterCtx(), metav1.ListOptions{})
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+		})
+
+	It("Verbs not granted in the cluster are forbidden",
+		func() {
+			By("Getting a pod in the test cluster")
+			_, err := newUserClient().CoreV1().Pods("default").Get(clusterCtx(), "non-existing", metav1.GetOptions{})
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+		})
+
+	It("Non-resource paths not granted in the cluster are forbidden",
+		func() {
+			By("Probing the health of the test cluster")
+			_, err := newUserClient().Discovery().RESTClient().Get().AbsPath("healthz").DoRaw(clusterCtx())
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+		})
+})
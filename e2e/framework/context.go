@@ -14,6 +14,8 @@ type E2EContext struct {
 	HubKubeConfig  string
 	TestCluster    string
 	IsOCMInstalled bool
+
+	IsProxyAuthorizationClusterScoped bool
 }
 
 func ParseFlags() {
@@ -36,6 +38,10 @@ func registerFlags() {
 		"ocm-installed",
 		false,
 		"Is the test running inside OCM environment")
+	flag.BoolVar(&context.IsProxyAuthorizationClusterScoped,
+		"proxy-authorization-cluster-scoped",
+		false,
+		"Is the cluster-gateway running with --authorize-proxy-subpath and --authorize-proxy-subpath-cluster-scoped")
 }
 
 func defaultFlags() {
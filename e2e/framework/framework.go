@@ -19,6 +19,7 @@ type Framework interface {
 	HubRESTConfig() *rest.Config
 	TestClusterName() string
 	IsOCMInstalled() bool
+	IsProxyAuthorizationClusterScoped() bool
 
 	HubNativeClient() kubernetes.Interface
 	HubRuntimeClient() client.Client
@@ -75,6 +76,10 @@ func (f *framework) IsOCMInstalled() bool {
 	return f.ctx.IsOCMInstalled
 }
 
+func (f *framework) IsProxyAuthorizationClusterScoped() bool {
+	return f.ctx.IsProxyAuthorizationClusterScoped
+}
+
 func (f *framework) TestClusterName() string {
 	return f.ctx.TestCluster
 }
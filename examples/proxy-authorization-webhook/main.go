@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	clusterv1alpha1 "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+)
+
+var bindAddress string
+var certFile string
+var keyFile string
+var userName string
+var clusterLabel string
+
+// The webhook allows the user to list deployments only in the clusters with
+// the label, and has no opinion on the other requests which are then
+// authorized by the hub.
+func main() {
+
+	cmd := cobra.Command{
+		RunE: func(cmd *cobra.Command, args []string) error {
+			http.HandleFunc("/authorize", authorize)
+			klog.Infof("Serving the proxy authorization webhook at %s", bindAddress)
+			return http.ListenAndServeTLS(bindAddress, certFile, keyFile, nil)
+		},
+	}
+	cmd.Flags().StringVarP(&bindAddress, "bind-address", "", ":9443", "the address to serve the webhook")
+	cmd.Flags().StringVarP(&certFile, "tls-cert-file", "", "", "the serving certificate of the webhook")
+	cmd.Flags().StringVarP(&keyFile, "tls-private-key-file", "", "", "the serving key of the webhook")
+	cmd.Flags().StringVarP(&userName, "user", "", "", "the user allowed to list deployments")
+	cmd.Flags().StringVarP(&clusterLabel, "cluster-label", "", "env=dev", "the label of the clusters the deployments can be listed")
+	if err := cmd.Execute(); err != nil {
+		klog.Fatal(err)
+	}
+}
+
+func authorize(w http.ResponseWriter, r *http.Request) {
+	sar := &authorizationv1.SubjectAccessReview{}
+	if err := json.NewDecoder(r.Body).Decode(sar); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attrs := sar.Spec.ResourceAttributes
+	cluster := sar.Spec.Extra[clusterv1alpha1.AuthorizationExtraKeyClusterName]
+	labels := sets.NewString(sar.Spec.Extra[clusterv1alpha1.AuthorizationExtraKeyClusterLabels]...)
+	if sar.Spec.User == userName && attrs != nil && attrs.Resource == "deployments" {
+		switch {
+		case attrs.Verb == "list" && labels.Has(clusterLabel):
+			sar.Status.Allowed = true
+		default:
+			sar.Status.Denied = true
+			sar.Status.Reason = fmt.Sprintf("%s can only list deployments in the clusters labelled %s, not %v",
+				userName, clusterLabel, cluster)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sar); err != nil {
+		klog.Errorf("Failed writing the response: %v", err)
+	}
+}
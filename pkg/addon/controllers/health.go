@@ -14,10 +14,11 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	multicluster "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/transport"
-	"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+	clusterv1alpha1 "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
 	"github.com/oam-dev/cluster-gateway/pkg/common"
 	"github.com/oam-dev/cluster-gateway/pkg/event"
 	"github.com/oam-dev/cluster-gateway/pkg/generated/clientset/versioned"
+	"github.com/oam-dev/cluster-gateway/pkg/health"
 )
 
 var (
@@ -29,15 +30,16 @@ type ClusterGatewayHealthProber struct {
 	multiClusterRestClient rest.Interface
 	gatewayClient          versioned.Interface
 	runtimeClient          client.Client
+	probeConfig            *health.ProbeConfiguration
 }
 
-func SetupClusterGatewayHealthProberWithManager(mgr ctrl.Manager) error {
+func SetupClusterGatewayHealthProberWithManager(mgr ctrl.Manager, probeConfig *health.ProbeConfiguration) error {
 	gatewayClient, err := versioned.NewForConfig(mgr.GetConfig())
 	if err != nil {
 		return err
 	}
 	copied := rest.CopyConfig(mgr.GetConfig())
-	copied.WrapTransport = multicluster.NewClusterGatewayRoundTripper
+	copied.WrapTransport = multicluster.NewClusterGatewayHealthProbeRoundTripper
 	multiClusterClient, err := kubernetes.NewForConfig(copied)
 	if err != nil {
 		return err
@@ -46,6 +48,7 @@ func SetupClusterGatewayHealthProberWithManager(mgr ctrl.Manager) error {
 		multiClusterRestClient: multiClusterClient.Discovery().RESTClient(),
 		gatewayClient:          gatewayClient,
 		runtimeClient:          mgr.GetClient(),
+		probeConfig:            probeConfig,
 	}
 	src := event.AddOnHealthResyncHandler(mgr.GetClient(), time.Second)
 	return ctrl.NewControllerManagedBy(mgr).
@@ -59,45 +62,14 @@ func (c *ClusterGatewayHealthProber) Reconcile(ctx context.Context, request reco
 		return reconcile.Result{}, nil
 	}
 	clusterName := request.Namespace
-	gw, err := c.gatewayClient.ClusterV1alpha1().
-		ClusterGateways().
-		GetHealthiness(ctx, clusterName, metav1.GetOptions{})
+	gw, next, err := health.ProbeAndUpdate(ctx, c.gatewayClient, c.multiClusterRestClient, c.probeConfig, clusterName)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
-	resp, healthErr := c.multiClusterRestClient.
-		Get().
-		AbsPath("healthz").
-		DoRaw(multicluster.WithMultiClusterContext(context.TODO(), clusterName))
-	healthy := string(resp) == "ok" && healthErr == nil
-	if !healthy {
-		healthErrMsg := ""
-		if healthErr != nil {
-			healthErrMsg = healthErr.Error()
-		}
-		healthLog.Info("Cluster unhealthy", "cluster", clusterName,
-			"body", string(resp),
-			"error", healthErrMsg)
-	}
-	if healthy != gw.Status.Healthy {
-		gw.Status.Healthy = healthy
-		if !healthy {
-			if healthErr != nil {
-				gw.Status.HealthyReason = v1alpha1.HealthyReasonType(healthErr.Error())
-			}
-		} else {
-			gw.Status.HealthyReason = ""
-		}
-		healthLog.Info("Updating cluster healthiness",
-			"cluster", clusterName,
-			"healthy", healthy)
-		_, err = c.gatewayClient.ClusterV1alpha1().
-			ClusterGateways().
-			UpdateHealthiness(ctx, gw, metav1.UpdateOptions{})
-		if err != nil {
-			return reconcile.Result{}, err
-		}
+	if gw == nil {
+		return reconcile.Result{RequeueAfter: next}, nil
 	}
+	healthy := gw.Status.Healthy
 
 	addon := &addonv1alpha1.ManagedClusterAddOn{}
 	if err := c.runtimeClient.Get(ctx, request.NamespacedName, addon); err != nil {
@@ -120,10 +92,11 @@ func (c *ClusterGatewayHealthProber) Reconcile(ctx context.Context, request reco
 			})
 		} else {
 			errMsg := "Unknown"
-			if healthErr != nil {
-				errMsg = healthErr.Error()
-			} else if len(string(resp)) > 0 {
-				errMsg = string(resp)
+			if len(gw.Status.HealthyReason) > 0 {
+				errMsg = string(gw.Status.HealthyReason)
+			}
+			if cond := meta.FindStatusCondition(gw.Status.Conditions, clusterv1alpha1.ClusterGatewayConditionHealthy); cond != nil && len(cond.Message) > 0 {
+				errMsg += ": " + cond.Message
 			}
 			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
 				Type:    addonv1alpha1.ManagedClusterAddOnConditionAvailable,
@@ -137,11 +110,5 @@ func (c *ClusterGatewayHealthProber) Reconcile(ctx context.Context, request reco
 		}
 	}
 
-	if !healthy {
-		return reconcile.Result{
-			Requeue:      true,
-			RequeueAfter: 5 * time.Second,
-		}, nil
-	}
-	return reconcile.Result{}, nil
+	return reconcile.Result{RequeueAfter: next}, nil
 }
@@ -55,3 +55,26 @@ func formatProxyURL(clusterName, originalPath string) string {
 		"proxy",
 		originalPath}, "/")
 }
+
+// HealthProbeHeader marks the requests of the health probes, which are let
+// through to the unhealthy clusters by the proxy subresource if the requester
+// is allowed to update the healthiness of the cluster.
+const HealthProbeHeader = "X-Cluster-Gateway-Health-Probe"
+
+var _ http.RoundTripper = &healthProbeRoundTripper{}
+
+type healthProbeRoundTripper struct {
+	delegate http.RoundTripper
+}
+
+// NewClusterGatewayHealthProbeRoundTripper returns the round tripper of the
+// health probes requesting the cluster in the context via the proxy.
+func NewClusterGatewayHealthProbeRoundTripper(delegate http.RoundTripper) http.RoundTripper {
+	return &healthProbeRoundTripper{delegate: NewClusterGatewayRoundTripper(delegate)}
+}
+
+func (h *healthProbeRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.Header.Set(HealthProbeHeader, "true")
+	return h.delegate.RoundTrip(request)
+}
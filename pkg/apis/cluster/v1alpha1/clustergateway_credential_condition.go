@@ -0,0 +1,124 @@
+package v1alpha1
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
+)
+
+// the reasons of the CredentialValid condition, the failures of verifying the
+// X509 credentials are reported by the reasons of cert.X509Error
+const (
+	credentialConditionReasonValid   = "Valid"
+	credentialConditionReasonMissing = "CredentialMissing"
+	credentialConditionReasonExpired = "CredentialExpired"
+)
+
+// SetCredentialCondition sets the CredentialValid condition by verifying the
+// credential and the CA bundles of the cluster, which expects the credential
+// expiration to be set in the status already.
+func SetCredentialCondition(gw *ClusterGateway) {
+	meta.SetStatusCondition(&gw.Status.Conditions, getCredentialCondition(gw, time.Now()))
+}
+
+func getCredentialCondition(gw *ClusterGateway, now time.Time) metav1.Condition {
+	condition := metav1.Condition{
+		Type:   ClusterGatewayConditionCredentialValid,
+		Status: metav1.ConditionTrue,
+		Reason: credentialConditionReasonValid,
+	}
+	invalidate := func(reason, message string) metav1.Condition {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reason
+		condition.Message = message
+		return condition
+	}
+	credential := gw.Spec.Access.Credential
+	if credential == nil {
+		return invalidate(credentialConditionReasonMissing, "the cluster has no credential")
+	}
+	if expiration := gw.Status.CredentialExpirationTime; expiration != nil && !expiration.After(now) {
+		return invalidate(credentialConditionReasonExpired,
+			fmt.Sprintf("the credential expired at %s", expiration.UTC().Format(time.RFC3339)))
+	}
+	verification := getCredentialVerification(gw)
+	if verification.err != nil {
+		return invalidate(x509ErrorReason(verification.err), verification.err.Error())
+	}
+	if err := cert.VerifyCertificatesValidity(verification.certs, now); err != nil {
+		return invalidate(x509ErrorReason(err), err.Error())
+	}
+	if verification.caErr != nil {
+		return invalidate(x509ErrorReason(verification.caErr), verification.caErr.Error())
+	}
+	return condition
+}
+
+// credentialVerifications caches the verifications of the credentials and the
+// CA bundles by the clusters, so that the PEM data is only parsed once they
+// change instead of upon every read of the cluster gateways.
+var credentialVerifications sync.Map
+
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type credentialVerification struct {
+	fingerprint string
+	// err is the failure of verifying the X509 key pair regardless of the
+	// validity window, which is checked upon the certs at the time
+	err   error
+	certs []*x509.Certificate
+	caErr error
+}
+
+func getCredentialVerification(gw *ClusterGateway) *credentialVerification {
+	fingerprint := clusterTransportFingerprint(gw)
+	if v, ok := credentialVerifications.Load(gw.Name); ok && v.(*credentialVerification).fingerprint == fingerprint {
+		return v.(*credentialVerification)
+	}
+	verification := &credentialVerification{fingerprint: fingerprint}
+	if credential := gw.Spec.Access.Credential; credential.Type == CredentialTypeX509Certificate && credential.X509 != nil {
+		verification.err = cert.VerifyX509KeyPair(credential.X509.Certificate, credential.X509.PrivateKey, time.Time{})
+		if verification.err == nil {
+			verification.certs, _ = certutil.ParseCertsPEM(credential.X509.Certificate)
+		}
+	}
+	if endpoint := gw.Spec.Access.Endpoint; endpoint != nil && endpoint.Const != nil {
+		caBundles := [][]byte{endpoint.Const.CABundle}
+		for _, e := range endpoint.Const.Endpoints {
+			caBundles = append(caBundles, e.CABundle)
+		}
+		for _, caBundle := range caBundles {
+			if len(caBundle) == 0 {
+				continue
+			}
+			if err := cert.VerifyCABundle(caBundle); err != nil {
+				verification.caErr = err
+				break
+			}
+		}
+	}
+	credentialVerifications.Store(gw.Name, verification)
+	return verification
+}
+
+// evictCredentialVerification removes the cached verification of the removed
+// cluster.
+func evictCredentialVerification(cluster string) {
+	credentialVerifications.Delete(cluster)
+}
+
+func x509ErrorReason(err error) string {
+	var x509Err *cert.X509Error
+	if errors.As(err, &x509Err) {
+		return string(x509Err.Reason)
+	}
+	return string(cert.X509ErrorReasonInvalidCertificate)
+}
@@ -0,0 +1,123 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert/certtest"
+)
+
+func TestGetCredentialCondition(t *testing.T) {
+	now := time.Now()
+	certPEM, keyPEM := certtest.NewKeyPair(t, now.Add(-time.Hour), now.Add(time.Hour))
+	_, otherKeyPEM := certtest.NewKeyPair(t, now.Add(-time.Hour), now.Add(time.Hour))
+	expiredCertPEM, expiredKeyPEM := certtest.NewKeyPair(t, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	expired := metav1.NewTime(now.Add(-time.Minute))
+	newX509Gateway := func(certificate, key []byte, caBundle []byte) *ClusterGateway {
+		return &ClusterGateway{
+			Spec: ClusterGatewaySpec{
+				Access: ClusterAccess{
+					Endpoint: &ClusterEndpoint{
+						Type:  ClusterEndpointTypeConst,
+						Const: &ClusterEndpointConst{Address: testEndpoint, CABundle: caBundle},
+					},
+					Credential: &ClusterAccessCredential{
+						Type: CredentialTypeX509Certificate,
+						X509: &X509{Certificate: certificate, PrivateKey: key},
+					},
+				},
+			},
+		}
+	}
+	cases := []struct {
+		name           string
+		gateway        *ClusterGateway
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "missing credential",
+			gateway:        &ClusterGateway{},
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "CredentialMissing",
+		},
+		{
+			name:           "valid x509",
+			gateway:        newX509Gateway(certPEM, keyPEM, certPEM),
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "Valid",
+		},
+		{
+			name:           "invalid certificate",
+			gateway:        newX509Gateway([]byte(testCertData), keyPEM, certPEM),
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "InvalidCertificate",
+		},
+		{
+			name:           "mismatched private key",
+			gateway:        newX509Gateway(certPEM, otherKeyPEM, certPEM),
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "CertificateKeyMismatch",
+		},
+		{
+			name:           "expired certificate",
+			gateway:        newX509Gateway(expiredCertPEM, expiredKeyPEM, certPEM),
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "CertificateExpired",
+		},
+		{
+			name:           "invalid ca bundle",
+			gateway:        newX509Gateway(certPEM, keyPEM, []byte(testCAData)),
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "InvalidCABundle",
+		},
+		{
+			name: "expired token",
+			gateway: &ClusterGateway{
+				Spec: ClusterGatewaySpec{Access: ClusterAccess{Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: testToken,
+				}}},
+				Status: ClusterGatewayStatus{CredentialExpirationTime: &expired},
+			},
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "CredentialExpired",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cond := getCredentialCondition(c.gateway, now)
+			assert.Equal(t, ClusterGatewayConditionCredentialValid, cond.Type)
+			assert.Equal(t, c.expectedStatus, cond.Status)
+			assert.Equal(t, c.expectedReason, cond.Reason)
+		})
+	}
+}
+
+func TestCredentialVerificationCache(t *testing.T) {
+	now := time.Now()
+	certPEM, keyPEM := certtest.NewKeyPair(t, now.Add(-time.Hour), now.Add(time.Hour))
+	_, otherKeyPEM := certtest.NewKeyPair(t, now.Add(-time.Hour), now.Add(time.Hour))
+	gw := &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "verification-test"},
+		Spec: ClusterGatewaySpec{Access: ClusterAccess{Credential: &ClusterAccessCredential{
+			Type: CredentialTypeX509Certificate,
+			X509: &X509{Certificate: certPEM, PrivateKey: keyPEM},
+		}}},
+	}
+	defer evictCredentialVerification(gw.Name)
+
+	assert.Equal(t, "Valid", getCredentialCondition(gw, now).Reason)
+	cached := getCredentialVerification(gw)
+	assert.Same(t, cached, getCredentialVerification(gw.DeepCopy()))
+	// the validity window is checked upon the cached certificates
+	assert.Equal(t, "CertificateExpired", getCredentialCondition(gw, now.Add(2*time.Hour)).Reason)
+
+	// the changed credential is verified again
+	gw.Spec.Access.Credential.X509.PrivateKey = otherKeyPEM
+	assert.Equal(t, "CertificateKeyMismatch", getCredentialCondition(gw, now).Reason)
+	assert.NotSame(t, cached, getCredentialVerification(gw))
+}
@@ -0,0 +1,59 @@
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-gateway/pkg/common"
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+// getCredentialExpiration parses the expiration of the X509 certificate or
+// the "exp" claim of the token, returns false if not expiring or unknown.
+func getCredentialExpiration(credential *ClusterAccessCredential) (time.Time, bool) {
+	if credential == nil {
+		return time.Time{}, false
+	}
+	if credential.X509 != nil && len(credential.X509.Certificate) > 0 {
+		return cert.CertificateExpiration(credential.X509.Certificate)
+	}
+	if len(credential.ServiceAccountToken) > 0 {
+		return cert.JWTExpiration(credential.ServiceAccountToken)
+	}
+	return time.Time{}, false
+}
+
+// ListClusterCredentialExpirations reads the expirations of the credentials
+// from the cluster secrets by the cluster names. The Dynamic credentials are
+// skipped because they are issued on demand.
+func ListClusterCredentialExpirations() map[string]time.Time {
+	secretControl := singleton.GetSecretControl()
+	if secretControl == nil {
+		return nil
+	}
+	secrets, err := secretControl.List(context.TODO())
+	if err != nil {
+		klog.Warningf("Failed listing cluster secrets for credential expirations: %v", err)
+		return nil
+	}
+	expirations := make(map[string]time.Time)
+	for _, secret := range secrets {
+		var credential *ClusterAccessCredential
+		switch CredentialType(secret.Labels[common.LabelKeyClusterCredentialType]) {
+		case CredentialTypeX509Certificate:
+			credential = &ClusterAccessCredential{X509: &X509{Certificate: secret.Data[v1.TLSCertKey]}}
+		case CredentialTypeServiceAccountToken:
+			credential = &ClusterAccessCredential{ServiceAccountToken: string(secret.Data[v1.ServiceAccountTokenKey])}
+		default:
+			continue
+		}
+		if expiration, ok := getCredentialExpiration(credential); ok {
+			expirations[secret.Name] = expiration
+		}
+	}
+	return expirations
+}
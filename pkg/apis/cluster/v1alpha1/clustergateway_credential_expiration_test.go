@@ -0,0 +1,66 @@
+package v1alpha1
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/oam-dev/cluster-gateway/pkg/common"
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert/certtest"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+func newTestJWT(exp time.Time) string {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	return encode(`{"alg":"none"}`) + "." + encode(fmt.Sprintf(`{"exp":%d}`, exp.Unix())) + ".signature"
+}
+
+func TestListClusterCredentialExpirations(t *testing.T) {
+	certExp := time.Now().Add(24 * time.Hour).Truncate(time.Second).UTC()
+	tokenExp := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	newSecret := func(name string, credType CredentialType, data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testNamespace,
+				Name:      name,
+				Labels: map[string]string{
+					common.LabelKeyClusterCredentialType: string(credType),
+				},
+			},
+			Data: data,
+		}
+	}
+	fakeKubeClient := fake.NewSimpleClientset(
+		newSecret("x509", CredentialTypeX509Certificate, map[string][]byte{"tls.crt": certtest.NewCertificate(t, certExp)}),
+		newSecret("token", CredentialTypeServiceAccountToken, map[string][]byte{"token": []byte(newTestJWT(tokenExp))}),
+		newSecret("opaque-token", CredentialTypeServiceAccountToken, map[string][]byte{"token": []byte(testToken)}),
+		newSecret("dynamic", CredentialTypeDynamic, map[string][]byte{"token": []byte(newTestJWT(tokenExp))}),
+	)
+	singleton.SetSecretControl(cert.NewDirectApiSecretControl(testNamespace, fakeKubeClient))
+	defer singleton.SetSecretControl(nil)
+
+	assert.Equal(t, map[string]time.Time{
+		"x509":  certExp,
+		"token": tokenExp,
+	}, ListClusterCredentialExpirations())
+}
+
+func TestPrintCredentialExpiration(t *testing.T) {
+	gw := &ClusterGateway{}
+	assert.Equal(t, "<none>", printCredentialExpiration(gw))
+	expired := metav1.NewTime(time.Now().Add(-time.Minute))
+	gw.Status.CredentialExpirationTime = &expired
+	assert.Equal(t, "Expired", printCredentialExpiration(gw))
+	expiring := metav1.NewTime(time.Now().Add(49 * time.Hour))
+	gw.Status.CredentialExpirationTime = &expiring
+	assert.Equal(t, "2d", printCredentialExpiration(gw))
+}
@@ -0,0 +1,652 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource/resourcerest"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+var _ resource.SubResource = &ClusterGatewayFanout{}
+var _ registryrest.Storage = &ClusterGatewayFanout{}
+var _ resourcerest.Connecter = &ClusterGatewayFanout{}
+
+// FanoutAllClusters is the name of the ClusterGateway in the path of the
+// fanout subresource, e.g. "clustergateways/*/fanout/api/v1/pods", the
+// clusters are selected by the cluster selector instead.
+const FanoutAllClusters = "*"
+
+// AnnotationKeyFanoutCluster is annotated to the items merged by the fanout
+// subresource with the name of the cluster the item is from.
+const AnnotationKeyFanoutCluster = "cluster.core.oam.dev/cluster"
+
+// AnnotationKeyFanoutClusterStatus is annotated to the BOOKMARK events of the
+// fanout watch reporting the failures of the clusters, with the status of the
+// failure in JSON.
+const AnnotationKeyFanoutClusterStatus = "cluster.core.oam.dev/cluster-status"
+
+// AnnotationKeyFanoutClusterRelist is annotated to the BOOKMARK events of the
+// fanout watch if the resource version of the cluster expired. The cluster is
+// no longer watched in the stream, and should be listed again.
+const AnnotationKeyFanoutClusterRelist = "cluster.core.oam.dev/cluster-relist"
+
+// fanoutQueryKeys are the query parameters of the fanout subresource, which
+// are not proxied to the clusters
+var fanoutQueryKeys = []string{"clusterSelector", "parallelism", "clusterTimeout", "clusterResourceVersions", "clusterContinues", "impersonate"}
+
+// ClusterGatewayFanout is a subresource for ClusterGateway which proxies the
+// same read request to the clusters selected by labels concurrently, and
+// merges the responses into one list.
+type ClusterGatewayFanout struct {
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterGatewayFanoutOptions struct {
+	metav1.TypeMeta
+
+	// Path is the target api path of the fanout request.
+	// e.g. "/api/v1/namespaces/default/pods"
+	Path string `json:"path"`
+
+	// ClusterSelector is the label selector of the clusters to request, all
+	// the clusters are requested if empty.
+	ClusterSelector string `json:"clusterSelector,omitempty"`
+
+	// Parallelism is the maximum number of the clusters requested
+	// concurrently, which is capped by --proxy-fanout-parallelism.
+	Parallelism int32 `json:"parallelism,omitempty"`
+
+	// ClusterTimeout is the timeout of the request to each cluster, the
+	// timeout of the cluster applies if shorter.
+	ClusterTimeout metav1.Duration `json:"clusterTimeout,omitempty"`
+
+	// ClusterResourceVersions are the resource versions to resume watching
+	// the clusters from, in the form of "<cluster>=<resourceVersion>,...".
+	ClusterResourceVersions map[string]string `json:"clusterResourceVersions,omitempty"`
+
+	// ClusterContinues are the continue tokens to read the next pages of the
+	// clusters from, in the form of "<cluster>=<continue>,...". Only the
+	// listed clusters are requested if set.
+	ClusterContinues map[string]string `json:"clusterContinues,omitempty"`
+
+	// Impersonate indicates whether to impersonate as the original user
+	// identity in the clusters, same as the proxy subresource.
+	Impersonate bool `json:"impersonate"`
+}
+
+// ClusterGatewayFanoutList is the list responded by the fanout subresource.
+// The items are merged from the clusters and annotated with the clusters they
+// are from, while the results of the clusters are listed in Clusters.
+type ClusterGatewayFanoutList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []runtime.RawExtension `json:"items"`
+	// Clusters are the results of the requests to the selected clusters
+	Clusters []ClusterGatewayFanoutResult `json:"clusters"`
+}
+
+// ClusterGatewayFanoutResult is the result of the request to a cluster.
+type ClusterGatewayFanoutResult struct {
+	// Cluster is the name of the cluster
+	Cluster string `json:"cluster"`
+	// Items is the number of the items merged from the cluster
+	Items int `json:"items"`
+	// Status is the failure of the request to the cluster, e.g. the error
+	// responded by the cluster, the timeout or the forbidden access, which
+	// is unset if succeeded
+	Status *metav1.Status `json:"status,omitempty"`
+	// ResourceVersion is the resource version of the list responded by the
+	// cluster
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// Continue is the continue token of the list responded by the cluster if
+	// more items remain, which is passed on by the clusterContinues parameter
+	// to read the next page
+	Continue string `json:"continue,omitempty"`
+}
+
+func (c *ClusterGatewayFanout) SubResourceName() string {
+	return "fanout"
+}
+
+func (c *ClusterGatewayFanout) New() runtime.Object {
+	return &ClusterGatewayFanoutOptions{}
+}
+
+func (c *ClusterGatewayFanout) Destroy() {}
+
+func (c *ClusterGatewayFanout) Connect(ctx context.Context, id string, options runtime.Object, r registryrest.Responder) (http.Handler, error) {
+	fanoutOpts, ok := options.(*ClusterGatewayFanoutOptions)
+	if !ok {
+		return nil, fmt.Errorf("invalid options object: %#v", options)
+	}
+	if id != FanoutAllClusters {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("the fanout subresource must be requested with the name %q, "+
+			"the clusters are selected by the clusterSelector parameter", FanoutAllClusters))
+	}
+	selector, err := labels.Parse(fanoutOpts.ClusterSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid cluster selector: %v", err))
+	}
+
+	// the clusters are only revealed to the users allowed to list them
+	userInfo, _ := request.UserFrom(ctx)
+	if err := authorizeClusterGatewayAccess(ctx, userInfo, "list", "", ""); err != nil {
+		return nil, err
+	}
+	parentStorage, ok := contextutil.GetParentStorageGetter(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no parent storage found")
+	}
+	lister, ok := parentStorage.(registryrest.Lister)
+	if !ok {
+		return nil, fmt.Errorf("parent storage doesn't support listing")
+	}
+	listObj, err := lister.List(ctx, &metainternalversion.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed listing clusters")
+	}
+
+	parallelism := config.ProxyFanoutParallelism
+	if p := int(fanoutOpts.Parallelism); p > 0 && p < parallelism {
+		parallelism = p
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	clusters := listObj.(*ClusterGatewayList).Items
+	if len(fanoutOpts.ClusterContinues) > 0 {
+		// the other clusters have been read through
+		continued := make([]ClusterGateway, 0, len(fanoutOpts.ClusterContinues))
+		for _, cluster := range clusters {
+			if _, ok := fanoutOpts.ClusterContinues[cluster.Name]; ok {
+				continued = append(continued, cluster)
+			}
+		}
+		clusters = continued
+	}
+	reqInfo, _ := request.RequestInfoFrom(ctx)
+	return &fanoutHandler{
+		clusters:         clusters,
+		path:             fanoutOpts.Path,
+		impersonate:      fanoutOpts.Impersonate,
+		requestInfo:      newProxyRequestInfo(reqInfo.Verb, fanoutOpts.Path),
+		parallelism:      parallelism,
+		clusterTimeout:   fanoutOpts.ClusterTimeout.Duration,
+		resourceVersions: fanoutOpts.ClusterResourceVersions,
+		continues:        fanoutOpts.ClusterContinues,
+		responder:        r,
+	}, nil
+}
+
+// authorizeClusterGatewayAccess authorizes the user on the ClusterGateway or
+// its subresource in the hub.
+func authorizeClusterGatewayAccess(ctx context.Context, userInfo user.Info, verb, subresource, name string) error {
+	decision, reason, err := loopback.GetAuthorizer().Authorize(ctx, authorizer.AttributesRecord{
+		User:            userInfo,
+		Verb:            verb,
+		ResourceRequest: true,
+		APIGroup:        config.MetaApiGroupName,
+		APIVersion:      config.MetaApiVersionName,
+		Resource:        config.MetaApiResourceName,
+		Subresource:     subresource,
+		Name:            name,
+	})
+	if err != nil {
+		return apierrors.NewInternalError(errors.Wrapf(err, "authorization failed due to %s", reason))
+	}
+	if decision != authorizer.DecisionAllow {
+		resource := config.MetaApiResourceName
+		if subresource != "" {
+			resource += "/" + subresource
+		}
+		msg := fmt.Sprintf("user %v cannot %s %s", userInfo.GetName(), verb, resource)
+		if reason != "" {
+			msg += ": " + reason
+		}
+		return apierrors.NewForbidden(clusterGatewayGroupResource(), name, errors.New(msg))
+	}
+	return nil
+}
+
+func (c *ClusterGatewayFanout) NewConnectOptions() (runtime.Object, bool, string) {
+	return &ClusterGatewayFanoutOptions{}, true, "path"
+}
+
+func (c *ClusterGatewayFanout) ConnectMethods() []string {
+	return []string{"GET"}
+}
+
+var _ resource.QueryParameterObject = &ClusterGatewayFanoutOptions{}
+
+func (in *ClusterGatewayFanoutOptions) ConvertFromUrlValues(values *url.Values) error {
+	in.Path = values.Get("path")
+	in.ClusterSelector = values.Get("clusterSelector")
+	in.Impersonate = values.Get("impersonate") == "true"
+	if raw := values.Get("parallelism"); raw != "" {
+		parallelism, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || parallelism <= 0 {
+			return apierrors.NewBadRequest(fmt.Sprintf("invalid parallelism %q, must be a positive integer", raw))
+		}
+		in.Parallelism = int32(parallelism)
+	}
+	if raw := values.Get("clusterTimeout"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return apierrors.NewBadRequest(fmt.Sprintf("invalid cluster timeout %q, must be a positive duration", raw))
+		}
+		in.ClusterTimeout = metav1.Duration{Duration: timeout}
+	}
+	if raw := values.Get("clusterResourceVersions"); raw != "" {
+		resourceVersions, err := parseFanoutClusterValues(raw)
+		if err != nil {
+			return apierrors.NewBadRequest(fmt.Sprintf("invalid cluster resource versions %q, must be in the form of \"<cluster>=<resourceVersion>,...\"", raw))
+		}
+		in.ClusterResourceVersions = resourceVersions
+	}
+	if raw := values.Get("clusterContinues"); raw != "" {
+		continues, err := parseFanoutClusterValues(raw)
+		if err != nil {
+			return apierrors.NewBadRequest(fmt.Sprintf("invalid cluster continues %q, must be in the form of \"<cluster>=<continue>,...\"", raw))
+		}
+		in.ClusterContinues = continues
+	}
+	return nil
+}
+
+// parseFanoutClusterValues parses the values of the clusters in the form of
+// "<cluster>=<value>,...".
+func parseFanoutClusterValues(raw string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		cluster, value, ok := strings.Cut(pair, "=")
+		if !ok || cluster == "" || value == "" {
+			return nil, fmt.Errorf("invalid pair %q", pair)
+		}
+		values[cluster] = value
+	}
+	return values, nil
+}
+
+var _ http.Handler = &fanoutHandler{}
+
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type fanoutHandler struct {
+	clusters       []ClusterGateway
+	path           string
+	impersonate    bool
+	requestInfo    *request.RequestInfo
+	parallelism    int
+	clusterTimeout time.Duration
+	// resourceVersions are the resource versions of the clusters to resume
+	// watching from
+	resourceVersions map[string]string
+	// continues are the continue tokens of the clusters to read the next
+	// pages from
+	continues map[string]string
+	responder registryrest.Responder
+	// watchedType is the type of the objects watched, which is learnt from
+	// the events of the clusters for reporting the failures of the clusters
+	watchedType atomic.Pointer[metav1.TypeMeta]
+}
+
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type fanoutClusterResponse struct {
+	items  []json.RawMessage
+	result ClusterGatewayFanoutResult
+}
+
+// ServeHTTP requests the clusters concurrently, and streams the items of each
+// cluster once it responds. The list is always responded with 200, and the
+// failures of the clusters are carried in the results of the clusters. The
+// watches are multiplexed by serveWatch instead.
+func (h *fanoutHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	for _, key := range fanoutQueryKeys {
+		query.Del(key)
+	}
+	if isWatchQuery(query) {
+		h.serveWatch(writer, req, query)
+		return
+	}
+	if isLongRunningProxyRequest(req) {
+		h.responder.Error(apierrors.NewBadRequest("following or upgrading is not supported by the fanout subresource"))
+		return
+	}
+	if query.Has("continue") {
+		h.responder.Error(apierrors.NewBadRequest("the continue tokens are per cluster, pass them by the clusterContinues parameter"))
+		return
+	}
+	if config.ProxyFanoutTimeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), config.ProxyFanoutTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	responses := make(chan *fanoutClusterResponse)
+	go func() {
+		var wg sync.WaitGroup
+		tokens := make(chan struct{}, h.parallelism)
+		for i := range h.clusters {
+			tokens <- struct{}{}
+			wg.Add(1)
+			go func(cluster *ClusterGateway) {
+				defer func() {
+					<-tokens
+					wg.Done()
+				}()
+				responses <- h.serveCluster(req, cluster, query)
+			}(&h.clusters[i])
+		}
+		wg.Wait()
+		close(responses)
+	}()
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	flusher, _ := writer.(http.Flusher)
+	_, _ = io.WriteString(writer, `{"kind":"List","apiVersion":"v1","metadata":{},"items":[`)
+	results := make([]ClusterGatewayFanoutResult, 0, len(h.clusters))
+	separator := ""
+	for resp := range responses {
+		for _, item := range resp.items {
+			_, _ = io.WriteString(writer, separator)
+			_, _ = writer.Write(item)
+			separator = ","
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		results = append(results, resp.result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Cluster < results[j].Cluster
+	})
+	data, err := json.Marshal(results)
+	if err != nil {
+		klog.Errorf("Failed encoding the fanout results: %v", err)
+		data = []byte("[]")
+	}
+	_, _ = io.WriteString(writer, `],"clusters":`)
+	_, _ = writer.Write(data)
+	_, _ = io.WriteString(writer, "}")
+}
+
+// serveCluster requests the cluster by the proxy handler, as if the request
+// is proxied to the cluster by the proxy subresource.
+func (h *fanoutHandler) serveCluster(req *http.Request, cluster *ClusterGateway, query url.Values) (resp *fanoutClusterResponse) {
+	ts := time.Now()
+	resp = &fanoutClusterResponse{result: ClusterGatewayFanoutResult{Cluster: cluster.Name}}
+	ctx := req.Context()
+	if h.clusterTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.clusterTimeout)
+		defer cancel()
+	}
+	fail := func(err error) *fanoutClusterResponse {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = apierrors.NewTimeoutError(fmt.Sprintf("timed out requesting cluster %s: %v", cluster.Name, err), 0)
+		}
+		resp.items = nil
+		resp.result.Items = 0
+		resp.result.Status = proxyErrorStatus(err)
+		return resp
+	}
+	recorder := &fanoutResponseRecorder{header: http.Header{}, statusCode: http.StatusOK, limit: config.ProxyFanoutMaxResponseBytes}
+	defer func() {
+		// the proxy aborts the handler by panicking upon failing to copy the
+		// response, e.g. timed out in the middle of the response
+		if r := recover(); r != nil {
+			if r != http.ErrAbortHandler {
+				klog.Errorf("Panic requesting cluster %s in fanout: %v", cluster.Name, r)
+			}
+			if recorder.exceeded {
+				resp = fail(newFanoutResponseTooLargeError(cluster.Name, recorder.limit))
+				return
+			}
+			resp = fail(fmt.Errorf("the response of the cluster %s is aborted", cluster.Name))
+		}
+	}()
+
+	if err := h.admitCluster(ctx, cluster); err != nil {
+		return fail(err)
+	}
+	if token, ok := h.continues[cluster.Name]; ok {
+		continued := url.Values{"continue": []string{token}}
+		for k, v := range query {
+			continued[k] = v
+		}
+		query = continued
+	}
+	responder := &fanoutResponder{}
+	h.newClusterProxyHandler(cluster, responder, ts).ServeHTTP(recorder, h.newClusterRequest(ctx, req, cluster, query))
+	if recorder.exceeded {
+		return fail(newFanoutResponseTooLargeError(cluster.Name, recorder.limit))
+	}
+	if responder.err != nil {
+		return fail(responder.err)
+	}
+	if recorder.statusCode >= http.StatusBadRequest {
+		return fail(fanoutResponseError(recorder.statusCode, recorder.body.Bytes()))
+	}
+	items, listMeta, err := decodeFanoutItems(cluster.Name, recorder)
+	if err != nil {
+		return fail(err)
+	}
+	resp.items = items
+	resp.result.Items = len(items)
+	resp.result.ResourceVersion = listMeta.ResourceVersion
+	resp.result.Continue = listMeta.Continue
+	return resp
+}
+
+// admitCluster checks the access to the proxy subresource of the cluster, as
+// if the request is proxied by the proxy subresource. The target path and the
+// healthiness of the cluster are checked by the proxy handler.
+func (h *fanoutHandler) admitCluster(ctx context.Context, cluster *ClusterGateway) error {
+	userInfo, _ := request.UserFrom(ctx)
+	return authorizeClusterGatewayAccess(ctx, userInfo, h.requestInfo.Verb, "proxy", cluster.Name)
+}
+
+// newClusterRequest returns the request to the proxy subresource of the
+// cluster with the query.
+func (h *fanoutHandler) newClusterRequest(ctx context.Context, req *http.Request, cluster *ClusterGateway, query url.Values) *http.Request {
+	clusterReq := req.Clone(ctx)
+	clusterReq.Header = utilnet.CloneHeader(req.Header)
+	// the responses are decoded for merging, and decompressed by the transport
+	clusterReq.Header.Set("Accept", "application/json")
+	clusterReq.Header.Del("Accept-Encoding")
+	clusterReq.URL.Path = apiPrefix + cluster.Name + apiSuffix + h.path
+	clusterReq.URL.RawQuery = query.Encode()
+	clusterReq.RequestURI = clusterReq.URL.RequestURI()
+	return clusterReq
+}
+
+func (h *fanoutHandler) newClusterProxyHandler(cluster *ClusterGateway, responder registryrest.Responder, ts time.Time) *proxyHandler {
+	return &proxyHandler{
+		parentName:     cluster.Name,
+		path:           h.path,
+		impersonate:    h.impersonate,
+		clusterGateway: cluster,
+		requestInfo:    h.requestInfo,
+		startTime:      ts,
+		responder:      responder,
+		finishFunc:     newProxyFinishFunc(cluster.Name, h.requestInfo, ts),
+	}
+}
+
+// decodeFanoutItems decodes the object or the items of the list responded by
+// the cluster, and annotates them with the cluster. The list metadata is
+// returned for paginating the cluster.
+func decodeFanoutItems(cluster string, recorder *fanoutResponseRecorder) ([]json.RawMessage, metav1.ListMeta, error) {
+	var listMeta metav1.ListMeta
+	if contentType := recorder.header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "application/json" {
+			return nil, listMeta, &apierrors.StatusError{ErrStatus: metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    http.StatusNotAcceptable,
+				Reason:  metav1.StatusReasonNotAcceptable,
+				Message: fmt.Sprintf("only the JSON responses can be merged, got %q from cluster %s", contentType, cluster),
+			}}
+		}
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(recorder.body.Bytes(), &obj); err != nil {
+		return nil, listMeta, apierrors.NewInternalError(errors.Wrapf(err, "failed decoding the response of cluster %s", cluster))
+	}
+	objs := []interface{}{obj}
+	apiVersion, kind := "", ""
+	if items, ok := obj["items"].([]interface{}); ok {
+		objs = items
+		apiVersion, _, _ = unstructured.NestedString(obj, "apiVersion")
+		kind, _, _ = unstructured.NestedString(obj, "kind")
+		kind = strings.TrimSuffix(kind, "List")
+		listMeta.ResourceVersion, _, _ = unstructured.NestedString(obj, "metadata", "resourceVersion")
+		listMeta.Continue, _, _ = unstructured.NestedString(obj, "metadata", "continue")
+	}
+	data := make([]json.RawMessage, 0, len(objs))
+	for _, o := range objs {
+		m, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		item := &unstructured.Unstructured{Object: m}
+		// the items of the typed lists omit the type meta
+		if item.GetKind() == "" && kind != "" {
+			item.SetKind(kind)
+		}
+		if item.GetAPIVersion() == "" && apiVersion != "" {
+			item.SetAPIVersion(apiVersion)
+		}
+		annotateFanoutItem(item, cluster)
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return nil, listMeta, apierrors.NewInternalError(errors.Wrapf(err, "failed encoding the item of cluster %s", cluster))
+		}
+		data = append(data, raw)
+	}
+	return data, listMeta, nil
+}
+
+func annotateFanoutItem(item *unstructured.Unstructured, cluster string) {
+	annotations := item.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AnnotationKeyFanoutCluster] = cluster
+	item.SetAnnotations(annotations)
+}
+
+// fanoutResponseError returns the status responded by the cluster, or the
+// generic one if the response is not a status
+func fanoutResponseError(statusCode int, body []byte) error {
+	status := &metav1.Status{}
+	if err := json.Unmarshal(body, status); err == nil && status.Kind == "Status" {
+		return &apierrors.StatusError{ErrStatus: *status}
+	}
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    int32(statusCode),
+		Reason:  metav1.StatusReasonUnknown,
+		Message: strings.TrimSpace(string(body)),
+	}}
+}
+
+var _ http.ResponseWriter = &fanoutResponseRecorder{}
+var _ http.Flusher = &fanoutResponseRecorder{}
+
+// fanoutResponseRecorder buffers the response of the cluster for merging, up
+// to the limit of bytes if positive
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type fanoutResponseRecorder struct {
+	header      http.Header
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+	limit       int64
+	exceeded    bool
+}
+
+func (in *fanoutResponseRecorder) Header() http.Header {
+	return in.header
+}
+
+func (in *fanoutResponseRecorder) WriteHeader(statusCode int) {
+	if !in.wroteHeader {
+		in.statusCode = statusCode
+		in.wroteHeader = true
+	}
+}
+
+func (in *fanoutResponseRecorder) Write(b []byte) (int, error) {
+	in.WriteHeader(http.StatusOK)
+	if in.limit > 0 && int64(in.body.Len()+len(b)) > in.limit {
+		in.exceeded = true
+		return 0, fmt.Errorf("the response exceeds %d bytes", in.limit)
+	}
+	return in.body.Write(b)
+}
+
+// newFanoutResponseTooLargeError returns the error of the cluster responding
+// more than the limit of bytes for merging.
+func newFanoutResponseTooLargeError(cluster string, limit int64) error {
+	return apierrors.NewRequestEntityTooLargeError(fmt.Sprintf(
+		"the response of cluster %s exceeds %d bytes, try narrowing it down by limit or selectors", cluster, limit))
+}
+
+func (in *fanoutResponseRecorder) Flush() {}
+
+var _ registryrest.Responder = &fanoutResponder{}
+
+// fanoutResponder receives the error of the proxy handler instead of
+// responding it
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type fanoutResponder struct {
+	err error
+}
+
+func (in *fanoutResponder) Object(statusCode int, obj runtime.Object) {
+	if status, ok := obj.(*metav1.Status); ok {
+		in.err = &apierrors.StatusError{ErrStatus: *status}
+		return
+	}
+	in.err = fmt.Errorf("unexpected response %d", statusCode)
+}
+
+func (in *fanoutResponder) Error(err error) {
+	in.err = err
+}
@@ -0,0 +1,320 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/utils/pointer"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+var _ rest.Getter = &fakeParentLister{}
+var _ rest.Lister = &fakeParentLister{}
+
+type fakeParentLister struct {
+	fakeParentStorage
+	items []ClusterGateway
+}
+
+func (f *fakeParentLister) NewList() runtime.Object {
+	return &ClusterGatewayList{}
+}
+
+func (f *fakeParentLister) List(ctx context.Context, options *internalversion.ListOptions) (runtime.Object, error) {
+	list := &ClusterGatewayList{}
+	for _, item := range f.items {
+		if matchClusterGateway(options, &item) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeParentLister) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	return nil, nil
+}
+
+func newFanoutTestCluster(name, env string, handler http.HandlerFunc, t *testing.T) ClusterGateway {
+	svr := httptest.NewTLSServer(handler)
+	t.Cleanup(svr.Close)
+	return ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"env": env}},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type:  ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{Address: svr.URL, Insecure: pointer.Bool(true)},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: name,
+				},
+			},
+		},
+	}
+}
+
+func serveFanout(t *testing.T, parent *fakeParentLister, opts *ClusterGatewayFanoutOptions, query string) (*ClusterGatewayFanoutList, error) {
+	userInfo := &user.DefaultInfo{Name: "x"}
+	ctx := contextutil.WithParentStorage(context.TODO(), parent)
+	ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+	ctx = request.WithUser(ctx, userInfo)
+	responder := &fakeResponder{}
+	handler, err := (&ClusterGatewayFanout{}).Connect(ctx, FanoutAllClusters, opts, responder)
+	if err != nil {
+		return nil, err
+	}
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(request.WithUser(r.Context(), userInfo)))
+	}))
+	defer svr.Close()
+	resp, err := svr.Client().Get(svr.URL + apiPrefix + FanoutAllClusters + "/fanout" + opts.Path + "?" + query)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if responder.receivingErr != nil {
+		return nil, responder.receivingErr
+	}
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	list := &ClusterGatewayFanoutList{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(list))
+	return list, nil
+}
+
+func TestClusterGatewayFanout(t *testing.T) {
+	// the hub allows proxying to all the clusters except the denied one
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		if a.GetSubresource() == "proxy" && a.GetName() == "dev-denied" {
+			return authorizer.DecisionNoOpinion, "", nil
+		}
+		return authorizer.DecisionAllow, "", nil
+	}
+	var receivedQuery, receivedAccept string
+	pods := func(w http.ResponseWriter, r *http.Request) {
+		receivedQuery, receivedAccept = r.URL.RawQuery, r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[`+
+			`{"metadata":{"name":"a","annotations":{"k":"v"}}},{"metadata":{"name":"b"}}]}`)
+	}
+	parent := &fakeParentLister{items: []ClusterGateway{
+		newFanoutTestCluster("dev-ok", "dev", pods, t),
+		newFanoutTestCluster("dev-missing", "dev", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			status := apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "").Status()
+			status.Kind, status.APIVersion = "Status", "v1"
+			_ = json.NewEncoder(w).Encode(status)
+		}, t),
+		newFanoutTestCluster("dev-slow", "dev", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}, t),
+		newFanoutTestCluster("dev-denied", "dev", pods, t),
+		newFanoutTestCluster("prod", "prod", pods, t),
+	}}
+
+	list, err := serveFanout(t, parent, &ClusterGatewayFanoutOptions{
+		Path:            "/api/v1/namespaces/default/pods",
+		ClusterSelector: "env=dev",
+		ClusterTimeout:  metav1.Duration{Duration: 500 * time.Millisecond},
+	}, "clusterSelector=env%3Ddev&clusterTimeout=500ms&limit=10")
+	require.NoError(t, err)
+	assert.Equal(t, "limit=10", receivedQuery)
+	assert.Equal(t, "application/json", receivedAccept)
+
+	// the items are annotated with the cluster and the kind of the list
+	require.Equal(t, 2, len(list.Items))
+	for i, name := range []string{"a", "b"} {
+		item := &unstructured.Unstructured{}
+		require.NoError(t, item.UnmarshalJSON(list.Items[i].Raw))
+		assert.Equal(t, name, item.GetName())
+		assert.Equal(t, "Pod", item.GetKind())
+		assert.Equal(t, "v1", item.GetAPIVersion())
+		assert.Equal(t, "dev-ok", item.GetAnnotations()[AnnotationKeyFanoutCluster])
+	}
+
+	// the failures are carried per cluster
+	results := map[string]ClusterGatewayFanoutResult{}
+	for _, result := range list.Clusters {
+		results[result.Cluster] = result
+	}
+	require.Equal(t, 4, len(results))
+	assert.Equal(t, ClusterGatewayFanoutResult{Cluster: "dev-ok", Items: 2}, results["dev-ok"])
+	require.NotNil(t, results["dev-missing"].Status)
+	assert.Equal(t, metav1.StatusReasonNotFound, results["dev-missing"].Status.Reason)
+	require.NotNil(t, results["dev-slow"].Status)
+	assert.Equal(t, metav1.StatusReasonTimeout, results["dev-slow"].Status.Reason)
+	require.NotNil(t, results["dev-denied"].Status)
+	assert.Equal(t, metav1.StatusReasonForbidden, results["dev-denied"].Status.Reason)
+
+	// the followed logs are not supported
+	_, err = serveFanout(t, parent, &ClusterGatewayFanoutOptions{Path: "/api/v1/namespaces/default/pods/a/log"}, "follow=true")
+	assert.True(t, apierrors.IsBadRequest(err), "unexpected error: %v", err)
+
+	// the clusters are only listed for the users allowed to
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+	_, err = serveFanout(t, parent, &ClusterGatewayFanoutOptions{Path: "/api/v1/pods"}, "")
+	assert.True(t, apierrors.IsForbidden(err), "unexpected error: %v", err)
+}
+
+func TestClusterGatewayFanoutParallelism(t *testing.T) {
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		return authorizer.DecisionAllow, "", nil
+	}
+	lock := &sync.Mutex{}
+	inFlight, maxInFlight := 0, 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"kind":"Namespace","apiVersion":"v1","metadata":{"name":"default"}}`)
+	}
+	parent := &fakeParentLister{}
+	for i := 0; i < 6; i++ {
+		parent.items = append(parent.items, newFanoutTestCluster(fmt.Sprintf("c-%d", i), "dev", handler, t))
+	}
+	list, err := serveFanout(t, parent, &ClusterGatewayFanoutOptions{Path: "/api/v1/namespaces/default", Parallelism: 2}, "parallelism=2")
+	require.NoError(t, err)
+	assert.Equal(t, 6, len(list.Items))
+	assert.Equal(t, 6, len(list.Clusters))
+	assert.LessOrEqual(t, maxInFlight, 2)
+
+	// the responses exceeding the limit fail the cluster only
+	defer func(limit int64) {
+		config.ProxyFanoutMaxResponseBytes = limit
+	}(config.ProxyFanoutMaxResponseBytes)
+	config.ProxyFanoutMaxResponseBytes = 256
+	parent.items = append(parent.items, newFanoutTestCluster("large", "dev", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"kind":"Namespace","apiVersion":"v1","metadata":{"name":"default","annotations":{"k":"%s"}}}`,
+			strings.Repeat("x", 1024))
+	}, t))
+	list, err = serveFanout(t, parent, &ClusterGatewayFanoutOptions{Path: "/api/v1/namespaces/default"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 6, len(list.Items))
+	require.Equal(t, 7, len(list.Clusters))
+	result := list.Clusters[6]
+	assert.Equal(t, "large", result.Cluster)
+	require.NotNil(t, result.Status)
+	assert.Equal(t, metav1.StatusReasonRequestEntityTooLarge, result.Status.Reason)
+
+	// the name must be the wildcard
+	_, err = (&ClusterGatewayFanout{}).Connect(context.TODO(), "c-0", &ClusterGatewayFanoutOptions{}, nil)
+	assert.True(t, apierrors.IsBadRequest(err))
+	_, err = (&ClusterGatewayFanout{}).Connect(context.TODO(), FanoutAllClusters, &ClusterGatewayFanoutOptions{ClusterSelector: "a in b"}, nil)
+	assert.True(t, apierrors.IsBadRequest(err))
+}
+
+func TestClusterGatewayFanoutPagination(t *testing.T) {
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		return authorizer.DecisionAllow, "", nil
+	}
+	// each cluster lists 3 pods by the pages of the limit, continuing from
+	// the index of the next pod
+	pods := func(w http.ResponseWriter, r *http.Request) {
+		start := 0
+		if token := r.URL.Query().Get("continue"); token != "" {
+			_, _ = fmt.Sscanf(token, "next-%d", &start)
+		}
+		end := 3
+		metadata := `{"resourceVersion":"10"}`
+		if limit := r.URL.Query().Get("limit"); limit == "2" && start+2 < end {
+			end = start + 2
+			metadata = fmt.Sprintf(`{"resourceVersion":"10","continue":"next-%d"}`, end)
+		}
+		var items []string
+		for i := start; i < end; i++ {
+			items = append(items, fmt.Sprintf(`{"metadata":{"name":"pod-%d"}}`, i))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"kind":"PodList","apiVersion":"v1","metadata":%s,"items":[%s]}`, metadata, strings.Join(items, ","))
+	}
+	parent := &fakeParentLister{items: []ClusterGateway{
+		newFanoutTestCluster("a", "dev", pods, t),
+		newFanoutTestCluster("b", "dev", pods, t),
+	}}
+
+	list, err := serveFanout(t, parent, &ClusterGatewayFanoutOptions{Path: "/api/v1/pods"}, "limit=2")
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(list.Items))
+	assert.Equal(t, []ClusterGatewayFanoutResult{
+		{Cluster: "a", Items: 2, ResourceVersion: "10", Continue: "next-2"},
+		{Cluster: "b", Items: 2, ResourceVersion: "10", Continue: "next-2"},
+	}, list.Clusters)
+
+	// only the continued clusters are requested for the next pages
+	list, err = serveFanout(t, parent, &ClusterGatewayFanoutOptions{
+		Path:             "/api/v1/pods",
+		ClusterContinues: map[string]string{"b": "next-2"},
+	}, "limit=2&clusterContinues=b%3Dnext-2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(list.Items))
+	assert.Equal(t, []ClusterGatewayFanoutResult{{Cluster: "b", Items: 1, ResourceVersion: "10"}}, list.Clusters)
+
+	// the continue token can't be shared by the clusters
+	_, err = serveFanout(t, parent, &ClusterGatewayFanoutOptions{Path: "/api/v1/pods"}, "limit=2&continue=next-2")
+	assert.True(t, apierrors.IsBadRequest(err), "unexpected error: %v", err)
+
+	opts := &ClusterGatewayFanoutOptions{}
+	require.NoError(t, opts.ConvertFromUrlValues(&url.Values{"clusterContinues": []string{"a=x,b=y"}}))
+	assert.Equal(t, map[string]string{"a": "x", "b": "y"}, opts.ClusterContinues)
+	assert.True(t, apierrors.IsBadRequest(opts.ConvertFromUrlValues(&url.Values{"clusterContinues": []string{"a"}})))
+}
+
+func TestClusterGatewayFanoutTimeout(t *testing.T) {
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		return authorizer.DecisionAllow, "", nil
+	}
+	defer func(timeout time.Duration) {
+		config.ProxyFanoutTimeout = timeout
+	}(config.ProxyFanoutTimeout)
+	config.ProxyFanoutTimeout = 200 * time.Millisecond
+	parent := &fakeParentLister{items: []ClusterGateway{
+		newFanoutTestCluster("slow", "dev", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}, t),
+	}}
+	ts := time.Now()
+	list, err := serveFanout(t, parent, &ClusterGatewayFanoutOptions{Path: "/api/v1/pods"}, "")
+	require.NoError(t, err)
+	assert.Less(t, time.Since(ts), 5*time.Second)
+	require.Equal(t, 1, len(list.Clusters))
+	require.NotNil(t, list.Clusters[0].Status)
+	assert.Equal(t, metav1.StatusReasonTimeout, list.Clusters[0].Status.Reason)
+}
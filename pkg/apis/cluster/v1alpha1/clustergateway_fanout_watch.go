@@ -0,0 +1,313 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
+)
+
+// fanoutWatchBackoff is the backoff of rewatching the cluster upon failures
+var fanoutWatchBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      30 * time.Second,
+}
+
+func isWatchQuery(query url.Values) bool {
+	v := query.Get("watch")
+	return v == "true" || v == "1"
+}
+
+// serveWatch multiplexes the watches of the clusters into one stream of the
+// watch events, the objects in which are annotated with the clusters. Each
+// cluster is watched independently and rewatched from its last resource
+// version upon disconnection, so the stream survives the failures of the
+// clusters. The failures are streamed in-band as the BOOKMARK events annotated
+// with the status, as the ERROR events end the watches of the clients.
+func (h *fanoutHandler) serveWatch(writer http.ResponseWriter, req *http.Request, query url.Values) {
+	if httpstream.IsUpgradeRequest(req) {
+		h.responder.Error(apierrors.NewBadRequest("upgrading is not supported by the fanout subresource"))
+		return
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	// the timeout applies to the multiplexed watch instead of the clusters
+	if raw := query.Get("timeoutSeconds"); raw != "" {
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || seconds <= 0 {
+			h.responder.Error(apierrors.NewBadRequest(fmt.Sprintf("invalid timeoutSeconds %q", raw)))
+			return
+		}
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+		defer cancel()
+		query.Del("timeoutSeconds")
+	}
+	// the bookmarks are always requested to keep the resource versions fresh
+	bookmarks := query.Get("allowWatchBookmarks") == "true"
+	query.Set("allowWatchBookmarks", "true")
+
+	events := make(chan *metav1.WatchEvent)
+	wg := &sync.WaitGroup{}
+	for i := range h.clusters {
+		resourceVersion, ok := h.resourceVersions[h.clusters[i].Name]
+		if !ok {
+			resourceVersion = query.Get("resourceVersion")
+		}
+		wg.Add(1)
+		go func(cluster *ClusterGateway, resourceVersion string) {
+			defer wg.Done()
+			h.watchCluster(ctx, req, cluster, resourceVersion, query, bookmarks, events)
+		}(&h.clusters[i], resourceVersion)
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	flusher, _ := writer.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	encoder := json.NewEncoder(writer)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if err := encoder.Encode(event); err != nil {
+				klog.V(4).Infof("Stopped streaming the fanout watch: %v", err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// watchCluster watches the cluster until the context is done. The cluster is
+// rewatched from the last resource version upon disconnection. Upon the
+// resource version expired, the cluster is no longer watched, as rewatching
+// from the latest would miss the deletions in between, and the client is told
+// to list the cluster again instead.
+func (h *fanoutHandler) watchCluster(ctx context.Context, req *http.Request, cluster *ClusterGateway, resourceVersion string, query url.Values, bookmarks bool, events chan<- *metav1.WatchEvent) {
+	emit := func(event *metav1.WatchEvent) bool {
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	backoff := fanoutWatchBackoff
+	for ctx.Err() == nil {
+		ts := time.Now()
+		var established bool
+		var err error
+		resourceVersion, established, err = h.watchClusterOnce(ctx, req, cluster, resourceVersion, query, bookmarks, emit)
+		if ctx.Err() != nil {
+			return
+		}
+		if established {
+			backoff = fanoutWatchBackoff
+		}
+		if err != nil {
+			klog.V(4).Infof("Failed watching cluster %s in fanout: %v", cluster.Name, err)
+			relist := apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+			if !emit(h.newFanoutWatchStatusEvent(cluster.Name, resourceVersion, err, relist)) || relist {
+				return
+			}
+		} else if time.Since(ts) >= fanoutWatchBackoff.Duration {
+			// the watch is closed by the cluster, e.g. timed out
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
+
+// watchClusterOnce watches the cluster by the proxy handler from the resource
+// version, and emits the events annotated with the cluster until the watch
+// ends. It returns the last resource version, whether the watch is
+// established and the failure of the watch. The BOOKMARK events of the cluster
+// only update the resource version unless the bookmarks are requested.
+func (h *fanoutHandler) watchClusterOnce(ctx context.Context, req *http.Request, cluster *ClusterGateway, resourceVersion string, query url.Values, bookmarks bool, emit func(*metav1.WatchEvent) bool) (string, bool, error) {
+	ts := time.Now()
+	if err := h.admitCluster(ctx, cluster); err != nil {
+		return resourceVersion, false, err
+	}
+	clusterQuery := url.Values{}
+	for k, v := range query {
+		clusterQuery[k] = v
+	}
+	clusterQuery.Del("resourceVersion")
+	if resourceVersion != "" {
+		clusterQuery.Set("resourceVersion", resourceVersion)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	reader, pipe := io.Pipe()
+	writer := &fanoutWatchWriter{header: http.Header{}, statusCode: http.StatusOK, headerWritten: make(chan struct{}), pipe: pipe}
+	responder := &fanoutResponder{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			// the proxy aborts the handler by panicking upon failing to copy
+			// the response, e.g. the watch is stopped or disconnected
+			if r := recover(); r != nil && r != http.ErrAbortHandler {
+				klog.Errorf("Panic watching cluster %s in fanout: %v", cluster.Name, r)
+			}
+			_ = pipe.Close()
+		}()
+		h.newClusterProxyHandler(cluster, responder, ts).ServeHTTP(writer, h.newClusterRequest(ctx, req, cluster, clusterQuery))
+	}()
+	defer func() {
+		cancel()
+		_ = reader.Close()
+		<-done
+	}()
+
+	select {
+	case <-writer.headerWritten:
+	case <-done:
+		select {
+		case <-writer.headerWritten:
+		default:
+			if responder.err != nil {
+				return resourceVersion, false, responder.err
+			}
+			return resourceVersion, false, fmt.Errorf("no response watching cluster %s", cluster.Name)
+		}
+	}
+	if writer.statusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(reader)
+		<-done
+		if responder.err != nil {
+			return resourceVersion, false, responder.err
+		}
+		return resourceVersion, false, fanoutResponseError(writer.statusCode, body)
+	}
+
+	decoder := json.NewDecoder(reader)
+	for {
+		event := &metav1.WatchEvent{}
+		if err := decoder.Decode(event); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				<-done
+				return resourceVersion, true, responder.err
+			}
+			return resourceVersion, true, errors.Wrapf(err, "failed decoding the watch events of cluster %s", cluster.Name)
+		}
+		if event.Type == string(watch.Error) {
+			return resourceVersion, true, fanoutResponseError(http.StatusInternalServerError, event.Object.Raw)
+		}
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal(event.Object.Raw, &obj); err != nil {
+			return resourceVersion, true, errors.Wrapf(err, "failed decoding the watch event of cluster %s", cluster.Name)
+		}
+		item := &unstructured.Unstructured{Object: obj}
+		if v := item.GetResourceVersion(); v != "" {
+			resourceVersion = v
+		}
+		if event.Type == string(watch.Bookmark) && !bookmarks {
+			continue
+		}
+		if h.watchedType.Load() == nil && item.GetAPIVersion() != "" && item.GetKind() != "" {
+			h.watchedType.CompareAndSwap(nil, &metav1.TypeMeta{APIVersion: item.GetAPIVersion(), Kind: item.GetKind()})
+		}
+		annotateFanoutItem(item, cluster.Name)
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			return resourceVersion, true, errors.Wrapf(err, "failed encoding the watch event of cluster %s", cluster.Name)
+		}
+		if !emit(&metav1.WatchEvent{Type: event.Type, Object: runtime.RawExtension{Raw: raw}}) {
+			return resourceVersion, true, nil
+		}
+	}
+}
+
+// newFanoutWatchStatusEvent returns the BOOKMARK event reporting the failure
+// watching the cluster, the object of which is annotated with the cluster and
+// the status of the failure, and whether the cluster should be listed again.
+// The object is of the type watched if any event is received, otherwise the
+// Status.
+func (h *fanoutHandler) newFanoutWatchStatusEvent(cluster, resourceVersion string, err error, relist bool) *metav1.WatchEvent {
+	status := proxyErrorStatus(err)
+	status.APIVersion, status.Kind = "v1", "Status"
+	statusRaw, _ := json.Marshal(status)
+	item := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	item.SetAPIVersion("v1")
+	item.SetKind("Status")
+	if watchedType := h.watchedType.Load(); watchedType != nil {
+		item.SetAPIVersion(watchedType.APIVersion)
+		item.SetKind(watchedType.Kind)
+	}
+	item.SetResourceVersion(resourceVersion)
+	annotations := map[string]string{
+		AnnotationKeyFanoutCluster:       cluster,
+		AnnotationKeyFanoutClusterStatus: string(statusRaw),
+	}
+	if relist {
+		annotations[AnnotationKeyFanoutClusterRelist] = "true"
+	}
+	item.SetAnnotations(annotations)
+	raw, _ := json.Marshal(item.Object)
+	return &metav1.WatchEvent{Type: string(watch.Bookmark), Object: runtime.RawExtension{Raw: raw}}
+}
+
+var _ http.ResponseWriter = &fanoutWatchWriter{}
+var _ http.Flusher = &fanoutWatchWriter{}
+
+// fanoutWatchWriter pipes the watch response of the cluster for decoding
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type fanoutWatchWriter struct {
+	header        http.Header
+	statusCode    int
+	once          sync.Once
+	headerWritten chan struct{}
+	pipe          *io.PipeWriter
+}
+
+func (in *fanoutWatchWriter) Header() http.Header {
+	return in.header
+}
+
+func (in *fanoutWatchWriter) WriteHeader(statusCode int) {
+	in.once.Do(func() {
+		in.statusCode = statusCode
+		close(in.headerWritten)
+	})
+}
+
+func (in *fanoutWatchWriter) Write(b []byte) (int, error) {
+	in.WriteHeader(http.StatusOK)
+	return in.pipe.Write(b)
+}
+
+func (in *fanoutWatchWriter) Flush() {}
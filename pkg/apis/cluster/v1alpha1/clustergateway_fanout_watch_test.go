@@ -0,0 +1,147 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+)
+
+func watchFanout(t *testing.T, parent *fakeParentLister, opts *ClusterGatewayFanoutOptions, query string) []metav1.WatchEvent {
+	userInfo := &user.DefaultInfo{Name: "x"}
+	ctx := contextutil.WithParentStorage(context.TODO(), parent)
+	ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+	ctx = request.WithUser(ctx, userInfo)
+	handler, err := (&ClusterGatewayFanout{}).Connect(ctx, FanoutAllClusters, opts, &fakeResponder{})
+	require.NoError(t, err)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(request.WithUser(r.Context(), userInfo)))
+	}))
+	defer svr.Close()
+	resp, err := svr.Client().Get(svr.URL + apiPrefix + FanoutAllClusters + "/fanout" + opts.Path + "?" + query)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var events []metav1.WatchEvent
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := metav1.WatchEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			return events
+		}
+		events = append(events, event)
+	}
+}
+
+func TestClusterGatewayFanoutWatch(t *testing.T) {
+	defer func(backoff wait.Backoff) {
+		fanoutWatchBackoff = backoff
+	}(fanoutWatchBackoff)
+	fanoutWatchBackoff = wait.Backoff{Duration: 100 * time.Millisecond, Factor: 1, Steps: 1000}
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		return authorizer.DecisionAllow, "", nil
+	}
+
+	lock := &sync.Mutex{}
+	requests := map[string][]string{}
+	record := func(cluster string, r *http.Request) string {
+		lock.Lock()
+		defer lock.Unlock()
+		query := r.URL.Query()
+		assert.Equal(t, "true", query.Get("watch"))
+		assert.Equal(t, "true", query.Get("allowWatchBookmarks"))
+		assert.Equal(t, "", query.Get("timeoutSeconds"))
+		requests[cluster] = append(requests[cluster], query.Get("resourceVersion"))
+		return query.Get("resourceVersion")
+	}
+	stream := func(w http.ResponseWriter, events ...string) {
+		w.Header().Set("Content-Type", "application/json")
+		for _, event := range events {
+			_, _ = fmt.Fprintln(w, event)
+			w.(http.Flusher).Flush()
+		}
+	}
+	pod := func(eventType watch.EventType, name, resourceVersion string) string {
+		return fmt.Sprintf(`{"type":%q,"object":{"kind":"Pod","apiVersion":"v1","metadata":{"name":%q,"resourceVersion":%q}}}`,
+			eventType, name, resourceVersion)
+	}
+	parent := &fakeParentLister{items: []ClusterGateway{
+		// disconnected after the first event, and resumed from it
+		newFanoutTestCluster("a", "dev", func(w http.ResponseWriter, r *http.Request) {
+			switch record("a", r) {
+			case "":
+				stream(w, pod(watch.Added, "a-1", "1"))
+			case "1":
+				stream(w, pod(watch.Modified, "a-1", "2"), pod(watch.Bookmark, "", "3"))
+				<-r.Context().Done()
+			}
+		}, t),
+		// the resource version is expired, and left for relisting
+		newFanoutTestCluster("b", "dev", func(w http.ResponseWriter, r *http.Request) {
+			switch record("b", r) {
+			case "5":
+				stream(w, `{"type":"ERROR","object":{"kind":"Status","apiVersion":"v1","status":"Failure",`+
+					`"message":"too old resource version","reason":"Expired","code":410}}`)
+			case "":
+				stream(w, pod(watch.Added, "b-1", "10"))
+				<-r.Context().Done()
+			}
+		}, t),
+		// always failing
+		newFanoutTestCluster("c", "dev", func(w http.ResponseWriter, r *http.Request) {
+			record("c", r)
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}, t),
+	}}
+
+	events := watchFanout(t, parent, &ClusterGatewayFanoutOptions{
+		Path:                    "/api/v1/pods",
+		ClusterResourceVersions: map[string]string{"b": "5"},
+	}, "watch=true&timeoutSeconds=1&clusterResourceVersions=b%3D5")
+
+	received := map[string][]string{}
+	for _, event := range events {
+		require.NotEqual(t, string(watch.Error), event.Type)
+		obj := &unstructured.Unstructured{}
+		require.NoError(t, obj.UnmarshalJSON(event.Object.Raw))
+		annotations := obj.GetAnnotations()
+		cluster := annotations[AnnotationKeyFanoutCluster]
+		if raw, ok := annotations[AnnotationKeyFanoutClusterStatus]; ok {
+			require.Equal(t, string(watch.Bookmark), event.Type)
+			status := &metav1.Status{}
+			require.NoError(t, json.Unmarshal([]byte(raw), status))
+			received[cluster] = append(received[cluster], fmt.Sprintf("%s/%s@%s relist=%s",
+				event.Type, status.Reason, obj.GetResourceVersion(), annotations[AnnotationKeyFanoutClusterRelist]))
+			continue
+		}
+		received[cluster] = append(received[cluster], event.Type+"/"+obj.GetName()+"@"+obj.GetResourceVersion())
+	}
+	assert.Equal(t, []string{"ADDED/a-1@1", "MODIFIED/a-1@2"}, received["a"])
+	assert.Equal(t, []string{"BOOKMARK/Expired@5 relist=true"}, received["b"])
+	assert.Greater(t, len(received["c"]), 1)
+	for _, event := range received["c"] {
+		assert.Equal(t, "BOOKMARK/"+string(metav1.StatusReasonUnknown)+"@ relist=", event)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"", "1"}, requests["a"])
+	assert.Equal(t, []string{"5"}, requests["b"])
+}
@@ -2,7 +2,9 @@ package v1alpha1
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 
 	"github.com/oam-dev/cluster-gateway/pkg/config"
@@ -63,6 +65,24 @@ func (in *ClusterGatewayHealth) Update(ctx context.Context, name string, objInfo
 	}
 	latestSecret.Annotations[AnnotationKeyClusterGatewayStatusHealthy] = strconv.FormatBool(updatingClusterGateway.Status.Healthy)
 	latestSecret.Annotations[AnnotationKeyClusterGatewayStatusHealthyReason] = string(updatingClusterGateway.Status.HealthyReason)
+	probeRaw, err := marshalProbeStatus(&updatingClusterGateway.Status)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(probeRaw) > 0 {
+		latestSecret.Annotations[AnnotationKeyClusterGatewayStatusProbe] = probeRaw
+	} else {
+		delete(latestSecret.Annotations, AnnotationKeyClusterGatewayStatusProbe)
+	}
+	if len(updatingClusterGateway.Status.Conditions) > 0 {
+		conditionsRaw, err := json.Marshal(updatingClusterGateway.Status.Conditions)
+		if err != nil {
+			return nil, false, err
+		}
+		latestSecret.Annotations[AnnotationKeyClusterGatewayStatusConditions] = string(conditionsRaw)
+	} else {
+		delete(latestSecret.Annotations, AnnotationKeyClusterGatewayStatusConditions)
+	}
 	updated, err := singleton.GetKubeClient().
 		CoreV1().
 		Secrets(config.SecretNamespace).
@@ -76,3 +96,51 @@ func (in *ClusterGatewayHealth) Update(ctx context.Context, name string, objInfo
 	}
 	return clusterGateway, false, nil
 }
+
+// clusterGatewayProbeStatus is the part of the status written by the health
+// probers, which is stored in a single annotation of the cluster secret.
+// +k8s:deepcopy-gen=false
+// +k8s:openapi-gen=false
+type clusterGatewayProbeStatus struct {
+	LastProbeTime        *metav1.Time     `json:"lastProbeTime,omitempty"`
+	ProbeLatency         *metav1.Duration `json:"probeLatency,omitempty"`
+	ConsecutiveFailures  int32            `json:"consecutiveFailures,omitempty"`
+	ConsecutiveSuccesses int32            `json:"consecutiveSuccesses,omitempty"`
+	FailingChecks        []string         `json:"failingChecks,omitempty"`
+	Version              string           `json:"version,omitempty"`
+}
+
+// marshalProbeStatus returns the annotation value of the probe status, or
+// empty if no probe is recorded
+func marshalProbeStatus(status *ClusterGatewayStatus) (string, error) {
+	probe := clusterGatewayProbeStatus{
+		LastProbeTime:        status.LastProbeTime,
+		ProbeLatency:         status.ProbeLatency,
+		ConsecutiveFailures:  status.ConsecutiveFailures,
+		ConsecutiveSuccesses: status.ConsecutiveSuccesses,
+		FailingChecks:        status.FailingChecks,
+		Version:              status.Version,
+	}
+	if reflect.DeepEqual(probe, clusterGatewayProbeStatus{}) {
+		return "", nil
+	}
+	bs, err := json.Marshal(probe)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+func unmarshalProbeStatus(raw string, status *ClusterGatewayStatus) error {
+	probe := clusterGatewayProbeStatus{}
+	if err := json.Unmarshal([]byte(raw), &probe); err != nil {
+		return err
+	}
+	status.LastProbeTime = probe.LastProbeTime
+	status.ProbeLatency = probe.ProbeLatency
+	status.ConsecutiveFailures = probe.ConsecutiveFailures
+	status.ConsecutiveSuccesses = probe.ConsecutiveSuccesses
+	status.FailingChecks = probe.FailingChecks
+	status.Version = probe.Version
+	return nil
+}
@@ -0,0 +1,222 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+)
+
+var _ resource.ArbitrarySubResource = &ClusterGatewayIdentityExchange{}
+var _ rest.NamedCreater = &ClusterGatewayIdentityExchange{}
+
+// IdentityExchangeRuleSource is where the identity exchange rule is from
+type IdentityExchangeRuleSource string
+
+const (
+	// IdentityExchangeRuleSourceCluster is the proxy config in the annotation
+	// of the cluster
+	IdentityExchangeRuleSourceCluster IdentityExchangeRuleSource = "Cluster"
+	// IdentityExchangeRuleSourceGlobal is the proxy config loaded from
+	// --cluster-gateway-proxy-config
+	IdentityExchangeRuleSourceGlobal IdentityExchangeRuleSource = "Global"
+)
+
+// ClusterGatewayIdentityExchange is a subresource for ClusterGateway which
+// dry-runs the identity exchange rules for the given identity, without
+// proxying any request to the managed cluster.
+type ClusterGatewayIdentityExchange struct {
+}
+
+// ClusterGatewayIdentityExchangeReview is posted to the identityexchange
+// subresource of ClusterGateway, the status is filled by the evaluation of
+// the identity exchange rules as if proxying requests with impersonation.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterGatewayIdentityExchangeReview struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterGatewayIdentityExchangeReviewSpec   `json:"spec"`
+	Status ClusterGatewayIdentityExchangeReviewStatus `json:"status,omitempty"`
+}
+
+// ClusterGatewayIdentityExchangeReviewSpec is the identity to exchange. The
+// identity of the requesting user is used if both user and groups are empty.
+type ClusterGatewayIdentityExchangeReviewSpec struct {
+	User   string              `json:"user,omitempty"`
+	Groups []string            `json:"groups,omitempty"`
+	UID    string              `json:"uid,omitempty"`
+	Extra  map[string][]string `json:"extra,omitempty"`
+}
+
+type ClusterGatewayIdentityExchangeReviewStatus struct {
+	// Matched indicates whether any of the rules matches the identity
+	Matched bool `json:"matched"`
+	// Source is where the matched rule is from
+	Source IdentityExchangeRuleSource `json:"source,omitempty"`
+	// RuleName is the name of the matched rule
+	RuleName string `json:"ruleName,omitempty"`
+	// Impersonation is the identity impersonated by the proxied requests, it
+	// is the given identity if no rule matches, and is unset if the requests
+	// are not impersonated, e.g. matching PrivilegedIdentityExchanger
+	Impersonation *ImpersonatedIdentity `json:"impersonation,omitempty"`
+	// Error is the failure of exchanging the identity with the matched rule,
+	// the proxied requests are rejected upon such failure
+	Error string `json:"error,omitempty"`
+	// Trace is the rules evaluated in order until the matched one
+	Trace []IdentityExchangeRuleTrace `json:"trace,omitempty"`
+}
+
+type ImpersonatedIdentity struct {
+	User   string              `json:"user,omitempty"`
+	Groups []string            `json:"groups,omitempty"`
+	UID    string              `json:"uid,omitempty"`
+	Extra  map[string][]string `json:"extra,omitempty"`
+}
+
+type IdentityExchangeRuleTrace struct {
+	Source  IdentityExchangeRuleSource `json:"source"`
+	Rule    string                     `json:"rule"`
+	Type    ClientIdentityExchangeType `json:"type"`
+	Matched bool                       `json:"matched"`
+	// Reason is why the identity does not match the source of the rule
+	Reason string `json:"reason,omitempty"`
+}
+
+func (in *ClusterGatewayIdentityExchange) SubResourceName() string {
+	return "identityexchange"
+}
+
+func (in *ClusterGatewayIdentityExchange) New() runtime.Object {
+	return &ClusterGatewayIdentityExchangeReview{}
+}
+
+func (in *ClusterGatewayIdentityExchange) Destroy() {}
+
+func (in *ClusterGatewayIdentityExchange) Create(ctx context.Context, name string, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	review, ok := obj.(*ClusterGatewayIdentityExchangeReview)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("not a ClusterGatewayIdentityExchangeReview: %#v", obj))
+	}
+	parentObj, err := (&ClusterGateway{}).Get(ctx, name, &metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	clusterGateway := parentObj.(*ClusterGateway)
+
+	var userInfo user.Info = &user.DefaultInfo{
+		Name:   review.Spec.User,
+		Groups: review.Spec.Groups,
+		UID:    review.Spec.UID,
+		Extra:  review.Spec.Extra,
+	}
+	requester, ok := request.UserFrom(ctx)
+	if len(review.Spec.User) == 0 && len(review.Spec.Groups) == 0 {
+		if !ok {
+			return nil, apierrors.NewBadRequest("no user is given to exchange")
+		}
+		userInfo = requester
+	} else {
+		// reviewing another identity reveals how it is exchanged, which is
+		// only allowed to the users who can impersonate it
+		if !ok {
+			return nil, apierrors.NewBadRequest("no user is found in the request")
+		}
+		if err := authorizeImpersonation(ctx, requester, userInfo, name); err != nil {
+			return nil, err
+		}
+	}
+
+	review.Status = reviewIdentityExchange(ctx, clusterGateway, name, userInfo)
+	return review, nil
+}
+
+// reviewIdentityExchange evaluates the identity exchange rules the same way as
+// the proxy subresource, and records the evaluated rules
+func reviewIdentityExchange(ctx context.Context, clusterGateway *ClusterGateway, cluster string, userInfo user.Info) ClusterGatewayIdentityExchangeReviewStatus {
+	status := ClusterGatewayIdentityExchangeReviewStatus{}
+	tracer := func(source IdentityExchangeRuleSource, rule *ClientIdentityExchangeRule, mismatch string) {
+		status.Trace = append(status.Trace, IdentityExchangeRuleTrace{
+			Source:  source,
+			Rule:    rule.Name,
+			Type:    rule.Type,
+			Matched: mismatch == "",
+			Reason:  mismatch,
+		})
+	}
+	source, ruleName, projected, err := exchangeClusterIdentity(ctx, clusterGateway, cluster, userInfo, tracer)
+	status.Matched = len(source) > 0
+	status.Source = source
+	status.RuleName = ruleName
+	switch {
+	case err != nil:
+		status.Error = err.Error()
+	case !status.Matched:
+		status.Impersonation = &ImpersonatedIdentity{
+			User:   userInfo.GetName(),
+			Groups: userInfo.GetGroups(),
+			Extra:  userInfo.GetExtra(),
+		}
+	case len(projected.UserName) > 0 || len(projected.Groups) > 0:
+		status.Impersonation = &ImpersonatedIdentity{
+			User:   projected.UserName,
+			Groups: projected.Groups,
+			UID:    projected.UID,
+			Extra:  projected.Extra,
+		}
+	}
+	return status
+}
+
+// authorizeImpersonation authorizes the requester to impersonate the user,
+// the groups, the uid and the extra of the given identity in the hub, the
+// same way as the impersonation headers are authorized by kube-apiserver.
+func authorizeImpersonation(ctx context.Context, requester, userInfo user.Info, name string) error {
+	var attrs []authorizer.AttributesRecord
+	if len(userInfo.GetName()) > 0 {
+		if namespace, sa, err := serviceaccount.SplitUsername(userInfo.GetName()); err == nil {
+			attrs = append(attrs, authorizer.AttributesRecord{Namespace: namespace, Resource: "serviceaccounts", Name: sa})
+		} else {
+			attrs = append(attrs, authorizer.AttributesRecord{Resource: "users", Name: userInfo.GetName()})
+		}
+	}
+	for _, group := range userInfo.GetGroups() {
+		attrs = append(attrs, authorizer.AttributesRecord{Resource: "groups", Name: group})
+	}
+	if len(userInfo.GetUID()) > 0 {
+		attrs = append(attrs, authorizer.AttributesRecord{APIGroup: authenticationv1.GroupName, Resource: "uids", Name: userInfo.GetUID()})
+	}
+	for key, values := range userInfo.GetExtra() {
+		for _, value := range values {
+			attrs = append(attrs, authorizer.AttributesRecord{APIGroup: authenticationv1.GroupName, Resource: "userextras", Subresource: key, Name: value})
+		}
+	}
+	for _, attr := range attrs {
+		attr.User = requester
+		attr.Verb = "impersonate"
+		attr.ResourceRequest = true
+		decision, reason, err := loopback.GetAuthorizer().Authorize(ctx, attr)
+		if err != nil {
+			return apierrors.NewInternalError(errors.Wrapf(err, "authorization failed due to %s", reason))
+		}
+		if decision != authorizer.DecisionAllow {
+			msg := fmt.Sprintf("user %v cannot impersonate %s %q", requester.GetName(), attr.Resource, attr.Name)
+			if reason != "" {
+				msg += ": " + reason
+			}
+			return apierrors.NewForbidden(clusterGatewayGroupResource(), name, errors.New(msg))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/util/feature"
+	k8stesting "k8s.io/component-base/featuregate/testing"
+	"k8s.io/utils/pointer"
+
+	"github.com/oam-dev/cluster-gateway/pkg/common"
+	"github.com/oam-dev/cluster-gateway/pkg/featuregates"
+)
+
+func TestReviewIdentityExchange(t *testing.T) {
+	SetGlobalClusterGatewayProxyConfiguration(&ClusterGatewayProxyConfiguration{
+		Spec: ClusterGatewayProxyConfigurationSpec{
+			ClientIdentityExchanger: ClientIdentityExchanger{Rules: []ClientIdentityExchangeRule{{
+				Name:   "sudoer",
+				Type:   PrivilegedIdentityExchanger,
+				Source: &IdentityExchangerSource{Group: pointer.String("sudoer")},
+			}, {
+				Name:   "dev",
+				Type:   StaticMappingIdentityExchanger,
+				Source: &IdentityExchangerSource{UserPattern: pointer.String("dev-.*")},
+				Target: &IdentityExchangerTarget{User: "developer", Groups: []string{"dev"}},
+			}}},
+		},
+	})
+	defer SetGlobalClusterGatewayProxyConfiguration(&ClusterGatewayProxyConfiguration{})
+
+	clusterGateway := &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "c1"},
+		Spec: ClusterGatewaySpec{ProxyConfig: &ClusterGatewayProxyConfiguration{
+			Spec: ClusterGatewayProxyConfigurationSpec{
+				ClientIdentityExchanger: ClientIdentityExchanger{Rules: []ClientIdentityExchangeRule{{
+					Name:   "local",
+					Type:   StaticMappingIdentityExchanger,
+					Source: &IdentityExchangerSource{User: pointer.String("alice"), Cluster: pointer.String("c1")},
+					Target: &IdentityExchangerTarget{User: "local-alice"},
+				}, {
+					Name:   "external",
+					Type:   ExternalIdentityExchanger,
+					Source: &IdentityExchangerSource{User: pointer.String("bob")},
+				}}},
+			},
+		}},
+	}
+
+	testcases := map[string]struct {
+		UserInfo user.Info
+		Status   ClusterGatewayIdentityExchangeReviewStatus
+	}{
+		"cluster-rule": {
+			UserInfo: &user.DefaultInfo{Name: "alice"},
+			Status: ClusterGatewayIdentityExchangeReviewStatus{
+				Matched:       true,
+				Source:        IdentityExchangeRuleSourceCluster,
+				RuleName:      "local",
+				Impersonation: &ImpersonatedIdentity{User: "local-alice"},
+				Trace: []IdentityExchangeRuleTrace{
+					{Source: IdentityExchangeRuleSourceCluster, Rule: "local", Type: StaticMappingIdentityExchanger, Matched: true},
+				},
+			},
+		},
+		"global-rule": {
+			UserInfo: &user.DefaultInfo{Name: "dev-1"},
+			Status: ClusterGatewayIdentityExchangeReviewStatus{
+				Matched:       true,
+				Source:        IdentityExchangeRuleSourceGlobal,
+				RuleName:      "dev",
+				Impersonation: &ImpersonatedIdentity{User: "developer", Groups: []string{"dev"}},
+				Trace: []IdentityExchangeRuleTrace{
+					{Source: IdentityExchangeRuleSourceCluster, Rule: "local", Type: StaticMappingIdentityExchanger, Reason: `user "dev-1" does not equal "alice"`},
+					{Source: IdentityExchangeRuleSourceCluster, Rule: "external", Type: ExternalIdentityExchanger, Reason: `user "dev-1" does not equal "bob"`},
+					{Source: IdentityExchangeRuleSourceGlobal, Rule: "sudoer", Type: PrivilegedIdentityExchanger, Reason: `groups [] do not contain "sudoer"`},
+					{Source: IdentityExchangeRuleSourceGlobal, Rule: "dev", Type: StaticMappingIdentityExchanger, Matched: true},
+				},
+			},
+		},
+		"privileged": {
+			UserInfo: &user.DefaultInfo{Name: "root", Groups: []string{"sudoer"}},
+			Status: ClusterGatewayIdentityExchangeReviewStatus{
+				Matched:  true,
+				Source:   IdentityExchangeRuleSourceGlobal,
+				RuleName: "sudoer",
+				Trace: []IdentityExchangeRuleTrace{
+					{Source: IdentityExchangeRuleSourceCluster, Rule: "local", Type: StaticMappingIdentityExchanger, Reason: `user "root" does not equal "alice"`},
+					{Source: IdentityExchangeRuleSourceCluster, Rule: "external", Type: ExternalIdentityExchanger, Reason: `user "root" does not equal "bob"`},
+					{Source: IdentityExchangeRuleSourceGlobal, Rule: "sudoer", Type: PrivilegedIdentityExchanger, Matched: true},
+				},
+			},
+		},
+		"failed": {
+			UserInfo: &user.DefaultInfo{Name: "bob"},
+			Status: ClusterGatewayIdentityExchangeReviewStatus{
+				Matched:  true,
+				Source:   IdentityExchangeRuleSourceCluster,
+				RuleName: "external",
+				Error:    "url is not set for ExternalIdentityExchanger external",
+				Trace: []IdentityExchangeRuleTrace{
+					{Source: IdentityExchangeRuleSourceCluster, Rule: "local", Type: StaticMappingIdentityExchanger, Reason: `user "bob" does not equal "alice"`},
+					{Source: IdentityExchangeRuleSourceCluster, Rule: "external", Type: ExternalIdentityExchanger, Matched: true},
+				},
+			},
+		},
+		"no-match": {
+			UserInfo: &user.DefaultInfo{Name: "carol", Groups: []string{"tester"}},
+			Status: ClusterGatewayIdentityExchangeReviewStatus{
+				Impersonation: &ImpersonatedIdentity{User: "carol", Groups: []string{"tester"}},
+				Trace: []IdentityExchangeRuleTrace{
+					{Source: IdentityExchangeRuleSourceCluster, Rule: "local", Type: StaticMappingIdentityExchanger, Reason: `user "carol" does not equal "alice"`},
+					{Source: IdentityExchangeRuleSourceCluster, Rule: "external", Type: ExternalIdentityExchanger, Reason: `user "carol" does not equal "bob"`},
+					{Source: IdentityExchangeRuleSourceGlobal, Rule: "sudoer", Type: PrivilegedIdentityExchanger, Reason: `groups ["tester"] do not contain "sudoer"`},
+					{Source: IdentityExchangeRuleSourceGlobal, Rule: "dev", Type: StaticMappingIdentityExchanger, Reason: `user "carol" does not match pattern "dev-.*"`},
+				},
+			},
+		},
+	}
+	for name, tt := range testcases {
+		t.Run(name, func(t *testing.T) {
+			status := reviewIdentityExchange(context.TODO(), clusterGateway, "c1", tt.UserInfo)
+			assert.Equal(t, tt.Status, status)
+		})
+	}
+}
+
+func TestCreateClusterGatewayIdentityExchangeReview(t *testing.T) {
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.ClientIdentityPenetration, true)
+	setupTestSecretClient(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      testName,
+			Labels: map[string]string{
+				common.LabelKeyClusterCredentialType: string(CredentialTypeServiceAccountToken),
+			},
+			Annotations: map[string]string{
+				AnnotationClusterGatewayProxyConfiguration: `
+spec:
+  clientIdentityExchanger:
+    rules:
+      - name: local
+        source:
+          user: bob
+        target:
+          user: local-bob
+        type: StaticMappingIdentityExchanger
+`,
+			},
+		},
+		Data: map[string][]byte{
+			"ca.crt":   []byte(testCAData),
+			"token":    []byte(testToken),
+			"endpoint": []byte(testEndpoint),
+		},
+	})
+	storage := &ClusterGatewayIdentityExchange{}
+	var impersonated []string
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		if a.GetUser().GetName() != "alice" || a.GetVerb() != "impersonate" {
+			return authorizer.DecisionNoOpinion, "", nil
+		}
+		impersonated = append(impersonated, a.GetResource()+"/"+a.GetName())
+		if a.GetResource() == "users" && a.GetName() == "bob" {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+
+	// defaults to the requesting user
+	ctx := request.WithUser(context.TODO(), &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}})
+	obj, err := storage.Create(ctx, testName, &ClusterGatewayIdentityExchangeReview{}, nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	review := obj.(*ClusterGatewayIdentityExchangeReview)
+	assert.False(t, review.Status.Matched)
+	assert.Equal(t, &ImpersonatedIdentity{User: "alice", Groups: []string{"dev"}}, review.Status.Impersonation)
+
+	obj, err = storage.Create(ctx, testName, &ClusterGatewayIdentityExchangeReview{
+		Spec: ClusterGatewayIdentityExchangeReviewSpec{User: "bob"},
+	}, nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	review = obj.(*ClusterGatewayIdentityExchangeReview)
+	assert.True(t, review.Status.Matched)
+	assert.Equal(t, IdentityExchangeRuleSourceCluster, review.Status.Source)
+	assert.Equal(t, &ImpersonatedIdentity{User: "local-bob"}, review.Status.Impersonation)
+
+	// rejected if the requester can't impersonate the identity
+	_, err = storage.Create(ctx, testName, &ClusterGatewayIdentityExchangeReview{
+		Spec: ClusterGatewayIdentityExchangeReviewSpec{User: "bob", Groups: []string{"admin"}},
+	}, nil, &metav1.CreateOptions{})
+	require.True(t, apierrors.IsForbidden(err))
+	_, err = storage.Create(request.WithUser(context.TODO(), &user.DefaultInfo{Name: "carol"}), testName, &ClusterGatewayIdentityExchangeReview{
+		Spec: ClusterGatewayIdentityExchangeReviewSpec{User: "bob"},
+	}, nil, &metav1.CreateOptions{})
+	require.True(t, apierrors.IsForbidden(err))
+	assert.Equal(t, []string{"users/bob", "users/bob", "groups/admin"}, impersonated)
+
+	_, err = storage.Create(ctx, "non-existing", &ClusterGatewayIdentityExchangeReview{}, nil, &metav1.CreateOptions{})
+	require.Error(t, err)
+}
@@ -31,26 +31,28 @@ import (
 	"k8s.io/klog/v2"
 	"k8s.io/utils/strings/slices"
 
+	multicluster "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/transport"
 	"github.com/oam-dev/cluster-gateway/pkg/config"
 	"github.com/oam-dev/cluster-gateway/pkg/featuregates"
 	"github.com/oam-dev/cluster-gateway/pkg/metrics"
 
 	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	utilnet "k8s.io/apimachinery/pkg/util/net"
 	apiproxy "k8s.io/apimachinery/pkg/util/proxy"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
 	"k8s.io/apiserver/pkg/endpoints/request"
 	registryrest "k8s.io/apiserver/pkg/registry/rest"
 	restclient "k8s.io/client-go/rest"
-	"k8s.io/client-go/transport"
 	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
 	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource/resourcerest"
 	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
-	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
 )
 
 var _ resource.SubResource = &ClusterGatewayProxy{}
@@ -110,62 +112,68 @@ func (c *ClusterGatewayProxy) Connect(ctx context.Context, id string, options ru
 	clusterGateway := parentObj.(*ClusterGateway)
 
 	reqInfo, _ := request.RequestInfoFrom(ctx)
+	proxyReqInfo := newProxyRequestInfo(reqInfo.Verb, proxyOpts.Path)
+
+	return &proxyHandler{
+		parentName:     id,
+		path:           proxyOpts.Path,
+		impersonate:    proxyOpts.Impersonate,
+		clusterGateway: clusterGateway,
+		requestInfo:    proxyReqInfo,
+		startTime:      ts,
+		responder:      r,
+		finishFunc:     newProxyFinishFunc(id, proxyReqInfo, ts),
+	}, nil
+}
+
+// newProxyRequestInfo parses the target path of the proxied request, the verb
+// is inherited from the request to the hub.
+func newProxyRequestInfo(verb, path string) *request.RequestInfo {
 	factory := request.RequestInfoFactory{
 		APIPrefixes:          sets.NewString("api", "apis"),
 		GrouplessAPIPrefixes: sets.NewString("api"),
 	}
-	proxyReqInfo, _ := factory.NewRequestInfo(&http.Request{
+	info, _ := factory.NewRequestInfo(&http.Request{
 		URL: &url.URL{
-			Path: proxyOpts.Path,
+			Path: path,
 		},
-		Method: strings.ToUpper(reqInfo.Verb),
+		Method: strings.ToUpper(verb),
 	})
-	proxyReqInfo.Verb = reqInfo.Verb
+	info.Verb = verb
+	return info
+}
 
-	if config.AuthorizateProxySubpath {
-		user, _ := request.UserFrom(ctx)
-		var attr authorizer.Attributes
-		if proxyReqInfo.IsResourceRequest {
-			attr = authorizer.AttributesRecord{
-				User:        user,
-				APIGroup:    proxyReqInfo.APIGroup,
-				APIVersion:  proxyReqInfo.APIVersion,
-				Resource:    proxyReqInfo.Resource,
-				Subresource: proxyReqInfo.Subresource,
-				Namespace:   proxyReqInfo.Namespace,
-				Name:        proxyReqInfo.Name,
-				Verb:        proxyReqInfo.Verb,
-			}
-		} else {
-			path, _ := url.ParseRequestURI(proxyReqInfo.Path)
-			attr = authorizer.AttributesRecord{
-				User: user,
-				Path: path.Path,
-				Verb: proxyReqInfo.Verb,
-			}
-		}
+// newProxyFinishFunc records the metrics of the proxied request upon finishing
+func newProxyFinishFunc(cluster string, info *request.RequestInfo, ts time.Time) func(code int) {
+	return func(code int) {
+		metrics.RecordProxiedRequestsByResource(info.Resource, info.Verb, code)
+		metrics.RecordProxiedRequestsByCluster(cluster, code)
+		metrics.RecordProxiedRequestsDuration(info.Resource, info.Verb, cluster, code, time.Since(ts))
+	}
+}
 
-		decision, reason, err := loopback.GetAuthorizer().Authorize(ctx, attr)
-		if err != nil {
-			return nil, errors.Wrapf(err, "authorization failed due to %s", reason)
-		}
-		if decision != authorizer.DecisionAllow {
-			return nil, fmt.Errorf("proxying by user %v is forbidden authorization failed", user.GetName())
+// proxyRequestAttributes returns the attributes of the request to the cluster
+// for the authorization and the audit policy.
+func proxyRequestAttributes(userInfo user.Info, info *request.RequestInfo) authorizer.AttributesRecord {
+	if info.IsResourceRequest {
+		return authorizer.AttributesRecord{
+			User:            userInfo,
+			ResourceRequest: true,
+			APIGroup:        info.APIGroup,
+			APIVersion:      info.APIVersion,
+			Resource:        info.Resource,
+			Subresource:     info.Subresource,
+			Namespace:       info.Namespace,
+			Name:            info.Name,
+			Verb:            info.Verb,
 		}
 	}
-
-	return &proxyHandler{
-		parentName:     id,
-		path:           proxyOpts.Path,
-		impersonate:    proxyOpts.Impersonate,
-		clusterGateway: clusterGateway,
-		responder:      r,
-		finishFunc: func(code int) {
-			metrics.RecordProxiedRequestsByResource(proxyReqInfo.Resource, proxyReqInfo.Verb, code)
-			metrics.RecordProxiedRequestsByCluster(id, code)
-			metrics.RecordProxiedRequestsDuration(proxyReqInfo.Resource, proxyReqInfo.Verb, id, code, time.Since(ts))
-		},
-	}, nil
+	path, _ := url.ParseRequestURI(info.Path)
+	return authorizer.AttributesRecord{
+		User: userInfo,
+		Path: path.Path,
+		Verb: info.Verb,
+	}
 }
 
 func (c *ClusterGatewayProxy) NewConnectOptions() (runtime.Object, bool, string) {
@@ -192,6 +200,8 @@ type proxyHandler struct {
 	path           string
 	impersonate    bool
 	clusterGateway *ClusterGateway
+	requestInfo    *request.RequestInfo
+	startTime      time.Time
 	responder      registryrest.Responder
 	finishFunc     func(code int)
 }
@@ -206,6 +216,9 @@ type proxyResponseWriter struct {
 	http.Hijacker
 	http.Flusher
 	statusCode int
+	// status is the error responded by the responder
+	status *metav1.Status
+	bytes  int64
 }
 
 func (in *proxyResponseWriter) WriteHeader(statusCode int) {
@@ -213,6 +226,12 @@ func (in *proxyResponseWriter) WriteHeader(statusCode int) {
 	in.ResponseWriter.WriteHeader(statusCode)
 }
 
+func (in *proxyResponseWriter) Write(b []byte) (int, error) {
+	n, err := in.ResponseWriter.Write(b)
+	in.bytes += int64(n)
+	return n, err
+}
+
 func newProxyResponseWriter(_writer http.ResponseWriter) *proxyResponseWriter {
 	writer := &proxyResponseWriter{ResponseWriter: _writer, statusCode: http.StatusOK}
 	writer.Hijacker, _ = _writer.(http.Hijacker)
@@ -222,20 +241,56 @@ func newProxyResponseWriter(_writer http.ResponseWriter) *proxyResponseWriter {
 
 func (p *proxyHandler) ServeHTTP(_writer http.ResponseWriter, request *http.Request) {
 	writer := newProxyResponseWriter(_writer)
+	auditEvent := p.newAuditEvent(request)
 	defer func() {
 		p.finishFunc(writer.statusCode)
+		if auditEvent != nil {
+			completeProxyAuditEvent(auditEvent, writer, time.Since(p.startTime))
+		}
 	}()
 	cluster := p.clusterGateway
+	// the requests are admitted by the handler instead of the connecting, so
+	// that the rejections are audited as well
+	if config.AuthorizateProxySubpath {
+		if err := authorizeProxyRequest(request.Context(), cluster, p.requestInfo); err != nil {
+			p.error(writer, err)
+			return
+		}
+	}
+	// the health probes are let through to the unhealthy clusters, otherwise
+	// the clusters never recover
+	probe := isHealthProbeRequest(request, cluster)
+	if !probe && utilfeature.DefaultFeatureGate.Enabled(featuregates.HealthinessCheck) && isClusterUnhealthy(cluster) {
+		metrics.RecordRejectedRequest(cluster.Name, rejectedReasonUnhealthy)
+		p.error(writer, newClusterUnhealthyError(cluster))
+		return
+	}
 	if cluster.Spec.Access.Credential == nil {
 		responsewriters.InternalError(writer, request, fmt.Errorf("proxying cluster %s not support due to lacking credentials", cluster.Name))
 		return
 	}
 
+	limits, _ := getClusterProxyLimits(cluster.Annotations, nil)
+	longRunning := isLongRunningProxyRequest(request)
+	release, err := getClusterRequestLimiter(cluster.Name, limits).acquire(request.Context(), longRunning)
+	if err != nil {
+		p.error(writer, err)
+		return
+	}
+	defer release()
+	ctx := request.Context()
+	if !longRunning {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.timeout)
+		defer cancel()
+	}
+
 	// Go 1.19 removes the URL clone in WithContext method and therefore change
 	// to deep copy here
-	newReq := request.Clone(request.Context())
+	newReq := request.Clone(ctx)
 	newReq.Header = utilnet.CloneHeader(request.Header)
 	newReq.URL.Path = p.path
+	newReq.Header.Del(multicluster.HealthProbeHeader)
 
 	urlAddr, err := GetEndpointURL(cluster)
 	if err != nil {
@@ -249,24 +304,50 @@ func (p *proxyHandler) ServeHTTP(_writer http.ResponseWriter, request *http.Requ
 	newReq.URL.RawQuery = unescapeQueryValues(request.URL.Query()).Encode()
 	newReq.RequestURI = newReq.URL.RequestURI()
 
-	cfg, err := NewConfigFromCluster(request.Context(), cluster)
+	clusterTransport, err := getClusterTransport(request.Context(), cluster)
 	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating cluster proxy client config %s", cluster.Name))
+		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating cluster proxy client %s", cluster.Name))
 		return
 	}
+	var impersonate restclient.ImpersonationConfig
 	if p.impersonate || utilfeature.DefaultFeatureGate.Enabled(featuregates.ClientIdentityPenetration) {
-		cfg.Impersonate = p.getImpersonationConfig(request)
+		var source IdentityExchangeRuleSource
+		var ruleName string
+		impersonate, source, ruleName, err = p.getImpersonationConfig(request)
+		if auditEvent != nil {
+			setProxyAuditEventIdentity(auditEvent, impersonate, source, ruleName)
+		}
+		if err != nil {
+			p.error(writer, apierrors.NewForbidden(clusterGatewayGroupResource(), cluster.Name, err))
+			return
+		}
 	}
-	rt, err := restclient.TransportFor(cfg)
+	rt := clusterTransport.RoundTripperFor(impersonate)
+	upgradeTransport, err := clusterTransport.UpgradeTransportFor(impersonate)
 	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating cluster proxy client %s", cluster.Name))
+		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating upgrader client %s", cluster.Name))
 		return
 	}
+	if !probe && utilfeature.DefaultFeatureGate.Enabled(featuregates.HealthinessCheck) && circuitBreakerEnabled() {
+		cb := getClusterCircuitBreaker(cluster.Name)
+		trial, retryAfter, ok := cb.allow()
+		if !ok {
+			metrics.RecordRejectedRequest(cluster.Name, rejectedReasonCircuitOpen)
+			p.error(writer, newCircuitOpenError(cluster.Name, retryAfter))
+			return
+		}
+		if httpstream.IsUpgradeRequest(request) {
+			// the upgraded connections are not tracked by the circuit breaker
+			cb.release(trial)
+		} else {
+			rt = cb.roundTripper(trial, rt)
+		}
+	}
 	proxy := apiproxy.NewUpgradeAwareHandler(
 		&url.URL{
 			Scheme:   urlAddr.Scheme,
 			Path:     newReq.URL.Path,
-			Host:     urlAddr.Host,
+			Host:     clusterTransport.Host(urlAddr.Host),
 			RawQuery: request.URL.RawQuery,
 		},
 		rt,
@@ -275,39 +356,39 @@ func (p *proxyHandler) ServeHTTP(_writer http.ResponseWriter, request *http.Requ
 		nil)
 
 	const defaultFlushInterval = 200 * time.Millisecond
-	transportCfg, err := cfg.TransportConfig()
-	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating transport config %s", cluster.Name))
-		return
-	}
-	tlsConfig, err := transport.TLSConfigFor(transportCfg)
-	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating tls config %s", cluster.Name))
-		return
-	}
-	upgrader, err := transport.HTTPWrappersForConfig(transportCfg, apiproxy.MirrorRequest)
-	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating upgrader client %s", cluster.Name))
-		return
-	}
-	upgrading := utilnet.SetOldTransportDefaults(&http.Transport{
-		TLSClientConfig: tlsConfig,
-		DialContext:     cfg.Dial,
-	})
-	proxy.UpgradeTransport = apiproxy.NewUpgradeRequestRoundTripper(
-		upgrading,
-		RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
-			newReq := utilnet.CloneRequest(req)
-			return upgrader.RoundTrip(newReq)
-		}))
+	proxy.UpgradeTransport = upgradeTransport
 	proxy.Transport = rt
 	proxy.FlushInterval = defaultFlushInterval
 	proxy.Responder = ErrorResponderFunc(func(w http.ResponseWriter, req *http.Request, err error) {
-		p.responder.Error(err)
+		p.error(writer, err)
 	})
 	proxy.ServeHTTP(writer, newReq)
 }
 
+// error responds the error by the responder, which doesn't write to the
+// writer, so the status is recorded for the metrics and the audit.
+func (p *proxyHandler) error(writer *proxyResponseWriter, err error) {
+	writer.status = proxyErrorStatus(err)
+	writer.statusCode = int(writer.status.Code)
+	p.responder.Error(err)
+}
+
+// proxyErrorStatus returns the status of the API errors, or the internal
+// error status for the others.
+func proxyErrorStatus(err error) *metav1.Status {
+	var statusErr apierrors.APIStatus
+	if errors.As(err, &statusErr) {
+		status := statusErr.Status()
+		return &status
+	}
+	return &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusInternalServerError,
+		Reason:  metav1.StatusReasonUnknown,
+		Message: err.Error(),
+	}
+}
+
 type noSuppressPanicError struct{}
 
 func (noSuppressPanicError) Write(p []byte) (n int, err error) {
@@ -336,31 +417,27 @@ func (e ErrorResponderFunc) Error(w http.ResponseWriter, req *http.Request, err
 	e(w, req, err)
 }
 
-func (p *proxyHandler) getImpersonationConfig(req *http.Request) restclient.ImpersonationConfig {
+// getImpersonationConfig returns the identity impersonated in the cluster,
+// along with the source and the name of the identity exchange rule applied.
+func (p *proxyHandler) getImpersonationConfig(req *http.Request) (restclient.ImpersonationConfig, IdentityExchangeRuleSource, string, error) {
 	user, _ := request.UserFrom(req.Context())
-	if p.clusterGateway.Spec.ProxyConfig != nil {
-		matched, ruleName, projected, err := ExchangeIdentity(&p.clusterGateway.Spec.ProxyConfig.Spec.ClientIdentityExchanger, user, p.parentName)
-		if err != nil {
-			klog.Errorf("exchange identity with cluster config error: %v", err)
-		}
-		if matched {
-			klog.Infof("identity exchanged with rule `%s` in the proxy config from cluster `%s`", ruleName, p.clusterGateway.Name)
-			return *projected
-		}
+	source, ruleName, projected, err := exchangeClusterIdentity(req.Context(), p.clusterGateway, p.parentName, user, nil)
+	from := "global config"
+	if source == IdentityExchangeRuleSourceCluster {
+		from = fmt.Sprintf("cluster `%s`", p.clusterGateway.Name)
 	}
-	matched, ruleName, projected, err := ExchangeIdentity(&GlobalClusterGatewayProxyConfiguration.Spec.ClientIdentityExchanger, user, p.parentName)
 	if err != nil {
-		klog.Errorf("exchange identity with global config error: %v", err)
+		return restclient.ImpersonationConfig{}, source, ruleName, errors.Wrapf(err, "failed exchanging identity with rule `%s` in the proxy config from %s", ruleName, from)
 	}
-	if matched {
-		klog.Infof("identity exchanged with rule `%s` in the proxy config from global config", ruleName)
-		return *projected
+	if projected != nil {
+		klog.Infof("identity exchanged with rule `%s` in the proxy config from %s", ruleName, from)
+		return *projected, source, ruleName, nil
 	}
 	return restclient.ImpersonationConfig{
 		UserName: user.GetName(),
 		Groups:   user.GetGroups(),
 		Extra:    user.GetExtra(),
-	}
+	}, source, ruleName, nil
 }
 
 // NewClusterGatewayProxyRequestEscaper wrap the base http.Handler and escape
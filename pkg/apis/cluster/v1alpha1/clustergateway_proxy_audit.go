@@ -0,0 +1,131 @@
+package v1alpha1
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	restclient "k8s.io/client-go/rest"
+
+	proxyaudit "github.com/oam-dev/cluster-gateway/pkg/audit"
+)
+
+// The annotations of the audit events of the proxied requests.
+const (
+	// AuditAnnotationKeyCluster is the name of the cluster proxied to
+	AuditAnnotationKeyCluster = "cluster.core.oam.dev/cluster"
+	// AuditAnnotationKeyIdentityExchangeRule is the name of the identity
+	// exchange rule applied to the user
+	AuditAnnotationKeyIdentityExchangeRule = "cluster.core.oam.dev/identity-exchange-rule"
+	// AuditAnnotationKeyIdentityExchangeRuleSource is where the applied
+	// identity exchange rule comes from, either "Cluster" or "Global"
+	AuditAnnotationKeyIdentityExchangeRuleSource = "cluster.core.oam.dev/identity-exchange-rule-source"
+	// AuditAnnotationKeyLatency is the duration of the proxied request
+	AuditAnnotationKeyLatency = "cluster.core.oam.dev/latency"
+	// AuditAnnotationKeyResponseBytes is the size of the response body relayed
+	// from the cluster
+	AuditAnnotationKeyResponseBytes = "cluster.core.oam.dev/response-bytes"
+)
+
+// newAuditEvent returns the audit event of the proxied request, or nil if
+// the request is not audited by the policy. The bodies are not recorded, so
+// the levels above Metadata are lowered to Metadata.
+func (p *proxyHandler) newAuditEvent(req *http.Request) *auditinternal.Event {
+	if p.requestInfo == nil {
+		return nil
+	}
+	userInfo, _ := request.UserFrom(req.Context())
+	auditConfig := proxyaudit.EvaluatePolicyRule(proxyRequestAttributes(userInfo, p.requestInfo))
+	if auditConfig.Level.Less(auditinternal.LevelMetadata) ||
+		omitsAuditStage(auditConfig.OmitStages, auditinternal.StageResponseComplete) {
+		return nil
+	}
+	auditID, ok := audit.AuditIDFrom(req.Context())
+	if !ok {
+		auditID = uuid.NewUUID()
+	}
+	targetURI := &url.URL{Path: p.requestInfo.Path, RawQuery: unescapeQueryValues(req.URL.Query()).Encode()}
+	ev := &auditinternal.Event{
+		Level:                    auditinternal.LevelMetadata,
+		AuditID:                  auditID,
+		Stage:                    auditinternal.StageResponseComplete,
+		RequestURI:               targetURI.RequestURI(),
+		Verb:                     p.requestInfo.Verb,
+		UserAgent:                req.UserAgent(),
+		RequestReceivedTimestamp: metav1.NewMicroTime(p.startTime),
+		Annotations: map[string]string{
+			AuditAnnotationKeyCluster: p.parentName,
+		},
+	}
+	if userInfo != nil {
+		ev.User = toAuditUserInfo(userInfo.GetName(), userInfo.GetUID(), userInfo.GetGroups(), userInfo.GetExtra())
+	}
+	for _, ip := range utilnet.SourceIPs(req) {
+		ev.SourceIPs = append(ev.SourceIPs, ip.String())
+	}
+	if p.requestInfo.IsResourceRequest {
+		ev.ObjectRef = &auditinternal.ObjectReference{
+			Resource:    p.requestInfo.Resource,
+			Namespace:   p.requestInfo.Namespace,
+			Name:        p.requestInfo.Name,
+			APIGroup:    p.requestInfo.APIGroup,
+			APIVersion:  p.requestInfo.APIVersion,
+			Subresource: p.requestInfo.Subresource,
+		}
+	}
+	return ev
+}
+
+// setProxyAuditEventIdentity records the identity impersonated in the
+// cluster and the identity exchange rule applied.
+func setProxyAuditEventIdentity(ev *auditinternal.Event, impersonate restclient.ImpersonationConfig, source IdentityExchangeRuleSource, ruleName string) {
+	if impersonate.UserName != "" {
+		impersonated := toAuditUserInfo(impersonate.UserName, impersonate.UID, impersonate.Groups, impersonate.Extra)
+		ev.ImpersonatedUser = &impersonated
+	}
+	if ruleName != "" {
+		ev.Annotations[AuditAnnotationKeyIdentityExchangeRule] = ruleName
+		ev.Annotations[AuditAnnotationKeyIdentityExchangeRuleSource] = string(source)
+	}
+}
+
+// completeProxyAuditEvent records the response of the proxied request and
+// sends the event to the audit backend.
+func completeProxyAuditEvent(ev *auditinternal.Event, writer *proxyResponseWriter, latency time.Duration) {
+	ev.StageTimestamp = metav1.NewMicroTime(time.Now())
+	ev.ResponseStatus = writer.status
+	if ev.ResponseStatus == nil {
+		ev.ResponseStatus = &metav1.Status{Code: int32(writer.statusCode)}
+	}
+	ev.Annotations[AuditAnnotationKeyLatency] = latency.String()
+	ev.Annotations[AuditAnnotationKeyResponseBytes] = strconv.FormatInt(writer.bytes, 10)
+	proxyaudit.ProcessEvent(ev)
+}
+
+func toAuditUserInfo(name, uid string, groups []string, extra map[string][]string) authnv1.UserInfo {
+	userInfo := authnv1.UserInfo{Username: name, UID: uid, Groups: groups}
+	if len(extra) > 0 {
+		userInfo.Extra = make(map[string]authnv1.ExtraValue, len(extra))
+		for k, v := range extra {
+			userInfo.Extra[k] = v
+		}
+	}
+	return userInfo
+}
+
+func omitsAuditStage(omitStages []auditinternal.Stage, stage auditinternal.Stage) bool {
+	for _, s := range omitStages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package v1alpha1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/audit/policy"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/apiserver/plugin/pkg/audit/fake"
+	k8stesting "k8s.io/component-base/featuregate/testing"
+	"k8s.io/utils/pointer"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+
+	proxyaudit "github.com/oam-dev/cluster-gateway/pkg/audit"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/featuregates"
+)
+
+const testAuditPolicy = `
+apiVersion: audit.k8s.io/v1
+kind: Policy
+rules:
+- level: None
+  resources:
+  - group: ""
+    resources: ["secrets"]
+- level: RequestResponse
+`
+
+func TestProxyHandlerAudit(t *testing.T) {
+	endpointSvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+		_, _ = resp.Write([]byte("hello"))
+	}))
+	defer endpointSvr.Close()
+	gw := &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "audit-test"},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  endpointSvr.URL,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: "myToken",
+				},
+			},
+			ProxyConfig: &ClusterGatewayProxyConfiguration{
+				Spec: ClusterGatewayProxyConfigurationSpec{
+					ClientIdentityExchanger: ClientIdentityExchanger{Rules: []ClientIdentityExchangeRule{{
+						Name:   "external",
+						Type:   ExternalIdentityExchanger,
+						Source: &IdentityExchangerSource{User: pointer.String("tester")},
+						URL:    pointer.String("http://127.0.0.1:0"),
+					}, {
+						Name:   "group-matcher",
+						Type:   StaticMappingIdentityExchanger,
+						Source: &IdentityExchangerSource{Group: pointer.String("group")},
+						Target: &IdentityExchangerTarget{User: "local"},
+					}}},
+				},
+			},
+		},
+	}
+
+	p, err := policy.LoadPolicyFromBytes([]byte(testAuditPolicy))
+	require.NoError(t, err)
+	var events []*auditinternal.Event
+	proxyaudit.Set(&fake.Backend{OnRequest: func(evs []*auditinternal.Event) {
+		events = append(events, evs...)
+	}}, policy.NewPolicyRuleEvaluator(p))
+	defer proxyaudit.Set(nil, nil)
+
+	serve := func(userName, path string) *fakeResponder {
+		responder := &fakeResponder{}
+		ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+		ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+		handler, err := (&ClusterGatewayProxy{}).Connect(ctx, gw.Name, &ClusterGatewayProxyOptions{Path: path, Impersonate: true}, responder)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, apiPrefix+gw.Name+apiSuffix+path+"?dryRun=All", nil)
+		req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: userName, Groups: []string{"group"}}))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return responder
+	}
+
+	// the identity is exchanged and the request is recorded at Metadata level
+	responder := serve("test", "/api/v1/namespaces/default/pods/foo")
+	require.NoError(t, responder.receivingErr)
+	require.Equal(t, 1, len(events))
+	ev := events[0]
+	assert.Equal(t, auditinternal.LevelMetadata, ev.Level)
+	assert.Equal(t, auditinternal.StageResponseComplete, ev.Stage)
+	assert.Equal(t, "get", ev.Verb)
+	assert.Equal(t, "/api/v1/namespaces/default/pods/foo?dryRun=All", ev.RequestURI)
+	assert.Equal(t, "test", ev.User.Username)
+	require.NotNil(t, ev.ImpersonatedUser)
+	assert.Equal(t, "local", ev.ImpersonatedUser.Username)
+	assert.Equal(t, &auditinternal.ObjectReference{
+		Resource:   "pods",
+		Namespace:  "default",
+		Name:       "foo",
+		APIVersion: "v1",
+	}, ev.ObjectRef)
+	assert.Equal(t, int32(http.StatusOK), ev.ResponseStatus.Code)
+	assert.Equal(t, gw.Name, ev.Annotations[AuditAnnotationKeyCluster])
+	assert.Equal(t, "group-matcher", ev.Annotations[AuditAnnotationKeyIdentityExchangeRule])
+	assert.Equal(t, string(IdentityExchangeRuleSourceCluster), ev.Annotations[AuditAnnotationKeyIdentityExchangeRuleSource])
+	assert.Equal(t, "5", ev.Annotations[AuditAnnotationKeyResponseBytes])
+	assert.NotEmpty(t, ev.Annotations[AuditAnnotationKeyLatency])
+
+	// the failed identity exchange is recorded with the rule and the status
+	responder = serve("tester", "/api/v1/namespaces/default/pods/foo")
+	require.Error(t, responder.receivingErr)
+	require.Equal(t, 2, len(events))
+	ev = events[1]
+	assert.Nil(t, ev.ImpersonatedUser)
+	assert.Equal(t, "external", ev.Annotations[AuditAnnotationKeyIdentityExchangeRule])
+	assert.Equal(t, int32(http.StatusForbidden), ev.ResponseStatus.Code)
+	assert.Equal(t, metav1.StatusReasonForbidden, ev.ResponseStatus.Reason)
+
+	// the requests of the resources at None level are not recorded
+	responder = serve("test", "/api/v1/namespaces/default/secrets/foo")
+	require.NoError(t, responder.receivingErr)
+	assert.Equal(t, 2, len(events))
+
+	// the requests rejected by the subpath authorization are recorded
+	defer func(authorize bool) {
+		config.AuthorizateProxySubpath = authorize
+	}(config.AuthorizateProxySubpath)
+	config.AuthorizateProxySubpath = true
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		if a.GetResource() == "configmaps" {
+			return authorizer.DecisionNoOpinion, "", nil
+		}
+		return authorizer.DecisionAllow, "", nil
+	}
+	responder = serve("test", "/api/v1/namespaces/default/configmaps/foo")
+	require.Error(t, responder.receivingErr)
+	require.Equal(t, 3, len(events))
+	assert.Equal(t, int32(http.StatusForbidden), events[2].ResponseStatus.Code)
+	assert.Equal(t, gw.Name, events[2].Annotations[AuditAnnotationKeyCluster])
+
+	// the requests rejected upon the unhealthy cluster are recorded
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.HealthinessCheck, true)
+	gw.Status.HealthyReason = HealthyReasonTypeConnectionRefused
+	responder = serve("test", "/api/v1/namespaces/default/pods/foo")
+	require.Error(t, responder.receivingErr)
+	require.Equal(t, 4, len(events))
+	assert.Equal(t, int32(http.StatusServiceUnavailable), events[3].ResponseStatus.Code)
+}
@@ -0,0 +1,169 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/authorization/union"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	webhookutil "k8s.io/apiserver/pkg/util/webhook"
+	authorizerwebhook "k8s.io/apiserver/plugin/pkg/authorizer/webhook"
+	webhookmetrics "k8s.io/apiserver/plugin/pkg/authorizer/webhook/metrics"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+// The user extra keys carrying the identity of the cluster in the proxy
+// subpath authorization, which are sent to the authorization webhooks in the
+// SubjectAccessReview.
+const (
+	// AuthorizationExtraKeyClusterName is the name of the cluster proxied to
+	AuthorizationExtraKeyClusterName = "authorization.cluster.core.oam.dev/cluster-name"
+	// AuthorizationExtraKeyClusterLabels is the labels of the cluster proxied
+	// to, in the form of "key=value"
+	AuthorizationExtraKeyClusterLabels = "authorization.cluster.core.oam.dev/cluster-labels"
+)
+
+// ClusterScopedAPIGroupSuffix is the suffix of the synthetic API groups in
+// the cluster-scoped proxy subpath authorization.
+const ClusterScopedAPIGroupSuffix = "clusters.cluster.core.oam.dev"
+
+// ClusterScopedAPIGroup returns the synthetic API group of the resources in
+// the cluster, e.g. "apps.<cluster>.clusters.cluster.core.oam.dev", and
+// "<cluster>.clusters.cluster.core.oam.dev" for the core group. The cluster
+// names containing dots are rejected as ambiguous.
+func ClusterScopedAPIGroup(cluster, group string) string {
+	if group == "" {
+		return cluster + "." + ClusterScopedAPIGroupSuffix
+	}
+	return group + "." + cluster + "." + ClusterScopedAPIGroupSuffix
+}
+
+// ClusterScopedPath returns the non-resource path in the cluster for the
+// cluster-scoped proxy subpath authorization, e.g. "/clusters/<cluster>/healthz".
+func ClusterScopedPath(cluster, path string) string {
+	return "/clusters/" + cluster + path
+}
+
+// proxyAuthorizationWebhook is consulted before the hub, nil if not configured
+var proxyAuthorizationWebhook authorizer.Authorizer
+
+// LoadProxyAuthorizationWebhook builds the webhook authorizing the proxied
+// requests from the kubeconfig file. The webhook denies the requests upon
+// failures.
+func LoadProxyAuthorizationWebhook() error {
+	if config.ProxyAuthorizationWebhookConfigFile == "" {
+		return nil
+	}
+	cfg, err := webhookutil.LoadKubeconfig(config.ProxyAuthorizationWebhookConfigFile, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed loading proxy authorization webhook config")
+	}
+	webhook, err := authorizerwebhook.New(cfg, "v1", 0, 0, *authorizerwebhook.DefaultRetryBackoff(),
+		authorizer.DecisionDeny, nil, "proxy", webhookmetrics.NoopAuthorizerMetrics{})
+	if err != nil {
+		return errors.Wrapf(err, "failed building proxy authorization webhook")
+	}
+	proxyAuthorizationWebhook = webhook
+	return nil
+}
+
+func getProxyAuthorizer() authorizer.Authorizer {
+	if proxyAuthorizationWebhook == nil {
+		return loopback.GetAuthorizer()
+	}
+	return union.New(proxyAuthorizationWebhook, loopback.GetAuthorizer())
+}
+
+// authorizeProxyRequest authorizes the target request in the cluster with the
+// identity of the cluster.
+func authorizeProxyRequest(ctx context.Context, clusterGateway *ClusterGateway, info *request.RequestInfo) error {
+	userInfo, _ := request.UserFrom(ctx)
+	if config.AuthorizeProxySubpathClusterScoped && strings.Contains(clusterGateway.Name, ".") {
+		// the scoped API groups are ambiguous with the dots, e.g. group "x"
+		// in cluster "a.b" and group "x.a" in cluster "b"
+		return apierrors.NewForbidden(clusterGatewayGroupResource(), clusterGateway.Name,
+			errors.New("the cluster names containing dots are not supported by the cluster-scoped proxy authorization"))
+	}
+	attr := proxyAuthorizationAttributes(userInfo, clusterGateway, info)
+	decision, reason, err := authorizeWithCache(ctx, attr)
+	if err != nil {
+		return errors.Wrapf(err, "authorization failed due to %s", reason)
+	}
+	if decision != authorizer.DecisionAllow {
+		msg := fmt.Sprintf("proxying %s by user %v is forbidden", describeProxyRequest(info), userInfo.GetName())
+		if reason != "" {
+			msg += ": " + reason
+		}
+		return apierrors.NewForbidden(clusterGatewayGroupResource(), clusterGateway.Name, errors.New(msg))
+	}
+	return nil
+}
+
+// proxyAuthorizationAttributes returns the attributes of the target request
+// carrying the identity of the cluster in the user extra, and in the API group
+// or the path if the authorization is cluster-scoped.
+func proxyAuthorizationAttributes(userInfo user.Info, clusterGateway *ClusterGateway, info *request.RequestInfo) authorizer.AttributesRecord {
+	attr := proxyRequestAttributes(withClusterIdentity(userInfo, clusterGateway), info)
+	if config.AuthorizeProxySubpathClusterScoped {
+		if attr.ResourceRequest {
+			attr.APIGroup = ClusterScopedAPIGroup(clusterGateway.Name, attr.APIGroup)
+		} else {
+			attr.Path = ClusterScopedPath(clusterGateway.Name, attr.Path)
+		}
+	}
+	return attr
+}
+
+func withClusterIdentity(userInfo user.Info, clusterGateway *ClusterGateway) user.Info {
+	extra := map[string][]string{}
+	if userInfo != nil {
+		for k, v := range userInfo.GetExtra() {
+			extra[k] = v
+		}
+	}
+	labels := make([]string, 0, len(clusterGateway.Labels))
+	for k, v := range clusterGateway.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	extra[AuthorizationExtraKeyClusterName] = []string{clusterGateway.Name}
+	extra[AuthorizationExtraKeyClusterLabels] = labels
+	if userInfo == nil {
+		return &user.DefaultInfo{Extra: extra}
+	}
+	return &user.DefaultInfo{
+		Name:   userInfo.GetName(),
+		UID:    userInfo.GetUID(),
+		Groups: userInfo.GetGroups(),
+		Extra:  extra,
+	}
+}
+
+func describeProxyRequest(info *request.RequestInfo) string {
+	if !info.IsResourceRequest {
+		return fmt.Sprintf("%s %s", info.Verb, info.Path)
+	}
+	resource := info.Resource
+	if info.APIGroup != "" {
+		resource += "." + info.APIGroup
+	}
+	if info.Subresource != "" {
+		resource += "/" + info.Subresource
+	}
+	parts := []string{info.Verb, resource}
+	if info.Name != "" {
+		parts = append(parts, info.Name)
+	}
+	if info.Namespace != "" {
+		parts = append(parts, "in namespace "+info.Namespace)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,120 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/metrics"
+)
+
+var (
+	proxyAuthorizationCache     *cache.LRUExpireCache
+	proxyAuthorizationCacheOnce sync.Once
+)
+
+func getProxyAuthorizationCache() *cache.LRUExpireCache {
+	proxyAuthorizationCacheOnce.Do(func() {
+		proxyAuthorizationCache = cache.NewLRUExpireCache(config.ProxyAuthorizationCacheSize)
+	})
+	return proxyAuthorizationCache
+}
+
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type cachedProxyAuthorizationDecision struct {
+	decision authorizer.Decision
+	reason   string
+}
+
+// proxyAuthorizationCacheKey is the full tuple of the attributes, including
+// the user extra carrying the identity of the cluster
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type proxyAuthorizationCacheKey struct {
+	User            string              `json:"u"`
+	UID             string              `json:"uid,omitempty"`
+	Groups          []string            `json:"g,omitempty"`
+	Extra           map[string][]string `json:"e,omitempty"`
+	Verb            string              `json:"v"`
+	ResourceRequest bool                `json:"rr"`
+	APIGroup        string              `json:"ag,omitempty"`
+	APIVersion      string              `json:"av,omitempty"`
+	Resource        string              `json:"r,omitempty"`
+	Subresource     string              `json:"sr,omitempty"`
+	Namespace       string              `json:"ns,omitempty"`
+	Name            string              `json:"n,omitempty"`
+	Path            string              `json:"p,omitempty"`
+}
+
+func newProxyAuthorizationCacheKey(attr authorizer.AttributesRecord) (string, error) {
+	key := proxyAuthorizationCacheKey{
+		Verb:            attr.Verb,
+		ResourceRequest: attr.ResourceRequest,
+		APIGroup:        attr.APIGroup,
+		APIVersion:      attr.APIVersion,
+		Resource:        attr.Resource,
+		Subresource:     attr.Subresource,
+		Namespace:       attr.Namespace,
+		Name:            attr.Name,
+		Path:            attr.Path,
+	}
+	if attr.User != nil {
+		key.User = attr.User.GetName()
+		key.UID = attr.User.GetUID()
+		key.Groups = attr.User.GetGroups()
+		key.Extra = attr.User.GetExtra()
+	}
+	data, err := json.Marshal(key)
+	return string(data), err
+}
+
+// authorizeWithCache authorizes the attributes by the cached decision, or by
+// the authorizers upon cache miss. The allowed and the other decisions are
+// cached by the separate TTLs, while the errors are never cached.
+func authorizeWithCache(ctx context.Context, attr authorizer.AttributesRecord) (authorizer.Decision, string, error) {
+	cacheEnabled := config.ProxyAuthorizationCacheAllowTTL > 0 || config.ProxyAuthorizationCacheDenyTTL > 0
+	var key string
+	if cacheEnabled {
+		var err error
+		if key, err = newProxyAuthorizationCacheKey(attr); err != nil {
+			return authorizer.DecisionNoOpinion, "", err
+		}
+		if cached, ok := getProxyAuthorizationCache().Get(key); ok {
+			d := cached.(cachedProxyAuthorizationDecision)
+			metrics.RecordProxyAuthorizationCacheHit(decisionString(d.decision))
+			return d.decision, d.reason, nil
+		}
+		metrics.RecordProxyAuthorizationCacheMiss()
+	}
+
+	ts := time.Now()
+	decision, reason, err := getProxyAuthorizer().Authorize(ctx, attr)
+	metrics.RecordClusterEscalationAccessReviewDuration(err == nil, time.Since(ts))
+	if err != nil || !cacheEnabled {
+		return decision, reason, err
+	}
+	ttl := config.ProxyAuthorizationCacheDenyTTL
+	if decision == authorizer.DecisionAllow {
+		ttl = config.ProxyAuthorizationCacheAllowTTL
+	}
+	if ttl > 0 {
+		getProxyAuthorizationCache().Add(key, cachedProxyAuthorizationDecision{decision: decision, reason: reason}, ttl)
+	}
+	return decision, reason, nil
+}
+
+func decisionString(decision authorizer.Decision) string {
+	switch decision {
+	case authorizer.DecisionAllow:
+		return "allow"
+	case authorizer.DecisionDeny:
+		return "deny"
+	}
+	return "no-opinion"
+}
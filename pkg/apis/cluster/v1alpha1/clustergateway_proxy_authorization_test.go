@@ -0,0 +1,213 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+func TestClusterScopedAPIGroup(t *testing.T) {
+	assert.Equal(t, "dev.clusters.cluster.core.oam.dev", ClusterScopedAPIGroup("dev", ""))
+	assert.Equal(t, "apps.dev.clusters.cluster.core.oam.dev", ClusterScopedAPIGroup("dev", "apps"))
+	assert.Equal(t, "/clusters/dev/healthz", ClusterScopedPath("dev", "/healthz"))
+}
+
+// testHubAuthorizer is the delegated authorizer of the hub in the tests
+var testHubAuthorizer authorizer.AuthorizerFunc
+
+func init() {
+	loopback.SetAuthorizer(authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		return testHubAuthorizer(ctx, a)
+	}))
+}
+
+// newTestAuthorizationWebhook allows the deployments only in the clusters
+// labelled env=dev, and has no opinion on the other resources.
+func newTestAuthorizationWebhook(t *testing.T) string {
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sar := &authorizationv1.SubjectAccessReview{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(sar))
+		attrs := sar.Spec.ResourceAttributes
+		if attrs != nil && attrs.Resource == "deployments" {
+			cluster := sar.Spec.Extra[AuthorizationExtraKeyClusterName]
+			if sets.NewString(sar.Spec.Extra[AuthorizationExtraKeyClusterLabels]...).Has("env=dev") {
+				sar.Status.Allowed = true
+			} else {
+				sar.Status.Denied = true
+				sar.Status.Reason = fmt.Sprintf("cluster %v is not labelled env=dev", cluster)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(sar)
+	}))
+	t.Cleanup(svr.Close)
+	kubeconfig := filepath.Join(t.TempDir(), "webhook.kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(fmt.Sprintf(`
+apiVersion: v1
+kind: Config
+clusters:
+- name: webhook
+  cluster:
+    server: %s
+    insecure-skip-tls-verify: true
+users:
+- name: gateway
+contexts:
+- name: webhook
+  context:
+    cluster: webhook
+    user: gateway
+current-context: webhook
+`, svr.URL)), 0600))
+	return kubeconfig
+}
+
+func TestAuthorizeProxyRequest(t *testing.T) {
+	defer func(scoped bool, webhook string, allowTTL, denyTTL time.Duration) {
+		config.AuthorizeProxySubpathClusterScoped = scoped
+		config.ProxyAuthorizationWebhookConfigFile = webhook
+		config.ProxyAuthorizationCacheAllowTTL, config.ProxyAuthorizationCacheDenyTTL = allowTTL, denyTTL
+		proxyAuthorizationWebhook = nil
+	}(config.AuthorizeProxySubpathClusterScoped, config.ProxyAuthorizationWebhookConfigFile,
+		config.ProxyAuthorizationCacheAllowTTL, config.ProxyAuthorizationCacheDenyTTL)
+	config.ProxyAuthorizationCacheAllowTTL, config.ProxyAuthorizationCacheDenyTTL = 0, 0
+
+	// the hub allows listing pods only in the dev cluster
+	var hubAttrs []authorizer.Attributes
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		hubAttrs = append(hubAttrs, a)
+		if a.GetVerb() == "list" && a.GetResource() == "pods" && a.GetAPIGroup() == ClusterScopedAPIGroup("dev", "") {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+	dev := &ClusterGateway{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"env": "dev"}}}
+	prod := &ClusterGateway{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}}}
+	ctx := request.WithUser(context.TODO(), &user.DefaultInfo{Name: "x", Groups: []string{"g"}, Extra: map[string][]string{"k": {"v"}}})
+	pods := &request.RequestInfo{IsResourceRequest: true, Verb: "list", APIVersion: "v1", Resource: "pods", Namespace: "default"}
+	deployments := &request.RequestInfo{IsResourceRequest: true, Verb: "list", APIGroup: "apps", APIVersion: "v1", Resource: "deployments"}
+
+	// the cluster is carried in the user extra regardless of the scope
+	config.AuthorizeProxySubpathClusterScoped = false
+	err := authorizeProxyRequest(ctx, dev, pods)
+	assert.True(t, apierrors.IsForbidden(err), "unexpected error: %v", err)
+	require.Equal(t, 1, len(hubAttrs))
+	assert.Equal(t, "", hubAttrs[0].GetAPIGroup())
+	assert.Equal(t, "x", hubAttrs[0].GetUser().GetName())
+	assert.Equal(t, map[string][]string{
+		"k":                                {"v"},
+		AuthorizationExtraKeyClusterName:   {"dev"},
+		AuthorizationExtraKeyClusterLabels: {"env=dev"},
+	}, hubAttrs[0].GetUser().GetExtra())
+
+	// the RBAC of the hub grants per-cluster access with the scoped API group
+	config.AuthorizeProxySubpathClusterScoped = true
+	assert.NoError(t, authorizeProxyRequest(ctx, dev, pods))
+	assert.True(t, apierrors.IsForbidden(authorizeProxyRequest(ctx, prod, pods)))
+	assert.Equal(t, ClusterScopedAPIGroup("prod", ""), hubAttrs[len(hubAttrs)-1].GetAPIGroup())
+	hubAttrs = nil
+	dotted := &ClusterGateway{ObjectMeta: metav1.ObjectMeta{Name: "a.dev"}}
+	assert.True(t, apierrors.IsForbidden(authorizeProxyRequest(ctx, dotted, pods)))
+	assert.Empty(t, hubAttrs)
+	assert.True(t, apierrors.IsForbidden(authorizeProxyRequest(ctx, dev, &request.RequestInfo{Verb: "get", Path: "/healthz"})))
+	require.Equal(t, 1, len(hubAttrs))
+	assert.Equal(t, "/clusters/dev/healthz", hubAttrs[0].GetPath())
+
+	// the webhook decides before the hub
+	config.ProxyAuthorizationWebhookConfigFile = newTestAuthorizationWebhook(t)
+	require.NoError(t, LoadProxyAuthorizationWebhook())
+	hubAttrs = nil
+	assert.NoError(t, authorizeProxyRequest(ctx, dev, deployments))
+	err = authorizeProxyRequest(ctx, prod, deployments)
+	require.True(t, apierrors.IsForbidden(err), "unexpected error: %v", err)
+	assert.Contains(t, err.Error(), "cluster [prod] is not labelled env=dev")
+	assert.Empty(t, hubAttrs)
+	assert.NoError(t, authorizeProxyRequest(ctx, dev, pods))
+	assert.Equal(t, 1, len(hubAttrs))
+}
+
+func TestAuthorizeWithCache(t *testing.T) {
+	defer func(allowTTL, denyTTL time.Duration) {
+		config.ProxyAuthorizationCacheAllowTTL, config.ProxyAuthorizationCacheDenyTTL = allowTTL, denyTTL
+		getProxyAuthorizationCache().RemoveAll(func(any) bool { return true })
+	}(config.ProxyAuthorizationCacheAllowTTL, config.ProxyAuthorizationCacheDenyTTL)
+	config.ProxyAuthorizationCacheAllowTTL, config.ProxyAuthorizationCacheDenyTTL = time.Minute, 100*time.Millisecond
+
+	reviews := 0
+	failing := false
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		reviews++
+		if failing {
+			return authorizer.DecisionNoOpinion, "", fmt.Errorf("hub unavailable")
+		}
+		if a.GetName() == "allowed" {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionNoOpinion, "not allowed", nil
+	}
+	attr := func(name string, extra map[string][]string) authorizer.AttributesRecord {
+		return authorizer.AttributesRecord{
+			User:            &user.DefaultInfo{Name: "x", Extra: extra},
+			Verb:            "get",
+			ResourceRequest: true,
+			Resource:        "pods",
+			Name:            name,
+		}
+	}
+	dev := map[string][]string{AuthorizationExtraKeyClusterName: {"dev"}}
+	prod := map[string][]string{AuthorizationExtraKeyClusterName: {"prod"}}
+
+	// the allowed decision is cached for the tuple including the cluster
+	for i := 0; i < 3; i++ {
+		decision, _, err := authorizeWithCache(context.TODO(), attr("allowed", dev))
+		require.NoError(t, err)
+		assert.Equal(t, authorizer.DecisionAllow, decision)
+	}
+	assert.Equal(t, 1, reviews)
+	_, _, err := authorizeWithCache(context.TODO(), attr("allowed", prod))
+	require.NoError(t, err)
+	assert.Equal(t, 2, reviews)
+
+	// the denied decision is cached with the reason by its own TTL
+	for i := 0; i < 2; i++ {
+		decision, reason, err := authorizeWithCache(context.TODO(), attr("denied", dev))
+		require.NoError(t, err)
+		assert.Equal(t, authorizer.DecisionNoOpinion, decision)
+		assert.Equal(t, "not allowed", reason)
+	}
+	assert.Equal(t, 3, reviews)
+	time.Sleep(200 * time.Millisecond)
+	_, _, err = authorizeWithCache(context.TODO(), attr("denied", dev))
+	require.NoError(t, err)
+	assert.Equal(t, 4, reviews)
+
+	// the errors are not cached
+	failing = true
+	for i := 0; i < 2; i++ {
+		_, _, err = authorizeWithCache(context.TODO(), attr("other", dev))
+		require.Error(t, err)
+	}
+	assert.Equal(t, 6, reviews)
+	decision, _, err := authorizeWithCache(context.TODO(), attr("allowed", dev))
+	require.NoError(t, err)
+	assert.Equal(t, authorizer.DecisionAllow, decision)
+	assert.Equal(t, 6, reviews)
+}
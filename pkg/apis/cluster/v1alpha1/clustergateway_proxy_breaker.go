@@ -0,0 +1,265 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	multicluster "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/transport"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/metrics"
+)
+
+// +k8s:openapi-gen=false
+type circuitState int
+
+const (
+	// circuitClosed lets the proxied requests through.
+	circuitClosed circuitState = iota
+	// circuitOpen rejects the proxied requests until the open duration
+	// elapses.
+	circuitOpen
+	// circuitHalfOpen lets a single trial request through, which closes the
+	// circuit if succeeded or opens it again if failed.
+	circuitHalfOpen
+)
+
+const (
+	rejectedReasonUnhealthy   = "Unhealthy"
+	rejectedReasonCircuitOpen = "CircuitOpen"
+)
+
+// clusterCircuitBreakers holds the circuit breakers of the clusters by name.
+var clusterCircuitBreakers sync.Map
+
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type clusterCircuitBreaker struct {
+	cluster string
+	now     func() time.Time
+
+	mu                  sync.Mutex
+	state               circuitState
+	windowStart         time.Time
+	requests            int
+	failures            int
+	consecutiveFailures int
+	openedAt            time.Time
+	trialStart          time.Time
+	trialInFlight       bool
+}
+
+func circuitBreakerEnabled() bool {
+	return config.ProxyCircuitBreakerConsecutiveFailures > 0 || config.ProxyCircuitBreakerFailureRatio > 0
+}
+
+func getClusterCircuitBreaker(cluster string) *clusterCircuitBreaker {
+	if cb, ok := clusterCircuitBreakers.Load(cluster); ok {
+		return cb.(*clusterCircuitBreaker)
+	}
+	cb, _ := clusterCircuitBreakers.LoadOrStore(cluster, newClusterCircuitBreaker(cluster, time.Now))
+	return cb.(*clusterCircuitBreaker)
+}
+
+// evictClusterCircuitBreaker removes the circuit breaker of the removed
+// cluster.
+func evictClusterCircuitBreaker(cluster string) {
+	clusterCircuitBreakers.Delete(cluster)
+}
+
+func newClusterCircuitBreaker(cluster string, now func() time.Time) *clusterCircuitBreaker {
+	return &clusterCircuitBreaker{cluster: cluster, now: now, windowStart: now()}
+}
+
+// allow checks whether the proxied request can be let through. The trial
+// request in the half-open state is returned as true, and its outcome must be
+// recorded or released. Otherwise, returns the remaining open duration.
+func (cb *clusterCircuitBreaker) allow() (trial bool, retryAfter time.Duration, ok bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := cb.now()
+	switch cb.state {
+	case circuitOpen:
+		if elapsed := now.Sub(cb.openedAt); elapsed < config.ProxyCircuitBreakerOpenDuration {
+			return false, config.ProxyCircuitBreakerOpenDuration - elapsed, false
+		}
+		cb.setState(circuitHalfOpen)
+		fallthrough
+	case circuitHalfOpen:
+		// the trial request is abandoned if not finished within the open
+		// duration, e.g. hanging upon the response headers, and another one is let
+		// through
+		if cb.trialInFlight && now.Sub(cb.trialStart) < config.ProxyCircuitBreakerOpenDuration {
+			return false, config.ProxyCircuitBreakerOpenDuration - now.Sub(cb.trialStart), false
+		}
+		cb.trialInFlight = true
+		cb.trialStart = now
+		return true, 0, true
+	}
+	return false, 0, true
+}
+
+// record counts the outcome of the proxied request and trips the circuit if
+// the thresholds are reached.
+func (cb *clusterCircuitBreaker) record(trial bool, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := cb.now()
+	switch cb.state {
+	case circuitHalfOpen:
+		if !trial {
+			return
+		}
+		cb.trialInFlight = false
+		if failed {
+			cb.trip(now)
+			return
+		}
+		cb.reset(now)
+		cb.setState(circuitClosed)
+	case circuitClosed:
+		if trial {
+			return
+		}
+		if now.Sub(cb.windowStart) >= config.ProxyCircuitBreakerWindow {
+			cb.windowStart = now
+			cb.requests, cb.failures = 0, 0
+		}
+		cb.requests++
+		if !failed {
+			cb.consecutiveFailures = 0
+			return
+		}
+		cb.failures++
+		cb.consecutiveFailures++
+		if config.ProxyCircuitBreakerConsecutiveFailures > 0 && cb.consecutiveFailures >= config.ProxyCircuitBreakerConsecutiveFailures {
+			cb.trip(now)
+			return
+		}
+		if config.ProxyCircuitBreakerFailureRatio > 0 && cb.requests >= config.ProxyCircuitBreakerMinRequests &&
+			float64(cb.failures)/float64(cb.requests) >= config.ProxyCircuitBreakerFailureRatio {
+			cb.trip(now)
+		}
+	}
+}
+
+// release gives up the trial request without an outcome, e.g. cancelled by
+// the client.
+func (cb *clusterCircuitBreaker) release(trial bool) {
+	if !trial {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == circuitHalfOpen {
+		cb.trialInFlight = false
+	}
+}
+
+func (cb *clusterCircuitBreaker) trip(now time.Time) {
+	cb.reset(now)
+	cb.openedAt = now
+	cb.setState(circuitOpen)
+}
+
+func (cb *clusterCircuitBreaker) reset(now time.Time) {
+	cb.windowStart = now
+	cb.requests, cb.failures, cb.consecutiveFailures = 0, 0, 0
+	cb.trialInFlight = false
+}
+
+func (cb *clusterCircuitBreaker) setState(state circuitState) {
+	cb.state = state
+	metrics.RecordClusterCircuitBreakerState(cb.cluster, int(state))
+}
+
+// roundTripper records the outcomes of the requests through the delegate,
+// the transport errors, e.g. dialing and TLS handshake failures, and the
+// gateway errors are considered failures.
+func (cb *clusterCircuitBreaker) roundTripper(trial bool, delegate http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := delegate.RoundTrip(req)
+		switch {
+		case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+			cb.release(trial)
+		case err != nil:
+			cb.record(trial, true)
+		default:
+			cb.record(trial, isClusterFailureStatus(resp.StatusCode))
+		}
+		return resp, err
+	})
+}
+
+// isClusterFailureStatus returns true if the response status tells the
+// cluster is unreachable or overloaded. The other 5xx responses, e.g. from a
+// broken aggregated API or admission webhook, are specific to the requests and
+// don't trip the circuit of the whole cluster.
+func isClusterFailureStatus(code int) bool {
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isClusterUnhealthy returns true if the cluster is reported unhealthy by the
+// health checks. The clusters never checked are not considered unhealthy.
+func isClusterUnhealthy(cluster *ClusterGateway) bool {
+	return !cluster.Status.Healthy && (cluster.Status.LastProbeTime != nil || len(cluster.Status.HealthyReason) > 0)
+}
+
+// isHealthProbeRequest returns true if the request is marked as the health
+// probe, and the requester is allowed to update the healthiness of the cluster
+// so that the mark can't be abused to bypass the health checks.
+func isHealthProbeRequest(req *http.Request, cluster *ClusterGateway) bool {
+	if req.Header.Get(multicluster.HealthProbeHeader) != "true" {
+		return false
+	}
+	userInfo, ok := request.UserFrom(req.Context())
+	if !ok {
+		return false
+	}
+	return authorizeClusterGatewayAccess(req.Context(), userInfo, "update", "health", cluster.Name) == nil
+}
+
+// newServiceUnavailable returns the 503 error carrying the Retry-After
+// duration, which is written to the header by the responder.
+func newServiceUnavailable(name string, message string, retryAfter time.Duration) *apierrors.StatusError {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusServiceUnavailable,
+		Reason:  metav1.StatusReasonServiceUnavailable,
+		Message: message,
+		Details: &metav1.StatusDetails{
+			Name:              name,
+			Group:             clusterGatewayGroupResource().Group,
+			Kind:              clusterGatewayGroupResource().Resource,
+			RetryAfterSeconds: int32(math.Ceil(retryAfter.Seconds())),
+		},
+	}}
+}
+
+func newClusterUnhealthyError(cluster *ClusterGateway) *apierrors.StatusError {
+	msg := fmt.Sprintf("cluster %s is unhealthy", cluster.Name)
+	if len(cluster.Status.HealthyReason) > 0 {
+		msg = fmt.Sprintf("%s: %s", msg, cluster.Status.HealthyReason)
+	}
+	if cond := meta.FindStatusCondition(cluster.Status.Conditions, ClusterGatewayConditionHealthy); cond != nil && len(cond.Message) > 0 {
+		msg = fmt.Sprintf("%s, %s", msg, cond.Message)
+	}
+	return newServiceUnavailable(cluster.Name, msg, config.ProxyUnhealthyRetryAfter)
+}
+
+func newCircuitOpenError(cluster string, retryAfter time.Duration) *apierrors.StatusError {
+	return newServiceUnavailable(cluster, fmt.Sprintf("circuit breaker of cluster %s is open after failed requests", cluster), retryAfter)
+}
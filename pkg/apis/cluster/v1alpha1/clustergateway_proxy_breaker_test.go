@@ -0,0 +1,279 @@
+package v1alpha1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/util/feature"
+	k8stesting "k8s.io/component-base/featuregate/testing"
+	"k8s.io/utils/pointer"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+
+	multicluster "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/transport"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/featuregates"
+)
+
+func TestClusterCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	cb := newClusterCircuitBreaker("c1", func() time.Time { return now })
+
+	// tripped by consecutive failures
+	for i := 0; i < config.ProxyCircuitBreakerConsecutiveFailures; i++ {
+		trial, _, ok := cb.allow()
+		require.True(t, ok)
+		require.False(t, trial)
+		cb.record(false, true)
+	}
+	_, retryAfter, ok := cb.allow()
+	assert.False(t, ok)
+	assert.Equal(t, config.ProxyCircuitBreakerOpenDuration, retryAfter)
+	now = now.Add(config.ProxyCircuitBreakerOpenDuration / 3)
+	_, retryAfter, ok = cb.allow()
+	assert.False(t, ok)
+	assert.Equal(t, config.ProxyCircuitBreakerOpenDuration*2/3, retryAfter)
+
+	// half-open lets a single trial request through
+	now = now.Add(config.ProxyCircuitBreakerOpenDuration)
+	trial, _, ok := cb.allow()
+	assert.True(t, ok)
+	assert.True(t, trial)
+	_, _, ok = cb.allow()
+	assert.False(t, ok)
+	cb.record(false, false)
+	assert.Equal(t, circuitHalfOpen, cb.state)
+
+	// failed trial opens the circuit again
+	cb.record(true, true)
+	assert.Equal(t, circuitOpen, cb.state)
+	_, _, ok = cb.allow()
+	assert.False(t, ok)
+
+	// released trial lets another one through
+	now = now.Add(config.ProxyCircuitBreakerOpenDuration)
+	trial, _, _ = cb.allow()
+	cb.release(trial)
+	trial, _, ok = cb.allow()
+	assert.True(t, ok)
+	assert.True(t, trial)
+
+	// succeeded trial closes the circuit
+	cb.record(true, false)
+	assert.Equal(t, circuitClosed, cb.state)
+	trial, _, ok = cb.allow()
+	assert.True(t, ok)
+	assert.False(t, trial)
+
+	// tripped by failure ratio
+	for i := 0; i < config.ProxyCircuitBreakerMinRequests; i++ {
+		cb.record(false, i%2 == 1)
+	}
+	assert.Equal(t, circuitOpen, cb.state)
+
+	// failure ratio is counted within the window
+	now = now.Add(config.ProxyCircuitBreakerOpenDuration)
+	trial, _, _ = cb.allow()
+	cb.record(trial, false)
+	for i := 0; i < config.ProxyCircuitBreakerMinRequests; i++ {
+		if i == config.ProxyCircuitBreakerMinRequests/2 {
+			now = now.Add(config.ProxyCircuitBreakerWindow)
+		}
+		cb.record(false, i%2 == 1)
+	}
+	assert.Equal(t, circuitClosed, cb.state)
+}
+
+func TestProxyHandlerCircuitBreaker(t *testing.T) {
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.HealthinessCheck, true)
+	code := http.StatusBadGateway
+	endpointSvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(code)
+	}))
+	defer endpointSvr.Close()
+	gw := &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "breaker-test"},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  endpointSvr.URL,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: "myToken",
+				},
+			},
+		},
+	}
+	defer clusterCircuitBreakers.Delete(gw.Name)
+
+	serve := func() (*httptest.ResponseRecorder, *fakeResponder) {
+		responder := &fakeResponder{}
+		ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+		ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+		handler, err := (&ClusterGatewayProxy{}).Connect(ctx, gw.Name, &ClusterGatewayProxyOptions{Path: "/abc"}, responder)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, apiPrefix+gw.Name+apiSuffix+"/abc", nil)
+		handler.ServeHTTP(recorder, req)
+		return recorder, responder
+	}
+
+	// the errors specific to the requests don't trip the circuit
+	code = http.StatusInternalServerError
+	for i := 0; i < 2*config.ProxyCircuitBreakerConsecutiveFailures; i++ {
+		recorder, responder := serve()
+		require.NoError(t, responder.receivingErr)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	}
+
+	code = http.StatusBadGateway
+	for i := 0; i < config.ProxyCircuitBreakerConsecutiveFailures; i++ {
+		recorder, responder := serve()
+		require.NoError(t, responder.receivingErr)
+		assert.Equal(t, http.StatusBadGateway, recorder.Code)
+	}
+	_, responder := serve()
+	require.Error(t, responder.receivingErr)
+	assert.True(t, apierrors.IsServiceUnavailable(responder.receivingErr))
+	retryAfter, ok := apierrors.SuggestsClientDelay(responder.receivingErr)
+	assert.True(t, ok)
+	assert.Equal(t, int(config.ProxyCircuitBreakerOpenDuration.Seconds()), retryAfter)
+}
+
+// newHealthTestCluster returns the unhealthy cluster proxying to the endpoint
+func newHealthTestCluster(name string, handler http.HandlerFunc, t *testing.T) *ClusterGateway {
+	endpointSvr := httptest.NewTLSServer(handler)
+	t.Cleanup(endpointSvr.Close)
+	return &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  endpointSvr.URL,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: "myToken",
+				},
+			},
+		},
+		Status: ClusterGatewayStatus{
+			Healthy:       false,
+			HealthyReason: "healthz: connection refused",
+		},
+	}
+}
+
+// serveHealthTestCluster proxies the request to "/healthz" of the cluster by
+// the user, optionally marked as the health probe.
+func serveHealthTestCluster(t *testing.T, gw *ClusterGateway, userInfo user.Info, probe bool) (*httptest.ResponseRecorder, *fakeResponder) {
+	responder := &fakeResponder{}
+	ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+	ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+	handler, err := (&ClusterGatewayProxy{}).Connect(ctx, gw.Name, &ClusterGatewayProxyOptions{Path: "/healthz"}, responder)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, apiPrefix+gw.Name+apiSuffix+"/healthz", nil)
+	req = req.WithContext(request.WithUser(req.Context(), userInfo))
+	if probe {
+		req.Header.Set(multicluster.HealthProbeHeader, "true")
+	}
+	handler.ServeHTTP(recorder, req)
+	return recorder, responder
+}
+
+func TestProxyUnhealthyCluster(t *testing.T) {
+	gw := newHealthTestCluster("c1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}, t)
+	userInfo := &user.DefaultInfo{Name: "x"}
+
+	// not enforced without the feature gate
+	recorder, responder := serveHealthTestCluster(t, gw, userInfo, false)
+	require.NoError(t, responder.receivingErr)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.HealthinessCheck, true)
+	_, responder = serveHealthTestCluster(t, gw, userInfo, false)
+	err := responder.receivingErr
+	require.Error(t, err)
+	assert.True(t, apierrors.IsServiceUnavailable(err))
+	assert.Equal(t, "cluster c1 is unhealthy: healthz: connection refused", err.Error())
+	retryAfter, ok := apierrors.SuggestsClientDelay(err)
+	assert.True(t, ok)
+	assert.Equal(t, int(config.ProxyUnhealthyRetryAfter.Seconds()), retryAfter)
+
+	// never checked clusters are not rejected
+	gw.Status.HealthyReason = ""
+	recorder, responder = serveHealthTestCluster(t, gw, userInfo, false)
+	require.NoError(t, responder.receivingErr)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestProxyHealthProbeRecovery(t *testing.T) {
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.HealthinessCheck, true)
+	// only the prober is allowed to update the healthiness
+	testHubAuthorizer = func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		if a.GetSubresource() == "health" && a.GetVerb() == "update" && a.GetUser().GetName() != "prober" {
+			return authorizer.DecisionNoOpinion, "", nil
+		}
+		return authorizer.DecisionAllow, "", nil
+	}
+	var receivedProbeHeader string
+	gw := newHealthTestCluster("probe-test", func(w http.ResponseWriter, r *http.Request) {
+		receivedProbeHeader = r.Header.Get(multicluster.HealthProbeHeader)
+		_, _ = w.Write([]byte("ok"))
+	}, t)
+	now := time.Now()
+	cb := newClusterCircuitBreaker(gw.Name, func() time.Time { return now })
+	cb.trip(now)
+	clusterCircuitBreakers.Store(gw.Name, cb)
+	defer clusterCircuitBreakers.Delete(gw.Name)
+	userInfo, prober := &user.DefaultInfo{Name: "x"}, &user.DefaultInfo{Name: "prober"}
+
+	// the unhealthy cluster rejects the requests, including the marked ones
+	// from the users not allowed to update the healthiness
+	for _, probe := range []bool{false, true} {
+		_, responder := serveHealthTestCluster(t, gw, userInfo, probe)
+		require.Error(t, responder.receivingErr)
+		assert.True(t, apierrors.IsServiceUnavailable(responder.receivingErr))
+	}
+
+	// the probes reach the cluster regardless of the health and the circuit,
+	// without the mark forwarded
+	recorder, responder := serveHealthTestCluster(t, gw, prober, true)
+	require.NoError(t, responder.receivingErr)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+	assert.Empty(t, receivedProbeHeader)
+	assert.Equal(t, circuitOpen, cb.state)
+
+	// the cluster recovers after reported healthy by the probes, and the
+	// circuit closes upon the trial request
+	gw.Status.Healthy, gw.Status.HealthyReason = true, ""
+	_, responder = serveHealthTestCluster(t, gw, userInfo, false)
+	require.Error(t, responder.receivingErr)
+	now = now.Add(config.ProxyCircuitBreakerOpenDuration)
+	recorder, responder = serveHealthTestCluster(t, gw, userInfo, false)
+	require.NoError(t, responder.receivingErr)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, circuitClosed, cb.state)
+}
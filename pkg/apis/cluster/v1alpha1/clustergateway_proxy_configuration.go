@@ -17,14 +17,19 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"regexp"
+	"sync"
+	"sync/atomic"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/client-go/rest"
+	"k8s.io/utils/lru"
 	"k8s.io/utils/strings/slices"
 
 	"github.com/oam-dev/cluster-gateway/pkg/config"
@@ -34,6 +39,16 @@ const (
 	AnnotationClusterGatewayProxyConfiguration = "cluster.core.oam.dev/cluster-gateway-proxy-configuration"
 )
 
+// the reasons of the ProxyConfigurationValid condition
+const (
+	proxyConfigurationConditionReasonValid   = "Valid"
+	proxyConfigurationConditionReasonInvalid = "InvalidProxyConfiguration"
+)
+
+// identityPatternCacheSize bounds the compiled patterns cached, as the
+// patterns of the clusters are read from the secrets
+const identityPatternCacheSize = 1024
+
 type ClusterGatewayProxyConfiguration struct {
 	metav1.TypeMeta `json:",inline"`
 	Spec            ClusterGatewayProxyConfigurationSpec `json:"spec"`
@@ -62,6 +77,24 @@ type ClientIdentityExchangeRule struct {
 
 	Target *IdentityExchangerTarget `json:"target,omitempty"`
 	URL    *string                  `json:"url,omitempty"`
+	// External configures the requests to the URL of the ExternalIdentityExchanger
+	External *IdentityExchangerExternal `json:"external,omitempty"`
+}
+
+type IdentityExchangerExternal struct {
+	// CAFile is the path to the CA for verifying the external exchanger
+	CAFile string `json:"caFile,omitempty"`
+	// CertFile and KeyFile are the paths to the client certificate presented
+	// to the external exchanger
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// InsecureSkipTLSVerify skips verifying the external exchanger
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+	// Timeout of the requests to the external exchanger, defaults to 10s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// CacheTTL is how long the exchanged identities are cached, the responses
+	// are not cached if unset
+	CacheTTL *metav1.Duration `json:"cacheTTL,omitempty"`
 }
 
 type IdentityExchangerTarget struct {
@@ -81,29 +114,106 @@ type IdentityExchangerSource struct {
 	ClusterPattern *string `json:"clusterPattern,omitempty"`
 }
 
+var globalClusterGatewayProxyConfiguration atomic.Pointer[ClusterGatewayProxyConfiguration]
+
+// GlobalClusterGatewayProxyConfiguration mirrors the global proxy
+// configuration upon SetGlobalClusterGatewayProxyConfiguration.
+//
+// Deprecated: use GetGlobalClusterGatewayProxyConfiguration and
+// SetGlobalClusterGatewayProxyConfiguration, reading the variable races with
+// the reloads, and assigning it takes no effect.
 var GlobalClusterGatewayProxyConfiguration = &ClusterGatewayProxyConfiguration{}
 
+// globalClusterGatewayProxyConfigurationLock serializes the updates of the
+// deprecated GlobalClusterGatewayProxyConfiguration
+var globalClusterGatewayProxyConfigurationLock sync.Mutex
+
+func init() {
+	globalClusterGatewayProxyConfiguration.Store(GlobalClusterGatewayProxyConfiguration)
+}
+
+// GetGlobalClusterGatewayProxyConfiguration returns the proxy configuration
+// loaded from --cluster-gateway-proxy-config. The returned configuration must
+// not be modified.
+func GetGlobalClusterGatewayProxyConfiguration() *ClusterGatewayProxyConfiguration {
+	return globalClusterGatewayProxyConfiguration.Load()
+}
+
+// SetGlobalClusterGatewayProxyConfiguration replaces the global proxy
+// configuration.
+func SetGlobalClusterGatewayProxyConfiguration(cfg *ClusterGatewayProxyConfiguration) {
+	globalClusterGatewayProxyConfigurationLock.Lock()
+	defer globalClusterGatewayProxyConfigurationLock.Unlock()
+	globalClusterGatewayProxyConfiguration.Store(cfg)
+	GlobalClusterGatewayProxyConfiguration = cfg
+}
+
 func LoadGlobalClusterGatewayProxyConfig() error {
 	if config.ClusterGatewayProxyConfigPath == "" {
 		return nil
 	}
-	bs, err := os.ReadFile(config.ClusterGatewayProxyConfigPath)
-	if err != nil {
-		return err
-	}
-	return yaml.Unmarshal(bs, GlobalClusterGatewayProxyConfiguration)
+	return ReloadGlobalClusterGatewayProxyConfig()
 }
 
+// ExchangeIdentity exchanges the identity with the rules in order.
+//
+// Deprecated: use ExchangeIdentityWithContext, the requests to the
+// ExternalIdentityExchanger are not cancelled along with the callers.
 func ExchangeIdentity(exchanger *ClientIdentityExchanger, userInfo user.Info, cluster string) (matched bool, ruleName string, projected *rest.ImpersonationConfig, err error) {
+	return ExchangeIdentityWithContext(context.TODO(), exchanger, userInfo, cluster)
+}
+
+// ExchangeIdentityWithContext exchanges the identity with the rules in order,
+// the context is used for requesting the ExternalIdentityExchanger.
+func ExchangeIdentityWithContext(ctx context.Context, exchanger *ClientIdentityExchanger, userInfo user.Info, cluster string) (matched bool, ruleName string, projected *rest.ImpersonationConfig, err error) {
+	return traceExchangeIdentity(ctx, exchanger, userInfo, cluster, nil)
+}
+
+// exchangeClusterIdentity exchanges the identity with the proxy config of the
+// cluster first and then the global one, the projected identity is nil if no
+// rule matches.
+func exchangeClusterIdentity(ctx context.Context, clusterGateway *ClusterGateway, cluster string, userInfo user.Info, tracer func(source IdentityExchangeRuleSource, rule *ClientIdentityExchangeRule, mismatch string)) (source IdentityExchangeRuleSource, ruleName string, projected *rest.ImpersonationConfig, err error) {
+	sourceTracer := func(source IdentityExchangeRuleSource) identityExchangeTracer {
+		if tracer == nil {
+			return nil
+		}
+		return func(rule *ClientIdentityExchangeRule, mismatch string) {
+			tracer(source, rule, mismatch)
+		}
+	}
+	if cond := meta.FindStatusCondition(clusterGateway.Status.Conditions, ClusterGatewayConditionProxyConfigurationValid); cond != nil && cond.Status == metav1.ConditionFalse {
+		return IdentityExchangeRuleSourceCluster, "", nil, fmt.Errorf("invalid proxy config of cluster %s: %s", clusterGateway.Name, cond.Message)
+	}
+	if clusterGateway.Spec.ProxyConfig != nil {
+		matched, ruleName, projected, err := traceExchangeIdentity(ctx, &clusterGateway.Spec.ProxyConfig.Spec.ClientIdentityExchanger, userInfo, cluster, sourceTracer(IdentityExchangeRuleSourceCluster))
+		if matched {
+			return IdentityExchangeRuleSourceCluster, ruleName, projected, err
+		}
+	}
+	matched, ruleName, projected, err := traceExchangeIdentity(ctx, &GetGlobalClusterGatewayProxyConfiguration().Spec.ClientIdentityExchanger, userInfo, cluster, sourceTracer(IdentityExchangeRuleSourceGlobal))
+	if matched {
+		return IdentityExchangeRuleSourceGlobal, ruleName, projected, err
+	}
+	return "", "", nil, nil
+}
+
+// identityExchangeTracer observes the rules evaluated in order, the mismatch
+// is empty for the matched rule
+type identityExchangeTracer func(rule *ClientIdentityExchangeRule, mismatch string)
+
+func traceExchangeIdentity(ctx context.Context, exchanger *ClientIdentityExchanger, userInfo user.Info, cluster string, tracer identityExchangeTracer) (matched bool, ruleName string, projected *rest.ImpersonationConfig, err error) {
 	for _, rule := range exchanger.Rules {
-		if matched, projected, err = exchangeIdentity(&rule, userInfo, cluster); matched {
+		if tracer != nil {
+			tracer(&rule, identityMismatch(rule.Source, userInfo, cluster))
+		}
+		if matched, projected, err = exchangeIdentity(ctx, &rule, userInfo, cluster); matched {
 			return matched, rule.Name, projected, err
 		}
 	}
 	return false, "", nil, nil
 }
 
-func exchangeIdentity(rule *ClientIdentityExchangeRule, userInfo user.Info, cluster string) (matched bool, projected *rest.ImpersonationConfig, err error) {
+func exchangeIdentity(ctx context.Context, rule *ClientIdentityExchangeRule, userInfo user.Info, cluster string) (matched bool, projected *rest.ImpersonationConfig, err error) {
 	if !matchIdentity(rule.Source, userInfo, cluster) {
 		return false, nil, nil
 	}
@@ -111,28 +221,82 @@ func exchangeIdentity(rule *ClientIdentityExchangeRule, userInfo user.Info, clus
 	case PrivilegedIdentityExchanger:
 		return true, &rest.ImpersonationConfig{}, nil
 	case StaticMappingIdentityExchanger:
+		if rule.Target == nil {
+			return true, nil, fmt.Errorf("target is not set for StaticMappingIdentityExchanger %s", rule.Name)
+		}
 		return true, &rest.ImpersonationConfig{
 			UserName: rule.Target.User,
 			Groups:   rule.Target.Groups,
 			UID:      rule.Target.UID,
 		}, nil
 	case ExternalIdentityExchanger:
-		return true, nil, fmt.Errorf("ExternalIdentityExchanger is not implemented")
+		projected, err = exchangeExternalIdentity(ctx, rule, userInfo, cluster)
+		return true, projected, err
 	}
 	return true, nil, fmt.Errorf("unknown exchanger type: %s", rule.Type)
 }
 
-// denyQuery return true when the pattern is valid and could be used as regular expression,
-// and the given query does not match the pattern, otherwise return false
+// identityPatterns caches the compiled patterns in the identity exchanger
+// sources, which are compiled once the proxy configurations are validated
+var identityPatterns = lru.New(identityPatternCacheSize)
+
+func compileIdentityPattern(pattern string) (*regexp.Regexp, error) {
+	if compiled, ok := identityPatterns.Get(pattern); ok {
+		return compiled.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	identityPatterns.Add(pattern, compiled)
+	return compiled, nil
+}
+
+// getClusterProxyConfiguration parses and validates the proxy configuration
+// in the annotations of the cluster, which is nil if not configured.
+func getClusterProxyConfiguration(annotations map[string]string, path *field.Path) (*ClusterGatewayProxyConfiguration, field.ErrorList) {
+	raw, ok := annotations[AnnotationClusterGatewayProxyConfiguration]
+	if !ok {
+		return nil, nil
+	}
+	path = path.Key(AnnotationClusterGatewayProxyConfiguration)
+	proxyConfig := &ClusterGatewayProxyConfiguration{}
+	if err := yaml.Unmarshal([]byte(raw), proxyConfig); err != nil {
+		return nil, field.ErrorList{field.Invalid(path, field.OmitValueType{}, err.Error())}
+	}
+	if errs := ValidateClusterGatewayProxyConfiguration(proxyConfig); len(errs) > 0 {
+		return nil, field.ErrorList{field.Invalid(path, field.OmitValueType{}, errs.ToAggregate().Error())}
+	}
+	return proxyConfig, nil
+}
+
+func getProxyConfigurationCondition(errs field.ErrorList) metav1.Condition {
+	if len(errs) > 0 {
+		return metav1.Condition{
+			Type:    ClusterGatewayConditionProxyConfigurationValid,
+			Status:  metav1.ConditionFalse,
+			Reason:  proxyConfigurationConditionReasonInvalid,
+			Message: errs.ToAggregate().Error(),
+		}
+	}
+	return metav1.Condition{
+		Type:   ClusterGatewayConditionProxyConfigurationValid,
+		Status: metav1.ConditionTrue,
+		Reason: proxyConfigurationConditionReasonValid,
+	}
+}
+
+// denyQuery return true when the given query does not match the pattern, or
+// the pattern is not a valid regular expression, otherwise return false
 func (in *IdentityExchangerSource) denyQuery(pattern *string, query string) bool {
 	if pattern == nil {
 		return false
 	}
-	matched, err := regexp.Match(*pattern, []byte(query))
+	compiled, err := compileIdentityPattern(*pattern)
 	if err != nil {
-		return false
+		return true
 	}
-	return !matched
+	return !compiled.MatchString(query)
 }
 
 // denyGroups return true if none of the group matches the given pattern
@@ -149,24 +313,30 @@ func (in *IdentityExchangerSource) denyGroups(groupPattern *string, groups []str
 }
 
 func matchIdentity(in *IdentityExchangerSource, userInfo user.Info, cluster string) bool {
+	return identityMismatch(in, userInfo, cluster) == ""
+}
+
+// identityMismatch returns the reason why the identity does not match the
+// source, or empty if matched
+func identityMismatch(in *IdentityExchangerSource, userInfo user.Info, cluster string) string {
 	if in == nil {
-		return false
+		return "source is not set"
 	}
 	switch {
 	case in.User != nil && userInfo.GetName() != *in.User:
-		return false
+		return fmt.Sprintf("user %q does not equal %q", userInfo.GetName(), *in.User)
 	case in.Group != nil && !slices.Contains(userInfo.GetGroups(), *in.Group):
-		return false
+		return fmt.Sprintf("groups %q do not contain %q", userInfo.GetGroups(), *in.Group)
 	case in.UID != nil && userInfo.GetUID() != *in.UID:
-		return false
+		return fmt.Sprintf("uid %q does not equal %q", userInfo.GetUID(), *in.UID)
 	case in.Cluster != nil && cluster != *in.Cluster:
-		return false
+		return fmt.Sprintf("cluster %q does not equal %q", cluster, *in.Cluster)
 	case in.denyQuery(in.UserPattern, userInfo.GetName()):
-		return false
+		return fmt.Sprintf("user %q does not match pattern %q", userInfo.GetName(), *in.UserPattern)
 	case in.denyGroups(in.GroupPattern, userInfo.GetGroups()):
-		return false
+		return fmt.Sprintf("groups %q do not match pattern %q", userInfo.GetGroups(), *in.GroupPattern)
 	case in.denyQuery(in.ClusterPattern, cluster):
-		return false
+		return fmt.Sprintf("cluster %q does not match pattern %q", cluster, *in.ClusterPattern)
 	}
-	return true
+	return ""
 }
@@ -0,0 +1,125 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+const (
+	defaultExternalIdentityExchangeTimeout = 10 * time.Second
+	externalIdentityCacheSize              = 1024
+	maxExternalIdentityErrorBodyLength     = 1024
+)
+
+var externalIdentityCache = cache.NewLRUExpireCache(externalIdentityCacheSize)
+
+// externalIdentityExchangeRequest is posted to the ExternalIdentityExchanger
+// +k8s:openapi-gen=false
+type externalIdentityExchangeRequest struct {
+	User    string              `json:"user"`
+	Groups  []string            `json:"groups,omitempty"`
+	UID     string              `json:"uid,omitempty"`
+	Extra   map[string][]string `json:"extra,omitempty"`
+	Cluster string              `json:"cluster"`
+}
+
+// externalIdentityExchangeResponse is returned from the
+// ExternalIdentityExchanger, which is used as the impersonation config
+// +k8s:openapi-gen=false
+type externalIdentityExchangeResponse struct {
+	User   string              `json:"user"`
+	Groups []string            `json:"groups,omitempty"`
+	UID    string              `json:"uid,omitempty"`
+	Extra  map[string][]string `json:"extra,omitempty"`
+}
+
+// exchangeExternalIdentity posts the user info and the cluster to the URL of
+// the rule. It fails closed, the identity is not projected upon any error
+// from the external exchanger.
+func exchangeExternalIdentity(ctx context.Context, rule *ClientIdentityExchangeRule, userInfo user.Info, cluster string) (*rest.ImpersonationConfig, error) {
+	if rule.URL == nil || len(*rule.URL) == 0 {
+		return nil, fmt.Errorf("url is not set for ExternalIdentityExchanger %s", rule.Name)
+	}
+	ext := rule.External
+	if ext == nil {
+		ext = &IdentityExchangerExternal{}
+	}
+	body, err := json.Marshal(externalIdentityExchangeRequest{
+		User:    userInfo.GetName(),
+		Groups:  userInfo.GetGroups(),
+		UID:     userInfo.GetUID(),
+		Extra:   userInfo.GetExtra(),
+		Cluster: cluster,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := *rule.URL + "\x00" + string(body)
+	if ext.CacheTTL != nil && ext.CacheTTL.Duration > 0 {
+		if cached, ok := externalIdentityCache.Get(cacheKey); ok {
+			projected := cached.(rest.ImpersonationConfig)
+			return &projected, nil
+		}
+	}
+
+	rt, err := transport.New(&transport.Config{
+		TLS: transport.TLSConfig{
+			CAFile:   ext.CAFile,
+			CertFile: ext.CertFile,
+			KeyFile:  ext.KeyFile,
+			Insecure: ext.InsecureSkipTLSVerify,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed building client for ExternalIdentityExchanger %s", rule.Name)
+	}
+	timeout := defaultExternalIdentityExchangeTimeout
+	if ext.Timeout != nil && ext.Timeout.Duration > 0 {
+		timeout = ext.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *rule.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid url for ExternalIdentityExchanger %s", rule.Name)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed requesting ExternalIdentityExchanger %s", rule.Name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxExternalIdentityErrorBodyLength))
+		return nil, fmt.Errorf("ExternalIdentityExchanger %s responded with status %d: %s", rule.Name, resp.StatusCode, string(msg))
+	}
+	exchanged := &externalIdentityExchangeResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(exchanged); err != nil {
+		return nil, errors.Wrapf(err, "failed decoding response from ExternalIdentityExchanger %s", rule.Name)
+	}
+	if len(exchanged.User) == 0 {
+		return nil, fmt.Errorf("ExternalIdentityExchanger %s responded with empty user", rule.Name)
+	}
+	projected := rest.ImpersonationConfig{
+		UserName: exchanged.User,
+		Groups:   exchanged.Groups,
+		UID:      exchanged.UID,
+		Extra:    exchanged.Extra,
+	}
+	if ext.CacheTTL != nil && ext.CacheTTL.Duration > 0 {
+		externalIdentityCache.Add(cacheKey, projected, ext.CacheTTL.Duration)
+	}
+	return &projected, nil
+}
@@ -0,0 +1,123 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+)
+
+func TestExchangeExternalIdentity(t *testing.T) {
+	requests := int32(0)
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		require.Equal(t, http.MethodPost, req.Method)
+		exchangeReq := &externalIdentityExchangeRequest{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(exchangeReq))
+		switch exchangeReq.User {
+		case "slow":
+			time.Sleep(time.Second)
+		case "unknown":
+			resp.WriteHeader(http.StatusForbidden)
+			_, _ = resp.Write([]byte("unknown user"))
+			return
+		case "empty":
+			_ = json.NewEncoder(resp).Encode(&externalIdentityExchangeResponse{})
+			return
+		}
+		_ = json.NewEncoder(resp).Encode(&externalIdentityExchangeResponse{
+			User:   exchangeReq.User + "@" + exchangeReq.Cluster,
+			Groups: append(exchangeReq.Groups, "exchanged"),
+			UID:    exchangeReq.UID,
+		})
+	}))
+	defer svr.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: svr.Certificate().Raw}), 0600))
+
+	testcases := map[string]struct {
+		External  *IdentityExchangerExternal
+		UserInfo  user.Info
+		Projected *rest.ImpersonationConfig
+		Error     string
+		Requests  int32
+	}{
+		"verified-by-ca": {
+			External:  &IdentityExchangerExternal{CAFile: caFile},
+			UserInfo:  &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}, UID: "1"},
+			Projected: &rest.ImpersonationConfig{UserName: "alice@cluster-1", Groups: []string{"dev", "exchanged"}, UID: "1"},
+			Requests:  2,
+		},
+		"cached": {
+			External: &IdentityExchangerExternal{
+				InsecureSkipTLSVerify: true,
+				CacheTTL:              &metav1.Duration{Duration: time.Minute},
+			},
+			UserInfo:  &user.DefaultInfo{Name: "bob"},
+			Projected: &rest.ImpersonationConfig{UserName: "bob@cluster-1", Groups: []string{"exchanged"}},
+			Requests:  1,
+		},
+		"untrusted-server": {
+			UserInfo: &user.DefaultInfo{Name: "alice"},
+			Error:    "failed requesting ExternalIdentityExchanger",
+		},
+		"rejected": {
+			External: &IdentityExchangerExternal{InsecureSkipTLSVerify: true},
+			UserInfo: &user.DefaultInfo{Name: "unknown"},
+			Error:    "responded with status 403: unknown user",
+			Requests: 2,
+		},
+		"empty-user": {
+			External: &IdentityExchangerExternal{InsecureSkipTLSVerify: true},
+			UserInfo: &user.DefaultInfo{Name: "empty"},
+			Error:    "responded with empty user",
+			Requests: 2,
+		},
+		"timeout": {
+			External: &IdentityExchangerExternal{
+				InsecureSkipTLSVerify: true,
+				Timeout:               &metav1.Duration{Duration: 100 * time.Millisecond},
+			},
+			UserInfo: &user.DefaultInfo{Name: "slow"},
+			Error:    "context deadline exceeded",
+			Requests: 2,
+		},
+	}
+	for name, tt := range testcases {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			rule := &ClientIdentityExchangeRule{
+				Name:     name,
+				Type:     ExternalIdentityExchanger,
+				URL:      pointer.String(svr.URL),
+				External: tt.External,
+			}
+			for i := 0; i < 2; i++ {
+				projected, err := exchangeExternalIdentity(context.TODO(), rule, tt.UserInfo, "cluster-1")
+				if tt.Error != "" {
+					require.Error(t, err)
+					assert.Contains(t, err.Error(), tt.Error)
+					assert.Nil(t, projected)
+					continue
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tt.Projected, projected)
+			}
+			assert.Equal(t, tt.Requests, atomic.LoadInt32(&requests))
+		})
+	}
+}
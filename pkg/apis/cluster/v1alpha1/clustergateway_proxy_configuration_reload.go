@@ -0,0 +1,134 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/metrics"
+)
+
+// proxyConfigResyncInterval is the interval of re-reading the global proxy
+// configuration in case of missing file events
+const proxyConfigResyncInterval = time.Minute
+
+var (
+	proxyConfigReloadLock   sync.Mutex
+	lastLoadedProxyConfigBs []byte
+)
+
+// ReloadGlobalClusterGatewayProxyConfig reads the global proxy configuration
+// file and replaces the configuration in use if the content is changed. The
+// configuration in use is kept if the new one is invalid.
+func ReloadGlobalClusterGatewayProxyConfig() error {
+	proxyConfigReloadLock.Lock()
+	defer proxyConfigReloadLock.Unlock()
+	path := config.ClusterGatewayProxyConfigPath
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		metrics.RecordProxyConfigReload(err)
+		return errors.Wrapf(err, "failed reading proxy config from %s", path)
+	}
+	if lastLoadedProxyConfigBs != nil && bytes.Equal(bs, lastLoadedProxyConfigBs) {
+		return nil
+	}
+	cfg := &ClusterGatewayProxyConfiguration{}
+	if err = yaml.Unmarshal(bs, cfg); err != nil {
+		metrics.RecordProxyConfigReload(err)
+		return errors.Wrapf(err, "failed parsing proxy config from %s", path)
+	}
+	if errs := ValidateClusterGatewayProxyConfiguration(cfg); len(errs) > 0 {
+		err = errs.ToAggregate()
+		metrics.RecordProxyConfigReload(err)
+		return errors.Wrapf(err, "invalid proxy config from %s", path)
+	}
+	previous := GetGlobalClusterGatewayProxyConfiguration()
+	SetGlobalClusterGatewayProxyConfiguration(cfg)
+	lastLoadedProxyConfigBs = bs
+	metrics.RecordProxyConfigReload(nil)
+	logProxyConfigChanges(path, previous, cfg)
+	return nil
+}
+
+// WatchGlobalClusterGatewayProxyConfig reloads the global proxy configuration
+// upon the changes of the file until the context is done.
+func WatchGlobalClusterGatewayProxyConfig(ctx context.Context) error {
+	path := config.ClusterGatewayProxyConfigPath
+	if path == "" {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// watching the parent directory, so that the replacement of the file is
+	// observed, e.g. the ConfigMap volumes swap the symlinks upon updates
+	if err = watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return errors.Wrapf(err, "failed watching proxy config %s", path)
+	}
+	go func() {
+		defer watcher.Close()
+		ticker := time.NewTicker(proxyConfigResyncInterval)
+		defer ticker.Stop()
+		reload := func() {
+			if err := ReloadGlobalClusterGatewayProxyConfig(); err != nil {
+				klog.Errorf("Failed reloading proxy config, keeping the previous one: %v", err)
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				reload()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				klog.Warningf("Error watching proxy config %s: %v", path, err)
+			case <-ticker.C:
+				reload()
+			}
+		}
+	}()
+	return nil
+}
+
+func logProxyConfigChanges(path string, previous, current *ClusterGatewayProxyConfiguration) {
+	previousRules := map[string]ClientIdentityExchangeRule{}
+	for _, rule := range previous.Spec.ClientIdentityExchanger.Rules {
+		previousRules[rule.Name] = rule
+	}
+	var added, modified, removed []string
+	for _, rule := range current.Spec.ClientIdentityExchanger.Rules {
+		previousRule, ok := previousRules[rule.Name]
+		switch {
+		case !ok:
+			added = append(added, rule.Name)
+		case !equality.Semantic.DeepEqual(previousRule, rule):
+			modified = append(modified, rule.Name)
+		}
+		delete(previousRules, rule.Name)
+	}
+	for _, rule := range previous.Spec.ClientIdentityExchanger.Rules {
+		if _, ok := previousRules[rule.Name]; ok {
+			removed = append(removed, rule.Name)
+		}
+	}
+	klog.Infof("Loaded proxy config from %s with %d rules, added rules: %v, modified rules: %v, removed rules: %v",
+		path, len(current.Spec.ClientIdentityExchanger.Rules), added, modified, removed)
+}
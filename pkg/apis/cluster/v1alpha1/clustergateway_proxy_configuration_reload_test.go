@@ -0,0 +1,109 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+const testProxyConfigTemplate = `apiVersion: cluster.core.oam.dev/v1alpha1
+kind: ClusterGatewayProxyConfiguration
+spec:
+  clientIdentityExchanger:
+    rules:
+      - name: %s
+        source:
+          group: sudoer
+        type: PrivilegedIdentityExchanger
+`
+
+func setupTestProxyConfigPath(t *testing.T, path string) {
+	configPath := config.ClusterGatewayProxyConfigPath
+	config.ClusterGatewayProxyConfigPath = path
+	t.Cleanup(func() {
+		proxyConfigReloadLock.Lock()
+		defer proxyConfigReloadLock.Unlock()
+		config.ClusterGatewayProxyConfigPath = configPath
+		lastLoadedProxyConfigBs = nil
+		SetGlobalClusterGatewayProxyConfiguration(&ClusterGatewayProxyConfiguration{})
+	})
+}
+
+func writeTestProxyConfig(t *testing.T, path string, ruleName string) {
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(testProxyConfigTemplate, ruleName)), 0600))
+}
+
+func globalProxyConfigRuleNames() []string {
+	var names []string
+	for _, rule := range GetGlobalClusterGatewayProxyConfiguration().Spec.ClientIdentityExchanger.Rules {
+		names = append(names, rule.Name)
+	}
+	return names
+}
+
+func TestReloadGlobalClusterGatewayProxyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	setupTestProxyConfigPath(t, path)
+
+	writeTestProxyConfig(t, path, "first")
+	require.NoError(t, LoadGlobalClusterGatewayProxyConfig())
+	assert.Equal(t, []string{"first"}, globalProxyConfigRuleNames())
+	assert.Same(t, GetGlobalClusterGatewayProxyConfiguration(), GlobalClusterGatewayProxyConfiguration)
+
+	// invalid config is rejected
+	require.NoError(t, os.WriteFile(path, []byte("spec: [invalid"), 0600))
+	require.Error(t, ReloadGlobalClusterGatewayProxyConfig())
+	assert.Equal(t, []string{"first"}, globalProxyConfigRuleNames())
+
+	// config with invalid rules is rejected
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(
+		fmt.Sprintf(testProxyConfigTemplate, "invalid"), "group: sudoer", "userPattern: '['", 1)), 0600))
+	err := ReloadGlobalClusterGatewayProxyConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spec.clientIdentityExchanger.rules[0].source.userPattern")
+	assert.Equal(t, []string{"first"}, globalProxyConfigRuleNames())
+
+	writeTestProxyConfig(t, path, "second")
+	require.NoError(t, ReloadGlobalClusterGatewayProxyConfig())
+	assert.Equal(t, []string{"second"}, globalProxyConfigRuleNames())
+
+	require.NoError(t, os.Remove(path))
+	require.Error(t, ReloadGlobalClusterGatewayProxyConfig())
+	assert.Equal(t, []string{"second"}, globalProxyConfigRuleNames())
+}
+
+func TestWatchGlobalClusterGatewayProxyConfig(t *testing.T) {
+	// mimicking the layout of the ConfigMap volumes
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data_1"), 0700))
+	writeTestProxyConfig(t, filepath.Join(dir, "..data_1", "config.yaml"), "first")
+	require.NoError(t, os.Symlink("..data_1", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "config.yaml"), filepath.Join(dir, "config.yaml")))
+	setupTestProxyConfigPath(t, filepath.Join(dir, "config.yaml"))
+
+	require.NoError(t, LoadGlobalClusterGatewayProxyConfig())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, WatchGlobalClusterGatewayProxyConfig(ctx))
+	assert.Equal(t, []string{"first"}, globalProxyConfigRuleNames())
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data_2"), 0700))
+	writeTestProxyConfig(t, filepath.Join(dir, "..data_2", "config.yaml"), "second")
+	require.NoError(t, os.Symlink("..data_2", filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "..data_1")))
+
+	require.Eventually(t, func() bool {
+		names := globalProxyConfigRuleNames()
+		return len(names) == 1 && names[0] == "second"
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -17,13 +17,19 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/component-base/featuregate/testing"
 	"k8s.io/utils/pointer"
+
+	"github.com/oam-dev/cluster-gateway/pkg/featuregates"
 )
 
 func TestExchangeIdentity(t *testing.T) {
@@ -130,19 +136,18 @@ func TestExchangeIdentity(t *testing.T) {
 			Projected: &rest.ImpersonationConfig{UserName: "special"},
 			Error:     nil,
 		},
-		"not-implemented": {
+		"external-without-url": {
 			Exchanger: &ClientIdentityExchanger{Rules: []ClientIdentityExchangeRule{{
 				Name:   "external-identity-exchange",
 				Type:   ExternalIdentityExchanger,
 				Source: &IdentityExchangerSource{ClusterPattern: pointer.String("cluster-\\d+")},
-				URL:    pointer.String("http://1.2.3.4:5000"),
 			}}},
 			UserInfo:  &user.DefaultInfo{Name: "test"},
 			Cluster:   "cluster-1",
 			Matched:   true,
 			RuleName:  "external-identity-exchange",
 			Projected: nil,
-			Error:     fmt.Errorf("ExternalIdentityExchanger is not implemented"),
+			Error:     fmt.Errorf("url is not set for ExternalIdentityExchanger external-identity-exchange"),
 		},
 		"no-match": {
 			Exchanger: &ClientIdentityExchanger{Rules: []ClientIdentityExchangeRule{{
@@ -158,7 +163,7 @@ func TestExchangeIdentity(t *testing.T) {
 	}
 	for name, tt := range testcases {
 		t.Run(name, func(t *testing.T) {
-			matched, ruleName, projected, err := ExchangeIdentity(tt.Exchanger, tt.UserInfo, tt.Cluster)
+			matched, ruleName, projected, err := ExchangeIdentityWithContext(context.TODO(), tt.Exchanger, tt.UserInfo, tt.Cluster)
 			if tt.Error != nil {
 				require.Error(t, tt.Error, err)
 				return
@@ -170,3 +175,193 @@ func TestExchangeIdentity(t *testing.T) {
 		})
 	}
 }
+
+func TestExchangeIdentityInvalidPattern(t *testing.T) {
+	exchanger := &ClientIdentityExchanger{Rules: []ClientIdentityExchangeRule{{
+		Name:   "invalid-pattern",
+		Type:   PrivilegedIdentityExchanger,
+		Source: &IdentityExchangerSource{UserPattern: pointer.String("test-[")},
+	}}}
+	matched, _, _, err := ExchangeIdentity(exchanger, &user.DefaultInfo{Name: "test-["}, "c1")
+	require.NoError(t, err)
+	require.False(t, matched)
+}
+
+func TestClusterGatewayInvalidProxyConfiguration(t *testing.T) {
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.ClientIdentityPenetration, true)
+	SetGlobalClusterGatewayProxyConfiguration(&ClusterGatewayProxyConfiguration{
+		Spec: ClusterGatewayProxyConfigurationSpec{
+			ClientIdentityExchanger: ClientIdentityExchanger{Rules: []ClientIdentityExchangeRule{{
+				Name:   "global",
+				Type:   PrivilegedIdentityExchanger,
+				Source: &IdentityExchangerSource{User: pointer.String("bob")},
+			}}},
+		},
+	})
+	defer SetGlobalClusterGatewayProxyConfiguration(&ClusterGatewayProxyConfiguration{})
+
+	secret := newTestClusterSecret("c1", "1")
+	secret.Annotations = map[string]string{
+		AnnotationClusterGatewayProxyConfiguration: `
+spec:
+  clientIdentityExchanger:
+    rules:
+      - name: local
+        source:
+          userPattern: "bob-["
+        type: PrivilegedIdentityExchanger
+`,
+	}
+	gw, err := convertFromSecret(secret)
+	require.NoError(t, err)
+	require.Nil(t, gw.Spec.ProxyConfig)
+	require.True(t, meta.IsStatusConditionFalse(gw.Status.Conditions, ClusterGatewayConditionProxyConfigurationValid))
+
+	// fails closed instead of falling back to the global rules
+	source, _, projected, err := exchangeClusterIdentity(context.TODO(), gw, "c1", &user.DefaultInfo{Name: "bob"}, nil)
+	require.Error(t, err)
+	require.Equal(t, IdentityExchangeRuleSourceCluster, source)
+	require.Nil(t, projected)
+
+	// rejected upon writing
+	proxyConfigErrs := func(gw *ClusterGateway) (errs []string) {
+		for _, err := range ValidateClusterGateway(gw) {
+			if err.Field == "metadata.annotations["+AnnotationClusterGatewayProxyConfiguration+"]" {
+				errs = append(errs, err.Detail)
+			}
+		}
+		return errs
+	}
+	require.Len(t, proxyConfigErrs(gw), 1)
+
+	secret.Annotations[AnnotationClusterGatewayProxyConfiguration] = `
+spec:
+  clientIdentityExchanger:
+    rules:
+      - name: local
+        source:
+          userPattern: "bob-.*"
+        type: PrivilegedIdentityExchanger
+`
+	gw, err = convertFromSecret(secret)
+	require.NoError(t, err)
+	require.NotNil(t, gw.Spec.ProxyConfig)
+	require.True(t, meta.IsStatusConditionTrue(gw.Status.Conditions, ClusterGatewayConditionProxyConfigurationValid))
+	source, _, projected, err = exchangeClusterIdentity(context.TODO(), gw, "c1", &user.DefaultInfo{Name: "bob"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, IdentityExchangeRuleSourceGlobal, source)
+	require.NotNil(t, projected)
+	require.Empty(t, proxyConfigErrs(gw))
+}
+
+func TestValidateClusterGatewayProxyConfiguration(t *testing.T) {
+	testcases := map[string]struct {
+		Rules  []ClientIdentityExchangeRule
+		Errors []string
+	}{
+		"valid": {
+			Rules: []ClientIdentityExchangeRule{{
+				Name:   "privileged",
+				Type:   PrivilegedIdentityExchanger,
+				Source: &IdentityExchangerSource{UserPattern: pointer.String("admin-.*")},
+			}, {
+				Name:   "static",
+				Type:   StaticMappingIdentityExchanger,
+				Source: &IdentityExchangerSource{Group: pointer.String("dev")},
+				Target: &IdentityExchangerTarget{User: "developer"},
+			}, {
+				Name:   "external",
+				Type:   ExternalIdentityExchanger,
+				Source: &IdentityExchangerSource{ClusterPattern: pointer.String("prod-\\d+")},
+				URL:    pointer.String("https://iam.example.com/exchange"),
+			}},
+		},
+		"missing-name-and-source": {
+			Rules: []ClientIdentityExchangeRule{{Type: PrivilegedIdentityExchanger}},
+			Errors: []string{
+				"spec.clientIdentityExchanger.rules[0].name: Required value",
+				"spec.clientIdentityExchanger.rules[0].source: Required value",
+			},
+		},
+		"duplicated-name": {
+			Rules: []ClientIdentityExchangeRule{{
+				Name:   "rule",
+				Type:   PrivilegedIdentityExchanger,
+				Source: &IdentityExchangerSource{User: pointer.String("a")},
+			}, {
+				Name:   "rule",
+				Type:   PrivilegedIdentityExchanger,
+				Source: &IdentityExchangerSource{User: pointer.String("b")},
+			}},
+			Errors: []string{`spec.clientIdentityExchanger.rules[1].name: Duplicate value: "rule"`},
+		},
+		"invalid-patterns": {
+			Rules: []ClientIdentityExchangeRule{{
+				Name: "rule",
+				Type: PrivilegedIdentityExchanger,
+				Source: &IdentityExchangerSource{
+					UserPattern:    pointer.String("user-["),
+					GroupPattern:   pointer.String("group-.*"),
+					ClusterPattern: pointer.String("(cluster"),
+				},
+			}},
+			Errors: []string{
+				"spec.clientIdentityExchanger.rules[0].source.userPattern: Invalid value",
+				"spec.clientIdentityExchanger.rules[0].source.clusterPattern: Invalid value",
+			},
+		},
+		"static-without-target": {
+			Rules: []ClientIdentityExchangeRule{{
+				Name:   "no-target",
+				Type:   StaticMappingIdentityExchanger,
+				Source: &IdentityExchangerSource{User: pointer.String("a")},
+			}, {
+				Name:   "no-target-user",
+				Type:   StaticMappingIdentityExchanger,
+				Source: &IdentityExchangerSource{User: pointer.String("a")},
+				Target: &IdentityExchangerTarget{Groups: []string{"g"}},
+			}},
+			Errors: []string{
+				"spec.clientIdentityExchanger.rules[0].target: Required value",
+				"spec.clientIdentityExchanger.rules[1].target.user: Required value",
+			},
+		},
+		"external-invalid-url": {
+			Rules: []ClientIdentityExchangeRule{{
+				Name:   "no-url",
+				Type:   ExternalIdentityExchanger,
+				Source: &IdentityExchangerSource{User: pointer.String("a")},
+			}, {
+				Name:   "bad-scheme",
+				Type:   ExternalIdentityExchanger,
+				Source: &IdentityExchangerSource{User: pointer.String("a")},
+				URL:    pointer.String("ftp://iam.example.com"),
+			}},
+			Errors: []string{
+				"spec.clientIdentityExchanger.rules[0].url: Required value",
+				"spec.clientIdentityExchanger.rules[1].url: Invalid value",
+			},
+		},
+		"unknown-type": {
+			Rules: []ClientIdentityExchangeRule{{
+				Name:   "unknown",
+				Type:   "Unknown",
+				Source: &IdentityExchangerSource{User: pointer.String("a")},
+			}},
+			Errors: []string{`spec.clientIdentityExchanger.rules[0].type: Unsupported value: "Unknown"`},
+		},
+	}
+	for name, tt := range testcases {
+		t.Run(name, func(t *testing.T) {
+			errs := ValidateClusterGatewayProxyConfiguration(&ClusterGatewayProxyConfiguration{
+				Spec: ClusterGatewayProxyConfigurationSpec{
+					ClientIdentityExchanger: ClientIdentityExchanger{Rules: tt.Rules},
+				},
+			})
+			require.Equal(t, len(tt.Errors), len(errs), errs.ToAggregate())
+			for i := range tt.Errors {
+				require.Contains(t, errs[i].Error(), tt.Errors[i])
+			}
+		})
+	}
+}
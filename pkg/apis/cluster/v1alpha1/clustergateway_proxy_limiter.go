@@ -0,0 +1,253 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/metrics"
+)
+
+// The annotations overriding the global limits of the proxied requests to
+// the cluster.
+const (
+	// AnnotationKeyClusterGatewayProxyQPS is the QPS of the proxied requests,
+	// "0" disables rate limiting
+	AnnotationKeyClusterGatewayProxyQPS = "cluster.core.oam.dev/proxy-qps"
+	// AnnotationKeyClusterGatewayProxyBurst is the burst of the proxied
+	// requests
+	AnnotationKeyClusterGatewayProxyBurst = "cluster.core.oam.dev/proxy-burst"
+	// AnnotationKeyClusterGatewayProxyMaxInFlight is the maximum number of the
+	// in-flight proxied requests, "0" disables the limit
+	AnnotationKeyClusterGatewayProxyMaxInFlight = "cluster.core.oam.dev/proxy-max-in-flight"
+	// AnnotationKeyClusterGatewayProxyTimeout is the timeout of the proxied
+	// requests, e.g. "1m"
+	AnnotationKeyClusterGatewayProxyTimeout = "cluster.core.oam.dev/proxy-timeout"
+)
+
+const (
+	rejectedReasonRateLimited     = "RateLimited"
+	rejectedReasonTooManyInFlight = "TooManyInFlight"
+
+	// maxInFlightRetryAfter is the Retry-After duration responded upon
+	// reaching the max-in-flight limit, which is unknown to the gateway
+	maxInFlightRetryAfter = time.Second
+)
+
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type clusterProxyLimits struct {
+	qps         float64
+	burst       int
+	maxInFlight int
+	timeout     time.Duration
+}
+
+// getClusterProxyLimits reads the limits of the cluster from the annotations,
+// the global defaults are used for the absent or invalid ones.
+func getClusterProxyLimits(annotations map[string]string, path *field.Path) (clusterProxyLimits, field.ErrorList) {
+	limits := clusterProxyLimits{
+		qps:         config.ProxyClusterQPS,
+		burst:       config.ProxyClusterBurst,
+		maxInFlight: config.ProxyClusterMaxInFlight,
+		timeout:     config.ProxyRequestTimeout,
+	}
+	var errs field.ErrorList
+	if raw, ok := annotations[AnnotationKeyClusterGatewayProxyQPS]; ok {
+		if qps, err := strconv.ParseFloat(raw, 64); err != nil || qps < 0 || math.IsInf(qps, 0) || math.IsNaN(qps) {
+			errs = append(errs, field.Invalid(path.Key(AnnotationKeyClusterGatewayProxyQPS), raw, "should be a non-negative number"))
+		} else {
+			limits.qps = qps
+		}
+	}
+	for key, value := range map[string]*int{
+		AnnotationKeyClusterGatewayProxyBurst:       &limits.burst,
+		AnnotationKeyClusterGatewayProxyMaxInFlight: &limits.maxInFlight,
+	} {
+		raw, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(raw); err != nil || n < 0 {
+			errs = append(errs, field.Invalid(path.Key(key), raw, "should be a non-negative integer"))
+		} else {
+			*value = n
+		}
+	}
+	if raw, ok := annotations[AnnotationKeyClusterGatewayProxyTimeout]; ok {
+		if timeout, err := time.ParseDuration(raw); err != nil || timeout <= 0 {
+			errs = append(errs, field.Invalid(path.Key(AnnotationKeyClusterGatewayProxyTimeout), raw, "should be a positive duration"))
+		} else {
+			limits.timeout = timeout
+		}
+	}
+	if limits.burst <= 0 {
+		limits.burst = int(math.Ceil(limits.qps))
+	}
+	return limits, errs
+}
+
+// clusterRequestLimiters holds the request limiters of the clusters by name.
+var clusterRequestLimiters sync.Map
+
+// +k8s:openapi-gen=false
+// +k8s:deepcopy-gen=false
+type clusterRequestLimiter struct {
+	cluster string
+	now     func() time.Time
+
+	mu       sync.Mutex
+	limits   clusterProxyLimits
+	limiter  *rate.Limiter
+	inFlight int
+}
+
+// getClusterRequestLimiter returns the limiter of the cluster, which is
+// updated to the latest limits.
+func getClusterRequestLimiter(cluster string, limits clusterProxyLimits) *clusterRequestLimiter {
+	l, ok := clusterRequestLimiters.Load(cluster)
+	if !ok {
+		l, _ = clusterRequestLimiters.LoadOrStore(cluster, newClusterRequestLimiter(cluster, limits, time.Now))
+	}
+	limiter := l.(*clusterRequestLimiter)
+	limiter.update(limits)
+	return limiter
+}
+
+// evictClusterRequestLimiter removes the limiter of the removed cluster, the
+// requests in flight still release to the evicted one.
+func evictClusterRequestLimiter(cluster string) {
+	clusterRequestLimiters.Delete(cluster)
+}
+
+func newClusterRequestLimiter(cluster string, limits clusterProxyLimits, now func() time.Time) *clusterRequestLimiter {
+	l := &clusterRequestLimiter{cluster: cluster, now: now}
+	l.update(limits)
+	return l
+}
+
+func (l *clusterRequestLimiter) update(limits clusterProxyLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits == limits && (l.limiter != nil) == (limits.qps > 0) {
+		return
+	}
+	l.limits = limits
+	switch {
+	case limits.qps <= 0:
+		l.limiter = nil
+	case l.limiter == nil:
+		l.limiter = rate.NewLimiter(rate.Limit(limits.qps), limits.burst)
+	default:
+		now := l.now()
+		l.limiter.SetLimitAt(now, rate.Limit(limits.qps))
+		l.limiter.SetBurstAt(now, limits.burst)
+	}
+}
+
+// inFlightRequests returns the number of the requests holding the in-flight
+// slots.
+func (l *clusterRequestLimiter) inFlightRequests() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// acquire waits for the rate limit and takes an in-flight slot unless the
+// request is long-running. The request is rejected if the in-flight limit is
+// reached or the rate limit can't be met within the max wait, otherwise the
+// returned func must be called upon finishing the request.
+func (l *clusterRequestLimiter) acquire(ctx context.Context, longRunning bool) (func(), error) {
+	l.mu.Lock()
+	if !longRunning && l.limits.maxInFlight > 0 && l.inFlight >= l.limits.maxInFlight {
+		l.mu.Unlock()
+		metrics.RecordRejectedRequest(l.cluster, rejectedReasonTooManyInFlight)
+		return nil, newTooManyRequestsError(
+			fmt.Sprintf("too many in-flight requests to cluster %s, the limit is %d", l.cluster, l.limits.maxInFlight),
+			maxInFlightRetryAfter)
+	}
+	var reservation *rate.Reservation
+	var delay time.Duration
+	now := l.now()
+	if l.limiter != nil {
+		reservation = l.limiter.ReserveN(now, 1)
+		delay = reservation.DelayFrom(now)
+		if !reservation.OK() || delay > config.ProxyRateLimitMaxWait {
+			reservation.CancelAt(now)
+			l.mu.Unlock()
+			metrics.RecordRejectedRequest(l.cluster, rejectedReasonRateLimited)
+			return nil, newTooManyRequestsError(
+				fmt.Sprintf("too many requests to cluster %s, the rate limit is %v QPS", l.cluster, l.limits.qps),
+				delay)
+		}
+	}
+	if !longRunning {
+		l.inFlight++
+		metrics.RecordClusterInFlightRequests(l.cluster, 1)
+	}
+	l.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			if longRunning {
+				return
+			}
+			l.mu.Lock()
+			l.inFlight--
+			l.mu.Unlock()
+			metrics.RecordClusterInFlightRequests(l.cluster, -1)
+		})
+	}
+	if delay <= 0 {
+		return release, nil
+	}
+	metrics.RecordClusterQueuedRequests(l.cluster, 1)
+	defer metrics.RecordClusterQueuedRequests(l.cluster, -1)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return release, nil
+	case <-ctx.Done():
+		reservation.CancelAt(l.now())
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// isLongRunningProxyRequest returns true for the watches, the followed logs
+// and the upgraded connections, which are neither timed out nor counted by
+// the max-in-flight limit.
+func isLongRunningProxyRequest(req *http.Request) bool {
+	if httpstream.IsUpgradeRequest(req) {
+		return true
+	}
+	query := req.URL.Query()
+	for _, key := range []string{"watch", "follow"} {
+		if v := query.Get(key); v == "true" || v == "1" {
+			return true
+		}
+	}
+	return false
+}
+
+// newTooManyRequestsError returns the 429 error carrying the Retry-After
+// duration, which is written to the header by the responder.
+func newTooManyRequestsError(message string, retryAfter time.Duration) *apierrors.StatusError {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return apierrors.NewTooManyRequests(message, seconds)
+}
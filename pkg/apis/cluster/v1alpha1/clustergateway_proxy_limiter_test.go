@@ -0,0 +1,172 @@
+package v1alpha1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/utils/pointer"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+func TestGetClusterProxyLimits(t *testing.T) {
+	limits, errs := getClusterProxyLimits(nil, field.NewPath("annotations"))
+	assert.Empty(t, errs)
+	assert.Equal(t, clusterProxyLimits{timeout: config.ProxyRequestTimeout}, limits)
+
+	limits, errs = getClusterProxyLimits(map[string]string{
+		AnnotationKeyClusterGatewayProxyQPS:         "2.5",
+		AnnotationKeyClusterGatewayProxyMaxInFlight: "10",
+		AnnotationKeyClusterGatewayProxyTimeout:     "1m",
+	}, field.NewPath("annotations"))
+	assert.Empty(t, errs)
+	assert.Equal(t, clusterProxyLimits{qps: 2.5, burst: 3, maxInFlight: 10, timeout: time.Minute}, limits)
+
+	limits, errs = getClusterProxyLimits(map[string]string{
+		AnnotationKeyClusterGatewayProxyQPS:         "-1",
+		AnnotationKeyClusterGatewayProxyBurst:       "many",
+		AnnotationKeyClusterGatewayProxyMaxInFlight: "-1",
+		AnnotationKeyClusterGatewayProxyTimeout:     "0s",
+	}, field.NewPath("annotations"))
+	assert.Equal(t, 4, len(errs))
+	assert.Equal(t, clusterProxyLimits{timeout: config.ProxyRequestTimeout}, limits)
+}
+
+func TestClusterRequestLimiter(t *testing.T) {
+	now := time.Now()
+	l := newClusterRequestLimiter("c1", clusterProxyLimits{maxInFlight: 1}, func() time.Time { return now })
+
+	// limited by in-flight requests excluding the long-running ones
+	release, err := l.acquire(context.TODO(), false)
+	require.NoError(t, err)
+	_, err = l.acquire(context.TODO(), false)
+	require.True(t, apierrors.IsTooManyRequests(err))
+	retryAfter, ok := apierrors.SuggestsClientDelay(err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, retryAfter)
+	releaseWatch, err := l.acquire(context.TODO(), true)
+	require.NoError(t, err)
+	releaseWatch()
+	release()
+	release()
+	assert.Equal(t, 0, l.inFlightRequests())
+
+	// limited by the rate without waiting
+	defer func(maxWait time.Duration) { config.ProxyRateLimitMaxWait = maxWait }(config.ProxyRateLimitMaxWait)
+	config.ProxyRateLimitMaxWait = 0
+	l.update(clusterProxyLimits{qps: 0.5, burst: 1})
+	release, err = l.acquire(context.TODO(), false)
+	require.NoError(t, err)
+	release()
+	_, err = l.acquire(context.TODO(), false)
+	require.True(t, apierrors.IsTooManyRequests(err))
+	retryAfter, _ = apierrors.SuggestsClientDelay(err)
+	assert.Equal(t, 2, retryAfter)
+	now = now.Add(2 * time.Second)
+	release, err = l.acquire(context.TODO(), false)
+	require.NoError(t, err)
+	release()
+
+	// queued until the rate limit is met, or the request is cancelled
+	config.ProxyRateLimitMaxWait = time.Second
+	l = newClusterRequestLimiter("c1", clusterProxyLimits{qps: 20, burst: 1}, time.Now)
+	release, err = l.acquire(context.TODO(), false)
+	require.NoError(t, err)
+	release()
+	start := time.Now()
+	release, err = l.acquire(context.TODO(), false)
+	require.NoError(t, err)
+	release()
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_, err = l.acquire(ctx, false)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, l.inFlightRequests())
+}
+
+func TestProxyHandlerLimits(t *testing.T) {
+	blocking := make(chan struct{})
+	endpointSvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/block" {
+			select {
+			case <-blocking:
+			case <-req.Context().Done():
+			}
+		}
+		resp.WriteHeader(http.StatusOK)
+	}))
+	defer endpointSvr.Close()
+	gw := &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "limiter-test",
+			Annotations: map[string]string{
+				AnnotationKeyClusterGatewayProxyMaxInFlight: "1",
+				AnnotationKeyClusterGatewayProxyTimeout:     "200ms",
+			},
+		},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  endpointSvr.URL,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: "myToken",
+				},
+			},
+		},
+	}
+	defer clusterRequestLimiters.Delete(gw.Name)
+
+	serve := func(path string) (*httptest.ResponseRecorder, *fakeResponder) {
+		responder := &fakeResponder{}
+		ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+		ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+		handler, err := (&ClusterGatewayProxy{}).Connect(ctx, gw.Name, &ClusterGatewayProxyOptions{Path: path}, responder)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, apiPrefix+gw.Name+apiSuffix+path, nil)
+		handler.ServeHTTP(recorder, req)
+		return recorder, responder
+	}
+
+	// the blocked request holds the only in-flight slot until timed out
+	done := make(chan *fakeResponder)
+	go func() {
+		_, responder := serve("/block")
+		done <- responder
+	}()
+	require.Eventually(t, func() bool {
+		l, ok := clusterRequestLimiters.Load(gw.Name)
+		return ok && l.(*clusterRequestLimiter).inFlightRequests() == 1
+	}, time.Second, 10*time.Millisecond)
+	_, responder := serve("/abc")
+	require.Error(t, responder.receivingErr)
+	assert.True(t, apierrors.IsTooManyRequests(responder.receivingErr))
+
+	select {
+	case responder = <-done:
+		assert.ErrorIs(t, responder.receivingErr, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		close(blocking)
+		t.Fatal("the blocked request is not timed out")
+	}
+	recorder, responder := serve("/abc")
+	require.NoError(t, responder.receivingErr)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -229,7 +229,7 @@ func TestGetImpersonationConfig(t *testing.T) {
 	require.NoError(t, err)
 	base := context.Background()
 
-	GlobalClusterGatewayProxyConfiguration = &ClusterGatewayProxyConfiguration{
+	SetGlobalClusterGatewayProxyConfiguration(&ClusterGatewayProxyConfiguration{
 		Spec: ClusterGatewayProxyConfigurationSpec{
 			ClientIdentityExchanger: ClientIdentityExchanger{Rules: []ClientIdentityExchangeRule{{
 				Name:   "name-matcher",
@@ -238,7 +238,7 @@ func TestGetImpersonationConfig(t *testing.T) {
 				Target: &IdentityExchangerTarget{User: "global"},
 			}}},
 		},
-	}
+	})
 
 	h := &proxyHandler{clusterGateway: &ClusterGateway{Spec: ClusterGatewaySpec{ProxyConfig: &ClusterGatewayProxyConfiguration{
 		Spec: ClusterGatewayProxyConfigurationSpec{
@@ -252,11 +252,29 @@ func TestGetImpersonationConfig(t *testing.T) {
 	}}}}
 
 	ctx := request.WithUser(base, &user.DefaultInfo{Name: "test", Groups: []string{"group"}})
-	require.Equal(t, clientgorest.ImpersonationConfig{UserName: "local"}, h.getImpersonationConfig(baseReq.WithContext(ctx)))
+	impersonate, _, _, err := h.getImpersonationConfig(baseReq.WithContext(ctx))
+	require.NoError(t, err)
+	require.Equal(t, clientgorest.ImpersonationConfig{UserName: "local"}, impersonate)
 
 	ctx = request.WithUser(base, &user.DefaultInfo{Name: "test", Groups: []string{"group-test"}})
-	require.Equal(t, clientgorest.ImpersonationConfig{UserName: "global"}, h.getImpersonationConfig(baseReq.WithContext(ctx)))
+	impersonate, _, _, err = h.getImpersonationConfig(baseReq.WithContext(ctx))
+	require.NoError(t, err)
+	require.Equal(t, clientgorest.ImpersonationConfig{UserName: "global"}, impersonate)
 
 	ctx = request.WithUser(base, &user.DefaultInfo{Name: "tester", Groups: []string{"group-test"}})
-	require.Equal(t, clientgorest.ImpersonationConfig{UserName: "tester", Groups: []string{"group-test"}}, h.getImpersonationConfig(baseReq.WithContext(ctx)))
+	impersonate, _, _, err = h.getImpersonationConfig(baseReq.WithContext(ctx))
+	require.NoError(t, err)
+	require.Equal(t, clientgorest.ImpersonationConfig{UserName: "tester", Groups: []string{"group-test"}}, impersonate)
+
+	// failing external exchanger rejects the request
+	h.clusterGateway.Spec.ProxyConfig.Spec.ClientIdentityExchanger.Rules = append(
+		[]ClientIdentityExchangeRule{{
+			Name:   "external",
+			Type:   ExternalIdentityExchanger,
+			Source: &IdentityExchangerSource{User: pointer.String("tester")},
+			URL:    pointer.String("http://127.0.0.1:0"),
+		}},
+		h.clusterGateway.Spec.ProxyConfig.Spec.ClientIdentityExchanger.Rules...)
+	_, _, _, err = h.getImpersonationConfig(baseReq.WithContext(ctx))
+	require.Error(t, err)
 }
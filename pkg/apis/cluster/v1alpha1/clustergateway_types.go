@@ -114,6 +114,40 @@ type ClusterEndpointConst struct {
 	Insecure *bool `json:"insecure,omitempty"`
 	// ProxyURL indicates the proxy url of the server
 	ProxyURL *string `json:"proxy-url,omitempty"`
+	// Endpoints are the ordered alternative addresses of the kube-apiserver,
+	// e.g. the load balancers in different zones. The requests fail over to
+	// the next endpoint upon dial or TLS errors, and stick to the last
+	// healthy one. Address is tried first unless listed here.
+	Endpoints []ClusterEndpointAddress `json:"endpoints,omitempty"`
+}
+
+type ClusterEndpointAddress struct {
+	// Address is a qualified hostname for accessing the kube-apiserver, which
+	// differs from the other endpoints of the cluster only by the host.
+	Address string `json:"address"`
+	// CABundle overrides the CABundle of the cluster for verifying the
+	// serving certificate of the endpoint.
+	CABundle []byte `json:"caBundle,omitempty"`
+}
+
+// GetEndpoints returns the ordered endpoints to fail over, the CABundle of
+// the cluster is used for the endpoints without one.
+func (in *ClusterEndpointConst) GetEndpoints() []ClusterEndpointAddress {
+	var endpoints []ClusterEndpointAddress
+	listed := false
+	for _, endpoint := range in.Endpoints {
+		listed = listed || endpoint.Address == in.Address
+	}
+	if !listed && len(in.Address) > 0 {
+		endpoints = append(endpoints, ClusterEndpointAddress{Address: in.Address})
+	}
+	endpoints = append(endpoints, in.Endpoints...)
+	for i := range endpoints {
+		if len(endpoints[i].CABundle) == 0 {
+			endpoints[i].CABundle = in.CABundle
+		}
+	}
+	return endpoints
 }
 
 type ClusterAccessCredential struct {
@@ -183,16 +217,59 @@ const (
 	HealthyReasonTypeCertificateMismatch         HealthyReasonType = "CertificateMismatch"
 	HealthyReasonTypeConnectionTimeout           HealthyReasonType = "ConnectionTimeout"
 	HealthyReasonTypeUnknownPrefix               HealthyReasonType = "Unknown:"
+	HealthyReasonTypeUnauthorized                HealthyReasonType = "Unauthorized"
+	HealthyReasonTypeConnectionRefused           HealthyReasonType = "ConnectionRefused"
+	HealthyReasonTypeProbeFailed                 HealthyReasonType = "ProbeFailed"
+)
+
+const (
+	// ClusterGatewayConditionReachable is true if the kube-apiserver of the
+	// cluster responds to the probes.
+	ClusterGatewayConditionReachable = "Reachable"
+	// ClusterGatewayConditionAuthenticated is true if the credential of the
+	// cluster is accepted by the kube-apiserver.
+	ClusterGatewayConditionAuthenticated = "Authenticated"
+	// ClusterGatewayConditionHealthy mirrors the healthiness of the cluster.
+	ClusterGatewayConditionHealthy = "Healthy"
+	// ClusterGatewayConditionCredentialValid is true if the credential of the
+	// cluster is well-formed.
+	ClusterGatewayConditionCredentialValid = "CredentialValid"
+	// ClusterGatewayConditionProxyConfigurationValid is true if the proxy
+	// configuration of the cluster is valid, the identity exchange of the
+	// proxied requests fails otherwise.
+	ClusterGatewayConditionProxyConfigurationValid = "ProxyConfigurationValid"
 )
 
 // ClusterGatewayStatus defines the observed state of ClusterGateway
 type ClusterGatewayStatus struct {
 	// Healthy indicates whether the cluster is healthy.
 	// If the `HealthinessCheck` feature gate is enabled, calling proxy
-	// subresource upon unhealthy clusters will be rejected.
+	// subresource upon unhealthy clusters will be rejected with 503.
 	Healthy bool `json:"healthy"`
 	// HealthyReason is the reason explaining the cluster's healthiness.
 	HealthyReason HealthyReasonType `json:"healthyReason,omitempty"`
+	// LastProbeTime is the time of the last health probe.
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+	// ProbeLatency is the time cost of the last health probe.
+	ProbeLatency *metav1.Duration `json:"probeLatency,omitempty"`
+	// ConsecutiveFailures is the number of the consecutive failed probes.
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+	// ConsecutiveSuccesses is the number of the consecutive succeeded probes.
+	ConsecutiveSuccesses int32 `json:"consecutiveSuccesses,omitempty"`
+	// FailingChecks are the failing checks reported by the last probe, e.g.
+	// "readyz:etcd" for the failing etcd check of the "/readyz" endpoint.
+	FailingChecks []string `json:"failingChecks,omitempty"`
+	// Version is the kube-apiserver version discovered by the last probe.
+	Version string `json:"version,omitempty"`
+	// CredentialExpirationTime is when the credential of the cluster expires,
+	// parsed from the X509 certificate or the "exp" claim of the token.
+	CredentialExpirationTime *metav1.Time `json:"credentialExpirationTime,omitempty"`
+	// Conditions are the observations of the cluster by the health probes,
+	// including Reachable, Authenticated, Healthy and CredentialValid.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 var _ resource.ObjectWithArbitrarySubResource = &ClusterGateway{}
@@ -200,6 +277,8 @@ var _ resource.ObjectWithArbitrarySubResource = &ClusterGateway{}
 func (in *ClusterGateway) GetArbitrarySubResources() []resource.ArbitrarySubResource {
 	return []resource.ArbitrarySubResource{
 		&ClusterGatewayProxy{},
+		&ClusterGatewayFanout{},
 		&ClusterGatewayHealth{},
+		&ClusterGatewayIdentityExchange{},
 	}
 }
@@ -7,9 +7,7 @@ import (
 	"strconv"
 	"strings"
 
-	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/apiserver/pkg/registry/rest"
-	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/utils/pointer"
 
 	"github.com/oam-dev/cluster-gateway/pkg/common"
@@ -22,11 +20,14 @@ import (
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/pkg/apis/clientauthentication"
 	"k8s.io/klog/v2"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 )
@@ -44,6 +45,8 @@ var _ rest.Lister = &ClusterGateway{}
 const (
 	AnnotationKeyClusterGatewayStatusHealthy       = "status.cluster.core.oam.dev/healthy"
 	AnnotationKeyClusterGatewayStatusHealthyReason = "status.cluster.core.oam.dev/healthy-reason"
+	AnnotationKeyClusterGatewayStatusProbe         = "status.cluster.core.oam.dev/probe"
+	AnnotationKeyClusterGatewayStatusConditions    = "status.cluster.core.oam.dev/conditions"
 )
 
 func (in *ClusterGateway) Get(ctx context.Context, name string, _ *metav1.GetOptions) (runtime.Object, error) {
@@ -72,10 +75,6 @@ func (in *ClusterGateway) Get(ctx context.Context, name string, _ *metav1.GetOpt
 }
 
 func (in *ClusterGateway) List(ctx context.Context, opt *internalversion.ListOptions) (runtime.Object, error) {
-	if opt.Watch {
-		// TODO: convert watch events from both Secret and ManagedCluster
-		return nil, fmt.Errorf("watch not supported")
-	}
 	clusterSecrets, err := singleton.GetSecretControl().List(ctx)
 	if err != nil {
 		return nil, err
@@ -83,6 +82,9 @@ func (in *ClusterGateway) List(ctx context.Context, opt *internalversion.ListOpt
 	list := &ClusterGatewayList{
 		Items: []ClusterGateway{},
 	}
+	if informer := singleton.GetSecretInformer(); informer != nil {
+		list.ResourceVersion = informer.LastSyncResourceVersion()
+	}
 
 	if options.OCMIntegration {
 		clusters, err := singleton.GetClusterControl().List(ctx)
@@ -101,14 +103,18 @@ func (in *ClusterGateway) List(ctx context.Context, opt *internalversion.ListOpt
 					klog.Warningf("skipping %v: failed converting clustergateway resource", secret.Name)
 					continue
 				}
-				list.Items = append(list.Items, *gw)
+				if matchClusterGateway(opt, gw) {
+					list.Items = append(list.Items, *gw)
+				}
 			} else {
 				gw, err := convertFromSecret(secret)
 				if err != nil {
 					klog.Warningf("skipping %v: failed converting clustergateway resource", secret.Name)
 					continue
 				}
-				list.Items = append(list.Items, *gw)
+				if matchClusterGateway(opt, gw) {
+					list.Items = append(list.Items, *gw)
+				}
 			}
 		}
 		return list, nil
@@ -120,7 +126,9 @@ func (in *ClusterGateway) List(ctx context.Context, opt *internalversion.ListOpt
 			klog.Errorf("failed converting secret to gateway: %v", err)
 			continue
 		}
-		list.Items = append(list.Items, *gw)
+		if matchClusterGateway(opt, gw) {
+			list.Items = append(list.Items, *gw)
+		}
 	}
 	return list, nil
 }
@@ -137,19 +145,29 @@ func (in *ClusterGateway) ConvertToTable(ctx context.Context, object runtime.Obj
 }
 
 func convertFromSecret(clusterSecret *v1.Secret) (*ClusterGateway, error) {
-	caData, endpoint, err := getEndpointFromSecret(clusterSecret)
-	if err != nil {
-		return nil, err
-	}
-	return convert(caData, endpoint, caData == nil, clusterSecret)
+	return convertClusterSecret(nil, clusterSecret, true)
 }
 
 func convertFromManagedClusterAndSecret(managedCluster *clusterv1.ManagedCluster, clusterSecret *v1.Secret) (*ClusterGateway, error) {
-	caData, endpoint, err := getEndpointFromManagedCluster(managedCluster)
+	return convertClusterSecret(managedCluster, clusterSecret, true)
+}
+
+// convertClusterSecret converts the cluster secret, whose endpoint is taken
+// from the ManagedCluster if present. The Dynamic credential is left unissued
+// unless issueCredential is set.
+func convertClusterSecret(managedCluster *clusterv1.ManagedCluster, clusterSecret *v1.Secret, issueCredential bool) (*ClusterGateway, error) {
+	if managedCluster != nil {
+		caData, endpoint, err := getEndpointFromManagedCluster(managedCluster)
+		if err != nil {
+			return nil, err
+		}
+		return convert(caData, endpoint, false, clusterSecret, issueCredential)
+	}
+	caData, endpoint, err := getEndpointFromSecret(clusterSecret)
 	if err != nil {
 		return nil, err
 	}
-	return convert(caData, endpoint, false, clusterSecret)
+	return convert(caData, endpoint, caData == nil, clusterSecret, issueCredential)
 }
 
 func getEndpointFromManagedCluster(managedCluster *clusterv1.ManagedCluster) ([]byte, string, error) {
@@ -176,14 +194,38 @@ func getEndpointFromSecret(secret *v1.Secret) ([]byte, string, error) {
 	return caData, endpointStr, nil
 }
 
-func convert(caData []byte, apiServerEndpoint string, insecure bool, secret *v1.Secret) (*ClusterGateway, error) {
+// secretDataKeyEndpoints is the secret data key of the alternative endpoints,
+// the "endpoint" key is kept for the primary one
+const secretDataKeyEndpoints = "endpoints"
+
+// getEndpointsFromSecret reads the alternative endpoints of the cluster from
+// the "endpoints" key in JSON format, e.g.
+// [{"address": "https://zone-a.example.com", "caBundle": "<base64 encoded CA>"}]
+func getEndpointsFromSecret(secret *v1.Secret) ([]ClusterEndpointAddress, error) {
+	raw, ok := secret.Data[secretDataKeyEndpoints]
+	if !ok || len(raw) == 0 {
+		return nil, nil
+	}
+	var endpoints []ClusterEndpointAddress
+	if err := json.Unmarshal(raw, &endpoints); err != nil {
+		return nil, fmt.Errorf("failed to decode secret data key %s: %v", secretDataKeyEndpoints, err)
+	}
+	return endpoints, nil
+}
+
+func convert(caData []byte, apiServerEndpoint string, insecure bool, secret *v1.Secret, issueCredential bool) (*ClusterGateway, error) {
 	c := &ClusterGateway{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:              secret.Name,
+			UID:               secret.UID,
+			ResourceVersion:   secret.ResourceVersion,
 			CreationTimestamp: secret.CreationTimestamp,
+			Labels:            filterReservedKeys(secret.Labels, reservedSecretLabelKeys),
+			Annotations:       filterReservedKeys(secret.Annotations, reservedSecretAnnotationKeys),
 		},
 		Spec: ClusterGatewaySpec{
-			Access: ClusterAccess{},
+			Provider: secret.Labels[common.LabelKeyClusterProvider],
+			Access:   ClusterAccess{},
 		},
 	}
 
@@ -204,25 +246,38 @@ func convert(caData []byte, apiServerEndpoint string, insecure bool, secret *v1.
 	case ClusterEndpointTypeConst:
 		fallthrough // backward compatibility
 	default:
+		endpoints, err := getEndpointsFromSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		if len(apiServerEndpoint) == 0 && len(endpoints) > 0 {
+			apiServerEndpoint = endpoints[0].Address
+		}
 		if len(apiServerEndpoint) == 0 {
 			return nil, errors.New("missing label key: api-endpoint")
 		}
+		for _, endpoint := range endpoints {
+			// the endpoints are verified by their own CA
+			insecure = insecure && len(endpoint.CABundle) == 0
+		}
 		if insecure {
 			c.Spec.Access.Endpoint = &ClusterEndpoint{
 				Type: ClusterEndpointType(endpointType),
 				Const: &ClusterEndpointConst{
-					Address:  apiServerEndpoint,
-					Insecure: &insecure,
-					ProxyURL: proxyURL,
+					Address:   apiServerEndpoint,
+					Insecure:  &insecure,
+					ProxyURL:  proxyURL,
+					Endpoints: endpoints,
 				},
 			}
 		} else {
 			c.Spec.Access.Endpoint = &ClusterEndpoint{
 				Type: ClusterEndpointType(endpointType),
 				Const: &ClusterEndpointConst{
-					Address:  apiServerEndpoint,
-					CABundle: caData,
-					ProxyURL: proxyURL,
+					Address:   apiServerEndpoint,
+					CABundle:  caData,
+					ProxyURL:  proxyURL,
+					Endpoints: endpoints,
 				},
 			}
 		}
@@ -253,9 +308,13 @@ func convert(caData []byte, apiServerEndpoint string, insecure bool, secret *v1.
 		}
 
 	case CredentialTypeDynamic:
-		credential, err := buildCredentialFromExecConfig(secret)
+		if !issueCredential {
+			c.Spec.Access.Credential = &ClusterAccessCredential{Type: CredentialTypeDynamic}
+			break
+		}
+		credential, err := buildDynamicCredential(secret, c.Spec.Access.Endpoint)
 		if err != nil {
-			return nil, fmt.Errorf("failed to issue credential from external command: %s", err)
+			return nil, fmt.Errorf("failed to issue credential from provider: %s", err)
 		}
 
 		c.Spec.Access.Credential = credential
@@ -263,6 +322,9 @@ func convert(caData []byte, apiServerEndpoint string, insecure bool, secret *v1.
 	default:
 		return nil, fmt.Errorf("unrecognized secret credential type %v", credentialType)
 	}
+	if expiration, ok := getCredentialExpiration(c.Spec.Access.Credential); ok {
+		c.Status.CredentialExpirationTime = &metav1.Time{Time: expiration}
+	}
 
 	if utilfeature.DefaultMutableFeatureGate.Enabled(featuregates.HealthinessCheck) {
 		if healthyRaw, ok := secret.Annotations[AnnotationKeyClusterGatewayStatusHealthy]; ok {
@@ -275,35 +337,91 @@ func convert(caData []byte, apiServerEndpoint string, insecure bool, secret *v1.
 		if healthyReason, ok := secret.Annotations[AnnotationKeyClusterGatewayStatusHealthyReason]; ok {
 			c.Status.HealthyReason = HealthyReasonType(healthyReason)
 		}
+		if probeRaw, ok := secret.Annotations[AnnotationKeyClusterGatewayStatusProbe]; ok {
+			if err := unmarshalProbeStatus(probeRaw, &c.Status); err != nil {
+				klog.Warningf("Ignoring the probe status of cluster %s: %v", c.Name, err)
+			}
+		}
+		if conditionsRaw, ok := secret.Annotations[AnnotationKeyClusterGatewayStatusConditions]; ok {
+			if err := json.Unmarshal([]byte(conditionsRaw), &c.Status.Conditions); err != nil {
+				klog.Warningf("Ignoring the conditions of cluster %s: %v", c.Name, err)
+			}
+		}
+		// the credential is verified upon reading instead of trusting the
+		// last probe, as the secret can be updated in between
+		SetCredentialCondition(c)
 	}
 
+	// the invalid proxy config of the cluster fails the identity exchange
+	// instead of falling back to the global one, see exchangeClusterIdentity
+	meta.RemoveStatusCondition(&c.Status.Conditions, ClusterGatewayConditionProxyConfigurationValid)
 	if utilfeature.DefaultMutableFeatureGate.Enabled(featuregates.ClientIdentityPenetration) {
-		if proxyConfigRaw, ok := secret.Annotations[AnnotationClusterGatewayProxyConfiguration]; ok {
-			proxyConfig := &ClusterGatewayProxyConfiguration{}
-			if err := yaml.Unmarshal([]byte(proxyConfigRaw), proxyConfig); err == nil {
+		if _, ok := secret.Annotations[AnnotationClusterGatewayProxyConfiguration]; ok {
+			proxyConfig, errs := getClusterProxyConfiguration(secret.Annotations, field.NewPath("metadata").Child("annotations"))
+			if len(errs) > 0 {
+				klog.Warningf("Invalid proxy config of cluster %s: %v", c.Name, errs.ToAggregate())
+			} else {
 				for _, rule := range proxyConfig.Spec.Rules {
 					rule.Source.Cluster = pointer.String(c.Name)
 				}
 				c.Spec.ProxyConfig = proxyConfig
 			}
+			meta.SetStatusCondition(&c.Status.Conditions, getProxyConfigurationCondition(errs))
 		}
 	}
 
 	return c, nil
 }
 
-func buildCredentialFromExecConfig(secret *v1.Secret) (*ClusterAccessCredential, error) {
-	execConfigRaw := secret.Data["exec"]
-	if len(execConfigRaw) == 0 {
-		return nil, errors.New("missing secret data key: exec")
+// getCredentialProvider returns the provider of the Dynamic credential, which
+// is also the secret data key of the provider config
+func getCredentialProvider(secret *v1.Secret) string {
+	if provider := secret.Labels[common.LabelKeyClusterCredentialProvider]; len(provider) > 0 {
+		return provider
+	}
+	return exec.CredentialProviderExec
+}
+
+// buildExecClusterInfo returns the cluster info passed to the credential
+// providers, which is only available for the const endpoints
+func buildExecClusterInfo(endpoint *ClusterEndpoint) *clientauthentication.Cluster {
+	if endpoint == nil || endpoint.Const == nil {
+		return nil
+	}
+	info := &clientauthentication.Cluster{
+		Server:                   endpoint.Const.Address,
+		CertificateAuthorityData: endpoint.Const.CABundle,
+		InsecureSkipTLSVerify:    pointer.BoolDeref(endpoint.Const.Insecure, false),
 	}
+	if endpoint.Const.ProxyURL != nil {
+		info.ProxyURL = *endpoint.Const.ProxyURL
+	}
+	return info
+}
 
-	var ec clientcmdapi.ExecConfig
-	if err := json.Unmarshal(execConfigRaw, &ec); err != nil {
-		return nil, fmt.Errorf("failed to decode exec config JSON from secret data: %v", err)
+// getCredentialProviderConfig returns the provider of the Dynamic credential
+// and its validated config, failing fast upon the invalid config, e.g. missing
+// the command, before issuing or reading the cached credential.
+func getCredentialProviderConfig(secret *v1.Secret) (string, []byte, error) {
+	provider := getCredentialProvider(secret)
+	providerConfig := secret.Data[provider]
+	if len(providerConfig) == 0 {
+		return "", nil, fmt.Errorf("missing secret data key: %s", provider)
+	}
+	if err := exec.ValidateCredentialProviderConfig(provider, providerConfig); err != nil {
+		return "", nil, err
+	}
+	return provider, providerConfig, nil
+}
+
+func buildDynamicCredential(secret *v1.Secret, endpoint *ClusterEndpoint) (*ClusterAccessCredential, error) {
+	provider, providerConfig, err := getCredentialProviderConfig(secret)
+	if err != nil {
+		return nil, err
 	}
 
-	cred, err := exec.IssueClusterCredential(secret.Name, &ec)
+	ctx := exec.WithClusterInfo(context.TODO(), buildExecClusterInfo(endpoint))
+	cred, err := exec.IssueClusterCredentialWithProvider(ctx, secret.Name, provider, providerConfig)
 	if err != nil {
 		return nil, err
 	}
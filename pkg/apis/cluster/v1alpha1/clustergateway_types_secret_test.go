@@ -2,13 +2,17 @@ package v1alpha1
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/oam-dev/cluster-gateway/pkg/common"
 	"github.com/oam-dev/cluster-gateway/pkg/config"
 	"github.com/oam-dev/cluster-gateway/pkg/featuregates"
 	"github.com/oam-dev/cluster-gateway/pkg/options"
 	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
+	"github.com/oam-dev/cluster-gateway/pkg/util/exec"
 	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
 
 	"github.com/stretchr/testify/assert"
@@ -19,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/apis/clientauthentication"
 	"k8s.io/component-base/featuregate"
 	k8stesting "k8s.io/component-base/featuregate/testing"
 	"k8s.io/utils/pointer"
@@ -108,6 +113,62 @@ func TestConvertSecretToGateway(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "multiple endpoints conversion",
+			inputSecret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: testNamespace,
+					Name:      testName,
+					Labels: map[string]string{
+						common.LabelKeyClusterCredentialType: string(CredentialTypeServiceAccountToken),
+					},
+				},
+				Data: map[string][]byte{
+					"token":     []byte(testToken),
+					"endpoints": []byte(`[{"address": "https://zone-a.example.com", "caBundle": "Y2E="}, {"address": "https://zone-b.example.com"}]`),
+				},
+			},
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: testName,
+				},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address: "https://zone-a.example.com",
+								Endpoints: []ClusterEndpointAddress{
+									{Address: "https://zone-a.example.com", CABundle: []byte("ca")},
+									{Address: "https://zone-b.example.com"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid endpoints should fail",
+			inputSecret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: testNamespace,
+					Name:      testName,
+					Labels: map[string]string{
+						common.LabelKeyClusterCredentialType: string(CredentialTypeServiceAccountToken),
+					},
+				},
+				Data: map[string][]byte{
+					"token":     []byte(testToken),
+					"endpoints": []byte(`not-json`),
+				},
+			},
+			expectedFailure: true,
+		},
 		{
 			name: "x509 certificate conversion",
 			inputSecret: &corev1.Secret{
@@ -236,6 +297,8 @@ func TestConvertSecretToGateway(t *testing.T) {
 					Annotations: map[string]string{
 						AnnotationKeyClusterGatewayStatusHealthy:       "True",
 						AnnotationKeyClusterGatewayStatusHealthyReason: "MyReason",
+						AnnotationKeyClusterGatewayStatusProbe:         `{"probeLatency": "1s", "consecutiveSuccesses": 2, "failingChecks": ["readyz:etcd"], "version": "v1.31.0"}`,
+						AnnotationKeyClusterGatewayStatusConditions:    `[{"type": "Healthy", "status": "True", "reason": "ProbeSucceeded", "lastTransitionTime": "2024-01-01T00:00:00Z", "message": ""}, {"type": "CredentialValid", "status": "False", "reason": "InvalidPrivateKey", "lastTransitionTime": "2024-01-01T00:00:00Z", "message": "stale"}]`,
 					},
 					Labels: map[string]string{
 						common.LabelKeyClusterCredentialType: string(CredentialTypeX509Certificate),
@@ -271,8 +334,25 @@ func TestConvertSecretToGateway(t *testing.T) {
 					},
 				},
 				Status: ClusterGatewayStatus{
-					Healthy:       true,
-					HealthyReason: "MyReason",
+					Healthy:              true,
+					HealthyReason:        "MyReason",
+					ProbeLatency:         &metav1.Duration{Duration: time.Second},
+					ConsecutiveSuccesses: 2,
+					FailingChecks:        []string{"readyz:etcd"},
+					Version:              "v1.31.0",
+					Conditions: []metav1.Condition{{
+						Type:               ClusterGatewayConditionHealthy,
+						Status:             metav1.ConditionTrue,
+						Reason:             "ProbeSucceeded",
+						LastTransitionTime: metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Local()),
+					}, {
+						// verified again upon conversion
+						Type:               ClusterGatewayConditionCredentialValid,
+						Status:             metav1.ConditionFalse,
+						Reason:             "InvalidCertificate",
+						Message:            "failed to parse certificate: data does not contain any valid RSA or ECDSA certificates",
+						LastTransitionTime: metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Local()),
+					}},
 				},
 			},
 		},
@@ -636,7 +716,7 @@ func TestListHybridClusterGateway(t *testing.T) {
 	assert.Equal(t, expectedNames, actualNames)
 }
 
-func TestBuildCredentialFromExecConfig(t *testing.T) {
+func TestBuildDynamicCredential(t *testing.T) {
 	cases := []struct {
 		name          string
 		secret        func(s *corev1.Secret) *corev1.Secret
@@ -658,6 +738,15 @@ func TestBuildCredentialFromExecConfig(t *testing.T) {
 			expectedError: "failed to decode exec config JSON from secret data: invalid character 's' looking for beginning of value",
 		},
 
+		{
+			name: "exec config of unknown apiVersion",
+			secret: func(s *corev1.Secret) *corev1.Secret {
+				s.Data["exec"] = []byte(`{"apiVersion": "example.org/v1", "command": "echo"}`)
+				return s
+			},
+			expectedError: `exec plugin: invalid apiVersion "example.org/v1"`,
+		},
+
 		{
 			name: "returns successfully a service account token",
 			secret: func(s *corev1.Secret) *corev1.Secret {
@@ -684,6 +773,44 @@ func TestBuildCredentialFromExecConfig(t *testing.T) {
 				},
 			},
 		},
+
+		{
+			name: "missing config of the credential provider",
+			secret: func(s *corev1.Secret) *corev1.Secret {
+				s.Labels[common.LabelKeyClusterCredentialProvider] = exec.CredentialProviderTokenFile
+				s.Data["exec"] = []byte(`{}`)
+				return s
+			},
+			expectedError: "missing secret data key: token-file",
+		},
+
+		{
+			name: "unknown credential provider",
+			secret: func(s *corev1.Secret) *corev1.Secret {
+				s.Labels[common.LabelKeyClusterCredentialProvider] = "unknown"
+				s.Data["unknown"] = []byte(`{}`)
+				return s
+			},
+			expectedError: `unknown credential provider "unknown"`,
+		},
+
+		{
+			name: "returns successfully a token from the token file",
+			secret: func(s *corev1.Secret) *corev1.Secret {
+				path := filepath.Join(t.TempDir(), "token")
+				require.NoError(t, os.WriteFile(path, []byte(testToken+"\n"), 0600))
+				allowed := config.DynamicCredentialTokenFileDirs
+				t.Cleanup(func() { config.DynamicCredentialTokenFileDirs = allowed })
+				config.DynamicCredentialTokenFileDirs = []string{filepath.Dir(path)}
+				s.Labels[common.LabelKeyClusterCredentialProvider] = exec.CredentialProviderTokenFile
+				s.Data[exec.CredentialProviderTokenFile] = []byte(`{"path": "` + path + `"}`)
+				return s
+			},
+			expected: &ClusterAccessCredential{
+				Type:                CredentialTypeDynamic,
+				ServiceAccountToken: testToken,
+			},
+		},
 	}
 
 	for _, tt := range cases {
@@ -692,6 +819,7 @@ func TestBuildCredentialFromExecConfig(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      testName,
 					Namespace: testNamespace,
+					Labels:    map[string]string{},
 				},
 				Data: map[string][]byte{},
 			}
@@ -699,7 +827,7 @@ func TestBuildCredentialFromExecConfig(t *testing.T) {
 				secret = tt.secret(secret)
 			}
 
-			got, err := buildCredentialFromExecConfig(secret)
+			got, err := buildDynamicCredential(secret, nil)
 			if tt.expectedError != "" {
 				assert.Error(t, err)
 				assert.EqualError(t, err, tt.expectedError)
@@ -711,3 +839,30 @@ func TestBuildCredentialFromExecConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildExecClusterInfo(t *testing.T) {
+	assert.Nil(t, buildExecClusterInfo(nil))
+	assert.Nil(t, buildExecClusterInfo(&ClusterEndpoint{Type: ClusterEndpointTypeClusterProxy}))
+	assert.Equal(t, &clientauthentication.Cluster{
+		Server:                   testEndpoint,
+		CertificateAuthorityData: []byte(testCAData),
+		ProxyURL:                 "socks5://localhost:1080",
+	}, buildExecClusterInfo(&ClusterEndpoint{
+		Type: ClusterEndpointTypeConst,
+		Const: &ClusterEndpointConst{
+			Address:  testEndpoint,
+			CABundle: []byte(testCAData),
+			ProxyURL: pointer.String("socks5://localhost:1080"),
+		},
+	}))
+	assert.Equal(t, &clientauthentication.Cluster{
+		Server:                testEndpoint,
+		InsecureSkipTLSVerify: true,
+	}, buildExecClusterInfo(&ClusterEndpoint{
+		Type: ClusterEndpointTypeConst,
+		Const: &ClusterEndpointConst{
+			Address:  testEndpoint,
+			Insecure: pointer.Bool(true),
+		},
+	}))
+}
@@ -0,0 +1,390 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"github.com/oam-dev/cluster-gateway/pkg/common"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/options"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+var _ rest.Watcher = &ClusterGateway{}
+
+const (
+	clusterGatewayWatchBufferSize       = 100
+	clusterGatewayWatchBookmarkInterval = time.Minute
+)
+
+// Watch converts the events from the cluster secret informer (and the OCM
+// ManagedCluster informer if OCM integration is enabled) into ClusterGateway
+// events. Because the gateway is not backed by a watch cache, deletions that
+// happen before the requested resourceVersion was observed are not replayed,
+// the client-side reflector will catch up on its next relist.
+func (in *ClusterGateway) Watch(ctx context.Context, opt *internalversion.ListOptions) (watch.Interface, error) {
+	secretInformer := singleton.GetSecretInformer()
+	if secretInformer == nil {
+		return nil, apierrors.NewMethodNotSupported(schema.GroupResource{
+			Group:    config.MetaApiGroupName,
+			Resource: config.MetaApiResourceName,
+		}, "watch (requires the SecretCache feature gate)")
+	}
+	if opt == nil {
+		opt = &internalversion.ListOptions{}
+	}
+	var sinceRV uint64
+	if len(opt.ResourceVersion) > 0 {
+		rv, err := parseResourceVersion(opt.ResourceVersion)
+		if err != nil {
+			return nil, apierrors.NewBadRequest(err.Error())
+		}
+		sinceRV = rv
+	}
+
+	w := &clusterGatewayWatcher{
+		ctx:     ctx,
+		opt:     opt,
+		sinceRV: sinceRV,
+		result:  make(chan watch.Event, clusterGatewayWatchBufferSize),
+		stopCh:  make(chan struct{}),
+		lastRV:  sinceRV,
+	}
+
+	secretReg, err := secretInformer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc:    w.onSecretAdd,
+		UpdateFunc: w.onSecretUpdate,
+		DeleteFunc: w.onSecretDelete,
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.registrations = append(w.registrations, informerRegistration{informer: secretInformer, registration: secretReg})
+
+	if clusterInformer := singleton.GetClusterInformer(); options.OCMIntegration && clusterInformer != nil {
+		clusterReg, err := clusterInformer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+			AddFunc:    w.onClusterAdd,
+			UpdateFunc: w.onClusterUpdate,
+			DeleteFunc: w.onClusterDelete,
+		})
+		if err != nil {
+			w.Stop()
+			return nil, err
+		}
+		w.registrations = append(w.registrations, informerRegistration{informer: clusterInformer, registration: clusterReg})
+	}
+
+	go w.run(secretReg)
+	return w, nil
+}
+
+// +k8s:openapi-gen=false
+type informerRegistration struct {
+	informer     cache.SharedIndexInformer
+	registration cache.ResourceEventHandlerRegistration
+}
+
+var _ watch.Interface = &clusterGatewayWatcher{}
+
+// +k8s:openapi-gen=false
+type clusterGatewayWatcher struct {
+	ctx     context.Context
+	opt     *internalversion.ListOptions
+	sinceRV uint64
+
+	registrations []informerRegistration
+
+	// mu guards the result channel from being closed while sending
+	mu       sync.RWMutex
+	stopped  bool
+	stopOnce sync.Once
+	result   chan watch.Event
+	stopCh   chan struct{}
+
+	rvLock sync.Mutex
+	lastRV uint64
+}
+
+func (w *clusterGatewayWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *clusterGatewayWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+		for _, r := range w.registrations {
+			if err := r.informer.RemoveEventHandler(r.registration); err != nil {
+				klog.Warningf("failed removing clustergateway watch event handler: %v", err)
+			}
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.stopped = true
+		close(w.result)
+	})
+}
+
+func (w *clusterGatewayWatcher) run(initial cache.ResourceEventHandlerRegistration) {
+	defer w.Stop()
+	if cache.WaitForCacheSync(w.stopCh, initial.HasSynced) && w.opt.SendInitialEvents != nil && *w.opt.SendInitialEvents {
+		w.sendBookmark(map[string]string{metav1.InitialEventsAnnotationKey: "true"})
+	}
+	var bookmarks <-chan time.Time
+	if w.opt.AllowWatchBookmarks {
+		ticker := time.NewTicker(clusterGatewayWatchBookmarkInterval)
+		defer ticker.Stop()
+		bookmarks = ticker.C
+	}
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-w.stopCh:
+			return
+		case <-bookmarks:
+			w.sendBookmark(nil)
+		}
+	}
+}
+
+func (w *clusterGatewayWatcher) send(ev watch.Event) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.stopped {
+		return
+	}
+	select {
+	case w.result <- ev:
+	case <-w.stopCh:
+	}
+}
+
+func (w *clusterGatewayWatcher) sendBookmark(annotations map[string]string) {
+	if !w.opt.AllowWatchBookmarks {
+		return
+	}
+	w.rvLock.Lock()
+	rv := w.lastRV
+	w.rvLock.Unlock()
+	w.send(watch.Event{
+		Type: watch.Bookmark,
+		Object: &ClusterGateway{
+			ObjectMeta: metav1.ObjectMeta{
+				ResourceVersion: strconv.FormatUint(rv, 10),
+				Annotations:     annotations,
+			},
+		},
+	})
+}
+
+func (w *clusterGatewayWatcher) observeResourceVersion(rv string) {
+	parsed, err := parseResourceVersion(rv)
+	if err != nil {
+		return
+	}
+	w.rvLock.Lock()
+	defer w.rvLock.Unlock()
+	if parsed > w.lastRV {
+		w.lastRV = parsed
+	}
+}
+
+// dispatch emits the event describing the transition from the old to the
+// new object w.r.t. the selectors from the watch options.
+func (w *clusterGatewayWatcher) dispatch(oldObj, newObj *ClusterGateway) {
+	oldMatched := oldObj != nil && matchClusterGateway(w.opt, oldObj)
+	newMatched := newObj != nil && matchClusterGateway(w.opt, newObj)
+	switch {
+	case oldMatched && newMatched:
+		w.send(watch.Event{Type: watch.Modified, Object: newObj})
+	case newMatched:
+		w.send(watch.Event{Type: watch.Added, Object: newObj})
+	case oldMatched:
+		w.send(watch.Event{Type: watch.Deleted, Object: oldObj})
+	}
+}
+
+func (w *clusterGatewayWatcher) onSecretAdd(obj interface{}, isInInitialList bool) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		return
+	}
+	w.observeResourceVersion(secret.ResourceVersion)
+	if isInInitialList && w.sinceRV > 0 {
+		// the client already observed the objects until the requested
+		// resource version, replaying the newer ones as modifications.
+		rv, err := parseResourceVersion(secret.ResourceVersion)
+		if err != nil || rv <= w.sinceRV {
+			return
+		}
+		if gw := w.convertSecret(secret); gw != nil && matchClusterGateway(w.opt, gw) {
+			w.send(watch.Event{Type: watch.Modified, Object: gw})
+		}
+		return
+	}
+	if isInInitialList && w.opt.SendInitialEvents != nil && !*w.opt.SendInitialEvents {
+		return
+	}
+	w.dispatch(nil, w.convertSecret(secret))
+}
+
+func (w *clusterGatewayWatcher) onSecretUpdate(oldObj, newObj interface{}) {
+	oldSecret, ok := oldObj.(*v1.Secret)
+	if !ok {
+		return
+	}
+	newSecret, ok := newObj.(*v1.Secret)
+	if !ok {
+		return
+	}
+	if oldSecret.ResourceVersion == newSecret.ResourceVersion {
+		return // periodic resync
+	}
+	w.observeResourceVersion(newSecret.ResourceVersion)
+	w.dispatch(w.convertSecret(oldSecret), w.convertSecret(newSecret))
+}
+
+func (w *clusterGatewayWatcher) onSecretDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		return
+	}
+	w.dispatch(w.convertSecret(secret), nil)
+}
+
+func (w *clusterGatewayWatcher) onClusterAdd(obj interface{}, isInInitialList bool) {
+	if isInInitialList {
+		// the initial state is already delivered by the secret informer
+		return
+	}
+	cluster, ok := obj.(*clusterv1.ManagedCluster)
+	if !ok {
+		return
+	}
+	w.onClusterChange(nil, cluster)
+}
+
+func (w *clusterGatewayWatcher) onClusterUpdate(oldObj, newObj interface{}) {
+	oldCluster, ok := oldObj.(*clusterv1.ManagedCluster)
+	if !ok {
+		return
+	}
+	newCluster, ok := newObj.(*clusterv1.ManagedCluster)
+	if !ok {
+		return
+	}
+	if oldCluster.ResourceVersion == newCluster.ResourceVersion {
+		return // periodic resync
+	}
+	w.onClusterChange(oldCluster, newCluster)
+}
+
+func (w *clusterGatewayWatcher) onClusterDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	cluster, ok := obj.(*clusterv1.ManagedCluster)
+	if !ok {
+		return
+	}
+	w.onClusterChange(cluster, nil)
+}
+
+// onClusterChange re-converts the cluster secret paired with the changing
+// ManagedCluster, the secret remains the source of truth of the gateway's
+// existence.
+func (w *clusterGatewayWatcher) onClusterChange(oldCluster, newCluster *clusterv1.ManagedCluster) {
+	name := ""
+	if newCluster != nil {
+		name = newCluster.Name
+	} else if oldCluster != nil {
+		name = oldCluster.Name
+	}
+	secret, err := singleton.GetSecretControl().Get(w.ctx, name)
+	if err != nil {
+		return
+	}
+	oldGw := convertWatchedClusterGateway(oldCluster, secret)
+	newGw := convertWatchedClusterGateway(newCluster, secret)
+	if oldGw == nil || newGw == nil {
+		return
+	}
+	w.dispatch(oldGw, newGw)
+}
+
+func (w *clusterGatewayWatcher) convertSecret(secret *v1.Secret) *ClusterGateway {
+	if _, ok := secret.Labels[common.LabelKeyClusterCredentialType]; !ok {
+		return nil
+	}
+	var cluster *clusterv1.ManagedCluster
+	if options.OCMIntegration && singleton.GetClusterControl() != nil {
+		if c, err := singleton.GetClusterControl().Get(w.ctx, secret.Name); err == nil {
+			cluster = c
+		}
+	}
+	return convertWatchedClusterGateway(cluster, secret)
+}
+
+// convertWatchedClusterGateway converts the cluster secret upon the informer
+// events. The Dynamic credentials are left unissued, as issuing them, e.g. by
+// running the exec plugin, would block the informer handlers. They are issued
+// when the cluster is proxied to, only the provider configs are validated so
+// that the invalid ones are skipped as by List.
+func convertWatchedClusterGateway(cluster *clusterv1.ManagedCluster, secret *v1.Secret) *ClusterGateway {
+	gw, err := convertClusterSecret(cluster, secret, false)
+	if err == nil && gw.Spec.Access.Credential.Type == CredentialTypeDynamic {
+		if _, _, err = getCredentialProviderConfig(secret); err != nil {
+			err = fmt.Errorf("invalid credential provider: %v", err)
+		}
+	}
+	if err != nil {
+		klog.Warningf("skipping %v: failed converting clustergateway resource: %v", secret.Name, err)
+		return nil
+	}
+	return gw
+}
+
+// matchClusterGateway checks the label and field selectors from the list
+// options against the cluster gateway.
+func matchClusterGateway(opt *internalversion.ListOptions, gw *ClusterGateway) bool {
+	if opt == nil {
+		return true
+	}
+	if opt.LabelSelector != nil && !opt.LabelSelector.Matches(labels.Set(gw.Labels)) {
+		return false
+	}
+	if opt.FieldSelector != nil && !opt.FieldSelector.Matches(fields.Set{"metadata.name": gw.Name}) {
+		return false
+	}
+	return true
+}
+
+func parseResourceVersion(rv string) (uint64, error) {
+	if len(rv) == 0 {
+		return 0, nil
+	}
+	parsed, err := strconv.ParseUint(rv, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid resource version %q: %v", rv, err)
+	}
+	return parsed, nil
+}
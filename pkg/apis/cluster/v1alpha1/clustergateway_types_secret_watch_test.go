@@ -0,0 +1,204 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1informer "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/pointer"
+
+	"github.com/oam-dev/cluster-gateway/pkg/common"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/options"
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+func newTestClusterSecret(name, rv string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       testNamespace,
+			Name:            name,
+			ResourceVersion: rv,
+			Labels: map[string]string{
+				common.LabelKeyClusterCredentialType: string(CredentialTypeServiceAccountToken),
+			},
+		},
+		Data: map[string][]byte{
+			"ca.crt":   []byte(testCAData),
+			"token":    []byte(testToken),
+			"endpoint": []byte(testEndpoint),
+		},
+	}
+}
+
+func setupTestSecretInformer(t *testing.T, objs ...*corev1.Secret) (*fake.Clientset, func()) {
+	options.OCMIntegration = false
+	config.SecretNamespace = testNamespace
+	fakeKubeClient := fake.NewSimpleClientset()
+	for _, obj := range objs {
+		_, err := fakeKubeClient.CoreV1().Secrets(testNamespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	informer := corev1informer.NewSecretInformer(fakeKubeClient, testNamespace, 0, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+	stopCh := make(chan struct{})
+	go informer.Run(stopCh)
+	require.True(t, cache.WaitForCacheSync(stopCh, informer.HasSynced))
+	singleton.SetSecretInformer(informer)
+	singleton.SetSecretControl(cert.NewCachedSecretControl(testNamespace, corev1lister.NewSecretLister(informer.GetIndexer())))
+	return fakeKubeClient, func() {
+		close(stopCh)
+		singleton.SetSecretInformer(nil)
+	}
+}
+
+func nextWatchEvent(t *testing.T, w watch.Interface) watch.Event {
+	select {
+	case ev, ok := <-w.ResultChan():
+		require.True(t, ok, "watch channel closed unexpectedly")
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for watch event")
+	}
+	return watch.Event{}
+}
+
+func TestWatchClusterGateway(t *testing.T) {
+	fakeKubeClient, cleanup := setupTestSecretInformer(t, newTestClusterSecret(testName, "1"))
+	defer cleanup()
+
+	storage := &ClusterGateway{}
+	w, err := storage.Watch(context.TODO(), &internalversion.ListOptions{})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	ev := nextWatchEvent(t, w)
+	assert.Equal(t, watch.Added, ev.Type)
+	assert.Equal(t, testName, ev.Object.(*ClusterGateway).Name)
+
+	_, err = fakeKubeClient.CoreV1().Secrets(testNamespace).Create(context.TODO(), newTestClusterSecret("new", "2"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Added, ev.Type)
+	assert.Equal(t, "new", ev.Object.(*ClusterGateway).Name)
+
+	updated := newTestClusterSecret("new", "3")
+	updated.Data["token"] = []byte("updated")
+	_, err = fakeKubeClient.CoreV1().Secrets(testNamespace).Update(context.TODO(), updated, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Modified, ev.Type)
+	assert.Equal(t, "updated", ev.Object.(*ClusterGateway).Spec.Access.Credential.ServiceAccountToken)
+	assert.Equal(t, "3", ev.Object.(*ClusterGateway).ResourceVersion)
+
+	// dropping the credential label removes the secret from the gateways
+	unlabeled := updated.DeepCopy()
+	unlabeled.ResourceVersion = "4"
+	unlabeled.Labels = nil
+	_, err = fakeKubeClient.CoreV1().Secrets(testNamespace).Update(context.TODO(), unlabeled, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Deleted, ev.Type)
+	assert.Equal(t, "new", ev.Object.(*ClusterGateway).Name)
+
+	require.NoError(t, fakeKubeClient.CoreV1().Secrets(testNamespace).Delete(context.TODO(), testName, metav1.DeleteOptions{}))
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Deleted, ev.Type)
+	assert.Equal(t, testName, ev.Object.(*ClusterGateway).Name)
+}
+
+func TestWatchClusterGatewayDynamicCredential(t *testing.T) {
+	dynamic := newTestClusterSecret("dynamic", "1")
+	dynamic.Labels[common.LabelKeyClusterCredentialType] = string(CredentialTypeDynamic)
+	// the command fails if the credential is issued
+	dynamic.Data["exec"] = []byte(`{"apiVersion": "client.authentication.k8s.io/v1beta1", "kind": "ExecConfig", "command": "false"}`)
+	invalid := newTestClusterSecret("invalid", "2")
+	invalid.Labels[common.LabelKeyClusterCredentialType] = string(CredentialTypeDynamic)
+	invalid.Data["exec"] = []byte("invalid exec config format")
+	_, cleanup := setupTestSecretInformer(t, dynamic, invalid, newTestClusterSecret(testName, "3"))
+	defer cleanup()
+
+	storage := &ClusterGateway{}
+	w, err := storage.Watch(context.TODO(), &internalversion.ListOptions{})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	received := map[string]*ClusterGateway{}
+	for i := 0; i < 2; i++ {
+		ev := nextWatchEvent(t, w)
+		assert.Equal(t, watch.Added, ev.Type)
+		gw := ev.Object.(*ClusterGateway)
+		received[gw.Name] = gw
+	}
+	require.Contains(t, received, "dynamic")
+	assert.Equal(t, &ClusterAccessCredential{Type: CredentialTypeDynamic}, received["dynamic"].Spec.Access.Credential)
+	assert.Contains(t, received, testName)
+	assert.NotContains(t, received, "invalid")
+}
+
+func TestWatchClusterGatewayFromResourceVersion(t *testing.T) {
+	_, cleanup := setupTestSecretInformer(t,
+		newTestClusterSecret("old", "5"),
+		newTestClusterSecret("newer", "7"))
+	defer cleanup()
+
+	storage := &ClusterGateway{}
+	w, err := storage.Watch(context.TODO(), &internalversion.ListOptions{
+		ResourceVersion:     "6",
+		AllowWatchBookmarks: true,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	ev := nextWatchEvent(t, w)
+	assert.Equal(t, watch.Modified, ev.Type)
+	assert.Equal(t, "newer", ev.Object.(*ClusterGateway).Name)
+
+	_, err = storage.Watch(context.TODO(), &internalversion.ListOptions{ResourceVersion: "invalid"})
+	assert.Error(t, err)
+}
+
+func TestWatchClusterGatewayInitialEvents(t *testing.T) {
+	_, cleanup := setupTestSecretInformer(t,
+		newTestClusterSecret(testName, "1"),
+		newTestClusterSecret("other", "2"))
+	defer cleanup()
+
+	storage := &ClusterGateway{}
+	w, err := storage.Watch(context.TODO(), &internalversion.ListOptions{
+		FieldSelector:       fields.OneTermEqualSelector("metadata.name", testName),
+		SendInitialEvents:   pointer.Bool(true),
+		AllowWatchBookmarks: true,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	ev := nextWatchEvent(t, w)
+	assert.Equal(t, watch.Added, ev.Type)
+	assert.Equal(t, testName, ev.Object.(*ClusterGateway).Name)
+
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Bookmark, ev.Type)
+	assert.Equal(t, "true", ev.Object.(*ClusterGateway).Annotations[metav1.InitialEventsAnnotationKey])
+	assert.Equal(t, "2", ev.Object.(*ClusterGateway).ResourceVersion)
+}
+
+func TestWatchClusterGatewayWithoutCache(t *testing.T) {
+	singleton.SetSecretInformer(nil)
+	storage := &ClusterGateway{}
+	_, err := storage.Watch(context.TODO(), &internalversion.ListOptions{})
+	assert.Error(t, err)
+}
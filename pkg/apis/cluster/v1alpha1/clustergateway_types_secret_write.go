@@ -0,0 +1,368 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/rest"
+
+	"github.com/oam-dev/cluster-gateway/pkg/common"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/options"
+	"github.com/oam-dev/cluster-gateway/pkg/util/exec"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+var _ rest.Creater = &ClusterGateway{}
+var _ rest.Updater = &ClusterGateway{}
+var _ rest.GracefulDeleter = &ClusterGateway{}
+
+var (
+	// reservedSecretLabelKeys are the secret labels holding the spec of
+	// the gateway which are not exposed as the labels of the gateway.
+	reservedSecretLabelKeys = []string{
+		common.LabelKeyClusterCredentialType,
+		common.LabelKeyClusterEndpointType,
+		common.LabelKeyClusterProvider,
+		common.LabelKeyClusterCredentialProvider,
+	}
+	// reservedSecretAnnotationKeys are the secret annotations holding the
+	// status of the gateway. They can only be updated via the "health"
+	// subresource or from the secret directly.
+	reservedSecretAnnotationKeys = []string{
+		AnnotationKeyClusterGatewayStatusHealthy,
+		AnnotationKeyClusterGatewayStatusHealthyReason,
+		AnnotationKeyClusterGatewayStatusProbe,
+		AnnotationKeyClusterGatewayStatusConditions,
+	}
+)
+
+func clusterGatewayGroupKind() schema.GroupKind {
+	return schema.GroupKind{
+		Group: config.MetaApiGroupName,
+		Kind:  "ClusterGateway",
+	}
+}
+
+func clusterGatewayGroupResource() schema.GroupResource {
+	return schema.GroupResource{
+		Group:    config.MetaApiGroupName,
+		Resource: config.MetaApiResourceName,
+	}
+}
+
+func (in *ClusterGateway) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	if singleton.GetKubeClient() == nil {
+		return nil, fmt.Errorf("loopback clients are not inited")
+	}
+	gw, ok := obj.(*ClusterGateway)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("not a ClusterGateway: %#v", obj))
+	}
+	if errs := ValidateClusterGateway(gw); len(errs) > 0 {
+		return nil, apierrors.NewInvalid(clusterGatewayGroupKind(), gw.Name, errs)
+	}
+	if createValidation != nil {
+		if err := createValidation(ctx, gw); err != nil {
+			return nil, err
+		}
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:    config.SecretNamespace,
+			Name:         gw.Name,
+			GenerateName: gw.GenerateName,
+		},
+	}
+	if err := convertToSecret(gw, secret, true); err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	created, err := singleton.GetKubeClient().CoreV1().
+		Secrets(config.SecretNamespace).
+		Create(ctx, secret, metav1.CreateOptions{DryRun: options.DryRun})
+	if err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return nil, apierrors.NewAlreadyExists(clusterGatewayGroupResource(), gw.Name)
+		}
+		return nil, err
+	}
+	return convertClusterSecret(nil, created, false)
+}
+
+func (in *ClusterGateway) Update(ctx context.Context, name string, objInfo rest.UpdatedObjectInfo, createValidation rest.ValidateObjectFunc, updateValidation rest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	if singleton.GetKubeClient() == nil {
+		return nil, false, fmt.Errorf("loopback clients are not inited")
+	}
+	// reading from the api directly instead of the cache to avoid updating
+	// upon stale resource version.
+	latestSecret, err := singleton.GetKubeClient().CoreV1().
+		Secrets(config.SecretNamespace).
+		Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, false, err
+		}
+		if !forceAllowCreate {
+			return nil, false, apierrors.NewNotFound(clusterGatewayGroupResource(), name)
+		}
+		creating, err := objInfo.UpdatedObject(ctx, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		created, err := in.Create(ctx, creating, createValidation, &metav1.CreateOptions{DryRun: options.DryRun})
+		if err != nil {
+			return nil, false, err
+		}
+		return created, true, nil
+	}
+	if _, ok := latestSecret.Labels[common.LabelKeyClusterCredentialType]; !ok {
+		return nil, false, apierrors.NewNotFound(clusterGatewayGroupResource(), name)
+	}
+
+	// the endpoint is read from the ManagedCluster instead of the secret if
+	// OCM integration is enabled, so it won't be written back.
+	existing, writeEndpoint, err := convertFromSecretForUpdate(ctx, latestSecret)
+	if err != nil {
+		return nil, false, err
+	}
+	updating, err := objInfo.UpdatedObject(ctx, existing)
+	if err != nil {
+		return nil, false, err
+	}
+	gw, ok := updating.(*ClusterGateway)
+	if !ok {
+		return nil, false, apierrors.NewBadRequest(fmt.Sprintf("not a ClusterGateway: %#v", updating))
+	}
+	if gw.Name != name {
+		return nil, false, apierrors.NewBadRequest(fmt.Sprintf("name mismatch: %q != %q", gw.Name, name))
+	}
+	if len(gw.ResourceVersion) > 0 && gw.ResourceVersion != latestSecret.ResourceVersion {
+		return nil, false, apierrors.NewConflict(clusterGatewayGroupResource(), name,
+			fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+	if errs := ValidateClusterGatewayUpdate(gw, existing); len(errs) > 0 {
+		return nil, false, apierrors.NewInvalid(clusterGatewayGroupKind(), gw.Name, errs)
+	}
+	if updateValidation != nil {
+		if err := updateValidation(ctx, gw, existing); err != nil {
+			return nil, false, err
+		}
+	}
+	secret := latestSecret.DeepCopy()
+	if err := convertToSecret(gw, secret, writeEndpoint); err != nil {
+		return nil, false, apierrors.NewBadRequest(err.Error())
+	}
+	updated, err := singleton.GetKubeClient().CoreV1().
+		Secrets(config.SecretNamespace).
+		Update(ctx, secret, metav1.UpdateOptions{DryRun: options.DryRun})
+	if err != nil {
+		return nil, false, err
+	}
+	if !writeEndpoint {
+		result, _, err := convertFromSecretForUpdate(ctx, updated)
+		return result, false, err
+	}
+	result, err := convertClusterSecret(nil, updated, false)
+	return result, false, err
+}
+
+func (in *ClusterGateway) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	if singleton.GetKubeClient() == nil {
+		return nil, false, fmt.Errorf("loopback clients are not inited")
+	}
+	if singleton.GetSecretControl() == nil {
+		return nil, false, fmt.Errorf("loopback secret client are not inited")
+	}
+	secret, err := singleton.GetSecretControl().Get(ctx, name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, apierrors.NewNotFound(clusterGatewayGroupResource(), name)
+		}
+		return nil, false, err
+	}
+	existing, _, err := convertFromSecretForUpdate(ctx, secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, apierrors.NewNotFound(clusterGatewayGroupResource(), name)
+		}
+		return nil, false, err
+	}
+	if deleteValidation != nil {
+		if err := deleteValidation(ctx, existing); err != nil {
+			return nil, false, err
+		}
+	}
+	if options == nil {
+		options = &metav1.DeleteOptions{}
+	}
+	if err := singleton.GetKubeClient().CoreV1().
+		Secrets(config.SecretNamespace).
+		Delete(ctx, name, metav1.DeleteOptions{
+			Preconditions:     options.Preconditions,
+			PropagationPolicy: options.PropagationPolicy,
+			DryRun:            options.DryRun,
+		}); err != nil {
+		return nil, false, err
+	}
+	return existing, true, nil
+}
+
+// convertFromSecretForUpdate converts the cluster secret for the writes, which
+// leave the Dynamic credential unissued so that a broken credential provider
+// doesn't block updating or deleting the cluster gateway.
+func convertFromSecretForUpdate(ctx context.Context, secret *v1.Secret) (*ClusterGateway, bool, error) {
+	if options.OCMIntegration && singleton.GetClusterControl() != nil {
+		if managedCluster, err := singleton.GetClusterControl().Get(ctx, secret.Name); err == nil {
+			gw, err := convertClusterSecret(managedCluster, secret, false)
+			return gw, false, err
+		}
+	}
+	gw, err := convertClusterSecret(nil, secret, false)
+	return gw, true, err
+}
+
+// convertToSecret is the reverse of convert, which writes the spec of the
+// cluster gateway into the secret.
+func convertToSecret(gw *ClusterGateway, secret *v1.Secret, writeEndpoint bool) error {
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+
+	// metadata
+	for k := range secret.Labels {
+		if !isReservedKey(k, reservedSecretLabelKeys) {
+			delete(secret.Labels, k)
+		}
+	}
+	for k, v := range filterReservedKeys(gw.Labels, reservedSecretLabelKeys) {
+		secret.Labels[k] = v
+	}
+	for k := range secret.Annotations {
+		if !isReservedKey(k, reservedSecretAnnotationKeys) {
+			delete(secret.Annotations, k)
+		}
+	}
+	for k, v := range filterReservedKeys(gw.Annotations, reservedSecretAnnotationKeys) {
+		secret.Annotations[k] = v
+	}
+	if len(gw.ResourceVersion) > 0 {
+		secret.ResourceVersion = gw.ResourceVersion
+	}
+	if len(gw.Spec.Provider) > 0 {
+		secret.Labels[common.LabelKeyClusterProvider] = gw.Spec.Provider
+	} else {
+		delete(secret.Labels, common.LabelKeyClusterProvider)
+	}
+
+	// endpoint
+	if gw.Spec.Access.Endpoint == nil {
+		return fmt.Errorf("missing endpoint")
+	}
+	secret.Labels[common.LabelKeyClusterEndpointType] = string(gw.Spec.Access.Endpoint.Type)
+	if writeEndpoint {
+		delete(secret.Data, "endpoint")
+		delete(secret.Data, "ca.crt")
+		delete(secret.Data, "ca")
+		delete(secret.Data, "proxy-url")
+		delete(secret.Data, secretDataKeyEndpoints)
+		switch gw.Spec.Access.Endpoint.Type {
+		case ClusterEndpointTypeConst:
+			endpoint := gw.Spec.Access.Endpoint.Const
+			if endpoint == nil {
+				return fmt.Errorf("missing const endpoint")
+			}
+			secret.Data["endpoint"] = []byte(endpoint.Address)
+			// an insecure endpoint is recognized by the absence of the CA
+			if (endpoint.Insecure == nil || !*endpoint.Insecure) && len(endpoint.CABundle) > 0 {
+				secret.Data["ca.crt"] = endpoint.CABundle
+			}
+			if endpoint.ProxyURL != nil && len(*endpoint.ProxyURL) > 0 {
+				secret.Data["proxy-url"] = []byte(*endpoint.ProxyURL)
+			}
+			if len(endpoint.Endpoints) > 0 {
+				endpoints, err := json.Marshal(endpoint.Endpoints)
+				if err != nil {
+					return err
+				}
+				secret.Data[secretDataKeyEndpoints] = endpoints
+			}
+		case ClusterEndpointTypeClusterProxy:
+		default:
+			return fmt.Errorf("unsupported endpoint type %v", gw.Spec.Access.Endpoint.Type)
+		}
+	}
+
+	// credential
+	if gw.Spec.Access.Credential == nil {
+		return fmt.Errorf("missing credential")
+	}
+	existingCredentialType := CredentialType(secret.Labels[common.LabelKeyClusterCredentialType])
+	credentialProvider := getCredentialProvider(secret)
+	secret.Labels[common.LabelKeyClusterCredentialType] = string(gw.Spec.Access.Credential.Type)
+	delete(secret.Data, v1.ServiceAccountTokenKey)
+	delete(secret.Data, v1.TLSCertKey)
+	delete(secret.Data, v1.TLSPrivateKeyKey)
+	removeCredentialProvider := func() {
+		if _, ok := exec.GetCredentialProvider(credentialProvider); ok {
+			delete(secret.Data, credentialProvider)
+		}
+		delete(secret.Labels, common.LabelKeyClusterCredentialProvider)
+	}
+	switch gw.Spec.Access.Credential.Type {
+	case CredentialTypeServiceAccountToken:
+		secret.Data[v1.ServiceAccountTokenKey] = []byte(gw.Spec.Access.Credential.ServiceAccountToken)
+		removeCredentialProvider()
+	case CredentialTypeX509Certificate:
+		if gw.Spec.Access.Credential.X509 == nil {
+			return fmt.Errorf("missing x509 credential")
+		}
+		secret.Data[v1.TLSCertKey] = gw.Spec.Access.Credential.X509.Certificate
+		secret.Data[v1.TLSPrivateKeyKey] = gw.Spec.Access.Credential.X509.PrivateKey
+		removeCredentialProvider()
+	case CredentialTypeDynamic:
+		// the issued credential is not persisted, the provider config is kept
+		if existingCredentialType != CredentialTypeDynamic || len(secret.Data[credentialProvider]) == 0 {
+			return fmt.Errorf("dynamic credential can only be configured via the %q key of the cluster secret", credentialProvider)
+		}
+	default:
+		return fmt.Errorf("unsupported credential type %v", gw.Spec.Access.Credential.Type)
+	}
+	return nil
+}
+
+func isReservedKey(key string, reserved []string) bool {
+	for _, r := range reserved {
+		if key == r {
+			return true
+		}
+	}
+	return false
+}
+
+// filterReservedKeys returns a copy of the map without the reserved keys, or
+// nil if nothing is left.
+func filterReservedKeys(m map[string]string, reserved []string) map[string]string {
+	var filtered map[string]string
+	for k, v := range m {
+		if isReservedKey(k, reserved) {
+			continue
+		}
+		if filtered == nil {
+			filtered = map[string]string{}
+		}
+		filtered[k] = v
+	}
+	return filtered
+}
@@ -0,0 +1,298 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"github.com/oam-dev/cluster-gateway/pkg/common"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/options"
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert/certtest"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+func setupTestSecretClient(objs ...*corev1.Secret) *fake.Clientset {
+	options.OCMIntegration = false
+	config.SecretNamespace = testNamespace
+	fakeKubeClient := fake.NewSimpleClientset()
+	for _, obj := range objs {
+		_ = fakeKubeClient.Tracker().Add(obj)
+	}
+	singleton.SetKubeClient(fakeKubeClient)
+	singleton.SetSecretControl(cert.NewDirectApiSecretControl(testNamespace, fakeKubeClient))
+	return fakeKubeClient
+}
+
+func TestConvertClusterGatewayToSecret(t *testing.T) {
+	cases := []struct {
+		name            string
+		gateway         *ClusterGateway
+		existing        *corev1.Secret
+		expectedFailure bool
+		expected        *corev1.Secret
+	}{
+		{
+			name: "service-account token with ca",
+			gateway: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        testName,
+					Labels:      map[string]string{"env": "dev"},
+					Annotations: map[string]string{"foo": "bar"},
+				},
+				Spec: ClusterGatewaySpec{
+					Provider: "kind",
+					Access: ClusterAccess{
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+								ProxyURL: pointer.String("socks5://localhost:1080"),
+							},
+						},
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+					},
+				},
+			},
+			expected: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"env":                                "dev",
+						common.LabelKeyClusterProvider:       "kind",
+						common.LabelKeyClusterEndpointType:   string(ClusterEndpointTypeConst),
+						common.LabelKeyClusterCredentialType: string(CredentialTypeServiceAccountToken),
+					},
+					Annotations: map[string]string{"foo": "bar"},
+				},
+				Data: map[string][]byte{
+					"endpoint":  []byte(testEndpoint),
+					"ca.crt":    []byte(testCAData),
+					"proxy-url": []byte("socks5://localhost:1080"),
+					"token":     []byte(testToken),
+				},
+			},
+		},
+		{
+			name: "x509 certificate over cluster-proxy replacing token",
+			gateway: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeClusterProxy,
+						},
+						Credential: &ClusterAccessCredential{
+							Type: CredentialTypeX509Certificate,
+							X509: &X509{
+								Certificate: []byte(testCertData),
+								PrivateKey:  []byte(testKeyData),
+							},
+						},
+					},
+				},
+			},
+			existing: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"env":                                "dev",
+						common.LabelKeyClusterCredentialType: string(CredentialTypeServiceAccountToken),
+					},
+					Annotations: map[string]string{
+						AnnotationKeyClusterGatewayStatusHealthy: "true",
+					},
+				},
+				Data: map[string][]byte{
+					"endpoint": []byte(testEndpoint),
+					"ca":       []byte(testCAData),
+					"token":    []byte(testToken),
+				},
+			},
+			expected: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						common.LabelKeyClusterEndpointType:   string(ClusterEndpointTypeClusterProxy),
+						common.LabelKeyClusterCredentialType: string(CredentialTypeX509Certificate),
+					},
+					Annotations: map[string]string{
+						AnnotationKeyClusterGatewayStatusHealthy: "true",
+					},
+				},
+				Data: map[string][]byte{
+					"tls.crt": []byte(testCertData),
+					"tls.key": []byte(testKeyData),
+				},
+			},
+		},
+		{
+			name: "dynamic credential without exec config should fail",
+			gateway: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeClusterProxy,
+						},
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeDynamic,
+							ServiceAccountToken: testToken,
+						},
+					},
+				},
+			},
+			expectedFailure: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			secret := &corev1.Secret{}
+			if c.existing != nil {
+				secret = c.existing.DeepCopy()
+			}
+			err := convertToSecret(c.gateway, secret, true)
+			if c.expectedFailure {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, secret)
+		})
+	}
+}
+
+func TestCreateUpdateDeleteClusterGateway(t *testing.T) {
+	fakeKubeClient := setupTestSecretClient()
+	storage := &ClusterGateway{}
+	caData := certtest.NewCertificate(t, time.Now().Add(time.Hour))
+	input := &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   testName,
+			Labels: map[string]string{"env": "dev"},
+		},
+		Spec: ClusterGatewaySpec{
+			Provider: "kind",
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  testEndpoint,
+						CABundle: caData,
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: testToken,
+				},
+			},
+		},
+	}
+
+	// create
+	created, err := storage.Create(context.TODO(), input.DeepCopy(), nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, input.Spec, created.(*ClusterGateway).Spec)
+	assert.Equal(t, input.Labels, created.(*ClusterGateway).Labels)
+	got, err := storage.Get(context.TODO(), testName, &metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, created, got)
+
+	_, err = storage.Create(context.TODO(), input.DeepCopy(), nil, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsAlreadyExists(err))
+
+	invalid := input.DeepCopy()
+	invalid.Name = "invalid"
+	invalid.Spec.Provider = ""
+	_, err = storage.Create(context.TODO(), invalid, nil, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsInvalid(err))
+
+	mismatched := input.DeepCopy()
+	mismatched.Name = "mismatched"
+	certPEM, _ := certtest.NewKeyPair(t, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	_, keyPEM := certtest.NewKeyPair(t, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	mismatched.Spec.Access.Credential = &ClusterAccessCredential{
+		Type: CredentialTypeX509Certificate,
+		X509: &X509{Certificate: certPEM, PrivateKey: keyPEM},
+	}
+	_, err = storage.Create(context.TODO(), mismatched, nil, &metav1.CreateOptions{})
+	require.True(t, apierrors.IsInvalid(err))
+	assert.Contains(t, err.Error(), "spec.access.credential.x509.privateKey")
+	assert.Contains(t, err.Error(), "private key does not match the certificate")
+
+	// update
+	updating := got.(*ClusterGateway).DeepCopy()
+	updating.Spec.Access.Credential.ServiceAccountToken = "updated"
+	updated, created2, err := storage.Update(context.TODO(), testName, rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.False(t, created2)
+	assert.Equal(t, "updated", updated.(*ClusterGateway).Spec.Access.Credential.ServiceAccountToken)
+	secret, err := fakeKubeClient.CoreV1().Secrets(testNamespace).Get(context.TODO(), testName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("updated"), secret.Data["token"])
+
+	_, _, err = storage.Update(context.TODO(), "non-existing", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// delete
+	deleted, immediate, err := storage.Delete(context.TODO(), testName, nil, &metav1.DeleteOptions{})
+	require.NoError(t, err)
+	assert.True(t, immediate)
+	assert.Equal(t, testName, deleted.(*ClusterGateway).Name)
+	_, err = fakeKubeClient.CoreV1().Secrets(testNamespace).Get(context.TODO(), testName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestUpdateNonClusterSecretShouldFail(t *testing.T) {
+	setupTestSecretClient(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      testName,
+		},
+	})
+	storage := &ClusterGateway{}
+	_, _, err := storage.Update(context.TODO(), testName, rest.DefaultUpdatedObjectInfo(&ClusterGateway{}), nil, nil, false, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestUpdateDeleteClusterGatewayWithBrokenCredentialProvider(t *testing.T) {
+	secret := newTestClusterSecret(testName, "1")
+	secret.Labels[common.LabelKeyClusterCredentialType] = string(CredentialTypeDynamic)
+	secret.Labels[common.LabelKeyClusterProvider] = "kind"
+	secret.Data["ca.crt"] = certtest.NewCertificate(t, time.Now().Add(time.Hour))
+	// the command fails if the credential is issued
+	secret.Data["exec"] = []byte(`{"apiVersion": "client.authentication.k8s.io/v1beta1", "kind": "ExecConfig", "command": "false"}`)
+	fakeKubeClient := setupTestSecretClient(secret)
+	storage := &ClusterGateway{}
+	_, err := storage.Get(context.TODO(), testName, &metav1.GetOptions{})
+	require.Error(t, err)
+
+	updating := &ClusterGateway{}
+	updated, _, err := storage.Update(context.TODO(), testName, rest.DefaultUpdatedObjectInfo(nil, func(_ context.Context, _, obj runtime.Object) (runtime.Object, error) {
+		gw := obj.(*ClusterGateway).DeepCopy()
+		gw.Labels = map[string]string{"env": "dev"}
+		updating = gw
+		return gw, nil
+	}), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, &ClusterAccessCredential{Type: CredentialTypeDynamic}, updating.Spec.Access.Credential)
+	assert.Equal(t, map[string]string{"env": "dev"}, updated.(*ClusterGateway).Labels)
+
+	deleted, _, err := storage.Delete(context.TODO(), testName, nil, &metav1.DeleteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, testName, deleted.(*ClusterGateway).Name)
+	_, err = fakeKubeClient.CoreV1().Secrets(testNamespace).Get(context.TODO(), testName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
@@ -2,9 +2,11 @@ package v1alpha1
 
 import (
 	"strconv"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
 var (
@@ -14,6 +16,7 @@ var (
 		{Name: "Credential-Type", Type: "string", Description: "the credential type"},
 		{Name: "Endpoint-Type", Type: "string", Description: "the endpoint type"},
 		{Name: "Healthy", Type: "string", Description: "the healthiness of the gateway"},
+		{Name: "Credential-Expires", Type: "string", Description: "the remaining time before the credential expires"},
 	}
 )
 
@@ -45,6 +48,17 @@ func printClusterGatewayRow(c *ClusterGateway) metav1.TableRow {
 	row := metav1.TableRow{
 		Object: runtime.RawExtension{Object: c},
 	}
-	row.Cells = append(row.Cells, name, provideType, credType, epType, strconv.FormatBool(c.Status.Healthy))
+	row.Cells = append(row.Cells, name, provideType, credType, epType, strconv.FormatBool(c.Status.Healthy), printCredentialExpiration(c))
 	return row
 }
+
+func printCredentialExpiration(c *ClusterGateway) string {
+	if c.Status.CredentialExpirationTime == nil {
+		return "<none>"
+	}
+	remaining := time.Until(c.Status.CredentialExpirationTime.Time)
+	if remaining <= 0 {
+		return "Expired"
+	}
+	return duration.HumanDuration(remaining)
+}
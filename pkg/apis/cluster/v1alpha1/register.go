@@ -55,7 +55,7 @@ var AddToScheme = func(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(schema.GroupVersion{
 		Group:   config.MetaApiGroupName,
 		Version: config.MetaApiVersionName,
-	}, &ClusterGatewayProxyOptions{})
+	}, &ClusterGatewayProxyOptions{}, &ClusterGatewayFanoutOptions{})
 
 	scheme.AddKnownTypes(schema.GroupVersion{
 		Group:   config.MetaApiGroupName,
@@ -46,8 +46,9 @@ var DialerGetter = func(ctx context.Context) (k8snet.DialFunc, error) {
 }
 
 func NewConfigFromCluster(ctx context.Context, c *ClusterGateway) (*restclient.Config, error) {
+	limits, _ := getClusterProxyLimits(c.Annotations, nil)
 	cfg := &restclient.Config{
-		Timeout: time.Second * 40,
+		Timeout: limits.timeout,
 	}
 	// setting up endpoint
 	switch c.Spec.Access.Endpoint.Type {
@@ -87,11 +88,14 @@ func NewConfigFromCluster(ctx context.Context, c *ClusterGateway) (*restclient.C
 		cfg.Host = c.Name // the same as the cluster name
 		cfg.Insecure = true
 		cfg.CAData = nil
-		dail, err := DialerGetter(ctx)
-		if err != nil {
-			return nil, err
+		// the konnectivity tunnel is single-use, so it's created upon dialing
+		cfg.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			dial, err := DialerGetter(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return dial(ctx, network, address)
 		}
-		cfg.Dial = dail
 	}
 	// setting up credentials
 	switch c.Spec.Access.Credential.Type {
@@ -0,0 +1,425 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"hash"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	apiproxy "k8s.io/apimachinery/pkg/util/proxy"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/transport"
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/metrics"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+const (
+	transportEvictionReasonCredentialChanged = "CredentialChanged"
+	transportEvictionReasonSecretChanged     = "SecretChanged"
+	transportEvictionReasonExpired           = "Expired"
+
+	transportCacheSweepInterval = time.Minute
+)
+
+// clusterTransport holds the reusable connections towards a managed cluster.
+// The impersonation of the requesting user is layered on top of it upon each
+// proxied request so that the connection pool is shared across users.
+// +k8s:openapi-gen=false
+type clusterTransport struct {
+	fingerprint     string
+	transportConfig *transport.Config
+	tlsConfig       *tls.Config
+	dial            utilnet.DialFunc
+	httpTransport   *http.Transport
+	tunnels         *clusterProxyTunnelPool
+	failover        *endpointFailoverDialer
+	roundTripper    http.RoundTripper
+	lastUsed        time.Time
+}
+
+func newClusterTransport(c *ClusterGateway, cfg *restclient.Config, fingerprint string) (*clusterTransport, error) {
+	transportCfg, err := cfg.TransportConfig()
+	if err != nil {
+		return nil, err
+	}
+	// impersonation is set per request
+	transportCfg.Impersonate = transport.ImpersonationConfig{}
+	tlsConfig, err := transport.TLSConfigFor(transportCfg)
+	if err != nil {
+		return nil, err
+	}
+	dial := cfg.Dial
+	if dial == nil {
+		dial = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	t := &clusterTransport{
+		fingerprint:     fingerprint,
+		transportConfig: transportCfg,
+		tlsConfig:       tlsConfig,
+		dial:            dial,
+		lastUsed:        time.Now(),
+	}
+	var base http.RoundTripper
+	if c.Spec.Access.Endpoint.Type == ClusterEndpointTypeClusterProxy {
+		t.tunnels = newClusterProxyTunnelPool(c.Name, tlsConfig)
+		base = t.tunnels.transport
+	} else {
+		t.httpTransport = utilnet.SetTransportDefaults(&http.Transport{
+			Proxy:               cfg.Proxy,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConnsPerHost: config.ClusterTransportMaxIdleConnsPerHost,
+			IdleConnTimeout:     config.ClusterTransportIdleConnTimeout,
+			DialContext:         dial,
+		})
+		// failing over the endpoints is not supported via the proxy-url
+		if endpoint := c.Spec.Access.Endpoint.Const; endpoint != nil && len(endpoint.GetEndpoints()) > 1 && cfg.Proxy == nil {
+			failoverTLSConfig := tlsConfig
+			if u, err := url.Parse(endpoint.Address); err == nil && tlsConfig != nil && tlsConfig.ServerName == u.Hostname() {
+				// the server name derived from the address is replaced by
+				// the ones of the endpoints, unlike the configured one
+				failoverTLSConfig = tlsConfig.Clone()
+				failoverTLSConfig.ServerName = ""
+			}
+			t.failover, err = newEndpointFailoverDialer(c.Name, endpoint.GetEndpoints(), failoverTLSConfig, dial)
+			if err != nil {
+				return nil, err
+			}
+			t.failover.nextProtos = t.httpTransport.TLSClientConfig.NextProtos
+			t.httpTransport.DialTLSContext = t.failover.DialTLSContext
+		}
+		base = t.httpTransport
+	}
+	rt, err := transport.HTTPWrappersForConfig(transportCfg, base)
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	t.roundTripper = rt
+	return t, nil
+}
+
+// RoundTripperFor returns the round tripper impersonating as the given
+// identity, or the plain one if the impersonation config is empty.
+func (t *clusterTransport) RoundTripperFor(impersonate restclient.ImpersonationConfig) http.RoundTripper {
+	if isEmptyImpersonationConfig(impersonate) {
+		return t.roundTripper
+	}
+	return transport.NewImpersonatingRoundTripper(toTransportImpersonationConfig(impersonate), t.roundTripper)
+}
+
+// UpgradeTransportFor returns the round tripper for upgrading requests, e.g.
+// exec and port-forward. The upgraded connections are hijacked so they are
+// not pooled.
+func (t *clusterTransport) UpgradeTransportFor(impersonate restclient.ImpersonationConfig) (apiproxy.UpgradeRequestRoundTripper, error) {
+	transportCfg := *t.transportConfig
+	transportCfg.Impersonate = toTransportImpersonationConfig(impersonate)
+	upgrader, err := transport.HTTPWrappersForConfig(&transportCfg, apiproxy.MirrorRequest)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := t.tlsConfig
+	if t.failover != nil {
+		// the upgrading requests are sent to the preferred endpoint
+		_, tlsConfig = t.failover.Preferred()
+	}
+	upgrading := utilnet.SetOldTransportDefaults(&http.Transport{
+		TLSClientConfig: tlsConfig,
+		DialContext:     t.dial,
+	})
+	return apiproxy.NewUpgradeRequestRoundTripper(
+		upgrading,
+		RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			newReq := utilnet.CloneRequest(req)
+			return upgrader.RoundTrip(newReq)
+		})), nil
+}
+
+// Host returns the "host:port" to send the requests, which is the preferred
+// endpoint if failing over the endpoints, otherwise the given host.
+func (t *clusterTransport) Host(host string) string {
+	if t.failover == nil {
+		return host
+	}
+	preferred, _ := t.failover.Preferred()
+	return preferred
+}
+
+func (t *clusterTransport) close() {
+	if t.httpTransport != nil {
+		t.httpTransport.CloseIdleConnections()
+	}
+	if t.tunnels != nil {
+		t.tunnels.close()
+	}
+}
+
+func isEmptyImpersonationConfig(impersonate restclient.ImpersonationConfig) bool {
+	return len(impersonate.UserName) == 0 &&
+		len(impersonate.UID) == 0 &&
+		len(impersonate.Groups) == 0 &&
+		len(impersonate.Extra) == 0
+}
+
+func toTransportImpersonationConfig(impersonate restclient.ImpersonationConfig) transport.ImpersonationConfig {
+	return transport.ImpersonationConfig{
+		UserName: impersonate.UserName,
+		UID:      impersonate.UID,
+		Groups:   impersonate.Groups,
+		Extra:    impersonate.Extra,
+	}
+}
+
+// +k8s:openapi-gen=false
+type clusterTransportCache struct {
+	mu                     sync.Mutex
+	entries                map[string]*clusterTransport
+	lastSweep              time.Time
+	invalidationRegistered bool
+	// building deduplicates the concurrent builds by cluster and fingerprint
+	building singleflight.Group
+}
+
+var clusterTransports = newClusterTransportCache()
+
+func newClusterTransportCache() *clusterTransportCache {
+	return &clusterTransportCache{
+		entries:   map[string]*clusterTransport{},
+		lastSweep: time.Now(),
+	}
+}
+
+// getClusterTransport returns the transport for proxying requests to the
+// cluster. The transports are cached by the cluster name and reused as long
+// as the endpoint and credential of the cluster remain unchanged.
+func getClusterTransport(ctx context.Context, c *ClusterGateway) (*clusterTransport, error) {
+	return clusterTransports.Get(ctx, c)
+}
+
+func (in *clusterTransportCache) Get(ctx context.Context, c *ClusterGateway) (*clusterTransport, error) {
+	in.registerInvalidation()
+	if !isClusterTransportCacheable(c) {
+		cfg, err := NewConfigFromCluster(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		return newClusterTransport(c, cfg, "")
+	}
+
+	fingerprint := clusterTransportFingerprint(c)
+	if entry := in.lookup(c.Name, fingerprint); entry != nil {
+		metrics.RecordClusterTransportCacheHit(c.Name)
+		return entry, nil
+	}
+	metrics.RecordClusterTransportCacheMiss(c.Name)
+	// the transports are built outside the lock, e.g. issuing the dynamic
+	// credentials, and the concurrent builds for the same cluster and
+	// fingerprint are deduplicated
+	buildCtx := context.WithoutCancel(ctx)
+	result := in.building.DoChan(c.Name+"/"+fingerprint, func() (interface{}, error) {
+		if entry := in.lookup(c.Name, fingerprint); entry != nil {
+			return entry, nil
+		}
+		cfg, err := NewConfigFromCluster(buildCtx, c)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := newClusterTransport(c, cfg, fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		return in.store(c.Name, entry), nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-result:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*clusterTransport), nil
+	}
+}
+
+// lookup returns the cached transport of the cluster if the fingerprint
+// matches, or nil.
+func (in *clusterTransportCache) lookup(name, fingerprint string) *clusterTransport {
+	now := time.Now()
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.sweepLocked(now)
+	entry, ok := in.entries[name]
+	if !ok || entry.fingerprint != fingerprint {
+		return nil
+	}
+	entry.lastUsed = now
+	return entry
+}
+
+// store caches the built transport of the cluster, which replaces the one of
+// the stale credential. The cached one is kept instead if built with the same
+// fingerprint meanwhile.
+func (in *clusterTransportCache) store(name string, entry *clusterTransport) *clusterTransport {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if existing, ok := in.entries[name]; ok {
+		if existing.fingerprint == entry.fingerprint {
+			entry.close()
+			return existing
+		}
+		in.evictLocked(name, transportEvictionReasonCredentialChanged)
+	}
+	in.entries[name] = entry
+	metrics.RecordClusterTransportCacheSize(len(in.entries))
+	return entry
+}
+
+// Invalidate evicts the cached transport of the cluster.
+func (in *clusterTransportCache) Invalidate(name string, reason string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.evictLocked(name, reason)
+}
+
+func (in *clusterTransportCache) evictLocked(name string, reason string) {
+	entry, ok := in.entries[name]
+	if !ok {
+		return
+	}
+	entry.close()
+	delete(in.entries, name)
+	metrics.RecordClusterTransportCacheEviction(name, reason)
+	metrics.RecordClusterTransportCacheSize(len(in.entries))
+}
+
+func (in *clusterTransportCache) sweepLocked(now time.Time) {
+	if now.Sub(in.lastSweep) < transportCacheSweepInterval {
+		return
+	}
+	in.lastSweep = now
+	for name, entry := range in.entries {
+		if now.Sub(entry.lastUsed) > config.ClusterTransportCacheExpiration {
+			in.evictLocked(name, transportEvictionReasonExpired)
+		}
+	}
+}
+
+// registerInvalidation evicts the cached transports upon changes from the
+// cluster secrets, so that the stale connections are closed promptly. The
+// other states of the removed clusters kept by the proxy, i.e. the request
+// limiters, the circuit breakers and the credential verifications, are
+// evicted as well.
+func (in *clusterTransportCache) registerInvalidation() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.invalidationRegistered {
+		return
+	}
+	informer := singleton.GetSecretInformer()
+	if informer == nil {
+		return
+	}
+	invalidate := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if secret, ok := obj.(*v1.Secret); ok {
+			in.Invalidate(secret.Name, transportEvictionReasonSecretChanged)
+		}
+	}
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, ok := oldObj.(*v1.Secret)
+			if !ok {
+				return
+			}
+			newSecret, ok := newObj.(*v1.Secret)
+			if !ok || oldSecret.ResourceVersion == newSecret.ResourceVersion {
+				return
+			}
+			// skipping the status updates from the annotations
+			if equality.Semantic.DeepEqual(oldSecret.Data, newSecret.Data) &&
+				equality.Semantic.DeepEqual(oldSecret.Labels, newSecret.Labels) {
+				return
+			}
+			invalidate(newSecret)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if secret, ok := obj.(*v1.Secret); ok {
+				in.Invalidate(secret.Name, transportEvictionReasonSecretChanged)
+				evictClusterRequestLimiter(secret.Name)
+				evictClusterCircuitBreaker(secret.Name)
+				evictCredentialVerification(secret.Name)
+			}
+		},
+	}); err != nil {
+		klog.Warningf("failed registering cluster transport invalidation: %v", err)
+		return
+	}
+	in.invalidationRegistered = true
+}
+
+func isClusterTransportCacheable(c *ClusterGateway) bool {
+	if c.Spec.Access.Endpoint == nil {
+		return false
+	}
+	switch c.Spec.Access.Endpoint.Type {
+	case ClusterEndpointTypeConst, ClusterEndpointTypeClusterProxy:
+		return true
+	}
+	return false
+}
+
+func clusterTransportFingerprint(c *ClusterGateway) string {
+	h := sha256.New()
+	writeFingerprintField := func(h hash.Hash, data []byte) {
+		h.Write([]byte(strconv.Itoa(len(data))))
+		h.Write([]byte{':'})
+		h.Write(data)
+	}
+	if endpoint := c.Spec.Access.Endpoint; endpoint != nil {
+		writeFingerprintField(h, []byte(endpoint.Type))
+		if endpoint.Const != nil {
+			writeFingerprintField(h, []byte(endpoint.Const.Address))
+			writeFingerprintField(h, endpoint.Const.CABundle)
+			writeFingerprintField(h, []byte(strconv.FormatBool(endpoint.Const.Insecure != nil && *endpoint.Const.Insecure)))
+			if endpoint.Const.ProxyURL != nil {
+				writeFingerprintField(h, []byte(*endpoint.Const.ProxyURL))
+			}
+			for _, e := range endpoint.Const.Endpoints {
+				writeFingerprintField(h, []byte(e.Address))
+				writeFingerprintField(h, e.CABundle)
+			}
+		}
+	}
+	if credential := c.Spec.Access.Credential; credential != nil {
+		writeFingerprintField(h, []byte(credential.Type))
+		writeFingerprintField(h, []byte(credential.ServiceAccountToken))
+		if credential.X509 != nil {
+			writeFingerprintField(h, credential.X509.Certificate)
+			writeFingerprintField(h, credential.X509.PrivateKey)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,173 @@
+package v1alpha1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+func newTestTransportClusterGateway(name, address, token string) *ClusterGateway {
+	gw := &ClusterGateway{
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  address,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: token,
+				},
+			},
+		},
+	}
+	gw.Name = name
+	return gw
+}
+
+func TestClusterTransportCache(t *testing.T) {
+	c := newClusterTransportCache()
+	gw := newTestTransportClusterGateway("c1", "https://foo.bar:443", "token")
+
+	first, err := c.Get(context.TODO(), gw)
+	require.NoError(t, err)
+	second, err := c.Get(context.TODO(), gw.DeepCopy())
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	// changing credential builds a new transport
+	rotated := newTestTransportClusterGateway("c1", "https://foo.bar:443", "rotated")
+	third, err := c.Get(context.TODO(), rotated)
+	require.NoError(t, err)
+	assert.NotSame(t, first, third)
+	assert.Equal(t, 1, len(c.entries))
+
+	// other clusters are cached separately
+	_, err = c.Get(context.TODO(), newTestTransportClusterGateway("c2", "https://foo.bar:443", "rotated"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(c.entries))
+
+	c.Invalidate("c1", transportEvictionReasonSecretChanged)
+	assert.Equal(t, 1, len(c.entries))
+	fourth, err := c.Get(context.TODO(), rotated)
+	require.NoError(t, err)
+	assert.NotSame(t, third, fourth)
+
+	// unused transports expire
+	expiration := config.ClusterTransportCacheExpiration
+	defer func() { config.ClusterTransportCacheExpiration = expiration }()
+	config.ClusterTransportCacheExpiration = time.Second
+	c.mu.Lock()
+	for _, entry := range c.entries {
+		entry.lastUsed = time.Now().Add(-time.Minute)
+	}
+	c.lastSweep = time.Now().Add(-time.Hour)
+	c.mu.Unlock()
+	_, err = c.Get(context.TODO(), rotated)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(c.entries))
+}
+
+func TestClusterTransportCacheConcurrentBuild(t *testing.T) {
+	c := newClusterTransportCache()
+	gw := newTestTransportClusterGateway("c1", "https://foo.bar:443", "token")
+	entries := make([]*clusterTransport, 8)
+	wg := &sync.WaitGroup{}
+	for i := range entries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entry, err := c.Get(context.TODO(), gw.DeepCopy())
+			assert.NoError(t, err)
+			entries[i] = entry
+		}(i)
+	}
+	wg.Wait()
+	for _, entry := range entries {
+		assert.Same(t, entries[0], entry)
+	}
+	assert.Equal(t, 1, len(c.entries))
+}
+
+func TestClusterTransportCacheClusterProxy(t *testing.T) {
+	c := newClusterTransportCache()
+	gw := newTestTransportClusterGateway("c1", "", "token")
+	gw.Spec.Access.Endpoint = &ClusterEndpoint{Type: ClusterEndpointTypeClusterProxy}
+	first, err := c.Get(context.TODO(), gw)
+	require.NoError(t, err)
+	second, err := c.Get(context.TODO(), gw)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	require.NotNil(t, first.tunnels)
+	assert.Nil(t, first.httpTransport)
+
+	c.Invalidate("c1", transportEvictionReasonSecretChanged)
+	assert.True(t, first.tunnels.closed)
+}
+
+func TestClusterTransportCacheEviction(t *testing.T) {
+	secret := newTestClusterSecret("evicted", "1")
+	fakeKubeClient, cleanup := setupTestSecretInformer(t, secret)
+	defer cleanup()
+	c := newClusterTransportCache()
+	gw := newTestTransportClusterGateway(secret.Name, "https://foo.bar:443", "token")
+	_, err := c.Get(context.TODO(), gw)
+	require.NoError(t, err)
+	getClusterRequestLimiter(gw.Name, clusterProxyLimits{})
+	getClusterCircuitBreaker(gw.Name)
+
+	// the states of the cluster are evicted upon the secret deleted
+	require.NoError(t, fakeKubeClient.CoreV1().Secrets(testNamespace).Delete(context.TODO(), secret.Name, metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.entries) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	_, ok := clusterRequestLimiters.Load(gw.Name)
+	assert.False(t, ok)
+	_, ok = clusterCircuitBreakers.Load(gw.Name)
+	assert.False(t, ok)
+}
+
+func TestClusterTransportImpersonation(t *testing.T) {
+	var received http.Header
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		received = req.Header.Clone()
+		resp.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	c := newClusterTransportCache()
+	entry, err := c.Get(context.TODO(), newTestTransportClusterGateway("c1", svr.URL, "token"))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, svr.URL+"/api", nil)
+	require.NoError(t, err)
+	resp, err := entry.RoundTripperFor(restclient.ImpersonationConfig{}).RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer token", received.Get("Authorization"))
+	assert.Empty(t, received.Get("Impersonate-User"))
+
+	req, err = http.NewRequest(http.MethodGet, svr.URL+"/api", nil)
+	require.NoError(t, err)
+	resp, err = entry.RoundTripperFor(restclient.ImpersonationConfig{UserName: "alice", Groups: []string{"dev"}}).RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "alice", received.Get("Impersonate-User"))
+	assert.Equal(t, "dev", received.Get("Impersonate-Group"))
+}
@@ -0,0 +1,133 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"sync/atomic"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/klog/v2"
+)
+
+// endpointFailoverDialer dials the endpoints of a Const cluster in order and
+// returns the first connection passing the TLS handshake. The last healthy
+// endpoint is tried first for the subsequent dials, so that the requests
+// stick to it until it fails. As the failover happens upon dialing, the
+// requests are never replayed.
+// +k8s:openapi-gen=false
+type endpointFailoverDialer struct {
+	cluster   string
+	endpoints []*failoverEndpoint
+	dial      utilnet.DialFunc
+	preferred int32
+	// nextProtos overrides the ALPN protocols of the endpoints, e.g. "h2"
+	nextProtos []string
+}
+
+// +k8s:openapi-gen=false
+type failoverEndpoint struct {
+	// host is the "host:port" to dial
+	host      string
+	tlsConfig *tls.Config
+}
+
+// newEndpointFailoverDialer builds the dialer from the endpoints of the
+// cluster, the TLS config of each endpoint is derived from the cluster's by
+// overriding the CA, and the server name unless configured.
+func newEndpointFailoverDialer(cluster string, endpoints []ClusterEndpointAddress, tlsConfig *tls.Config, dial utilnet.DialFunc) (*endpointFailoverDialer, error) {
+	d := &endpointFailoverDialer{
+		cluster: cluster,
+		dial:    dial,
+	}
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint.Address)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing endpoint %s of cluster %s: %v", endpoint.Address, cluster, err)
+		}
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		if len(cfg.ServerName) == 0 {
+			cfg.ServerName = u.Hostname()
+		}
+		if len(endpoint.CABundle) > 0 && !cfg.InsecureSkipVerify {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(endpoint.CABundle) {
+				return nil, fmt.Errorf("failed parsing CA bundle of endpoint %s of cluster %s", endpoint.Address, cluster)
+			}
+			cfg.RootCAs = pool
+		}
+		d.endpoints = append(d.endpoints, &failoverEndpoint{
+			host:      canonicalHost(u),
+			tlsConfig: cfg,
+		})
+	}
+	return d, nil
+}
+
+// DialTLSContext ignores the address requested, and dials the endpoints
+// starting from the preferred one.
+func (d *endpointFailoverDialer) DialTLSContext(ctx context.Context, network, _ string) (net.Conn, error) {
+	preferred := int(atomic.LoadInt32(&d.preferred))
+	var errs []error
+	for i := range d.endpoints {
+		idx := (preferred + i) % len(d.endpoints)
+		endpoint := d.endpoints[idx]
+		conn, err := d.dialEndpoint(ctx, network, endpoint)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			klog.V(4).Infof("Failed dialing endpoint %s of cluster %s: %v", endpoint.host, d.cluster, err)
+			errs = append(errs, fmt.Errorf("endpoint %s: %v", endpoint.host, err))
+			continue
+		}
+		if idx != preferred && atomic.CompareAndSwapInt32(&d.preferred, int32(preferred), int32(idx)) {
+			klog.Infof("Cluster %s failed over from endpoint %s to %s", d.cluster, d.endpoints[preferred].host, endpoint.host)
+		}
+		return conn, nil
+	}
+	return nil, fmt.Errorf("all endpoints of cluster %s are unavailable: %v", d.cluster, utilerrors.NewAggregate(errs))
+}
+
+func (d *endpointFailoverDialer) dialEndpoint(ctx context.Context, network string, endpoint *failoverEndpoint) (net.Conn, error) {
+	conn, err := d.dial(ctx, network, endpoint.host)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := endpoint.tlsConfig
+	if len(d.nextProtos) > 0 {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.NextProtos = d.nextProtos
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Preferred returns the host and the TLS config of the preferred endpoint.
+func (d *endpointFailoverDialer) Preferred() (string, *tls.Config) {
+	endpoint := d.endpoints[atomic.LoadInt32(&d.preferred)]
+	return endpoint.host, endpoint.tlsConfig
+}
+
+// canonicalHost returns the "host:port" of the url, defaulting the port by
+// the scheme.
+func canonicalHost(u *url.URL) string {
+	if len(u.Port()) > 0 {
+		return u.Host
+	}
+	if u.Scheme == "http" {
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+	return net.JoinHostPort(u.Hostname(), "443")
+}
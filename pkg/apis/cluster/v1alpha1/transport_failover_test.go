@@ -0,0 +1,145 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	restclient "k8s.io/client-go/rest"
+)
+
+func newTestFailoverEndpoints(t *testing.T) (healthy *httptest.Server, endpoints []ClusterEndpointAddress) {
+	healthy = httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(healthy.Close)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: healthy.Certificate().Raw})
+
+	// refusing connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	refused := "https://" + l.Addr().String()
+	require.NoError(t, l.Close())
+
+	// failing TLS handshakes
+	plain := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(plain.Close)
+	plainURL, err := url.Parse(plain.URL)
+	require.NoError(t, err)
+
+	return healthy, []ClusterEndpointAddress{
+		{Address: refused, CABundle: ca},
+		{Address: "https://" + plainURL.Host, CABundle: ca},
+		{Address: healthy.URL, CABundle: ca},
+	}
+}
+
+func TestEndpointFailoverDialer(t *testing.T) {
+	healthy, endpoints := newTestFailoverEndpoints(t)
+	var dialed []string
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	}
+	d, err := newEndpointFailoverDialer("c1", endpoints, nil, dial)
+	require.NoError(t, err)
+
+	conn, err := d.DialTLSContext(context.TODO(), "tcp", "ignored:443")
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, 3, len(dialed))
+	host, _ := d.Preferred()
+	assert.Equal(t, healthy.Listener.Addr().String(), host)
+
+	// sticking to the healthy endpoint
+	dialed = nil
+	conn, err = d.DialTLSContext(context.TODO(), "tcp", "ignored:443")
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, []string{healthy.Listener.Addr().String()}, dialed)
+
+	// failing over back to the first endpoint
+	healthy.Close()
+	dialed = nil
+	_, err = d.DialTLSContext(context.TODO(), "tcp", "ignored:443")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "all endpoints of cluster c1 are unavailable")
+	assert.Equal(t, 3, len(dialed))
+	assert.Equal(t, healthy.Listener.Addr().String(), dialed[0])
+
+	_, err = newEndpointFailoverDialer("c1", []ClusterEndpointAddress{{Address: "https://foo", CABundle: []byte("invalid")}}, nil, dial)
+	assert.Error(t, err)
+
+	// the configured server name is kept
+	d, err = newEndpointFailoverDialer("c1", []ClusterEndpointAddress{{Address: "https://foo"}, {Address: "https://bar"}}, &tls.Config{ServerName: "k8s.example.com"}, dial)
+	require.NoError(t, err)
+	for _, endpoint := range d.endpoints {
+		assert.Equal(t, "k8s.example.com", endpoint.tlsConfig.ServerName)
+	}
+	d, err = newEndpointFailoverDialer("c1", []ClusterEndpointAddress{{Address: "https://foo"}, {Address: "https://bar"}}, &tls.Config{}, dial)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", d.endpoints[0].tlsConfig.ServerName)
+	assert.Equal(t, "bar", d.endpoints[1].tlsConfig.ServerName)
+}
+
+func TestClusterTransportFailover(t *testing.T) {
+	healthy, endpoints := newTestFailoverEndpoints(t)
+	gw := newTestTransportClusterGateway("c1", endpoints[0].Address, "token")
+	gw.Spec.Access.Endpoint.Const.Insecure = nil
+	gw.Spec.Access.Endpoint.Const.Endpoints = endpoints[1:]
+	gw.Spec.Access.Endpoint.Const.CABundle = endpoints[0].CABundle
+
+	entry, err := newClusterTransportCache().Get(context.TODO(), gw)
+	require.NoError(t, err)
+	require.NotNil(t, entry.failover)
+	primary, err := url.Parse(endpoints[0].Address)
+	require.NoError(t, err)
+	// the server name derived from the address doesn't apply to the others
+	for i, endpoint := range entry.failover.endpoints {
+		u, err := url.Parse(endpoints[i].Address)
+		require.NoError(t, err)
+		assert.Equal(t, u.Hostname(), endpoint.tlsConfig.ServerName)
+	}
+	assert.Equal(t, primary.Host, entry.Host(primary.Host))
+
+	req, err := http.NewRequest(http.MethodGet, endpoints[0].Address+"/api", nil)
+	require.NoError(t, err)
+	resp, err := entry.RoundTripperFor(restclient.ImpersonationConfig{}).RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, healthy.Listener.Addr().String(), entry.Host(primary.Host))
+
+	// single endpoint doesn't fail over
+	entry, err = newClusterTransportCache().Get(context.TODO(), newTestTransportClusterGateway("c1", healthy.URL, "token"))
+	require.NoError(t, err)
+	assert.Nil(t, entry.failover)
+}
+
+func TestClusterEndpointConstGetEndpoints(t *testing.T) {
+	c := &ClusterEndpointConst{
+		Address:  "https://a",
+		CABundle: []byte("ca"),
+		Endpoints: []ClusterEndpointAddress{
+			{Address: "https://b", CABundle: []byte("ca-b")},
+			{Address: "https://c"},
+		},
+	}
+	assert.Equal(t, []ClusterEndpointAddress{
+		{Address: "https://a", CABundle: []byte("ca")},
+		{Address: "https://b", CABundle: []byte("ca-b")},
+		{Address: "https://c", CABundle: []byte("ca")},
+	}, c.GetEndpoints())
+	assert.Nil(t, c.Endpoints[1].CABundle)
+
+	c.Endpoints = append(c.Endpoints, ClusterEndpointAddress{Address: "https://a"})
+	assert.Equal(t, "https://b", c.GetEndpoints()[0].Address)
+	assert.Equal(t, 3, len(c.GetEndpoints()))
+}
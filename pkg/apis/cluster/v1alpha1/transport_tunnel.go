@@ -0,0 +1,270 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/metrics"
+)
+
+const (
+	tunnelDialTimeout    = 30 * time.Second
+	tunnelPingTimeout    = 10 * time.Second
+	tunnelInitialBackoff = 500 * time.Millisecond
+)
+
+var _ http2.ClientConnPool = &clusterProxyTunnelPool{}
+
+// clusterProxyTunnelPool keeps the konnectivity tunnels to a managed cluster
+// for reuse. The konnectivity client supports only one connection per tunnel,
+// so the proxied requests are multiplexed as HTTP/2 streams over the
+// connection, at most --proxy-max-streams-per-tunnel for each tunnel. The
+// pooled tunnels are pinged periodically and the unresponsive or idle ones
+// are closed. Opening tunnels is retried with exponential backoff after
+// consecutive failures.
+// +k8s:openapi-gen=false
+type clusterProxyTunnelPool struct {
+	cluster   string
+	tlsConfig *tls.Config
+	transport *http2.Transport
+
+	mu       sync.Mutex
+	tunnels  []*http2.ClientConn
+	dialing  *tunnelDial
+	failures int
+	lastErr  error
+	nextDial time.Time
+	closed   bool
+	stopCh   chan struct{}
+}
+
+// +k8s:openapi-gen=false
+type tunnelDial struct {
+	done chan struct{}
+	err  error
+}
+
+func newClusterProxyTunnelPool(cluster string, tlsConfig *tls.Config) *clusterProxyTunnelPool {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+	p := &clusterProxyTunnelPool{
+		cluster:   cluster,
+		tlsConfig: tlsConfig,
+		stopCh:    make(chan struct{}),
+	}
+	p.transport = &http2.Transport{
+		ConnPool:        p,
+		TLSClientConfig: tlsConfig,
+	}
+	go wait.Until(p.healthCheck, config.ClusterProxyTunnelHealthCheckInterval, p.stopCh)
+	return p
+}
+
+// GetClientConn reserves a stream from the pooled tunnels, or opens a new
+// tunnel if all of them are busy.
+func (p *clusterProxyTunnelPool) GetClientConn(req *http.Request, addr string) (*http2.ClientConn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errors.Errorf("tunnels to cluster %s are closed", p.cluster)
+		}
+		if cc := p.reserveLocked(); cc != nil {
+			p.mu.Unlock()
+			return cc, nil
+		}
+		if p.dialing == nil {
+			if backoff := time.Until(p.nextDial); backoff > 0 {
+				err := errors.Wrapf(p.lastErr, "backing off opening tunnel to cluster %s for %s after %d failures",
+					p.cluster, backoff.Round(time.Millisecond), p.failures)
+				p.mu.Unlock()
+				return nil, err
+			}
+			p.dialing = &tunnelDial{done: make(chan struct{})}
+			go p.dial(p.dialing, addr)
+		}
+		dialing := p.dialing
+		p.mu.Unlock()
+
+		select {
+		case <-dialing.done:
+			if dialing.err != nil {
+				return nil, dialing.err
+			}
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// MarkDead removes the tunnel from the pool.
+func (p *clusterProxyTunnelPool) MarkDead(cc *http2.ClientConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.tunnels {
+		if p.tunnels[i] == cc {
+			p.tunnels = append(p.tunnels[:i], p.tunnels[i+1:]...)
+			break
+		}
+	}
+	p.recordLocked()
+}
+
+func (p *clusterProxyTunnelPool) reserveLocked() *http2.ClientConn {
+	p.pruneLocked()
+	for _, cc := range p.tunnels {
+		st := cc.State()
+		if st.Closing || st.StreamsActive+st.StreamsReserved >= config.ClusterProxyMaxStreamsPerTunnel {
+			continue
+		}
+		if cc.ReserveNewRequest() {
+			return cc
+		}
+	}
+	return nil
+}
+
+func (p *clusterProxyTunnelPool) pruneLocked() {
+	alive := p.tunnels[:0]
+	for _, cc := range p.tunnels {
+		if !cc.State().Closed {
+			alive = append(alive, cc)
+		}
+	}
+	p.tunnels = alive
+}
+
+func (p *clusterProxyTunnelPool) recordLocked() {
+	streams := 0
+	for _, cc := range p.tunnels {
+		streams += cc.State().StreamsActive
+	}
+	metrics.RecordClusterProxyTunnels(p.cluster, len(p.tunnels), streams)
+}
+
+func (p *clusterProxyTunnelPool) dial(d *tunnelDial, addr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelDialTimeout)
+	defer cancel()
+	cc, err := p.newTunnel(ctx, addr)
+	metrics.RecordClusterProxyTunnelDial(p.cluster, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialing = nil
+	d.err = err
+	close(d.done)
+	if err != nil {
+		p.failures++
+		p.lastErr = err
+		p.nextDial = time.Now().Add(tunnelBackoff(p.failures))
+		klog.Warningf("Failed opening tunnel to cluster %s (%d consecutive failures): %v", p.cluster, p.failures, err)
+		return
+	}
+	p.failures, p.lastErr, p.nextDial = 0, nil, time.Time{}
+	if p.closed {
+		_ = cc.Close()
+		return
+	}
+	p.tunnels = append(p.tunnels, cc)
+	p.recordLocked()
+}
+
+func (p *clusterProxyTunnelPool) newTunnel(ctx context.Context, addr string) (*http2.ClientConn, error) {
+	dial, err := DialerGetter(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed creating tunnel to cluster %s", p.cluster)
+	}
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed dialing cluster %s over tunnel", p.cluster)
+	}
+	tlsConfig := p.tlsConfig
+	if len(tlsConfig.ServerName) == 0 {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrapf(err, "failed TLS handshake with cluster %s over tunnel", p.cluster)
+	}
+	if proto := tlsConn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+		_ = tlsConn.Close()
+		return nil, errors.Errorf("cluster %s negotiated protocol %q instead of %q over tunnel", p.cluster, proto, http2.NextProtoTLS)
+	}
+	return p.transport.NewClientConn(tlsConn)
+}
+
+func (p *clusterProxyTunnelPool) healthCheck() {
+	p.mu.Lock()
+	tunnels := append([]*http2.ClientConn(nil), p.tunnels...)
+	p.mu.Unlock()
+
+	for _, cc := range tunnels {
+		st := cc.State()
+		if st.Closed {
+			continue
+		}
+		if st.StreamsActive == 0 && st.StreamsReserved == 0 && !st.LastIdle.IsZero() &&
+			time.Since(st.LastIdle) > config.ClusterTransportIdleConnTimeout {
+			_ = cc.Close()
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), tunnelPingTimeout)
+		err := cc.Ping(ctx)
+		cancel()
+		if err != nil {
+			klog.Warningf("Closing unhealthy tunnel to cluster %s: %v", p.cluster, err)
+			metrics.RecordClusterProxyTunnelHealthCheckFailure(p.cluster)
+			_ = cc.Close()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pruneLocked()
+	p.recordLocked()
+}
+
+// close stops the pool, the tunnels are closed after the in-flight requests
+// are finished.
+func (p *clusterProxyTunnelPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stopCh)
+	for _, cc := range p.tunnels {
+		go func(cc *http2.ClientConn) {
+			_ = cc.Shutdown(context.Background())
+		}(cc)
+	}
+	p.tunnels = nil
+	p.recordLocked()
+}
+
+func tunnelBackoff(failures int) time.Duration {
+	backoff := tunnelInitialBackoff
+	for i := 1; i < failures && backoff < config.ClusterProxyTunnelMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > config.ClusterProxyTunnelMaxBackoff {
+		backoff = config.ClusterProxyTunnelMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,162 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8snet "k8s.io/apimachinery/pkg/util/net"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+// setupTestTunnelServer serves HTTP/2 behind the fake tunnels and counts the
+// tunnels opened
+func setupTestTunnelServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *int32) {
+	svr := httptest.NewUnstartedServer(handler)
+	svr.EnableHTTP2 = true
+	svr.StartTLS()
+	dials := new(int32)
+	dialerGetter := DialerGetter
+	DialerGetter = func(ctx context.Context) (k8snet.DialFunc, error) {
+		atomic.AddInt32(dials, 1)
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "tcp", svr.Listener.Addr().String())
+		}, nil
+	}
+	t.Cleanup(func() {
+		DialerGetter = dialerGetter
+		svr.Close()
+	})
+	return svr, dials
+}
+
+func newTestTunnelPool(t *testing.T) *clusterProxyTunnelPool {
+	pool := newClusterProxyTunnelPool("c1", &tls.Config{InsecureSkipVerify: true})
+	t.Cleanup(pool.close)
+	return pool
+}
+
+func doTunnelRequest(pool *clusterProxyTunnelPool) error {
+	resp, err := (&http.Client{Transport: pool.transport}).Get("https://c1/healthz")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestClusterProxyTunnelPoolReuse(t *testing.T) {
+	_, dials := setupTestTunnelServer(t, func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	})
+	pool := newTestTunnelPool(t)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, doTunnelRequest(pool))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(dials))
+	assert.Equal(t, 1, len(pool.tunnels))
+}
+
+func TestClusterProxyTunnelPoolMaxStreams(t *testing.T) {
+	maxStreams := config.ClusterProxyMaxStreamsPerTunnel
+	defer func() { config.ClusterProxyMaxStreamsPerTunnel = maxStreams }()
+	config.ClusterProxyMaxStreamsPerTunnel = 2
+
+	received := make(chan struct{}, 4)
+	release := make(chan struct{})
+	_, dials := setupTestTunnelServer(t, func(resp http.ResponseWriter, req *http.Request) {
+		received <- struct{}{}
+		<-release
+		resp.WriteHeader(http.StatusOK)
+	})
+	pool := newTestTunnelPool(t)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, doTunnelRequest(pool))
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for requests")
+		}
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(dials))
+}
+
+func TestClusterProxyTunnelPoolBackoff(t *testing.T) {
+	setupTestTunnelServer(t, func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	})
+	working := DialerGetter
+	failures := int32(0)
+	DialerGetter = func(ctx context.Context) (k8snet.DialFunc, error) {
+		atomic.AddInt32(&failures, 1)
+		return nil, errors.New("proxy unavailable")
+	}
+	pool := newTestTunnelPool(t)
+
+	err := doTunnelRequest(pool)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "proxy unavailable")
+	err = doTunnelRequest(pool)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "backing off")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&failures))
+
+	// recovers after the backoff
+	DialerGetter = working
+	pool.mu.Lock()
+	pool.nextDial = time.Now()
+	pool.mu.Unlock()
+	require.NoError(t, doTunnelRequest(pool))
+	assert.Equal(t, 0, pool.failures)
+}
+
+func TestClusterProxyTunnelPoolHealthCheck(t *testing.T) {
+	svr, dials := setupTestTunnelServer(t, func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	})
+	pool := newTestTunnelPool(t)
+	require.NoError(t, doTunnelRequest(pool))
+
+	pool.healthCheck()
+	assert.Equal(t, 1, len(pool.tunnels))
+
+	svr.CloseClientConnections()
+	pool.healthCheck()
+	assert.Equal(t, 0, len(pool.tunnels))
+
+	require.NoError(t, doTunnelRequest(pool))
+	assert.Equal(t, int32(2), atomic.LoadInt32(dials))
+
+	pool.close()
+	assert.Error(t, doTunnelRequest(pool))
+}
+
+func TestTunnelBackoff(t *testing.T) {
+	maxBackoff := config.ClusterProxyTunnelMaxBackoff
+	defer func() { config.ClusterProxyTunnelMaxBackoff = maxBackoff }()
+	config.ClusterProxyTunnelMaxBackoff = 3 * time.Second
+	assert.Equal(t, 500*time.Millisecond, tunnelBackoff(1))
+	assert.Equal(t, time.Second, tunnelBackoff(2))
+	assert.Equal(t, 2*time.Second, tunnelBackoff(3))
+	assert.Equal(t, 3*time.Second, tunnelBackoff(4))
+	assert.Equal(t, 3*time.Second, tunnelBackoff(100))
+}
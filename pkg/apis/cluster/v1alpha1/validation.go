@@ -16,60 +16,159 @@ package v1alpha1
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/url"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
 )
 
 func ValidateClusterGateway(c *ClusterGateway) field.ErrorList {
+	return validateClusterGateway(c, time.Now())
+}
+
+// ValidateClusterGatewayUpdate validates the updated cluster gateway. The
+// validity window of the X509 certificate is only checked if the credential
+// is changed, so that an expired certificate doesn't block updating the other
+// fields, e.g. the labels.
+func ValidateClusterGatewayUpdate(c, old *ClusterGateway) field.ErrorList {
+	now := time.Now()
+	if equality.Semantic.DeepEqual(c.Spec.Access.Credential, old.Spec.Access.Credential) {
+		now = time.Time{}
+	}
+	return validateClusterGateway(c, now)
+}
+
+func validateClusterGateway(c *ClusterGateway, now time.Time) field.ErrorList {
 	var errs field.ErrorList
-	errs = append(errs, ValidateClusterGatewaySpec(&c.Spec, field.NewPath("spec"))...)
+	_, limitErrs := getClusterProxyLimits(c.Annotations, field.NewPath("metadata").Child("annotations"))
+	errs = append(errs, limitErrs...)
+	_, proxyConfigErrs := getClusterProxyConfiguration(c.Annotations, field.NewPath("metadata").Child("annotations"))
+	errs = append(errs, proxyConfigErrs...)
+	errs = append(errs, validateClusterGatewaySpec(&c.Spec, now, field.NewPath("spec"))...)
 	return errs
 }
 
 func ValidateClusterGatewaySpec(c *ClusterGatewaySpec, path *field.Path) field.ErrorList {
+	return validateClusterGatewaySpec(c, time.Now(), path)
+}
+
+func validateClusterGatewaySpec(c *ClusterGatewaySpec, now time.Time, path *field.Path) field.ErrorList {
 	var errs field.ErrorList
 	if len(c.Provider) == 0 {
 		errs = append(errs, field.Required(path.Child("provider"), "should set provider"))
 	}
-	errs = append(errs, ValidateClusterGatewaySpecAccess(&c.Access, path.Child("access"))...)
+	errs = append(errs, validateClusterGatewaySpecAccess(&c.Access, now, path.Child("access"))...)
 	return errs
 }
 
 func ValidateClusterGatewaySpecAccess(c *ClusterAccess, path *field.Path) field.ErrorList {
+	return validateClusterGatewaySpecAccess(c, time.Now(), path)
+}
+
+func validateClusterGatewaySpecAccess(c *ClusterAccess, now time.Time, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if c.Endpoint == nil {
+		errs = append(errs, field.Required(path.Child("endpoint"), "should provide cluster endpoint"))
+	} else {
+		errs = append(errs, ValidateClusterGatewaySpecAccessEndpoint(c.Endpoint, path.Child("endpoint"))...)
+	}
+	if c.Credential == nil {
+		errs = append(errs, field.Required(path.Child("credential"), "should provide cluster credential"))
+	} else {
+		errs = append(errs, validateClusterGatewaySpecAccessCredential(c.Credential, now, path.Child("credential"))...)
+	}
+	return errs
+}
+
+func ValidateClusterGatewaySpecAccessEndpoint(c *ClusterEndpoint, path *field.Path) field.ErrorList {
 	var errs field.ErrorList
-	switch c.Endpoint.Type {
+	switch c.Type {
 	case ClusterEndpointTypeConst:
-		if len(c.Endpoint.Const.Address) == 0 {
-			errs = append(errs, field.Required(path.Child("endpoint"), "should provide cluster endpoint"))
+		if c.Const == nil {
+			errs = append(errs, field.Required(path.Child("const"), "should provide const endpoint"))
+		} else {
+			errs = append(errs, ValidateClusterGatewaySpecAccessEndpointConst(c.Const, path.Child("const"))...)
 		}
-		u, err := url.Parse(c.Endpoint.Const.Address)
-		if err != nil {
-			errs = append(errs, field.Invalid(path.Child("endpoint"), c.Endpoint, fmt.Sprintf("failed parsing as URL: %v", err)))
-			return errs
+	case ClusterEndpointTypeClusterProxy:
+		if c.Const != nil {
+			errs = append(errs, field.Forbidden(path.Child("const"), "should not be set for ClusterProxy endpoint"))
 		}
-		if u.Scheme != "https" {
-			errs = append(errs, field.Invalid(path.Child("endpoint"), c.Endpoint, "scheme must be https"))
+	default:
+		errs = append(errs, field.NotSupported(path.Child("type"), c.Type, []string{
+			string(ClusterEndpointTypeConst),
+			string(ClusterEndpointTypeClusterProxy),
+		}))
+	}
+	return errs
+}
+
+func ValidateClusterGatewaySpecAccessEndpointConst(c *ClusterEndpointConst, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if len(c.Address) == 0 {
+		errs = append(errs, field.Required(path.Child("address"), "should provide cluster endpoint"))
+	} else {
+		errs = append(errs, validateEndpointAddress(c.Address, path.Child("address"))...)
+	}
+	if len(c.CABundle) == 0 && (c.Insecure == nil || !*c.Insecure) {
+		errs = append(errs, field.Required(path.Child("caBundle"), "required for non-insecure endpoint"))
+	}
+	if len(c.CABundle) > 0 {
+		if err := cert.VerifyCABundle(c.CABundle); err != nil {
+			errs = append(errs, field.Invalid(path.Child("caBundle"), field.OmitValueType{}, err.Error()))
 		}
-		if len(c.Endpoint.Const.CABundle) == 0 &&
-			(c.Endpoint.Const.Insecure == nil || *c.Endpoint.Const.Insecure == false) {
-			errs = append(errs, field.Required(path.Child("caBundle"), "required for non-insecure endpoint"))
+	}
+	if c.ProxyURL != nil && len(*c.ProxyURL) > 0 {
+		u, err := url.Parse(*c.ProxyURL)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(path.Child("proxy-url"), *c.ProxyURL, fmt.Sprintf("failed parsing as URL: %v", err)))
+		case !supportedProxySchemes.Has(u.Scheme):
+			errs = append(errs, field.NotSupported(path.Child("proxy-url"), u.Scheme, supportedProxySchemes.List()))
+		case len(u.Host) == 0:
+			errs = append(errs, field.Invalid(path.Child("proxy-url"), *c.ProxyURL, "should provide proxy host"))
 		}
 	}
-	if c.Credential != nil {
-		errs = append(errs, ValidateClusterGatewaySpecAccessCredential(c.Credential, path.Child("credential"))...)
+	for i, endpoint := range c.Endpoints {
+		endpointPath := path.Child("endpoints").Index(i)
+		if len(endpoint.CABundle) > 0 {
+			if err := cert.VerifyCABundle(endpoint.CABundle); err != nil {
+				errs = append(errs, field.Invalid(endpointPath.Child("caBundle"), field.OmitValueType{}, err.Error()))
+			}
+		}
+		errs = append(errs, validateEndpointAddress(endpoint.Address, endpointPath.Child("address"))...)
 	}
 	return errs
 }
 
+// supportedProxySchemes are the schemes of the proxy-url supported by the
+// http transport
+var supportedProxySchemes = sets.NewString("http", "https", "socks5", "socks5h")
+
+func validateEndpointAddress(address string, path *field.Path) field.ErrorList {
+	u, err := url.Parse(address)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, address, fmt.Sprintf("failed parsing as URL: %v", err))}
+	}
+	if u.Scheme != "https" {
+		return field.ErrorList{field.Invalid(path, address, "scheme must be https")}
+	}
+	return nil
+}
+
 func ValidateClusterGatewaySpecAccessCredential(c *ClusterAccessCredential, path *field.Path) field.ErrorList {
+	return validateClusterGatewaySpecAccessCredential(c, time.Now(), path)
+}
+
+// validateClusterGatewaySpecAccessCredential skips the validity window of the
+// X509 certificate if the time is zero.
+func validateClusterGatewaySpecAccessCredential(c *ClusterAccessCredential, now time.Time, path *field.Path) field.ErrorList {
 	var errs field.ErrorList
-	supportedCredTypes := sets.NewString(string(CredentialTypeServiceAccountToken), string(CredentialTypeX509Certificate))
-	if !supportedCredTypes.Has(string(c.Type)) {
-		errs = append(errs, field.NotSupported(path.Child("type"), c.Type, supportedCredTypes.List()))
-	}
 	switch c.Type {
 	case CredentialTypeServiceAccountToken:
 		if _, err := base64.StdEncoding.DecodeString(c.ServiceAccountToken); err == nil {
@@ -88,7 +187,108 @@ func ValidateClusterGatewaySpecAccessCredential(c *ClusterAccessCredential, path
 			if len(c.X509.PrivateKey) == 0 {
 				errs = append(errs, field.Required(path.Child("x509").Child("privateKey"), "should provide x509 private key"))
 			}
-			// TODO: test if certificate and private-key matches modulus
+			if len(c.X509.Certificate) > 0 && len(c.X509.PrivateKey) > 0 {
+				errs = append(errs, ValidateX509KeyPair(c.X509, now, path.Child("x509"))...)
+			}
+		}
+	case CredentialTypeDynamic:
+		// the credential is issued by the provider configured in the cluster
+		// secret, whose config is validated upon reading the secret. The
+		// issued one is echoed back on updates.
+		if c.X509 != nil && (len(c.X509.Certificate) == 0) != (len(c.X509.PrivateKey) == 0) {
+			errs = append(errs, field.Invalid(path.Child("x509"), field.OmitValueType{}, "should provide both certificate and private key"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("type"), c.Type, []string{
+			string(CredentialTypeServiceAccountToken),
+			string(CredentialTypeX509Certificate),
+			string(CredentialTypeDynamic),
+		}))
+	}
+	return errs
+}
+
+// ValidateX509KeyPair verifies that the private key matches the certificate
+// and that the certificate is valid at the given time. The validity window is
+// not checked if the time is zero.
+func ValidateX509KeyPair(c *X509, now time.Time, path *field.Path) field.ErrorList {
+	err := cert.VerifyX509KeyPair(c.Certificate, c.PrivateKey, now)
+	if err == nil {
+		return nil
+	}
+	fieldPath := path.Child("certificate")
+	var x509Err *cert.X509Error
+	if errors.As(err, &x509Err) &&
+		(x509Err.Reason == cert.X509ErrorReasonInvalidPrivateKey || x509Err.Reason == cert.X509ErrorReasonKeyMismatch) {
+		fieldPath = path.Child("privateKey")
+	}
+	return field.ErrorList{field.Invalid(fieldPath, field.OmitValueType{}, err.Error())}
+}
+
+func ValidateClusterGatewayProxyConfiguration(c *ClusterGatewayProxyConfiguration) field.ErrorList {
+	return ValidateClientIdentityExchanger(&c.Spec.ClientIdentityExchanger, field.NewPath("spec").Child("clientIdentityExchanger"))
+}
+
+func ValidateClientIdentityExchanger(c *ClientIdentityExchanger, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	names := sets.NewString()
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		rulePath := path.Child("rules").Index(i)
+		if len(rule.Name) == 0 {
+			errs = append(errs, field.Required(rulePath.Child("name"), "should provide rule name"))
+		} else if names.Has(rule.Name) {
+			errs = append(errs, field.Duplicate(rulePath.Child("name"), rule.Name))
+		}
+		names.Insert(rule.Name)
+		if rule.Source == nil {
+			errs = append(errs, field.Required(rulePath.Child("source"), "should provide the source identity to match"))
+		} else {
+			errs = append(errs, ValidateIdentityExchangerSource(rule.Source, rulePath.Child("source"))...)
+		}
+		switch rule.Type {
+		case PrivilegedIdentityExchanger:
+		case StaticMappingIdentityExchanger:
+			if rule.Target == nil {
+				errs = append(errs, field.Required(rulePath.Child("target"), "should provide the target identity for StaticMappingIdentityExchanger"))
+			} else if len(rule.Target.User) == 0 {
+				errs = append(errs, field.Required(rulePath.Child("target").Child("user"), "should provide the target user for StaticMappingIdentityExchanger"))
+			}
+		case ExternalIdentityExchanger:
+			if rule.URL == nil || len(*rule.URL) == 0 {
+				errs = append(errs, field.Required(rulePath.Child("url"), "should provide url for ExternalIdentityExchanger"))
+			} else if u, err := url.Parse(*rule.URL); err != nil {
+				errs = append(errs, field.Invalid(rulePath.Child("url"), *rule.URL, fmt.Sprintf("failed parsing as URL: %v", err)))
+			} else if u.Scheme != "https" && u.Scheme != "http" {
+				errs = append(errs, field.Invalid(rulePath.Child("url"), *rule.URL, "scheme must be https or http"))
+			}
+		default:
+			errs = append(errs, field.NotSupported(rulePath.Child("type"), rule.Type, []string{
+				string(PrivilegedIdentityExchanger),
+				string(StaticMappingIdentityExchanger),
+				string(ExternalIdentityExchanger),
+			}))
+		}
+	}
+	return errs
+}
+
+func ValidateIdentityExchangerSource(c *IdentityExchangerSource, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	patterns := []struct {
+		name    string
+		pattern *string
+	}{
+		{name: "userPattern", pattern: c.UserPattern},
+		{name: "groupPattern", pattern: c.GroupPattern},
+		{name: "clusterPattern", pattern: c.ClusterPattern},
+	}
+	for _, p := range patterns {
+		if p.pattern == nil {
+			continue
+		}
+		if _, err := compileIdentityPattern(*p.pattern); err != nil {
+			errs = append(errs, field.Invalid(path.Child(p.name), *p.pattern, err.Error()))
 		}
 	}
 	return errs
@@ -0,0 +1,214 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/pointer"
+
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert/certtest"
+)
+
+func TestValidateClusterGateway(t *testing.T) {
+	now := time.Now()
+	caData := certtest.NewCertificate(t, now.Add(time.Hour))
+	certData, keyData := certtest.NewKeyPair(t, now.Add(-time.Hour), now.Add(time.Hour))
+	newGateway := func(endpoint *ClusterEndpoint, credential *ClusterAccessCredential) *ClusterGateway {
+		return &ClusterGateway{
+			Spec: ClusterGatewaySpec{
+				Provider: "kind",
+				Access: ClusterAccess{
+					Endpoint:   endpoint,
+					Credential: credential,
+				},
+			},
+		}
+	}
+	constEndpoint := func(mutate func(*ClusterEndpointConst)) *ClusterEndpoint {
+		endpoint := &ClusterEndpoint{
+			Type: ClusterEndpointTypeConst,
+			Const: &ClusterEndpointConst{
+				Address:  testEndpoint,
+				CABundle: caData,
+			},
+		}
+		if mutate != nil {
+			mutate(endpoint.Const)
+		}
+		return endpoint
+	}
+	tokenCredential := &ClusterAccessCredential{
+		Type:                CredentialTypeServiceAccountToken,
+		ServiceAccountToken: testToken,
+	}
+	cases := []struct {
+		name           string
+		input          *ClusterGateway
+		expectedErrors []string
+	}{
+		{
+			name:  "const endpoint with service-account token",
+			input: newGateway(constEndpoint(nil), tokenCredential),
+		},
+		{
+			name: "const endpoint with x509 certificate",
+			input: newGateway(constEndpoint(nil), &ClusterAccessCredential{
+				Type: CredentialTypeX509Certificate,
+				X509: &X509{Certificate: certData, PrivateKey: keyData},
+			}),
+		},
+		{
+			name: "cluster-proxy endpoint with dynamic credential",
+			input: newGateway(&ClusterEndpoint{Type: ClusterEndpointTypeClusterProxy}, &ClusterAccessCredential{
+				Type:                CredentialTypeDynamic,
+				ServiceAccountToken: testToken,
+			}),
+		},
+		{
+			name: "insecure const endpoint over proxy with alternative endpoints",
+			input: newGateway(constEndpoint(func(c *ClusterEndpointConst) {
+				c.CABundle = nil
+				c.Insecure = pointer.Bool(true)
+				c.ProxyURL = pointer.String("socks5://localhost:1080")
+				c.Endpoints = []ClusterEndpointAddress{{Address: "https://zone-a.example.com", CABundle: caData}}
+			}), tokenCredential),
+		},
+		{
+			name:           "missing endpoint and credential",
+			input:          newGateway(nil, nil),
+			expectedErrors: []string{"spec.access.endpoint: Required value", "spec.access.credential: Required value"},
+		},
+		{
+			name:           "const endpoint without const",
+			input:          newGateway(&ClusterEndpoint{Type: ClusterEndpointTypeConst}, tokenCredential),
+			expectedErrors: []string{"spec.access.endpoint.const: Required value"},
+		},
+		{
+			name:           "cluster-proxy endpoint with const",
+			input:          newGateway(&ClusterEndpoint{Type: ClusterEndpointTypeClusterProxy, Const: constEndpoint(nil).Const}, tokenCredential),
+			expectedErrors: []string{"spec.access.endpoint.const: Forbidden"},
+		},
+		{
+			name:           "unknown endpoint type",
+			input:          newGateway(&ClusterEndpoint{Type: "Unknown"}, tokenCredential),
+			expectedErrors: []string{`spec.access.endpoint.type: Unsupported value: "Unknown"`},
+		},
+		{
+			name: "invalid const endpoint",
+			input: newGateway(constEndpoint(func(c *ClusterEndpointConst) {
+				c.Address = "http://localhost:443"
+				c.CABundle = []byte(testCAData)
+				c.Endpoints = []ClusterEndpointAddress{{Address: "://"}}
+			}), tokenCredential),
+			expectedErrors: []string{
+				"spec.access.endpoint.const.address: Invalid value",
+				"spec.access.endpoint.const.caBundle: Invalid value",
+				"spec.access.endpoint.const.endpoints[0].address: Invalid value",
+			},
+		},
+		{
+			name: "missing address and ca bundle",
+			input: newGateway(constEndpoint(func(c *ClusterEndpointConst) {
+				c.Address = ""
+				c.CABundle = nil
+			}), tokenCredential),
+			expectedErrors: []string{
+				"spec.access.endpoint.const.address: Required value",
+				"spec.access.endpoint.const.caBundle: Required value",
+			},
+		},
+		{
+			name: "unsupported proxy-url scheme",
+			input: newGateway(constEndpoint(func(c *ClusterEndpointConst) {
+				c.ProxyURL = pointer.String("ftp://localhost:21")
+			}), tokenCredential),
+			expectedErrors: []string{`spec.access.endpoint.const.proxy-url: Unsupported value: "ftp"`},
+		},
+		{
+			name: "proxy-url without host",
+			input: newGateway(constEndpoint(func(c *ClusterEndpointConst) {
+				c.ProxyURL = pointer.String("http://")
+			}), tokenCredential),
+			expectedErrors: []string{"spec.access.endpoint.const.proxy-url: Invalid value"},
+		},
+		{
+			name: "unknown credential type",
+			input: newGateway(constEndpoint(nil), &ClusterAccessCredential{
+				Type: "Unknown",
+			}),
+			expectedErrors: []string{`spec.access.credential.type: Unsupported value: "Unknown"`},
+		},
+		{
+			name: "missing x509",
+			input: newGateway(constEndpoint(nil), &ClusterAccessCredential{
+				Type: CredentialTypeX509Certificate,
+			}),
+			expectedErrors: []string{"spec.access.credential.x509: Required value"},
+		},
+		{
+			name: "dynamic credential with partial x509",
+			input: newGateway(constEndpoint(nil), &ClusterAccessCredential{
+				Type: CredentialTypeDynamic,
+				X509: &X509{Certificate: certData},
+			}),
+			expectedErrors: []string{"spec.access.credential.x509: Invalid value"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			errs := ValidateClusterGateway(c.input)
+			if len(c.expectedErrors) == 0 {
+				assert.Empty(t, errs)
+				return
+			}
+			assert.Equal(t, len(c.expectedErrors), len(errs), "unexpected errors: %v", errs)
+			for _, expected := range c.expectedErrors {
+				assert.Contains(t, errs.ToAggregate().Error(), expected)
+			}
+		})
+	}
+}
+
+func TestValidateClusterGatewayUpdate(t *testing.T) {
+	now := time.Now()
+	expiredCert, expiredKey := certtest.NewKeyPair(t, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	renewedExpiredCert, renewedExpiredKey := certtest.NewKeyPair(t, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	_, mismatchedKey := certtest.NewKeyPair(t, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	newGateway := func(certPEM, keyPEM []byte) *ClusterGateway {
+		return &ClusterGateway{
+			Spec: ClusterGatewaySpec{
+				Provider: "kind",
+				Access: ClusterAccess{
+					Endpoint: &ClusterEndpoint{
+						Type:  ClusterEndpointTypeConst,
+						Const: &ClusterEndpointConst{Address: testEndpoint, Insecure: pointer.Bool(true)},
+					},
+					Credential: &ClusterAccessCredential{
+						Type: CredentialTypeX509Certificate,
+						X509: &X509{Certificate: certPEM, PrivateKey: keyPEM},
+					},
+				},
+			},
+		}
+	}
+	old := newGateway(expiredCert, expiredKey)
+	assert.NotEmpty(t, ValidateClusterGateway(old))
+
+	// unchanged expired credential doesn't block updating the other fields
+	updating := old.DeepCopy()
+	updating.Labels = map[string]string{"env": "dev"}
+	assert.Empty(t, ValidateClusterGatewayUpdate(updating, old))
+
+	// the key pair is still verified
+	updating = newGateway(expiredCert, mismatchedKey)
+	errs := ValidateClusterGatewayUpdate(updating, updating.DeepCopy())
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs.ToAggregate().Error(), "spec.access.credential.x509.privateKey")
+
+	// changed credential is checked against the validity window
+	updating = newGateway(renewedExpiredCert, renewedExpiredKey)
+	errs = ValidateClusterGatewayUpdate(updating, old)
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs.ToAggregate().Error(), "expired")
+}
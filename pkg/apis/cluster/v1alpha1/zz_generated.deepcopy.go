@@ -20,6 +20,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -41,6 +42,11 @@ func (in *ClientIdentityExchangeRule) DeepCopyInto(out *ClientIdentityExchangeRu
 		*out = new(string)
 		**out = **in
 	}
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(IdentityExchangerExternal)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClientIdentityExchangeRule.
@@ -140,6 +146,26 @@ func (in *ClusterEndpoint) DeepCopy() *ClusterEndpoint {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterEndpointAddress) DeepCopyInto(out *ClusterEndpointAddress) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEndpointAddress.
+func (in *ClusterEndpointAddress) DeepCopy() *ClusterEndpointAddress {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterEndpointAddress)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterEndpointConst) DeepCopyInto(out *ClusterEndpointConst) {
 	*out = *in
@@ -153,6 +179,18 @@ func (in *ClusterEndpointConst) DeepCopyInto(out *ClusterEndpointConst) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.ProxyURL != nil {
+		in, out := &in.ProxyURL, &out.ProxyURL
+		*out = new(string)
+		**out = **in
+	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]ClusterEndpointAddress, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEndpointConst.
@@ -171,7 +209,7 @@ func (in *ClusterGateway) DeepCopyInto(out *ClusterGateway) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGateway.
@@ -192,13 +230,118 @@ func (in *ClusterGateway) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayFanout) DeepCopyInto(out *ClusterGatewayFanout) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayFanout.
+func (in *ClusterGatewayFanout) DeepCopy() *ClusterGatewayFanout {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayFanout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayFanoutList) DeepCopyInto(out *ClusterGatewayFanoutList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]runtime.RawExtension, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]ClusterGatewayFanoutResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayFanoutList.
+func (in *ClusterGatewayFanoutList) DeepCopy() *ClusterGatewayFanoutList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayFanoutList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayFanoutOptions) DeepCopyInto(out *ClusterGatewayFanoutOptions) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ClusterTimeout = in.ClusterTimeout
+	if in.ClusterResourceVersions != nil {
+		in, out := &in.ClusterResourceVersions, &out.ClusterResourceVersions
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ClusterContinues != nil {
+		in, out := &in.ClusterContinues, &out.ClusterContinues
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayFanoutOptions.
+func (in *ClusterGatewayFanoutOptions) DeepCopy() *ClusterGatewayFanoutOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayFanoutOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterGatewayFanoutOptions) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayFanoutResult) DeepCopyInto(out *ClusterGatewayFanoutResult) {
+	*out = *in
+	if in.Status != nil {
+		in, out := &in.Status, &out.Status
+		*out = new(v1.Status)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayFanoutResult.
+func (in *ClusterGatewayFanoutResult) DeepCopy() *ClusterGatewayFanoutResult {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayFanoutResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterGatewayHealth) DeepCopyInto(out *ClusterGatewayHealth) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayHealth.
@@ -211,6 +354,109 @@ func (in *ClusterGatewayHealth) DeepCopy() *ClusterGatewayHealth {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayIdentityExchange) DeepCopyInto(out *ClusterGatewayIdentityExchange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayIdentityExchange.
+func (in *ClusterGatewayIdentityExchange) DeepCopy() *ClusterGatewayIdentityExchange {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayIdentityExchange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayIdentityExchangeReview) DeepCopyInto(out *ClusterGatewayIdentityExchangeReview) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayIdentityExchangeReview.
+func (in *ClusterGatewayIdentityExchangeReview) DeepCopy() *ClusterGatewayIdentityExchangeReview {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayIdentityExchangeReview)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterGatewayIdentityExchangeReview) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayIdentityExchangeReviewSpec) DeepCopyInto(out *ClusterGatewayIdentityExchangeReviewSpec) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Extra != nil {
+		in, out := &in.Extra, &out.Extra
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				inVal := (*in)[key]
+				in, out := &inVal, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayIdentityExchangeReviewSpec.
+func (in *ClusterGatewayIdentityExchangeReviewSpec) DeepCopy() *ClusterGatewayIdentityExchangeReviewSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayIdentityExchangeReviewSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayIdentityExchangeReviewStatus) DeepCopyInto(out *ClusterGatewayIdentityExchangeReviewStatus) {
+	*out = *in
+	if in.Impersonation != nil {
+		in, out := &in.Impersonation, &out.Impersonation
+		*out = new(ImpersonatedIdentity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Trace != nil {
+		in, out := &in.Trace, &out.Trace
+		*out = make([]IdentityExchangeRuleTrace, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayIdentityExchangeReviewStatus.
+func (in *ClusterGatewayIdentityExchangeReviewStatus) DeepCopy() *ClusterGatewayIdentityExchangeReviewStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayIdentityExchangeReviewStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterGatewayList) DeepCopyInto(out *ClusterGatewayList) {
 	*out = *in
@@ -339,6 +585,31 @@ func (in *ClusterGatewaySpec) DeepCopy() *ClusterGatewaySpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterGatewayStatus) DeepCopyInto(out *ClusterGatewayStatus) {
 	*out = *in
+	if in.LastProbeTime != nil {
+		in, out := &in.LastProbeTime, &out.LastProbeTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ProbeLatency != nil {
+		in, out := &in.ProbeLatency, &out.ProbeLatency
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.FailingChecks != nil {
+		in, out := &in.FailingChecks, &out.FailingChecks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CredentialExpirationTime != nil {
+		in, out := &in.CredentialExpirationTime, &out.CredentialExpirationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayStatus.
@@ -351,6 +622,46 @@ func (in *ClusterGatewayStatus) DeepCopy() *ClusterGatewayStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdentityExchangeRuleTrace) DeepCopyInto(out *IdentityExchangeRuleTrace) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityExchangeRuleTrace.
+func (in *IdentityExchangeRuleTrace) DeepCopy() *IdentityExchangeRuleTrace {
+	if in == nil {
+		return nil
+	}
+	out := new(IdentityExchangeRuleTrace)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdentityExchangerExternal) DeepCopyInto(out *IdentityExchangerExternal) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.CacheTTL != nil {
+		in, out := &in.CacheTTL, &out.CacheTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityExchangerExternal.
+func (in *IdentityExchangerExternal) DeepCopy() *IdentityExchangerExternal {
+	if in == nil {
+		return nil
+	}
+	out := new(IdentityExchangerExternal)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IdentityExchangerSource) DeepCopyInto(out *IdentityExchangerSource) {
 	*out = *in
@@ -421,6 +732,42 @@ func (in *IdentityExchangerTarget) DeepCopy() *IdentityExchangerTarget {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImpersonatedIdentity) DeepCopyInto(out *ImpersonatedIdentity) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Extra != nil {
+		in, out := &in.Extra, &out.Extra
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				inVal := (*in)[key]
+				in, out := &inVal, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImpersonatedIdentity.
+func (in *ImpersonatedIdentity) DeepCopy() *ImpersonatedIdentity {
+	if in == nil {
+		return nil
+	}
+	out := new(ImpersonatedIdentity)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualCluster) DeepCopyInto(out *VirtualCluster) {
 	*out = *in
@@ -32,9 +32,18 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterAccess":                                   schema_pkg_apis_cluster_v1alpha1_ClusterAccess(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterAccessCredential":                         schema_pkg_apis_cluster_v1alpha1_ClusterAccessCredential(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterEndpoint":                                 schema_pkg_apis_cluster_v1alpha1_ClusterEndpoint(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterEndpointAddress":                          schema_pkg_apis_cluster_v1alpha1_ClusterEndpointAddress(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterEndpointConst":                            schema_pkg_apis_cluster_v1alpha1_ClusterEndpointConst(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGateway":                                  schema_pkg_apis_cluster_v1alpha1_ClusterGateway(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayFanout":                            schema_pkg_apis_cluster_v1alpha1_ClusterGatewayFanout(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayFanoutList":                        schema_pkg_apis_cluster_v1alpha1_ClusterGatewayFanoutList(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayFanoutOptions":                     schema_pkg_apis_cluster_v1alpha1_ClusterGatewayFanoutOptions(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayFanoutResult":                      schema_pkg_apis_cluster_v1alpha1_ClusterGatewayFanoutResult(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayHealth":                            schema_pkg_apis_cluster_v1alpha1_ClusterGatewayHealth(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayIdentityExchange":                  schema_pkg_apis_cluster_v1alpha1_ClusterGatewayIdentityExchange(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayIdentityExchangeReview":            schema_pkg_apis_cluster_v1alpha1_ClusterGatewayIdentityExchangeReview(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayIdentityExchangeReviewSpec":        schema_pkg_apis_cluster_v1alpha1_ClusterGatewayIdentityExchangeReviewSpec(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayIdentityExchangeReviewStatus":      schema_pkg_apis_cluster_v1alpha1_ClusterGatewayIdentityExchangeReviewStatus(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayList":                              schema_pkg_apis_cluster_v1alpha1_ClusterGatewayList(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayProxy":                             schema_pkg_apis_cluster_v1alpha1_ClusterGatewayProxy(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayProxyConfiguration":                schema_pkg_apis_cluster_v1alpha1_ClusterGatewayProxyConfiguration(ref),
@@ -42,8 +51,11 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayProxyOptions":                      schema_pkg_apis_cluster_v1alpha1_ClusterGatewayProxyOptions(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewaySpec":                              schema_pkg_apis_cluster_v1alpha1_ClusterGatewaySpec(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayStatus":                            schema_pkg_apis_cluster_v1alpha1_ClusterGatewayStatus(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangeRuleTrace":                       schema_pkg_apis_cluster_v1alpha1_IdentityExchangeRuleTrace(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangerExternal":                       schema_pkg_apis_cluster_v1alpha1_IdentityExchangerExternal(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangerSource":                         schema_pkg_apis_cluster_v1alpha1_IdentityExchangerSource(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangerTarget":                         schema_pkg_apis_cluster_v1alpha1_IdentityExchangerTarget(ref),
+		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ImpersonatedIdentity":                            schema_pkg_apis_cluster_v1alpha1_ImpersonatedIdentity(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.VirtualCluster":                                  schema_pkg_apis_cluster_v1alpha1_VirtualCluster(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.VirtualClusterList":                              schema_pkg_apis_cluster_v1alpha1_VirtualClusterList(ref),
 		"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.VirtualClusterSpec":                              schema_pkg_apis_cluster_v1alpha1_VirtualClusterSpec(ref),
@@ -158,12 +170,18 @@ func schema_pkg_apis_cluster_v1alpha1_ClientIdentityExchangeRule(ref common.Refe
 							Format: "",
 						},
 					},
+					"external": {
+						SchemaProps: spec.SchemaProps{
+							Description: "External configures the requests to the URL of the ExternalIdentityExchanger",
+							Ref:         ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangerExternal"),
+						},
+					},
 				},
 				Required: []string{"name", "type", "source"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangerSource", "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangerTarget"},
+			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangerExternal", "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangerSource", "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangerTarget"},
 	}
 }
 
@@ -284,6 +302,34 @@ func schema_pkg_apis_cluster_v1alpha1_ClusterEndpoint(ref common.ReferenceCallba
 	}
 }
 
+func schema_pkg_apis_cluster_v1alpha1_ClusterEndpointAddress(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"address": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Address is a qualified hostname for accessing the kube-apiserver, which differs from the other endpoints of the cluster only by the host.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"caBundle": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CABundle overrides the CABundle of the cluster for verifying the serving certificate of the endpoint.",
+							Type:        []string{"string"},
+							Format:      "byte",
+						},
+					},
+				},
+				Required: []string{"address"},
+			},
+		},
+	}
+}
+
 func schema_pkg_apis_cluster_v1alpha1_ClusterEndpointConst(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -319,10 +365,26 @@ func schema_pkg_apis_cluster_v1alpha1_ClusterEndpointConst(ref common.ReferenceC
 							Format:      "",
 						},
 					},
+					"endpoints": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Endpoints are the ordered alternative addresses of the kube-apiserver, e.g. the load balancers in different zones. The requests fail over to the next endpoint upon dial or TLS errors, and stick to the last healthy one. Address is tried first unless listed here.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterEndpointAddress"),
+									},
+								},
+							},
+						},
+					},
 				},
 				Required: []string{"address"},
 			},
 		},
+		Dependencies: []string{
+			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterEndpointAddress"},
 	}
 }
 
@@ -353,69 +415,467 @@ func schema_pkg_apis_cluster_v1alpha1_ClusterGateway(ref common.ReferenceCallbac
 							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
 						},
 					},
-					"spec": {
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewaySpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewaySpec", "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayFanout(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayFanout is a subresource for ClusterGateway which proxies the same read request to the clusters selected by labels concurrently, and merges the responses into one list.",
+				Type:        []string{"object"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayFanoutList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayFanoutList is the list responded by the fanout subresource. The items are merged from the clusters and annotated with the clusters they are from, while the results of the clusters are listed in Clusters.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+						},
+					},
+					"items": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("k8s.io/apimachinery/pkg/runtime.RawExtension"),
+									},
+								},
+							},
+						},
+					},
+					"clusters": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Clusters are the results of the requests to the selected clusters",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayFanoutResult"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"items", "clusters"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayFanoutResult", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta", "k8s.io/apimachinery/pkg/runtime.RawExtension"},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayFanoutOptions(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"TypeMeta": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.TypeMeta"),
+						},
+					},
+					"path": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Path is the target api path of the fanout request. e.g. \"/api/v1/namespaces/default/pods\"",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"clusterSelector": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClusterSelector is the label selector of the clusters to request, all the clusters are requested if empty.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"parallelism": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Parallelism is the maximum number of the clusters requested concurrently, which is capped by --proxy-fanout-parallelism.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"clusterTimeout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClusterTimeout is the timeout of the request to each cluster, the timeout of the cluster applies if shorter.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"clusterResourceVersions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClusterResourceVersions are the resource versions to resume watching the clusters from, in the form of \"<cluster>=<resourceVersion>,...\".",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"clusterContinues": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClusterContinues are the continue tokens to read the next pages of the clusters from, in the form of \"<cluster>=<continue>,...\". Only the listed clusters are requested if set.",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"impersonate": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Impersonate indicates whether to impersonate as the original user identity in the clusters, same as the proxy subresource.",
+							Default:     false,
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"TypeMeta", "path", "impersonate"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Duration", "k8s.io/apimachinery/pkg/apis/meta/v1.TypeMeta"},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayFanoutResult(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayFanoutResult is the result of the request to a cluster.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"cluster": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Cluster is the name of the cluster",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"items": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Items is the number of the items merged from the cluster",
+							Default:     0,
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Status is the failure of the request to the cluster, e.g. the error responded by the cluster, the timeout or the forbidden access, which is unset if succeeded",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Status"),
+						},
+					},
+					"resourceVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ResourceVersion is the resource version of the list responded by the cluster",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"continue": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Continue is the continue token of the list responded by the cluster if more items remain, which is passed on by the clusterContinues parameter to read the next page",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"cluster", "items"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Status"},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayHealth(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewaySpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewaySpec", "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayIdentityExchange(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayIdentityExchange is a subresource for ClusterGateway which dry-runs the identity exchange rules for the given identity, without proxying any request to the managed cluster.",
+				Type:        []string{"object"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayIdentityExchangeReview(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayIdentityExchangeReview is posted to the identityexchange subresource of ClusterGateway, the status is filled by the evaluation of the identity exchange rules as if proxying requests with impersonation.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayIdentityExchangeReviewSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayIdentityExchangeReviewStatus"),
+						},
+					},
+				},
+				Required: []string{"spec"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayIdentityExchangeReviewSpec", "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayIdentityExchangeReviewStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayIdentityExchangeReviewSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayIdentityExchangeReviewSpec is the identity to exchange. The identity of the requesting user is used if both user and groups are empty.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"user": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"groups": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"uid": {
 						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewaySpec"),
+							Type:   []string{"string"},
+							Format: "",
 						},
 					},
-					"status": {
+					"extra": {
 						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayStatus"),
+							Type: []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type: []string{"array"},
+										Items: &spec.SchemaOrArray{
+											Schema: &spec.Schema{
+												SchemaProps: spec.SchemaProps{
+													Default: "",
+													Type:    []string{"string"},
+													Format:  "",
+												},
+											},
+										},
+									},
+								},
+							},
 						},
 					},
 				},
 			},
 		},
-		Dependencies: []string{
-			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewaySpec", "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
 	}
 }
 
-func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayHealth(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayIdentityExchangeReviewStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
 				Type: []string{"object"},
 				Properties: map[string]spec.Schema{
-					"kind": {
+					"matched": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Description: "Matched indicates whether any of the rules matches the identity",
+							Default:     false,
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"source": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Source is where the matched rule is from",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"apiVersion": {
+					"ruleName": {
 						SchemaProps: spec.SchemaProps{
-							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Description: "RuleName is the name of the matched rule",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"metadata": {
+					"impersonation": {
 						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+							Description: "Impersonation is the identity impersonated by the proxied requests, it is the given identity if no rule matches, and is unset if the requests are not impersonated, e.g. matching PrivilegedIdentityExchanger",
+							Ref:         ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ImpersonatedIdentity"),
 						},
 					},
-					"spec": {
+					"error": {
 						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewaySpec"),
+							Description: "Error is the failure of exchanging the identity with the matched rule, the proxied requests are rejected upon such failure",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
-					"status": {
+					"trace": {
 						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayStatus"),
+							Description: "Trace is the rules evaluated in order until the matched one",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangeRuleTrace"),
+									},
+								},
+							},
 						},
 					},
 				},
+				Required: []string{"matched"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewaySpec", "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ClusterGatewayStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+			"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.IdentityExchangeRuleTrace", "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1.ImpersonatedIdentity"},
 	}
 }
 
@@ -610,7 +1070,7 @@ func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayStatus(ref common.ReferenceC
 				Properties: map[string]spec.Schema{
 					"healthy": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Healthy indicates whether the cluster is healthy. If the `HealthinessCheck` feature gate is enabled, calling proxy subresource upon unhealthy clusters will be rejected.",
+							Description: "Healthy indicates whether the cluster is healthy. If the `HealthinessCheck` feature gate is enabled, calling proxy subresource upon unhealthy clusters will be rejected with 503.",
 							Default:     false,
 							Type:        []string{"boolean"},
 							Format:      "",
@@ -623,10 +1083,189 @@ func schema_pkg_apis_cluster_v1alpha1_ClusterGatewayStatus(ref common.ReferenceC
 							Format:      "",
 						},
 					},
+					"lastProbeTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastProbeTime is the time of the last health probe.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"probeLatency": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ProbeLatency is the time cost of the last health probe.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"consecutiveFailures": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ConsecutiveFailures is the number of the consecutive failed probes.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"consecutiveSuccesses": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ConsecutiveSuccesses is the number of the consecutive succeeded probes.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"failingChecks": {
+						SchemaProps: spec.SchemaProps{
+							Description: "FailingChecks are the failing checks reported by the last probe, e.g. \"readyz:etcd\" for the failing etcd check of the \"/readyz\" endpoint.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"version": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Version is the kube-apiserver version discovered by the last probe.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"credentialExpirationTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CredentialExpirationTime is when the credential of the cluster expires, parsed from the X509 certificate or the \"exp\" claim of the token.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"conditions": {
+						VendorExtensible: spec.VendorExtensible{
+							Extensions: spec.Extensions{
+								"x-kubernetes-list-map-keys": []interface{}{
+									"type",
+								},
+								"x-kubernetes-list-type": "map",
+							},
+						},
+						SchemaProps: spec.SchemaProps{
+							Description: "Conditions are the observations of the cluster by the health probes, including Reachable, Authenticated, Healthy and CredentialValid.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.Condition"),
+									},
+								},
+							},
+						},
+					},
 				},
 				Required: []string{"healthy"},
 			},
 		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Condition", "k8s.io/apimachinery/pkg/apis/meta/v1.Duration", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_IdentityExchangeRuleTrace(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"source": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"rule": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"matched": {
+						SchemaProps: spec.SchemaProps{
+							Default: false,
+							Type:    []string{"boolean"},
+							Format:  "",
+						},
+					},
+					"reason": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Reason is why the identity does not match the source of the rule",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"source", "rule", "type", "matched"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_cluster_v1alpha1_IdentityExchangerExternal(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"caFile": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CAFile is the path to the CA for verifying the external exchanger",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"certFile": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CertFile and KeyFile are the paths to the client certificate presented to the external exchanger",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"keyFile": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"insecureSkipTLSVerify": {
+						SchemaProps: spec.SchemaProps{
+							Description: "InsecureSkipTLSVerify skips verifying the external exchanger",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"timeout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Timeout of the requests to the external exchanger, defaults to 10s",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"cacheTTL": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CacheTTL is how long the exchanged identities are cached, the responses are not cached if unset",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
 	}
 }
 
@@ -722,6 +1361,66 @@ func schema_pkg_apis_cluster_v1alpha1_IdentityExchangerTarget(ref common.Referen
 	}
 }
 
+func schema_pkg_apis_cluster_v1alpha1_ImpersonatedIdentity(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"user": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"groups": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"uid": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"extra": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type: []string{"array"},
+										Items: &spec.SchemaOrArray{
+											Schema: &spec.Schema{
+												SchemaProps: spec.SchemaProps{
+													Default: "",
+													Type:    []string{"string"},
+													Format:  "",
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 func schema_pkg_apis_cluster_v1alpha1_VirtualCluster(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -962,12 +1661,25 @@ func schema_pkg_apis_cluster_v1alpha1_proxyResponseWriter(ref common.ReferenceCa
 							Format:  "int32",
 						},
 					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Description: "status is the error responded by the responder",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Status"),
+						},
+					},
+					"bytes": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
 				},
-				Required: []string{"ResponseWriter", "Hijacker", "Flusher", "statusCode"},
+				Required: []string{"ResponseWriter", "Hijacker", "Flusher", "statusCode", "status", "bytes"},
 			},
 		},
 		Dependencies: []string{
-			"net/http.Flusher", "net/http.Hijacker", "net/http.ResponseWriter"},
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Status", "net/http.Flusher", "net/http.Hijacker", "net/http.ResponseWriter"},
 	}
 }
 
@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/audit/policy"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/util/webhook"
+	"k8s.io/apiserver/plugin/pkg/audit/buffered"
+	pluginlog "k8s.io/apiserver/plugin/pkg/audit/log"
+	pluginwebhook "k8s.io/apiserver/plugin/pkg/audit/webhook"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+// the batching of the webhook backend, same as the defaults of kube-apiserver
+var webhookBatchConfig = buffered.BatchConfig{
+	BufferSize:     10000,
+	MaxBatchSize:   400,
+	MaxBatchWait:   30 * time.Second,
+	ThrottleEnable: true,
+	ThrottleQPS:    10,
+	ThrottleBurst:  15,
+	AsyncDelegate:  true,
+}
+
+var (
+	mu        sync.RWMutex
+	backend   audit.Backend
+	evaluator audit.PolicyRuleEvaluator
+)
+
+// Init loads the audit policy and builds the backends of the proxied requests
+// by the flags. Auditing is disabled if neither the log path nor the webhook
+// is configured.
+func Init() error {
+	if config.ProxyAuditLogPath == "" && config.ProxyAuditWebhookConfigFile == "" {
+		return nil
+	}
+	if config.ProxyAuditPolicyFile == "" {
+		return fmt.Errorf("--proxy-audit-policy-file is required for auditing the proxied requests")
+	}
+	p, err := policy.LoadPolicyFromFile(config.ProxyAuditPolicyFile)
+	if err != nil {
+		return err
+	}
+	var backends []audit.Backend
+	if config.ProxyAuditLogPath != "" {
+		var out io.Writer = os.Stdout
+		if config.ProxyAuditLogPath != "-" {
+			out = &lumberjack.Logger{
+				Filename:   config.ProxyAuditLogPath,
+				MaxAge:     config.ProxyAuditLogMaxAge,
+				MaxBackups: config.ProxyAuditLogMaxBackups,
+				MaxSize:    config.ProxyAuditLogMaxSize,
+			}
+		}
+		backends = append(backends, pluginlog.NewBackend(out, pluginlog.FormatJson, auditv1.SchemeGroupVersion))
+	}
+	if config.ProxyAuditWebhookConfigFile != "" {
+		webhookBackend, err := pluginwebhook.NewBackend(config.ProxyAuditWebhookConfigFile, auditv1.SchemeGroupVersion,
+			webhook.DefaultRetryBackoffWithInitialDelay(pluginwebhook.DefaultInitialBackoffDelay), nil)
+		if err != nil {
+			return fmt.Errorf("failed loading the audit webhook: %w", err)
+		}
+		backends = append(backends, buffered.NewBackend(webhookBackend, webhookBatchConfig))
+	}
+	Set(audit.Union(backends...), policy.NewPolicyRuleEvaluator(p))
+	return nil
+}
+
+// Set replaces the backend and the policy evaluator auditing the proxied
+// requests, nil backend disables auditing.
+func Set(b audit.Backend, e audit.PolicyRuleEvaluator) {
+	mu.Lock()
+	defer mu.Unlock()
+	backend, evaluator = b, e
+}
+
+// Run runs the backend until the server stops, the buffered events are
+// flushed upon shutting down.
+func Run(ctx server.PostStartHookContext) error {
+	mu.RLock()
+	b := backend
+	mu.RUnlock()
+	if b == nil {
+		return nil
+	}
+	if err := b.Run(ctx.Done()); err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		b.Shutdown()
+	}()
+	return nil
+}
+
+// EvaluatePolicyRule returns the audit config of the proxied request, the
+// level is None if auditing is disabled.
+func EvaluatePolicyRule(attrs authorizer.Attributes) audit.RequestAuditConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+	if backend == nil || evaluator == nil {
+		return audit.RequestAuditConfig{Level: auditinternal.LevelNone}
+	}
+	return evaluator.EvaluatePolicyRule(attrs)
+}
+
+// ProcessEvent sends the audit event to the backend.
+func ProcessEvent(ev *auditinternal.Event) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	if backend == nil {
+		return false
+	}
+	return backend.ProcessEvents(ev)
+}
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+)
+
+func TestInit(t *testing.T) {
+	defer func(policyFile, logPath string) {
+		config.ProxyAuditPolicyFile, config.ProxyAuditLogPath = policyFile, logPath
+		Set(nil, nil)
+	}(config.ProxyAuditPolicyFile, config.ProxyAuditLogPath)
+
+	// disabled without any backend
+	require.NoError(t, Init())
+	assert.Equal(t, auditinternal.LevelNone, EvaluatePolicyRule(authorizer.AttributesRecord{}).Level)
+	assert.False(t, ProcessEvent(&auditinternal.Event{}))
+
+	dir := t.TempDir()
+	config.ProxyAuditLogPath = filepath.Join(dir, "audit.log")
+	require.Error(t, Init())
+
+	config.ProxyAuditPolicyFile = filepath.Join(dir, "policy.yaml")
+	require.NoError(t, os.WriteFile(config.ProxyAuditPolicyFile, []byte(`
+apiVersion: audit.k8s.io/v1
+kind: Policy
+rules:
+- level: None
+  users: ["system:anonymous"]
+- level: Metadata
+`), 0600))
+	require.NoError(t, Init())
+	assert.Equal(t, auditinternal.LevelNone, EvaluatePolicyRule(authorizer.AttributesRecord{
+		User: &user.DefaultInfo{Name: "system:anonymous"},
+	}).Level)
+	assert.Equal(t, auditinternal.LevelMetadata, EvaluatePolicyRule(authorizer.AttributesRecord{
+		User: &user.DefaultInfo{Name: "test"},
+	}).Level)
+
+	assert.True(t, ProcessEvent(&auditinternal.Event{
+		Level:   auditinternal.LevelMetadata,
+		AuditID: "test-id",
+		Stage:   auditinternal.StageResponseComplete,
+		Verb:    "get",
+	}))
+	data, err := os.ReadFile(config.ProxyAuditLogPath)
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), `"apiVersion":"audit.k8s.io/v1"`), string(data))
+	assert.True(t, strings.Contains(string(data), `"auditID":"test-id"`), string(data))
+}
@@ -28,4 +28,9 @@ var (
 	LabelKeyClusterCredentialType = config.MetaApiGroupName + "/cluster-credential-type"
 	// LabelKeyClusterEndpointType describes the endpoint type.
 	LabelKeyClusterEndpointType = config.MetaApiGroupName + "/cluster-endpoint-type"
+	// LabelKeyClusterProvider describes the provider of the cluster.
+	LabelKeyClusterProvider = config.MetaApiGroupName + "/cluster-provider"
+	// LabelKeyClusterCredentialProvider describes the provider issuing the
+	// Dynamic credential, defaults to "exec".
+	LabelKeyClusterCredentialProvider = config.MetaApiGroupName + "/cluster-credential-provider"
 )
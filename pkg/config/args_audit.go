@@ -0,0 +1,44 @@
+package config
+
+import (
+	"github.com/spf13/pflag"
+)
+
+// ProxyAuditPolicyFile is the path of the audit policy file picking the
+// levels of the proxied requests, required by the audit backends
+var ProxyAuditPolicyFile = ""
+
+// ProxyAuditLogPath is the path of the file the audit events of the proxied
+// requests are written to, "-" means the standard output
+var ProxyAuditLogPath = ""
+
+// ProxyAuditLogMaxAge is the maximum number of days to retain the rotated
+// audit log files
+var ProxyAuditLogMaxAge = 0
+
+// ProxyAuditLogMaxBackups is the maximum number of the rotated audit log
+// files to retain
+var ProxyAuditLogMaxBackups = 0
+
+// ProxyAuditLogMaxSize is the maximum size in megabytes of the audit log file
+// before it gets rotated
+var ProxyAuditLogMaxSize = 100
+
+// ProxyAuditWebhookConfigFile is the path of the kubeconfig file of the
+// webhook receiving the audit events of the proxied requests
+var ProxyAuditWebhookConfigFile = ""
+
+func AddProxyAuditFlags(set *pflag.FlagSet) {
+	set.StringVarP(&ProxyAuditPolicyFile, "proxy-audit-policy-file", "", ProxyAuditPolicyFile,
+		"the path of the audit policy file picking the levels of the proxied requests")
+	set.StringVarP(&ProxyAuditLogPath, "proxy-audit-log-path", "", ProxyAuditLogPath,
+		"if set, the audit events of the proxied requests are written to the file, '-' means the standard output")
+	set.IntVarP(&ProxyAuditLogMaxAge, "proxy-audit-log-maxage", "", ProxyAuditLogMaxAge,
+		"the maximum number of days to retain the rotated audit log files")
+	set.IntVarP(&ProxyAuditLogMaxBackups, "proxy-audit-log-maxbackup", "", ProxyAuditLogMaxBackups,
+		"the maximum number of the rotated audit log files to retain")
+	set.IntVarP(&ProxyAuditLogMaxSize, "proxy-audit-log-maxsize", "", ProxyAuditLogMaxSize,
+		"the maximum size in megabytes of the audit log file before it gets rotated")
+	set.StringVarP(&ProxyAuditWebhookConfigFile, "proxy-audit-webhook-config-file", "", ProxyAuditWebhookConfigFile,
+		"if set, the audit events of the proxied requests are sent to the webhook in the kubeconfig file")
+}
@@ -1,12 +1,47 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/pflag"
 )
 
 var AuthorizateProxySubpath bool
 
+// AuthorizeProxySubpathClusterScoped scopes the API group (or the path of the
+// non-resource requests) in the subpath authorization attributes to the
+// cluster, so that the RBAC rules of the hub can grant per-cluster access
+var AuthorizeProxySubpathClusterScoped bool
+
+// ProxyAuthorizationWebhookConfigFile is the path of the kubeconfig file of
+// the webhook authorizing the proxied requests before the hub
+var ProxyAuthorizationWebhookConfigFile = ""
+
+// ProxyAuthorizationCacheSize is the maximum number of the cached decisions
+// of the proxy subpath authorization
+var ProxyAuthorizationCacheSize = 4096
+
+// ProxyAuthorizationCacheAllowTTL is the duration to cache the allowed
+// decisions of the proxy subpath authorization, 0 disables caching
+var ProxyAuthorizationCacheAllowTTL = 10 * time.Second
+
+// ProxyAuthorizationCacheDenyTTL is the duration to cache the denied
+// decisions of the proxy subpath authorization, 0 disables caching
+var ProxyAuthorizationCacheDenyTTL = 10 * time.Second
+
 func AddProxyAuthorizationFlags(set *pflag.FlagSet) {
 	set.BoolVarP(&AuthorizateProxySubpath, "authorize-proxy-subpath", "", false,
 		"perform an additional delegated authorization against the hub cluster for the target proxying path when invoking clustergateway/proxy subresource")
+	set.BoolVarP(&AuthorizeProxySubpathClusterScoped, "authorize-proxy-subpath-cluster-scoped", "", false,
+		"scope the API group of the proxy subpath authorization to the cluster, e.g. \"apps.<cluster>.clusters.cluster.core.oam.dev\", "+
+			"and the non-resource path to \"/clusters/<cluster>/...\"")
+	set.StringVarP(&ProxyAuthorizationWebhookConfigFile, "proxy-authorization-webhook-config-file", "", ProxyAuthorizationWebhookConfigFile,
+		"the kubeconfig file of the SubjectAccessReview webhook consulted before the hub for the proxy subpath authorization, "+
+			"the hub is only consulted upon no opinion")
+	set.IntVarP(&ProxyAuthorizationCacheSize, "proxy-authorization-cache-size", "", ProxyAuthorizationCacheSize,
+		"the maximum number of the cached decisions of the proxy subpath authorization")
+	set.DurationVarP(&ProxyAuthorizationCacheAllowTTL, "proxy-authorization-cache-allow-ttl", "", ProxyAuthorizationCacheAllowTTL,
+		"the duration to cache the allowed decisions of the proxy subpath authorization, 0 disables caching")
+	set.DurationVarP(&ProxyAuthorizationCacheDenyTTL, "proxy-authorization-cache-deny-ttl", "", ProxyAuthorizationCacheDenyTTL,
+		"the duration to cache the denied decisions of the proxy subpath authorization, 0 disables caching")
 }
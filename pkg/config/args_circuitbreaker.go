@@ -0,0 +1,49 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// ProxyUnhealthyRetryAfter is the Retry-After duration responded upon
+// rejecting the proxied requests to the unhealthy clusters
+var ProxyUnhealthyRetryAfter = 10 * time.Second
+
+// ProxyCircuitBreakerConsecutiveFailures is the number of consecutive failed
+// proxied requests tripping the circuit breaker of the cluster, 0 disables
+// tripping by consecutive failures
+var ProxyCircuitBreakerConsecutiveFailures = 5
+
+// ProxyCircuitBreakerFailureRatio is the ratio of the failed proxied requests
+// within the window tripping the circuit breaker of the cluster, 0 disables
+// tripping by the failure ratio
+var ProxyCircuitBreakerFailureRatio = 0.5
+
+// ProxyCircuitBreakerMinRequests is the minimum number of the proxied
+// requests within the window before the failure ratio is considered
+var ProxyCircuitBreakerMinRequests = 20
+
+// ProxyCircuitBreakerWindow is the duration of the window counting the
+// failure ratio of the proxied requests
+var ProxyCircuitBreakerWindow = 30 * time.Second
+
+// ProxyCircuitBreakerOpenDuration is the duration rejecting the proxied
+// requests after the circuit breaker trips, before a trial request is let
+// through
+var ProxyCircuitBreakerOpenDuration = 30 * time.Second
+
+func AddProxyCircuitBreakerFlags(set *pflag.FlagSet) {
+	set.DurationVarP(&ProxyUnhealthyRetryAfter, "proxy-unhealthy-retry-after", "", ProxyUnhealthyRetryAfter,
+		"the Retry-After duration responded upon rejecting the proxied requests to the unhealthy clusters")
+	set.IntVarP(&ProxyCircuitBreakerConsecutiveFailures, "proxy-circuit-breaker-consecutive-failures", "", ProxyCircuitBreakerConsecutiveFailures,
+		"the number of consecutive failed proxied requests tripping the circuit breaker of the cluster, 0 disables it")
+	set.Float64VarP(&ProxyCircuitBreakerFailureRatio, "proxy-circuit-breaker-failure-ratio", "", ProxyCircuitBreakerFailureRatio,
+		"the ratio of failed proxied requests within the window tripping the circuit breaker of the cluster, 0 disables it")
+	set.IntVarP(&ProxyCircuitBreakerMinRequests, "proxy-circuit-breaker-min-requests", "", ProxyCircuitBreakerMinRequests,
+		"the minimum number of proxied requests within the window before the failure ratio is considered")
+	set.DurationVarP(&ProxyCircuitBreakerWindow, "proxy-circuit-breaker-window", "", ProxyCircuitBreakerWindow,
+		"the duration of the window counting the failure ratio of the proxied requests")
+	set.DurationVarP(&ProxyCircuitBreakerOpenDuration, "proxy-circuit-breaker-open-duration", "", ProxyCircuitBreakerOpenDuration,
+		"the duration rejecting the proxied requests after the circuit breaker trips, before a trial request is let through")
+}
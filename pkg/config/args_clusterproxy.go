@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 )
@@ -11,6 +13,18 @@ var ClusterProxyCAFile string
 var ClusterProxyCertFile string
 var ClusterProxyKeyFile string
 
+// ClusterProxyMaxStreamsPerTunnel limits the concurrent requests multiplexed
+// over one tunnel, a new tunnel will be opened when all tunnels are busy
+var ClusterProxyMaxStreamsPerTunnel = 100
+
+// ClusterProxyTunnelHealthCheckInterval is the interval of pinging the pooled
+// tunnels, the unresponsive tunnels will be closed
+var ClusterProxyTunnelHealthCheckInterval = 30 * time.Second
+
+// ClusterProxyTunnelMaxBackoff is the maximum backoff between the retries of
+// opening tunnels after consecutive failures
+var ClusterProxyTunnelMaxBackoff = 30 * time.Second
+
 func ValidateClusterProxy() error {
 	if len(ClusterProxyHost) == 0 {
 		return nil
@@ -27,6 +41,9 @@ func ValidateClusterProxy() error {
 	if len(ClusterProxyKeyFile) == 0 {
 		return errors.New("--proxy-key must be specified")
 	}
+	if ClusterProxyMaxStreamsPerTunnel <= 0 {
+		return errors.New("--proxy-max-streams-per-tunnel must be greater than 0")
+	}
 	return nil
 }
 
@@ -41,4 +58,10 @@ func AddClusterProxyFlags(set *pflag.FlagSet) {
 		"the path to tls cert for connecting cluster proxy")
 	set.StringVarP(&ClusterProxyKeyFile, "proxy-key", "", "",
 		"the path to tls key for connecting cluster proxy")
+	set.IntVarP(&ClusterProxyMaxStreamsPerTunnel, "proxy-max-streams-per-tunnel", "", ClusterProxyMaxStreamsPerTunnel,
+		"the maximum concurrent requests multiplexed over one tunnel to the managed cluster")
+	set.DurationVarP(&ClusterProxyTunnelHealthCheckInterval, "proxy-tunnel-health-check-interval", "", ClusterProxyTunnelHealthCheckInterval,
+		"the interval of health checking the pooled tunnels to the managed clusters")
+	set.DurationVarP(&ClusterProxyTunnelMaxBackoff, "proxy-tunnel-max-backoff", "", ClusterProxyTunnelMaxBackoff,
+		"the maximum backoff before retrying to open tunnels to the managed cluster after failures")
 }
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// DynamicCredentialIssueTimeout bounds the issuance of the Dynamic
+// credentials, e.g. the running time of the exec plugins
+var DynamicCredentialIssueTimeout = 30 * time.Second
+
+// DynamicCredentialRefreshBefore is the duration before the expiration of
+// the cached Dynamic credentials to refresh them in the background
+var DynamicCredentialRefreshBefore = 5 * time.Minute
+
+// DynamicCredentialTokenFileDirs are the directories allowed for the token
+// files read by the credential providers, none is allowed if empty
+var DynamicCredentialTokenFileDirs []string
+
+// DynamicCredentialServiceAccounts are the service accounts in the hub, in
+// the form of "<namespace>/<name>", allowed for requesting the tokens by the
+// credential providers, none is allowed if empty
+var DynamicCredentialServiceAccounts []string
+
+func AddDynamicCredentialFlags(set *pflag.FlagSet) {
+	set.DurationVarP(&DynamicCredentialIssueTimeout, "dynamic-credential-issue-timeout", "", DynamicCredentialIssueTimeout,
+		"the timeout of issuing the dynamic credential for the managed cluster, e.g. running the exec plugin")
+	set.DurationVarP(&DynamicCredentialRefreshBefore, "dynamic-credential-refresh-before", "", DynamicCredentialRefreshBefore,
+		"the duration before the expiration of the cached dynamic credential to refresh it in the background")
+	set.StringSliceVarP(&DynamicCredentialTokenFileDirs, "dynamic-credential-token-file-dirs", "", DynamicCredentialTokenFileDirs,
+		"the directories allowed for the token files read by the dynamic credential providers, e.g. the projected service account token volumes")
+	set.StringSliceVarP(&DynamicCredentialServiceAccounts, "dynamic-credential-service-accounts", "", DynamicCredentialServiceAccounts,
+		"the service accounts in the hub cluster, in the form of <namespace>/<name>, allowed for requesting the tokens by the dynamic credential providers")
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// ProxyFanoutParallelism is the maximum number of the clusters requested
+// concurrently by each request to the fanout subresource
+var ProxyFanoutParallelism = 16
+
+// ProxyFanoutMaxResponseBytes is the maximum size of the response of each
+// cluster buffered by the fanout subresource for merging
+var ProxyFanoutMaxResponseBytes int64 = 32 << 20
+
+// ProxyFanoutTimeout bounds the total duration of each list request to the
+// fanout subresource, the clusters not responded in time are failed with the
+// timeout. It should be shorter than --request-timeout so that the results of
+// the clusters are still responded.
+var ProxyFanoutTimeout = 30 * time.Second
+
+func AddProxyFanoutFlags(set *pflag.FlagSet) {
+	set.IntVarP(&ProxyFanoutParallelism, "proxy-fanout-parallelism", "", ProxyFanoutParallelism,
+		"the maximum number of the clusters requested concurrently by each request to the clustergateway/fanout subresource")
+	set.Int64VarP(&ProxyFanoutMaxResponseBytes, "proxy-fanout-max-response-bytes", "", ProxyFanoutMaxResponseBytes,
+		"the maximum size of the response of each cluster buffered by the clustergateway/fanout subresource, 0 for unlimited")
+	set.DurationVarP(&ProxyFanoutTimeout, "proxy-fanout-timeout", "", ProxyFanoutTimeout,
+		"the total duration of each list request to the clustergateway/fanout subresource, which should be shorter than --request-timeout, 0 for unlimited")
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// HealthProbe runs the health prober inside the apiserver, which probes the
+// clusters listed from the cluster secrets without relying on OCM
+var HealthProbe = false
+
+// HealthProbeConfigPath is the path to the file declaring the probes of the
+// clusters
+var HealthProbeConfigPath = ""
+
+// HealthProbeWorkers is the number of the clusters probed concurrently
+var HealthProbeWorkers = 4
+
+// HealthProbeResyncPeriod is the period listing the clusters to probe
+var HealthProbeResyncPeriod = 30 * time.Second
+
+// HealthProbeLeaderElect elects a single replica to run the health prober
+var HealthProbeLeaderElect = true
+
+// HealthProbeStatusUpdatePeriod is the minimal period persisting the probe
+// results which don't change the healthiness or the conditions of the cluster
+var HealthProbeStatusUpdatePeriod = 5 * time.Minute
+
+// HealthProbeLeaderElectionLease is the name of the lease for electing the
+// health prober in the secret namespace
+const HealthProbeLeaderElectionLease = "cluster-gateway-health-prober"
+
+func AddHealthProbeFlags(set *pflag.FlagSet) {
+	set.BoolVarP(&HealthProbe, "health-probe", "", HealthProbe,
+		"run the health prober for the clusters listed from the cluster secrets, requires the HealthinessCheck feature gate")
+	set.StringVarP(&HealthProbeConfigPath, "health-probe-config", "", HealthProbeConfigPath,
+		"the path to the file declaring the probes of the clusters")
+	set.IntVarP(&HealthProbeWorkers, "health-probe-workers", "", HealthProbeWorkers,
+		"the number of the clusters probed concurrently")
+	set.DurationVarP(&HealthProbeResyncPeriod, "health-probe-resync-period", "", HealthProbeResyncPeriod,
+		"the period listing the clusters to probe")
+	set.DurationVarP(&HealthProbeStatusUpdatePeriod, "health-probe-status-update-period", "", HealthProbeStatusUpdatePeriod,
+		"the minimal period persisting the probe results which don't change the healthiness or the conditions of the cluster")
+	set.BoolVarP(&HealthProbeLeaderElect, "health-probe-leader-elect", "", HealthProbeLeaderElect,
+		"elect a single replica to run the health prober by the lease "+HealthProbeLeaderElectionLease+" in the secret namespace")
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// ProxyRequestTimeout is the default timeout of the proxied requests to the
+// clusters, excluding the watches and the upgraded connections
+var ProxyRequestTimeout = 40 * time.Second
+
+// ProxyClusterQPS is the default QPS of the proxied requests to each cluster,
+// 0 disables rate limiting
+var ProxyClusterQPS float64 = 0
+
+// ProxyClusterBurst is the default burst of the proxied requests to each
+// cluster, defaults to the QPS rounded up if not positive
+var ProxyClusterBurst = 0
+
+// ProxyClusterMaxInFlight is the default maximum number of the in-flight
+// proxied requests to each cluster, excluding the watches and the upgraded
+// connections, 0 disables the limit
+var ProxyClusterMaxInFlight = 0
+
+// ProxyRateLimitMaxWait is the maximum duration the proxied requests wait in
+// the queue for the rate limit of the cluster before being rejected
+var ProxyRateLimitMaxWait = time.Second
+
+func AddProxyRateLimitFlags(set *pflag.FlagSet) {
+	set.DurationVarP(&ProxyRequestTimeout, "proxy-request-timeout", "", ProxyRequestTimeout,
+		"the default timeout of the proxied requests to the clusters, excluding the watches and the upgraded connections")
+	set.Float64VarP(&ProxyClusterQPS, "proxy-cluster-qps", "", ProxyClusterQPS,
+		"the default QPS of the proxied requests to each cluster, 0 disables rate limiting")
+	set.IntVarP(&ProxyClusterBurst, "proxy-cluster-burst", "", ProxyClusterBurst,
+		"the default burst of the proxied requests to each cluster, defaults to the QPS rounded up")
+	set.IntVarP(&ProxyClusterMaxInFlight, "proxy-cluster-max-in-flight", "", ProxyClusterMaxInFlight,
+		"the default maximum number of in-flight proxied requests to each cluster, 0 disables the limit")
+	set.DurationVarP(&ProxyRateLimitMaxWait, "proxy-rate-limit-max-wait", "", ProxyRateLimitMaxWait,
+		"the maximum duration the proxied requests wait for the rate limit of the cluster before being rejected")
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2023 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// ClusterTransportCacheExpiration is the duration after which an unused
+// transport to the managed cluster is evicted from the cache
+var ClusterTransportCacheExpiration = 10 * time.Minute
+
+// ClusterTransportMaxIdleConnsPerHost limits the idle connections kept for
+// each managed cluster
+var ClusterTransportMaxIdleConnsPerHost = 25
+
+// ClusterTransportIdleConnTimeout is the maximum amount of time an idle
+// connection to the managed cluster will remain idle before closing itself
+var ClusterTransportIdleConnTimeout = 90 * time.Second
+
+func AddClusterTransportFlags(set *pflag.FlagSet) {
+	set.DurationVarP(&ClusterTransportCacheExpiration, "cluster-transport-cache-expiration", "", ClusterTransportCacheExpiration,
+		"the duration after which an unused transport to the managed cluster will be evicted from the cache")
+	set.IntVarP(&ClusterTransportMaxIdleConnsPerHost, "cluster-transport-max-idle-conns-per-host", "", ClusterTransportMaxIdleConnsPerHost,
+		"the maximum idle connections kept for each managed cluster")
+	set.DurationVarP(&ClusterTransportIdleConnTimeout, "cluster-transport-idle-conn-timeout", "", ClusterTransportIdleConnTimeout,
+		"the maximum amount of time an idle connection to the managed cluster will remain idle before closing itself")
+}
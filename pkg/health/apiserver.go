@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/server"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	multicluster "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/transport"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/featuregates"
+	"github.com/oam-dev/cluster-gateway/pkg/generated/clientset/versioned"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+// RunHealthProber is the post-start hook running the health prober inside
+// the apiserver if enabled by the flags.
+func RunHealthProber(ctx server.PostStartHookContext) error {
+	if !config.HealthProbe {
+		return nil
+	}
+	if !utilfeature.DefaultFeatureGate.Enabled(featuregates.HealthinessCheck) {
+		klog.Warningf("Skipping the health prober due to the disabled %s feature gate", featuregates.HealthinessCheck)
+		return nil
+	}
+	probeConfig, err := LoadProbeConfiguration(config.HealthProbeConfigPath)
+	if err != nil {
+		return err
+	}
+	// the loopback clients are inited by another post-start hook
+	if err := wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		return singleton.GetSecretControl() != nil, nil
+	}); err != nil {
+		return err
+	}
+	cfg := singleton.GetRestConfig()
+	gatewayClient, err := versioned.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	copied := rest.CopyConfig(cfg)
+	copied.WrapTransport = multicluster.NewClusterGatewayHealthProbeRoundTripper
+	multiClusterClient, err := kubernetes.NewForConfig(copied)
+	if err != nil {
+		return err
+	}
+	controller := NewController(
+		singleton.GetSecretControl(),
+		gatewayClient,
+		multiClusterClient.Discovery().RESTClient(),
+		probeConfig,
+		config.HealthProbeWorkers,
+		config.HealthProbeResyncPeriod)
+	go func() {
+		if !config.HealthProbeLeaderElect {
+			_ = controller.Start(ctx)
+			return
+		}
+		if err := controller.StartWithLeaderElection(ctx, singleton.GetKubeClient(), config.SecretNamespace, config.HealthProbeLeaderElectionLease); err != nil {
+			klog.Errorf("Failed running the health prober: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+)
+
+// the reasons of the conditions in true status
+const (
+	conditionReasonResponded      = "Responded"
+	conditionReasonAccepted       = "Accepted"
+	conditionReasonProbeSucceeded = "ProbeSucceeded"
+	conditionReasonUnknown        = "Unknown"
+	conditionReasonNotProbed      = "NotProbed"
+)
+
+// ClassifyError returns the healthy reason explaining the error of probing
+// the cluster. The errors are usually relayed by the proxy of the
+// cluster-gateway, so the messages are matched as well.
+func ClassifyError(err error) v1alpha1.HealthyReasonType {
+	if err == nil {
+		return ""
+	}
+	msg := err.Error()
+	var netErr net.Error
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalidErr x509.CertificateInvalidError
+	var certVerificationErr *tls.CertificateVerificationError
+	switch {
+	case apierrors.IsUnauthorized(err):
+		return v1alpha1.HealthyReasonTypeUnauthorized
+	case strings.Contains(msg, "no such cluster"):
+		return v1alpha1.HealthyReasonTypeClusterGatewayNotRegistered
+	case errors.As(err, &unknownAuthorityErr), errors.As(err, &hostnameErr),
+		errors.As(err, &certInvalidErr), errors.As(err, &certVerificationErr),
+		strings.Contains(msg, "x509: "), strings.Contains(msg, "tls: failed to verify certificate"):
+		return v1alpha1.HealthyReasonTypeCertificateMismatch
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout(),
+		apierrors.IsTimeout(err), apierrors.IsServerTimeout(err),
+		strings.Contains(msg, "i/o timeout"), strings.Contains(msg, "TLS handshake timeout"),
+		strings.Contains(msg, "context deadline exceeded"):
+		return v1alpha1.HealthyReasonTypeConnectionTimeout
+	case errors.Is(err, syscall.ECONNREFUSED), strings.Contains(msg, "connection refused"):
+		return v1alpha1.HealthyReasonTypeConnectionRefused
+	}
+	return v1alpha1.HealthyReasonTypeUnknownPrefix + v1alpha1.HealthyReasonType(" "+msg)
+}
+
+// conditionReason converts the healthy reason to the reason of the
+// conditions, which is in CamelCase.
+func conditionReason(reason v1alpha1.HealthyReasonType) string {
+	if strings.HasPrefix(string(reason), string(v1alpha1.HealthyReasonTypeUnknownPrefix)) {
+		return conditionReasonUnknown
+	}
+	return string(reason)
+}
+
+// isUnreachable returns true if the kube-apiserver of the cluster doesn't
+// respond, including the errors not carrying the status from the apiserver.
+func isUnreachable(err error, reason v1alpha1.HealthyReasonType) bool {
+	switch reason {
+	case v1alpha1.HealthyReasonTypeClusterGatewayNotRegistered,
+		v1alpha1.HealthyReasonTypeCertificateMismatch,
+		v1alpha1.HealthyReasonTypeConnectionTimeout,
+		v1alpha1.HealthyReasonTypeConnectionRefused:
+		return true
+	}
+	var statusErr apierrors.APIStatus
+	return err != nil && !errors.As(err, &statusErr)
+}
+
+// setProbeConditions sets the Reachable, Authenticated and Healthy conditions
+// by the probe result.
+func setProbeConditions(status *v1alpha1.ClusterGatewayStatus, result *Result, reason v1alpha1.HealthyReasonType) {
+	reachable := metav1.Condition{
+		Type:   v1alpha1.ClusterGatewayConditionReachable,
+		Status: metav1.ConditionTrue,
+		Reason: conditionReasonResponded,
+	}
+	authenticated := metav1.Condition{
+		Type:   v1alpha1.ClusterGatewayConditionAuthenticated,
+		Status: metav1.ConditionTrue,
+		Reason: conditionReasonAccepted,
+	}
+	switch {
+	case isUnreachable(result.Error, reason):
+		reachable.Status = metav1.ConditionFalse
+		reachable.Reason = conditionReason(reason)
+		reachable.Message = result.Error.Error()
+		authenticated.Status = metav1.ConditionUnknown
+		authenticated.Reason = conditionReasonNotProbed
+		authenticated.Message = "the cluster is unreachable"
+	case reason == v1alpha1.HealthyReasonTypeUnauthorized:
+		authenticated.Status = metav1.ConditionFalse
+		authenticated.Reason = conditionReason(reason)
+		authenticated.Message = result.Error.Error()
+	}
+	meta.SetStatusCondition(&status.Conditions, reachable)
+	meta.SetStatusCondition(&status.Conditions, authenticated)
+
+	healthy := metav1.Condition{
+		Type:   v1alpha1.ClusterGatewayConditionHealthy,
+		Status: metav1.ConditionTrue,
+		Reason: conditionReasonProbeSucceeded,
+	}
+	if !status.Healthy {
+		healthy.Status = metav1.ConditionFalse
+		healthy.Reason = conditionReason(status.HealthyReason)
+		healthy.Message = result.Message
+		if result.Healthy {
+			// recovering until reaching the success threshold
+			healthy.Message = "waiting for consecutive successful probes"
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, healthy)
+}
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := map[string]struct {
+		err      error
+		expected v1alpha1.HealthyReasonType
+	}{
+		"nil": {
+			err:      nil,
+			expected: "",
+		},
+		"unauthorized": {
+			err:      apierrors.NewUnauthorized("invalid bearer token"),
+			expected: v1alpha1.HealthyReasonTypeUnauthorized,
+		},
+		"not registered": {
+			err:      apierrors.NewInternalError(fmt.Errorf("no such cluster c1")),
+			expected: v1alpha1.HealthyReasonTypeClusterGatewayNotRegistered,
+		},
+		"unknown authority": {
+			err:      &url.Error{Op: "Get", URL: "https://c1", Err: x509.UnknownAuthorityError{}},
+			expected: v1alpha1.HealthyReasonTypeCertificateMismatch,
+		},
+		"relayed certificate error": {
+			err:      apierrors.NewInternalError(fmt.Errorf("tls: failed to verify certificate: x509: certificate signed by unknown authority")),
+			expected: v1alpha1.HealthyReasonTypeCertificateMismatch,
+		},
+		"deadline exceeded": {
+			err:      &url.Error{Op: "Get", URL: "https://c1", Err: context.DeadlineExceeded},
+			expected: v1alpha1.HealthyReasonTypeConnectionTimeout,
+		},
+		"gateway timeout": {
+			err:      apierrors.NewTimeoutError("timed out", 1),
+			expected: v1alpha1.HealthyReasonTypeConnectionTimeout,
+		},
+		"relayed dial timeout": {
+			err:      apierrors.NewInternalError(fmt.Errorf("dial tcp 10.0.0.1:6443: i/o timeout")),
+			expected: v1alpha1.HealthyReasonTypeConnectionTimeout,
+		},
+		"connection refused": {
+			err:      &url.Error{Op: "Get", URL: "https://c1", Err: syscall.ECONNREFUSED},
+			expected: v1alpha1.HealthyReasonTypeConnectionRefused,
+		},
+		"unknown": {
+			err:      apierrors.NewForbidden(schema.GroupResource{}, "", fmt.Errorf("denied")),
+			expected: `Unknown: forbidden: denied`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, ClassifyError(c.err))
+		})
+	}
+}
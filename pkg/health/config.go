@@ -0,0 +1,192 @@
+package health
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+)
+
+// AnnotationKeyHealthProbeConfiguration declares the probe configuration of
+// the cluster in YAML or JSON format, overriding the global configuration.
+const AnnotationKeyHealthProbeConfiguration = "cluster.core.oam.dev/health-probe-configuration"
+
+type ProbeType string
+
+const (
+	// ProbeTypeHealthz expects "ok" from the "/healthz" endpoint.
+	ProbeTypeHealthz ProbeType = "Healthz"
+	// ProbeTypeReadyz requests the "/readyz?verbose" endpoint and reports
+	// the failing checks.
+	ProbeTypeReadyz ProbeType = "Readyz"
+	// ProbeTypeLivez requests the "/livez?verbose" endpoint and reports the
+	// failing checks.
+	ProbeTypeLivez ProbeType = "Livez"
+	// ProbeTypeVersion discovers the version from the "/version" endpoint.
+	ProbeTypeVersion ProbeType = "Version"
+)
+
+const (
+	defaultProbeTimeout = 10 * time.Second
+	defaultProbePeriod  = 10 * time.Second
+)
+
+var supportedProbeTypes = sets.NewString(
+	string(ProbeTypeHealthz),
+	string(ProbeTypeReadyz),
+	string(ProbeTypeLivez),
+	string(ProbeTypeVersion),
+)
+
+// ProbeConfiguration declares how the clusters are probed.
+type ProbeConfiguration struct {
+	// Probes are run in order upon each probe, the cluster is healthy only if
+	// all of them succeed. Defaults to the Healthz probe.
+	Probes []Probe `json:"probes,omitempty"`
+	// FailureThreshold is the consecutive failures for the cluster to be
+	// considered unhealthy. Defaults to 1.
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+	// SuccessThreshold is the consecutive successes for the cluster to be
+	// considered healthy. Defaults to 1.
+	SuccessThreshold int32 `json:"successThreshold,omitempty"`
+	// Timeout of each probe. Defaults to 10s.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Period between the probes. Defaults to 10s.
+	Period *metav1.Duration `json:"period,omitempty"`
+}
+
+type Probe struct {
+	// Type of the probe.
+	Type ProbeType `json:"type"`
+	// Exclude skips the named checks of the Readyz and Livez probes.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// LoadProbeConfiguration reads the global probe configuration from the file,
+// returns the default configuration if the path is empty.
+func LoadProbeConfiguration(path string) (*ProbeConfiguration, error) {
+	cfg := &ProbeConfiguration{}
+	if len(path) > 0 {
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed reading probe config from %s", path)
+		}
+		if err := yaml.Unmarshal(bs, cfg); err != nil {
+			return nil, errors.Wrapf(err, "failed parsing probe config from %s", path)
+		}
+		if errs := ValidateProbeConfiguration(cfg); len(errs) > 0 {
+			return nil, errors.Wrapf(errs.ToAggregate(), "invalid probe config from %s", path)
+		}
+	}
+	return cfg.WithDefaults(), nil
+}
+
+// GetProbeConfiguration returns the probe configuration of the cluster. The
+// fields set by the annotation of the cluster override the global ones, and
+// the invalid annotation is ignored.
+func GetProbeConfiguration(global *ProbeConfiguration, gw *v1alpha1.ClusterGateway) (*ProbeConfiguration, error) {
+	cfg := &ProbeConfiguration{}
+	if global != nil {
+		cfg = global.DeepCopy()
+	}
+	raw, ok := gw.Annotations[AnnotationKeyHealthProbeConfiguration]
+	if !ok {
+		return cfg.WithDefaults(), nil
+	}
+	override := &ProbeConfiguration{}
+	if err := yaml.Unmarshal([]byte(raw), override); err != nil {
+		return cfg.WithDefaults(), fmt.Errorf("failed parsing probe config of cluster %s: %v", gw.Name, err)
+	}
+	if errs := ValidateProbeConfiguration(override); len(errs) > 0 {
+		return cfg.WithDefaults(), fmt.Errorf("invalid probe config of cluster %s: %v", gw.Name, errs.ToAggregate())
+	}
+	if len(override.Probes) > 0 {
+		cfg.Probes = override.Probes
+	}
+	if override.FailureThreshold > 0 {
+		cfg.FailureThreshold = override.FailureThreshold
+	}
+	if override.SuccessThreshold > 0 {
+		cfg.SuccessThreshold = override.SuccessThreshold
+	}
+	if override.Timeout != nil {
+		cfg.Timeout = override.Timeout
+	}
+	if override.Period != nil {
+		cfg.Period = override.Period
+	}
+	return cfg.WithDefaults(), nil
+}
+
+// WithDefaults returns a copy of the configuration with the defaults filled.
+func (in *ProbeConfiguration) WithDefaults() *ProbeConfiguration {
+	cfg := in.DeepCopy()
+	if len(cfg.Probes) == 0 {
+		cfg.Probes = []Probe{{Type: ProbeTypeHealthz}}
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.SuccessThreshold <= 0 {
+		cfg.SuccessThreshold = 1
+	}
+	if cfg.Timeout == nil || cfg.Timeout.Duration <= 0 {
+		cfg.Timeout = &metav1.Duration{Duration: defaultProbeTimeout}
+	}
+	if cfg.Period == nil || cfg.Period.Duration <= 0 {
+		cfg.Period = &metav1.Duration{Duration: defaultProbePeriod}
+	}
+	return cfg
+}
+
+func (in *ProbeConfiguration) DeepCopy() *ProbeConfiguration {
+	out := *in
+	if in.Probes != nil {
+		out.Probes = make([]Probe, len(in.Probes))
+		for i, probe := range in.Probes {
+			out.Probes[i] = Probe{Type: probe.Type}
+			if probe.Exclude != nil {
+				out.Probes[i].Exclude = append([]string{}, probe.Exclude...)
+			}
+		}
+	}
+	if in.Timeout != nil {
+		out.Timeout = &metav1.Duration{Duration: in.Timeout.Duration}
+	}
+	if in.Period != nil {
+		out.Period = &metav1.Duration{Duration: in.Period.Duration}
+	}
+	return &out
+}
+
+func ValidateProbeConfiguration(cfg *ProbeConfiguration) field.ErrorList {
+	var errs field.ErrorList
+	for i, probe := range cfg.Probes {
+		if !supportedProbeTypes.Has(string(probe.Type)) {
+			errs = append(errs, field.NotSupported(field.NewPath("probes").Index(i).Child("type"), probe.Type, supportedProbeTypes.List()))
+		}
+		if len(probe.Exclude) > 0 && probe.Type != ProbeTypeReadyz && probe.Type != ProbeTypeLivez {
+			errs = append(errs, field.Forbidden(field.NewPath("probes").Index(i).Child("exclude"), "only supported by Readyz and Livez probes"))
+		}
+	}
+	if cfg.FailureThreshold < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("failureThreshold"), cfg.FailureThreshold, "must not be negative"))
+	}
+	if cfg.SuccessThreshold < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("successThreshold"), cfg.SuccessThreshold, "must not be negative"))
+	}
+	if cfg.Timeout != nil && cfg.Timeout.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("timeout"), cfg.Timeout.Duration.String(), "must not be negative"))
+	}
+	if cfg.Period != nil && cfg.Period.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("period"), cfg.Period.Duration.String(), "must not be negative"))
+	}
+	return errs
+}
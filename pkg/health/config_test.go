@@ -0,0 +1,71 @@
+package health
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+)
+
+func TestLoadProbeConfiguration(t *testing.T) {
+	cfg, err := LoadProbeConfiguration("")
+	require.NoError(t, err)
+	assert.Equal(t, []Probe{{Type: ProbeTypeHealthz}}, cfg.Probes)
+	assert.Equal(t, int32(1), cfg.FailureThreshold)
+	assert.Equal(t, int32(1), cfg.SuccessThreshold)
+	assert.Equal(t, defaultProbeTimeout, cfg.Timeout.Duration)
+	assert.Equal(t, defaultProbePeriod, cfg.Period.Duration)
+
+	path := filepath.Join(t.TempDir(), "probes.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+probes:
+- type: Readyz
+  exclude: [etcd]
+- type: Version
+failureThreshold: 3
+period: 30s
+`), 0600))
+	cfg, err = LoadProbeConfiguration(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Probe{{Type: ProbeTypeReadyz, Exclude: []string{"etcd"}}, {Type: ProbeTypeVersion}}, cfg.Probes)
+	assert.Equal(t, int32(3), cfg.FailureThreshold)
+	assert.Equal(t, 30*time.Second, cfg.Period.Duration)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"probes": [{"type": "Version", "exclude": ["etcd"]}, {"type": "Unknown"}]}`), 0600))
+	_, err = LoadProbeConfiguration(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "probes[0].exclude")
+	assert.Contains(t, err.Error(), `probes[1].type: Unsupported value: "Unknown"`)
+}
+
+func TestGetProbeConfiguration(t *testing.T) {
+	global := (&ProbeConfiguration{
+		Probes:           []Probe{{Type: ProbeTypeLivez}},
+		FailureThreshold: 3,
+	}).WithDefaults()
+	gw := &v1alpha1.ClusterGateway{}
+	gw.Name = "c1"
+
+	cfg, err := GetProbeConfiguration(global, gw)
+	require.NoError(t, err)
+	assert.Equal(t, global, cfg)
+
+	gw.Annotations = map[string]string{AnnotationKeyHealthProbeConfiguration: `{"probes": [{"type": "Readyz"}], "timeout": "1s"}`}
+	cfg, err = GetProbeConfiguration(global, gw)
+	require.NoError(t, err)
+	assert.Equal(t, []Probe{{Type: ProbeTypeReadyz}}, cfg.Probes)
+	assert.Equal(t, int32(3), cfg.FailureThreshold)
+	assert.Equal(t, &metav1.Duration{Duration: time.Second}, cfg.Timeout)
+	assert.Equal(t, []Probe{{Type: ProbeTypeLivez}}, global.Probes)
+
+	gw.Annotations[AnnotationKeyHealthProbeConfiguration] = `{"failureThreshold": -1}`
+	cfg, err = GetProbeConfiguration(global, gw)
+	require.Error(t, err)
+	assert.Equal(t, global, cfg)
+}
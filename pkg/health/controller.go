@@ -0,0 +1,268 @@
+package health
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	multicluster "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/transport"
+	"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/generated/clientset/versioned"
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
+)
+
+// probedStatuses holds the statuses of the latest probes not persisted to
+// the clusters by name.
+var probedStatuses sync.Map
+
+// ProbeAndUpdate probes the cluster if the period has elapsed since the last
+// probe, and updates the result to the health subresource of the cluster if
+// changed. Returns the probed cluster, or nil if not probed, and the duration
+// to wait before the next probe.
+func ProbeAndUpdate(ctx context.Context, gatewayClient versioned.Interface, client rest.Interface, global *ProbeConfiguration, clusterName string) (*v1alpha1.ClusterGateway, time.Duration, error) {
+	gw, err := gatewayClient.ClusterV1alpha1().
+		ClusterGateways().
+		GetHealthiness(ctx, clusterName, metav1.GetOptions{})
+	if err != nil {
+		probedStatuses.Delete(clusterName)
+		return nil, 0, err
+	}
+	persisted := gw.Status.DeepCopy()
+	if cached, ok := probedStatuses.Load(clusterName); ok {
+		// resuming from the latest probe not persisted yet, unless the
+		// cluster is probed by another prober since then
+		if status := cached.(*v1alpha1.ClusterGatewayStatus); persisted.LastProbeTime == nil ||
+			status.LastProbeTime.After(persisted.LastProbeTime.Time) {
+			gw.Status = *status.DeepCopy()
+		}
+	}
+	cfg, err := GetProbeConfiguration(global, gw)
+	if err != nil {
+		klog.Errorf("Ignoring the probe configuration of cluster %s: %v", clusterName, err)
+	}
+	if last := gw.Status.LastProbeTime; last != nil {
+		if wait := cfg.Period.Duration - time.Since(last.Time); wait > 0 {
+			return nil, wait, nil
+		}
+	}
+	result := ProbeCluster(multicluster.WithMultiClusterContext(ctx, clusterName), client, cfg)
+	if !result.Healthy {
+		klog.Infof("Cluster %s unhealthy (%s): %s", clusterName, ClassifyError(result.Error), result.Message)
+	}
+	if ApplyResult(&gw.Status, result, cfg) {
+		klog.Infof("Updating the healthiness of cluster %s to %v", clusterName, gw.Status.Healthy)
+	}
+	v1alpha1.SetCredentialCondition(gw)
+	if !statusNeedsUpdate(persisted, &gw.Status) {
+		probedStatuses.Store(clusterName, gw.Status.DeepCopy())
+		return gw, cfg.Period.Duration, nil
+	}
+	gw, err = gatewayClient.ClusterV1alpha1().
+		ClusterGateways().
+		UpdateHealthiness(ctx, gw, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	probedStatuses.Delete(clusterName)
+	return gw, cfg.Period.Duration, nil
+}
+
+// statusNeedsUpdate returns true if the probed status differs from the
+// persisted one by the healthiness, the conditions or the observations.
+// Otherwise only the counters and the timestamps differ, which are persisted
+// at most once per status update period, so that the cluster secrets are not
+// rewritten upon every probe. The counters approaching the thresholds are
+// always persisted, as they decide the next transition.
+func statusNeedsUpdate(persisted, probed *v1alpha1.ClusterGatewayStatus) bool {
+	if persisted.Healthy != probed.Healthy ||
+		persisted.HealthyReason != probed.HealthyReason ||
+		persisted.Version != probed.Version ||
+		!equality.Semantic.DeepEqual(persisted.FailingChecks, probed.FailingChecks) ||
+		!equality.Semantic.DeepEqual(persisted.Conditions, probed.Conditions) {
+		return true
+	}
+	if isTransitioning(persisted) || isTransitioning(probed) {
+		return true
+	}
+	return persisted.LastProbeTime == nil ||
+		probed.LastProbeTime.Sub(persisted.LastProbeTime.Time) >= config.HealthProbeStatusUpdatePeriod
+}
+
+// isTransitioning returns true if the probes are counting towards flipping
+// the healthiness.
+func isTransitioning(status *v1alpha1.ClusterGatewayStatus) bool {
+	if status.Healthy {
+		return status.ConsecutiveFailures > 0
+	}
+	return status.ConsecutiveSuccesses > 0
+}
+
+// Controller probes the clusters listed from the cluster secrets, which
+// doesn't rely on the OCM addons.
+type Controller struct {
+	secretControl cert.SecretControl
+	gatewayClient versioned.Interface
+	client        rest.Interface
+	probeConfig   *ProbeConfiguration
+	workers       int
+	resyncPeriod  time.Duration
+}
+
+// probeQueue queues the clusters probed during a term of the controller. The
+// queue is not shared across the terms, as the workers of the previous term
+// may still be running after losing the lease.
+type probeQueue struct {
+	workqueue.TypedDelayingInterface[string]
+	mu       sync.Mutex
+	tracking sets.Set[string]
+}
+
+func newProbeQueue() *probeQueue {
+	return &probeQueue{
+		TypedDelayingInterface: workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[string]{
+			Name: "cluster-gateway-health-prober",
+		}),
+		tracking: sets.New[string](),
+	}
+}
+
+// NewController returns the controller probing the clusters listed by the
+// secret control. The client is expected to target the clusters by the
+// context, e.g. via the proxy of the cluster-gateway.
+func NewController(secretControl cert.SecretControl, gatewayClient versioned.Interface, client rest.Interface, probeConfig *ProbeConfiguration, workers int, resyncPeriod time.Duration) *Controller {
+	return &Controller{
+		secretControl: secretControl,
+		gatewayClient: gatewayClient,
+		client:        client,
+		probeConfig:   probeConfig,
+		workers:       workers,
+		resyncPeriod:  resyncPeriod,
+	}
+}
+
+// Start runs the controller until the context is cancelled. The newly listed
+// clusters are probed upon every resync, and then by their probe periods.
+// Start returns after the workers exit.
+func (c *Controller) Start(ctx context.Context) error {
+	c.run(ctx, newProbeQueue())
+	return nil
+}
+
+func (c *Controller) run(ctx context.Context, queue *probeQueue) {
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.UntilWithContext(ctx, func(ctx context.Context) {
+				c.runWorker(ctx, queue)
+			}, time.Second)
+		}()
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		c.resync(ctx, queue)
+	}, c.resyncPeriod)
+	queue.ShutDown()
+	wg.Wait()
+}
+
+func (c *Controller) resync(ctx context.Context, queue *probeQueue) {
+	secrets, err := c.secretControl.List(ctx)
+	if err != nil {
+		klog.Errorf("Failed listing clusters for health probing: %v", err)
+		return
+	}
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	for _, secret := range secrets {
+		if !queue.tracking.Has(secret.Name) {
+			queue.tracking.Insert(secret.Name)
+			queue.Add(secret.Name)
+		}
+	}
+}
+
+func (c *Controller) runWorker(ctx context.Context, queue *probeQueue) {
+	for c.processNextItem(ctx, queue) {
+	}
+}
+
+func (c *Controller) processNextItem(ctx context.Context, queue *probeQueue) bool {
+	name, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(name)
+	_, next, err := ProbeAndUpdate(ctx, c.gatewayClient, c.client, c.probeConfig, name)
+	if err != nil {
+		if _, getErr := c.secretControl.Get(ctx, name); apierrors.IsNotFound(getErr) {
+			// the cluster is removed, and tracked again if listed upon the
+			// next resync
+			queue.mu.Lock()
+			queue.tracking.Delete(name)
+			queue.mu.Unlock()
+			return true
+		}
+		klog.Errorf("Failed probing the healthiness of cluster %s: %v", name, err)
+		next = c.probeConfig.Period.Duration
+	}
+	queue.AddAfter(name, next)
+	return true
+}
+
+// StartWithLeaderElection runs the controller only while holding the lease,
+// so that the replicas don't probe the clusters simultaneously.
+func (c *Controller) StartWithLeaderElection(ctx context.Context, kubeClient kubernetes.Interface, namespace, name string) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		Client: kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: hostname + "_" + string(uuid.NewUUID()),
+		},
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("Started leading %s/%s, probing the clusters", namespace, name)
+				_ = c.Start(ctx)
+			},
+			OnStoppedLeading: func() {
+				klog.Infof("Stopped leading %s/%s", namespace, name)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// campaigning again after losing the lease until the context is cancelled
+	wait.UntilWithContext(ctx, elector.Run, time.Second)
+	return nil
+}
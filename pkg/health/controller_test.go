@@ -0,0 +1,238 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	multicluster "github.com/oam-dev/cluster-gateway/pkg/apis/cluster/transport"
+	"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/generated/clientset/versioned"
+)
+
+type fakeSecretControl struct {
+	mu      sync.Mutex
+	secrets map[string]*corev1.Secret
+}
+
+func (f *fakeSecretControl) Get(ctx context.Context, name string) (*corev1.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if secret, ok := f.secrets[name]; ok {
+		return secret, nil
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+}
+
+func (f *fakeSecretControl) List(ctx context.Context) ([]*corev1.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var secrets []*corev1.Secret
+	for _, secret := range f.secrets {
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+func (f *fakeSecretControl) remove(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.secrets, name)
+}
+
+// fakeGateway serves the health subresource and the "/healthz" proxy path of
+// the clusters, which rejects the requests other than the health probes to
+// the unhealthy clusters like the proxy subresource.
+type fakeGateway struct {
+	mu       sync.Mutex
+	clusters map[string]*v1alpha1.ClusterGateway
+	probes   map[string]int
+	updates  map[string]int
+	// healthz is the response of "/healthz", "ok" if empty
+	healthz string
+}
+
+func (f *fakeGateway) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/apis/cluster.core.oam.dev/v1alpha1/clustergateways/"), "/")
+	gw, ok := f.clusters[parts[0]]
+	if !ok {
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	switch {
+	case len(parts) == 3 && parts[1] == "proxy" && parts[2] == "healthz":
+		if !gw.Status.Healthy && len(gw.Status.HealthyReason) > 0 && req.Header.Get(multicluster.HealthProbeHeader) != "true" {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		f.probes[gw.Name]++
+		if f.healthz == "" {
+			_, _ = resp.Write([]byte("ok"))
+			return
+		}
+		_, _ = resp.Write([]byte(f.healthz))
+	case len(parts) == 2 && parts[1] == "health" && req.Method == http.MethodGet:
+		_ = json.NewEncoder(resp).Encode(gw)
+	case len(parts) == 2 && parts[1] == "health" && req.Method == http.MethodPut:
+		updated := &v1alpha1.ClusterGateway{}
+		_ = json.NewDecoder(req.Body).Decode(updated)
+		f.clusters[gw.Name] = updated
+		f.updates[gw.Name]++
+		_ = json.NewEncoder(resp).Encode(updated)
+	default:
+		resp.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeGateway) get(name string) (*v1alpha1.ClusterGateway, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.clusters[name], f.probes[name]
+}
+
+func TestController(t *testing.T) {
+	gateway := &fakeGateway{
+		clusters: map[string]*v1alpha1.ClusterGateway{},
+		probes:   map[string]int{},
+		updates:  map[string]int{},
+	}
+	secretControl := &fakeSecretControl{secrets: map[string]*corev1.Secret{}}
+	for _, name := range []string{"c1", "c2"} {
+		// the clusters recover from the unhealthy
+		gw := &v1alpha1.ClusterGateway{}
+		gw.Name = name
+		gw.Status.HealthyReason = v1alpha1.HealthyReasonTypeConnectionTimeout
+		gateway.clusters[name] = gw
+		secret := &corev1.Secret{}
+		secret.Name = name
+		secretControl.secrets[name] = secret
+	}
+	svr := httptest.NewServer(gateway)
+	defer svr.Close()
+
+	cfg := &rest.Config{Host: svr.URL}
+	gatewayClient, err := versioned.NewForConfig(cfg)
+	require.NoError(t, err)
+	copied := rest.CopyConfig(cfg)
+	copied.WrapTransport = multicluster.NewClusterGatewayHealthProbeRoundTripper
+	multiClusterClient, err := kubernetes.NewForConfig(copied)
+	require.NoError(t, err)
+
+	probeConfig := (&ProbeConfiguration{Period: &metav1.Duration{Duration: 100 * time.Millisecond}}).WithDefaults()
+	controller := NewController(secretControl, gatewayClient, multiClusterClient.Discovery().RESTClient(), probeConfig, 2, 50*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	queue := newProbeQueue()
+	stopped := make(chan struct{})
+	go func() {
+		controller.run(ctx, queue)
+		close(stopped)
+	}()
+
+	require.Eventually(t, func() bool {
+		gw, probes := gateway.get("c1")
+		return gw.Status.Healthy && gw.Status.LastProbeTime != nil && probes >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// removed clusters are no longer probed
+	secretControl.remove("c2")
+	gateway.mu.Lock()
+	delete(gateway.clusters, "c2")
+	gateway.mu.Unlock()
+	require.Eventually(t, func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return !queue.tracking.Has("c2")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the workers exit along with the term
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the workers didn't exit after the context is cancelled")
+	}
+	assert.True(t, queue.tracking.Has("c1"))
+	assert.True(t, queue.ShuttingDown())
+}
+
+func TestProbeAndUpdateStatus(t *testing.T) {
+	gw := &v1alpha1.ClusterGateway{}
+	gw.Name = "throttled"
+	gateway := &fakeGateway{
+		clusters: map[string]*v1alpha1.ClusterGateway{gw.Name: gw},
+		probes:   map[string]int{},
+		updates:  map[string]int{},
+	}
+	svr := httptest.NewServer(gateway)
+	defer svr.Close()
+	cfg := &rest.Config{Host: svr.URL}
+	gatewayClient, err := versioned.NewForConfig(cfg)
+	require.NoError(t, err)
+	copied := rest.CopyConfig(cfg)
+	copied.WrapTransport = multicluster.NewClusterGatewayHealthProbeRoundTripper
+	multiClusterClient, err := kubernetes.NewForConfig(copied)
+	require.NoError(t, err)
+	client := multiClusterClient.Discovery().RESTClient()
+	probeConfig := (&ProbeConfiguration{
+		Period:           &metav1.Duration{Duration: time.Millisecond},
+		FailureThreshold: 3,
+	}).WithDefaults()
+	probe := func() *v1alpha1.ClusterGateway {
+		time.Sleep(2 * time.Millisecond)
+		probed, _, err := ProbeAndUpdate(context.TODO(), gatewayClient, client, probeConfig, gw.Name)
+		require.NoError(t, err)
+		require.NotNil(t, probed)
+		return probed
+	}
+
+	// the first result is persisted
+	probed := probe()
+	assert.True(t, probed.Status.Healthy)
+	persisted, _ := gateway.get(gw.Name)
+	assert.Equal(t, 1, gateway.updates[gw.Name])
+	assert.True(t, persisted.Status.Healthy)
+
+	// the unchanged results are not persisted until the update period
+	probed = probe()
+	assert.True(t, probed.Status.LastProbeTime.After(persisted.Status.LastProbeTime.Time))
+	assert.Equal(t, 1, gateway.updates[gw.Name])
+	period := config.HealthProbeStatusUpdatePeriod
+	defer func() { config.HealthProbeStatusUpdatePeriod = period }()
+	config.HealthProbeStatusUpdatePeriod = 0
+	probe()
+	assert.Equal(t, 2, gateway.updates[gw.Name])
+	config.HealthProbeStatusUpdatePeriod = time.Hour
+
+	// the failures approaching the threshold are always persisted
+	gateway.mu.Lock()
+	gateway.healthz = "not ok"
+	gateway.mu.Unlock()
+	for i := 1; i <= 3; i++ {
+		probe()
+		persisted, _ = gateway.get(gw.Name)
+		assert.Equal(t, 2+i, gateway.updates[gw.Name])
+		assert.Equal(t, int32(i), persisted.Status.ConsecutiveFailures)
+	}
+	assert.False(t, persisted.Status.Healthy)
+	probe()
+	assert.Equal(t, 5, gateway.updates[gw.Name])
+}
@@ -0,0 +1,165 @@
+package health
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/rest"
+
+	"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+)
+
+// Result is the outcome of probing a cluster once.
+type Result struct {
+	// Healthy is true if all the probes succeed.
+	Healthy bool
+	// Message explains the failed probes.
+	Message string
+	// Error is the first error requesting the probes, if any.
+	Error error
+	// FailingChecks are the failing checks reported by the Readyz and Livez
+	// probes, prefixed by the endpoint, e.g. "readyz:etcd".
+	FailingChecks []string
+	// Version is the gitVersion discovered by the Version probe.
+	Version string
+	// Latency is the total time cost of the probes.
+	Latency time.Duration
+	// ProbeTime is the time starting the probes.
+	ProbeTime time.Time
+}
+
+// ProbeCluster runs the probes of the configuration with the client, which is
+// expected to target the cluster by the context, e.g. via the proxy of the
+// cluster-gateway.
+func ProbeCluster(ctx context.Context, client rest.Interface, cfg *ProbeConfiguration) *Result {
+	result := &Result{
+		Healthy:   true,
+		ProbeTime: time.Now(),
+	}
+	var messages []string
+	for _, probe := range cfg.Probes {
+		probeCtx, cancel := context.WithTimeout(ctx, cfg.Timeout.Duration)
+		msg, err := runProbe(probeCtx, client, probe, result)
+		cancel()
+		if err != nil && result.Error == nil {
+			result.Error = err
+		}
+		if len(msg) > 0 {
+			result.Healthy = false
+			messages = append(messages, msg)
+		}
+	}
+	result.Message = strings.Join(messages, "; ")
+	result.Latency = time.Since(result.ProbeTime)
+	return result
+}
+
+// runProbe returns the failure message of the probe, or empty if succeeded.
+func runProbe(ctx context.Context, client rest.Interface, probe Probe, result *Result) (string, error) {
+	switch probe.Type {
+	case ProbeTypeHealthz:
+		body, err := client.Get().AbsPath("healthz").DoRaw(ctx)
+		if err != nil {
+			return fmt.Sprintf("healthz: %v", err), err
+		}
+		if string(body) != "ok" {
+			return fmt.Sprintf("healthz: unexpected response %q", string(body)), nil
+		}
+	case ProbeTypeReadyz, ProbeTypeLivez:
+		endpoint := strings.ToLower(string(probe.Type))
+		req := client.Get().AbsPath(endpoint).Param("verbose", "")
+		for _, check := range probe.Exclude {
+			req = req.Param("exclude", check)
+		}
+		body, err := req.DoRaw(ctx)
+		failing := parseFailingChecks(body)
+		for _, check := range failing {
+			result.FailingChecks = append(result.FailingChecks, endpoint+":"+check)
+		}
+		if len(failing) > 0 {
+			return fmt.Sprintf("%s: failed checks %s", endpoint, strings.Join(failing, ",")), err
+		}
+		if err != nil {
+			return fmt.Sprintf("%s: %v", endpoint, err), err
+		}
+	case ProbeTypeVersion:
+		body, err := client.Get().AbsPath("version").DoRaw(ctx)
+		if err != nil {
+			return fmt.Sprintf("version: %v", err), err
+		}
+		info := &version.Info{}
+		if err := json.Unmarshal(body, info); err != nil {
+			return fmt.Sprintf("version: failed decoding response: %v", err), nil
+		}
+		result.Version = info.GitVersion
+	default:
+		return fmt.Sprintf("unsupported probe type %s", probe.Type), nil
+	}
+	return "", nil
+}
+
+// parseFailingChecks reads the names of the failing checks from the verbose
+// output of "/readyz" or "/livez", e.g. "[-]etcd failed: reason withheld".
+func parseFailingChecks(body []byte) []string {
+	var failing []string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "[-]") {
+			continue
+		}
+		check := strings.TrimPrefix(line, "[-]")
+		if idx := strings.IndexByte(check, ' '); idx >= 0 {
+			check = check[:idx]
+		}
+		failing = append(failing, check)
+	}
+	return failing
+}
+
+// ApplyResult records the result into the status of the cluster, and flips
+// the healthiness once the consecutive failures or successes reach the
+// thresholds. The reason of the unhealthiness is classified from the error,
+// and the conditions are set accordingly. Returns true if the healthiness is
+// changed.
+func ApplyResult(status *v1alpha1.ClusterGatewayStatus, result *Result, cfg *ProbeConfiguration) bool {
+	status.LastProbeTime = &metav1.Time{Time: result.ProbeTime}
+	status.ProbeLatency = &metav1.Duration{Duration: result.Latency}
+	status.FailingChecks = result.FailingChecks
+	if len(result.Version) > 0 {
+		status.Version = result.Version
+	}
+	reason := ClassifyError(result.Error)
+	if !result.Healthy && len(reason) == 0 {
+		reason = v1alpha1.HealthyReasonTypeProbeFailed
+	}
+	changed := false
+	if result.Healthy {
+		status.ConsecutiveSuccesses++
+		status.ConsecutiveFailures = 0
+		if !status.Healthy && status.ConsecutiveSuccesses >= cfg.SuccessThreshold {
+			status.Healthy = true
+			status.HealthyReason = ""
+			changed = true
+		}
+	} else {
+		status.ConsecutiveFailures++
+		status.ConsecutiveSuccesses = 0
+		if status.Healthy && status.ConsecutiveFailures >= cfg.FailureThreshold {
+			status.Healthy = false
+			changed = true
+		}
+		if !status.Healthy {
+			status.HealthyReason = reason
+		}
+	}
+	setProbeConditions(status, result, reason)
+	return changed
+}
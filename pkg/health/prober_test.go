@@ -0,0 +1,132 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/oam-dev/cluster-gateway/pkg/apis/cluster/v1alpha1"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) rest.Interface {
+	svr := httptest.NewServer(handler)
+	t.Cleanup(svr.Close)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: svr.URL})
+	require.NoError(t, err)
+	return client.Discovery().RESTClient()
+}
+
+func TestProbeCluster(t *testing.T) {
+	var excluded []string
+	client := newTestClient(t, func(resp http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/healthz":
+			_, _ = resp.Write([]byte("ok"))
+		case "/livez":
+			_, _ = resp.Write([]byte("[+]ping ok\nlivez check passed\n"))
+		case "/readyz":
+			_, verbose := req.URL.Query()["verbose"]
+			assert.True(t, verbose)
+			excluded = req.URL.Query()["exclude"]
+			resp.WriteHeader(http.StatusInternalServerError)
+			_, _ = resp.Write([]byte("[+]ping ok\n[-]etcd failed: reason withheld\n[-]informer-sync failed: reason withheld\nreadyz check failed\n"))
+		case "/version":
+			_, _ = resp.Write([]byte(`{"gitVersion": "v1.31.0"}`))
+		default:
+			resp.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	cfg := (&ProbeConfiguration{
+		Probes: []Probe{
+			{Type: ProbeTypeHealthz},
+			{Type: ProbeTypeLivez},
+			{Type: ProbeTypeVersion},
+		},
+	}).WithDefaults()
+	result := ProbeCluster(context.TODO(), client, cfg)
+	assert.True(t, result.Healthy)
+	assert.Empty(t, result.Message)
+	assert.Equal(t, "v1.31.0", result.Version)
+	assert.Empty(t, result.FailingChecks)
+
+	cfg.Probes = append(cfg.Probes, Probe{Type: ProbeTypeReadyz, Exclude: []string{"shutdown"}})
+	result = ProbeCluster(context.TODO(), client, cfg)
+	assert.False(t, result.Healthy)
+	assert.Equal(t, "readyz: failed checks etcd,informer-sync", result.Message)
+	assert.Equal(t, []string{"readyz:etcd", "readyz:informer-sync"}, result.FailingChecks)
+	assert.Error(t, result.Error)
+	assert.Equal(t, []string{"shutdown"}, excluded)
+}
+
+func TestProbeClusterTimeout(t *testing.T) {
+	client := newTestClient(t, func(resp http.ResponseWriter, req *http.Request) {
+		time.Sleep(time.Second)
+		_, _ = resp.Write([]byte("ok"))
+	})
+	cfg := (&ProbeConfiguration{Timeout: &metav1.Duration{Duration: 100 * time.Millisecond}}).WithDefaults()
+	result := ProbeCluster(context.TODO(), client, cfg)
+	assert.False(t, result.Healthy)
+	assert.Error(t, result.Error)
+	assert.Contains(t, result.Message, "healthz:")
+	assert.Less(t, result.Latency, time.Second)
+}
+
+func TestApplyResult(t *testing.T) {
+	cfg := (&ProbeConfiguration{FailureThreshold: 2, SuccessThreshold: 2}).WithDefaults()
+	status := &v1alpha1.ClusterGatewayStatus{Healthy: true}
+	failed := &Result{Healthy: false, Message: "healthz: down", ProbeTime: time.Now(), Latency: time.Second}
+	succeeded := &Result{Healthy: true, ProbeTime: time.Now(), Version: "v1.31.0"}
+
+	assert.False(t, ApplyResult(status, failed, cfg))
+	assert.True(t, status.Healthy)
+	assert.Equal(t, int32(1), status.ConsecutiveFailures)
+	assert.Equal(t, time.Second, status.ProbeLatency.Duration)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, v1alpha1.ClusterGatewayConditionHealthy))
+	assert.True(t, ApplyResult(status, failed, cfg))
+	assert.False(t, status.Healthy)
+	assert.Equal(t, v1alpha1.HealthyReasonTypeProbeFailed, status.HealthyReason)
+	healthy := meta.FindStatusCondition(status.Conditions, v1alpha1.ClusterGatewayConditionHealthy)
+	assert.Equal(t, metav1.ConditionFalse, healthy.Status)
+	assert.Equal(t, "ProbeFailed", healthy.Reason)
+	assert.Equal(t, "healthz: down", healthy.Message)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, v1alpha1.ClusterGatewayConditionReachable))
+
+	refused := &Result{Healthy: false, Message: "healthz: connection refused", Error: errors.New("dial tcp 127.0.0.1:6443: connect: connection refused"), ProbeTime: time.Now()}
+	assert.False(t, ApplyResult(status, refused, cfg))
+	assert.Equal(t, v1alpha1.HealthyReasonTypeConnectionRefused, status.HealthyReason)
+	reachable := meta.FindStatusCondition(status.Conditions, v1alpha1.ClusterGatewayConditionReachable)
+	assert.Equal(t, metav1.ConditionFalse, reachable.Status)
+	assert.Equal(t, "ConnectionRefused", reachable.Reason)
+	assert.Equal(t, metav1.ConditionUnknown, meta.FindStatusCondition(status.Conditions, v1alpha1.ClusterGatewayConditionAuthenticated).Status)
+
+	assert.False(t, ApplyResult(status, succeeded, cfg))
+	assert.False(t, status.Healthy)
+	assert.Equal(t, int32(0), status.ConsecutiveFailures)
+	assert.Equal(t, int32(1), status.ConsecutiveSuccesses)
+	assert.Equal(t, "waiting for consecutive successful probes", meta.FindStatusCondition(status.Conditions, v1alpha1.ClusterGatewayConditionHealthy).Message)
+	assert.True(t, ApplyResult(status, succeeded, cfg))
+	assert.True(t, status.Healthy)
+	assert.Empty(t, status.HealthyReason)
+	for _, cond := range []string{v1alpha1.ClusterGatewayConditionReachable, v1alpha1.ClusterGatewayConditionAuthenticated, v1alpha1.ClusterGatewayConditionHealthy} {
+		assert.True(t, meta.IsStatusConditionTrue(status.Conditions, cond), cond)
+	}
+	assert.Equal(t, "v1.31.0", status.Version)
+}
+
+func TestParseFailingChecks(t *testing.T) {
+	assert.Nil(t, parseFailingChecks(nil))
+	assert.Nil(t, parseFailingChecks([]byte("ok")))
+	assert.Equal(t, []string{"etcd", "poststarthook/start-apiextensions-informers"},
+		parseFailingChecks([]byte("[+]ping ok\n[-]etcd failed: reason withheld\n[-]poststarthook/start-apiextensions-informers failed: reason withheld\n")))
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	compbasemetrics "k8s.io/component-base/metrics"
+)
+
+// labels
+const (
+	authorizationDecision = "decision"
+)
+
+var (
+	ocmProxyAuthorizationCacheHitsTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "authorization_cache_hits_total",
+			Help:           "Number of proxy subpath authorizations decided by the cached decisions",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{authorizationDecision},
+	)
+	ocmProxyAuthorizationCacheMissesTotal = compbasemetrics.NewCounter(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "authorization_cache_misses_total",
+			Help:           "Number of proxy subpath authorizations reviewed by the authorizers",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+	)
+)
+
+func RecordProxyAuthorizationCacheHit(decision string) {
+	ocmProxyAuthorizationCacheHitsTotal.
+		WithLabelValues(decision).
+		Inc()
+}
+
+func RecordProxyAuthorizationCacheMiss() {
+	ocmProxyAuthorizationCacheMissesTotal.Inc()
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	compbasemetrics "k8s.io/component-base/metrics"
+)
+
+// labels
+const (
+	rejectedReason = "reason"
+)
+
+var (
+	ocmClusterCircuitBreakerState = compbasemetrics.NewGaugeVec(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_circuit_breaker_state",
+			Help:           "State of the circuit breaker of the managed cluster, 0 for closed, 1 for open and 2 for half-open",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster},
+	)
+	ocmRejectedRequestsTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "rejected_requests_total",
+			Help:           "Number of proxied requests rejected before reaching the managed cluster",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster, rejectedReason},
+	)
+)
+
+func RecordClusterCircuitBreakerState(cluster string, state int) {
+	ocmClusterCircuitBreakerState.
+		WithLabelValues(cluster).
+		Set(float64(state))
+}
+
+func RecordRejectedRequest(cluster string, reason string) {
+	ocmRejectedRequestsTotal.
+		WithLabelValues(cluster, reason).
+		Inc()
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	compbasemetrics "k8s.io/component-base/metrics"
+)
+
+// labels
+const (
+	credentialProvider    = "provider"
+	credentialIssueResult = "result"
+)
+
+var (
+	ocmDynamicCredentialIssueDurationHistogram = compbasemetrics.NewHistogramVec(
+		&compbasemetrics.HistogramOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "dynamic_credential_issue_duration_seconds",
+			Help:           "Time cost of issuing the dynamic credential for the managed cluster",
+			Buckets:        requestDurationSecondsBuckets,
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{credentialProvider, credentialIssueResult},
+	)
+	ocmDynamicCredentialIssueFailuresTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "dynamic_credential_issue_failures_total",
+			Help:           "Number of failures issuing the dynamic credential for the managed cluster",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster, credentialProvider},
+	)
+)
+
+var (
+	ocmClusterCredentialExpirySecondsDesc = compbasemetrics.NewDesc(
+		compbasemetrics.BuildFQName(namespace, subsystem, "cluster_credential_expiry_seconds"),
+		"Seconds until the credential of the managed cluster expires, negative if already expired",
+		[]string{proxiedCluster},
+		nil,
+		compbasemetrics.ALPHA,
+		"",
+	)
+	clusterCredentialExpirationsFunc   func() map[string]time.Time
+	clusterCredentialExpirationsFuncMu sync.RWMutex
+)
+
+// SetClusterCredentialExpirationsFunc sets the function listing the
+// expirations of the cluster credentials by the cluster names, which is
+// called upon collecting the metrics.
+func SetClusterCredentialExpirationsFunc(fn func() map[string]time.Time) {
+	clusterCredentialExpirationsFuncMu.Lock()
+	defer clusterCredentialExpirationsFuncMu.Unlock()
+	clusterCredentialExpirationsFunc = fn
+}
+
+var _ compbasemetrics.StableCollector = &clusterCredentialExpiryCollector{}
+
+type clusterCredentialExpiryCollector struct {
+	compbasemetrics.BaseStableCollector
+}
+
+func (c *clusterCredentialExpiryCollector) DescribeWithStability(ch chan<- *compbasemetrics.Desc) {
+	ch <- ocmClusterCredentialExpirySecondsDesc
+}
+
+func (c *clusterCredentialExpiryCollector) CollectWithStability(ch chan<- compbasemetrics.Metric) {
+	clusterCredentialExpirationsFuncMu.RLock()
+	fn := clusterCredentialExpirationsFunc
+	clusterCredentialExpirationsFuncMu.RUnlock()
+	if fn == nil {
+		return
+	}
+	for cluster, expiration := range fn() {
+		ch <- compbasemetrics.NewLazyConstMetric(ocmClusterCredentialExpirySecondsDesc,
+			compbasemetrics.GaugeValue, time.Until(expiration).Seconds(), cluster)
+	}
+}
+
+func RecordDynamicCredentialIssue(cluster string, provider string, d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+		ocmDynamicCredentialIssueFailuresTotal.
+			WithLabelValues(cluster, provider).
+			Inc()
+	}
+	ocmDynamicCredentialIssueDurationHistogram.
+		WithLabelValues(provider, result).
+		Observe(d.Seconds())
+}
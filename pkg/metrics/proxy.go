@@ -87,3 +87,9 @@ func RecordProxiedRequestsDuration(resource string, verb string, cluster string,
 		WithLabelValues(resource, verb, cluster, strconv.Itoa(code)).
 		Observe(ts.Seconds())
 }
+
+func RecordClusterEscalationAccessReviewDuration(succeeded bool, ts time.Duration) {
+	ocmProxiedClusterEscalationRequestDurationHistogram.
+		WithLabelValues(strconv.FormatBool(succeeded)).
+		Observe(ts.Seconds())
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	compbasemetrics "k8s.io/component-base/metrics"
+)
+
+// labels
+const (
+	reloadResult = "result"
+)
+
+var (
+	ocmProxyConfigReloadsTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "config_reloads_total",
+			Help:           "Number of attempts reloading the global proxy configuration",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{reloadResult},
+	)
+	ocmProxyConfigLastReloadSuccessTimestamp = compbasemetrics.NewGauge(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "config_last_reload_success_timestamp_seconds",
+			Help:           "Timestamp of the last successful reload of the global proxy configuration",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+	)
+)
+
+func RecordProxyConfigReload(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	} else {
+		ocmProxyConfigLastReloadSuccessTimestamp.SetToCurrentTime()
+	}
+	ocmProxyConfigReloadsTotal.
+		WithLabelValues(result).
+		Inc()
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	compbasemetrics "k8s.io/component-base/metrics"
+)
+
+var (
+	ocmClusterInFlightRequests = compbasemetrics.NewGaugeVec(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_inflight_requests",
+			Help:           "Number of in-flight proxied requests counted by the max-in-flight limit of the managed cluster",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster},
+	)
+	ocmClusterQueuedRequests = compbasemetrics.NewGaugeVec(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_queued_requests",
+			Help:           "Number of proxied requests waiting for the rate limit of the managed cluster",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster},
+	)
+)
+
+func RecordClusterInFlightRequests(cluster string, delta int) {
+	ocmClusterInFlightRequests.
+		WithLabelValues(cluster).
+		Add(float64(delta))
+}
+
+func RecordClusterQueuedRequests(cluster string, delta int) {
+	ocmClusterQueuedRequests.
+		WithLabelValues(cluster).
+		Add(float64(delta))
+}
@@ -15,6 +15,24 @@ var metrics = []compbasemetrics.Registerable{
 	ocmProxiedRequestsByClusterTotal,
 	ocmProxiedRequestsDurationHistogram,
 	ocmProxiedClusterEscalationRequestDurationHistogram,
+	ocmClusterTransportCacheHitsTotal,
+	ocmClusterTransportCacheMissesTotal,
+	ocmClusterTransportCacheEvictionsTotal,
+	ocmClusterTransportCacheSize,
+	ocmClusterProxyTunnels,
+	ocmClusterProxyTunnelStreams,
+	ocmClusterProxyTunnelDialsTotal,
+	ocmClusterProxyTunnelHealthCheckFailuresTotal,
+	ocmProxyConfigReloadsTotal,
+	ocmProxyConfigLastReloadSuccessTimestamp,
+	ocmDynamicCredentialIssueDurationHistogram,
+	ocmDynamicCredentialIssueFailuresTotal,
+	ocmClusterCircuitBreakerState,
+	ocmRejectedRequestsTotal,
+	ocmClusterInFlightRequests,
+	ocmClusterQueuedRequests,
+	ocmProxyAuthorizationCacheHitsTotal,
+	ocmProxyAuthorizationCacheMissesTotal,
 }
 
 func Register() {
@@ -22,5 +40,6 @@ func Register() {
 		for _, metric := range metrics {
 			legacyregistry.MustRegister(metric)
 		}
+		legacyregistry.CustomMustRegister(&clusterCredentialExpiryCollector{})
 	})
 }
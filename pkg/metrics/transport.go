@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	compbasemetrics "k8s.io/component-base/metrics"
+)
+
+// labels
+const (
+	evictionReason = "reason"
+)
+
+var (
+	ocmClusterTransportCacheHitsTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_transport_cache_hits_total",
+			Help:           "Number of proxied requests reusing a cached cluster transport",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster},
+	)
+	ocmClusterTransportCacheMissesTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_transport_cache_misses_total",
+			Help:           "Number of proxied requests building a new cluster transport",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster},
+	)
+	ocmClusterTransportCacheEvictionsTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_transport_cache_evictions_total",
+			Help:           "Number of cluster transports evicted from the cache",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster, evictionReason},
+	)
+	ocmClusterTransportCacheSize = compbasemetrics.NewGauge(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_transport_cache_size",
+			Help:           "Number of cluster transports in the cache",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+	)
+)
+
+func RecordClusterTransportCacheHit(cluster string) {
+	ocmClusterTransportCacheHitsTotal.
+		WithLabelValues(cluster).
+		Inc()
+}
+
+func RecordClusterTransportCacheMiss(cluster string) {
+	ocmClusterTransportCacheMissesTotal.
+		WithLabelValues(cluster).
+		Inc()
+}
+
+func RecordClusterTransportCacheEviction(cluster string, reason string) {
+	ocmClusterTransportCacheEvictionsTotal.
+		WithLabelValues(cluster, reason).
+		Inc()
+}
+
+func RecordClusterTransportCacheSize(size int) {
+	ocmClusterTransportCacheSize.Set(float64(size))
+}
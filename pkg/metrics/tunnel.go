@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	compbasemetrics "k8s.io/component-base/metrics"
+)
+
+// labels
+const (
+	tunnelDialResult = "result"
+)
+
+var (
+	ocmClusterProxyTunnels = compbasemetrics.NewGaugeVec(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_proxy_tunnels",
+			Help:           "Number of pooled tunnels to the managed cluster",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster},
+	)
+	ocmClusterProxyTunnelStreams = compbasemetrics.NewGaugeVec(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_proxy_tunnel_streams",
+			Help:           "Number of active streams over the pooled tunnels to the managed cluster, sampled upon health checking",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster},
+	)
+	ocmClusterProxyTunnelDialsTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_proxy_tunnel_dials_total",
+			Help:           "Number of attempts opening tunnels to the managed cluster",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster, tunnelDialResult},
+	)
+	ocmClusterProxyTunnelHealthCheckFailuresTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_proxy_tunnel_health_check_failures_total",
+			Help:           "Number of pooled tunnels closed for failing the health check",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{proxiedCluster},
+	)
+)
+
+func RecordClusterProxyTunnels(cluster string, tunnels int, streams int) {
+	ocmClusterProxyTunnels.
+		WithLabelValues(cluster).
+		Set(float64(tunnels))
+	ocmClusterProxyTunnelStreams.
+		WithLabelValues(cluster).
+		Set(float64(streams))
+}
+
+func RecordClusterProxyTunnelDial(cluster string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	ocmClusterProxyTunnelDialsTotal.
+		WithLabelValues(cluster, result).
+		Inc()
+}
+
+func RecordClusterProxyTunnelHealthCheckFailure(cluster string) {
+	ocmClusterProxyTunnelHealthCheckFailuresTotal.
+		WithLabelValues(cluster).
+		Inc()
+}
@@ -0,0 +1,49 @@
+// Package certtest generates the self-signed certificates for the tests.
+package certtest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// NewKeyPair returns the PEM encoded certificate and private key valid within
+// the given window, the key is a newly generated ECDSA P-256 key.
+func NewKeyPair(t testing.TB, notBefore, notAfter time.Time) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return NewKeyPairWithKey(t, key, notBefore, notAfter)
+}
+
+// NewKeyPairWithKey returns the PEM encoded certificate signed by the given
+// key and valid within the given window, along with the PKCS #8 private key.
+func NewKeyPairWithKey(t testing.TB, key crypto.Signer, notBefore, notAfter time.Time) ([]byte, []byte) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+// NewCertificate returns the PEM encoded certificate valid from an hour ago
+// until notAfter.
+func NewCertificate(t testing.TB, notAfter time.Time) []byte {
+	certPEM, _ := NewKeyPair(t, time.Now().Add(-time.Hour), notAfter)
+	return certPEM
+}
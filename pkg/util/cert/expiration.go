@@ -0,0 +1,80 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"time"
+)
+
+// JWTExpiration reads the "exp" claim of the token without verifying it
+func JWTExpiration(token string) (time.Time, bool) {
+	claims := struct {
+		Exp *int64 `json:"exp"`
+	}{}
+	if !decodeJWTClaims(token, &claims) || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(*claims.Exp, 0), true
+}
+
+// JWTSubject reads the "sub" and "aud" claims of the token without verifying
+// it, the audience can be either a string or a list of strings
+func JWTSubject(token string) (string, []string, bool) {
+	claims := struct {
+		Sub string          `json:"sub"`
+		Aud json.RawMessage `json:"aud"`
+	}{}
+	if !decodeJWTClaims(token, &claims) || claims.Sub == "" {
+		return "", nil, false
+	}
+	var audiences []string
+	if len(claims.Aud) > 0 && json.Unmarshal(claims.Aud, &audiences) != nil {
+		var audience string
+		if err := json.Unmarshal(claims.Aud, &audience); err != nil {
+			return "", nil, false
+		}
+		audiences = []string{audience}
+	}
+	return claims.Sub, audiences, true
+}
+
+func decodeJWTClaims(token string, claims interface{}) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(payload, claims) == nil
+}
+
+// CertificateExpiration returns the earliest NotAfter of the PEM encoded
+// certificates, i.e. when the certificate chain expires
+func CertificateExpiration(certPEM []byte) (time.Time, bool) {
+	var expiration time.Time
+	found := false
+	for rest := certPEM; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if !found || cert.NotAfter.Before(expiration) {
+			expiration = cert.NotAfter
+			found = true
+		}
+	}
+	return expiration, found
+}
@@ -0,0 +1,70 @@
+package cert
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert/certtest"
+)
+
+func TestJWTExpiration(t *testing.T) {
+	encode := func(v interface{}) string {
+		bs, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(bs)
+	}
+	exp := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	parsed, ok := JWTExpiration(encode(map[string]string{"alg": "none"}) + "." + encode(map[string]int64{"exp": exp.Unix()}) + ".signature")
+	assert.True(t, ok)
+	assert.Equal(t, exp, parsed)
+
+	_, ok = JWTExpiration("opaque-token")
+	assert.False(t, ok)
+	_, ok = JWTExpiration("a.!!!.c")
+	assert.False(t, ok)
+}
+
+func TestJWTSubject(t *testing.T) {
+	encode := func(v interface{}) string {
+		bs, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(bs)
+	}
+	header := encode(map[string]string{"alg": "none"})
+	subject, audiences, ok := JWTSubject(header + "." + encode(map[string]interface{}{"sub": "system:serviceaccount:ns:sa", "aud": []string{"a", "b"}}) + ".signature")
+	assert.True(t, ok)
+	assert.Equal(t, "system:serviceaccount:ns:sa", subject)
+	assert.Equal(t, []string{"a", "b"}, audiences)
+
+	subject, audiences, ok = JWTSubject(header + "." + encode(map[string]interface{}{"sub": "user", "aud": "a"}) + ".signature")
+	assert.True(t, ok)
+	assert.Equal(t, "user", subject)
+	assert.Equal(t, []string{"a"}, audiences)
+
+	_, _, ok = JWTSubject(header + "." + encode(map[string]interface{}{"aud": "a"}) + ".signature")
+	assert.False(t, ok)
+	_, _, ok = JWTSubject("opaque-token")
+	assert.False(t, ok)
+}
+
+func TestCertificateExpiration(t *testing.T) {
+	leafExp := time.Now().Add(24 * time.Hour).Truncate(time.Second).UTC()
+	intermediateExp := time.Now().Add(12 * time.Hour).Truncate(time.Second).UTC()
+
+	exp, ok := CertificateExpiration(certtest.NewCertificate(t, leafExp))
+	assert.True(t, ok)
+	assert.Equal(t, leafExp, exp)
+
+	// the earliest expiration of the chain
+	exp, ok = CertificateExpiration(append(certtest.NewCertificate(t, leafExp), certtest.NewCertificate(t, intermediateExp)...))
+	assert.True(t, ok)
+	assert.Equal(t, intermediateExp, exp)
+
+	_, ok = CertificateExpiration([]byte("invalid"))
+	assert.False(t, ok)
+	_, ok = CertificateExpiration(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("invalid")}))
+	assert.False(t, ok)
+}
@@ -0,0 +1,121 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+)
+
+// X509ErrorReason classifies the failure of verifying the X509 credential
+type X509ErrorReason string
+
+const (
+	X509ErrorReasonInvalidCertificate     X509ErrorReason = "InvalidCertificate"
+	X509ErrorReasonInvalidPrivateKey      X509ErrorReason = "InvalidPrivateKey"
+	X509ErrorReasonKeyMismatch            X509ErrorReason = "CertificateKeyMismatch"
+	X509ErrorReasonCertificateNotYetValid X509ErrorReason = "CertificateNotYetValid"
+	X509ErrorReasonCertificateExpired     X509ErrorReason = "CertificateExpired"
+	X509ErrorReasonInvalidCABundle        X509ErrorReason = "InvalidCABundle"
+)
+
+// X509Error is the failure of verifying the X509 credential or the CA bundle
+type X509Error struct {
+	Reason X509ErrorReason
+	Err    error
+}
+
+func (e *X509Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *X509Error) Unwrap() error {
+	return e.Err
+}
+
+func newX509Error(reason X509ErrorReason, format string, args ...interface{}) *X509Error {
+	return &X509Error{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// VerifyX509KeyPair parses the PEM encoded certificate chain and private key,
+// and verifies that the key matches the leading certificate and that all the
+// certificates are valid at the given time. The validity window is not checked
+// if the time is zero.
+func VerifyX509KeyPair(certPEM, keyPEM []byte, now time.Time) error {
+	certs, err := cert.ParseCertsPEM(certPEM)
+	if err != nil {
+		return newX509Error(X509ErrorReasonInvalidCertificate, "failed to parse certificate: %v", err)
+	}
+	key, err := keyutil.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return newX509Error(X509ErrorReasonInvalidPrivateKey, "failed to parse private key: %v", err)
+	}
+	if err = verifyKeyMatchesCertificate(certs[0], key); err != nil {
+		return &X509Error{Reason: X509ErrorReasonKeyMismatch, Err: err}
+	}
+	if now.IsZero() {
+		return nil
+	}
+	return VerifyCertificatesValidity(certs, now)
+}
+
+// VerifyCertificatesValidity verifies that all the certificates are valid at
+// the given time.
+func VerifyCertificatesValidity(certs []*x509.Certificate, now time.Time) error {
+	for _, c := range certs {
+		if now.Before(c.NotBefore) {
+			return newX509Error(X509ErrorReasonCertificateNotYetValid, "certificate %q is not valid before %s",
+				c.Subject.CommonName, c.NotBefore.UTC().Format(time.RFC3339))
+		}
+		if now.After(c.NotAfter) {
+			return newX509Error(X509ErrorReasonCertificateExpired, "certificate %q expired at %s",
+				c.Subject.CommonName, c.NotAfter.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// VerifyCABundle checks that the CA bundle consists of the PEM encoded
+// certificates.
+func VerifyCABundle(caPEM []byte) error {
+	if _, err := cert.ParseCertsPEM(caPEM); err != nil {
+		return newX509Error(X509ErrorReasonInvalidCABundle, "failed to parse CA bundle: %v", err)
+	}
+	return nil
+}
+
+func verifyKeyMatchesCertificate(c *x509.Certificate, key interface{}) error {
+	var pub crypto.PublicKey
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		pub = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		pub = &k.PublicKey
+	case ed25519.PrivateKey:
+		pub = k.Public()
+	default:
+		return fmt.Errorf("unsupported private key type %T", key)
+	}
+	matched := false
+	switch certPub := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		matched = certPub.Equal(pub)
+	case *ecdsa.PublicKey:
+		matched = certPub.Equal(pub)
+	case ed25519.PublicKey:
+		matched = certPub.Equal(pub)
+	default:
+		return fmt.Errorf("unsupported certificate public key type %T", c.PublicKey)
+	}
+	if !matched {
+		return errors.New("private key does not match the certificate")
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert/certtest"
+)
+
+func TestVerifyX509KeyPair(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	now := time.Now()
+	notBefore, notAfter := now.Add(-time.Hour), now.Add(time.Hour)
+
+	for name, key := range map[string]crypto.Signer{"rsa": rsaKey, "ecdsa": ecdsaKey, "ed25519": ed25519Key} {
+		t.Run(name, func(t *testing.T) {
+			certPEM, keyPEM := certtest.NewKeyPairWithKey(t, key, notBefore, notAfter)
+			assert.NoError(t, VerifyX509KeyPair(certPEM, keyPEM, now))
+		})
+	}
+
+	rsaCert, rsaKeyPEM := certtest.NewKeyPairWithKey(t, rsaKey, notBefore, notAfter)
+	expiredCert, expiredKeyPEM := certtest.NewKeyPairWithKey(t, rsaKey, notBefore.Add(-time.Hour), notBefore)
+	assert.NoError(t, VerifyX509KeyPair(expiredCert, expiredKeyPEM, time.Time{}))
+	_, ecdsaKeyPEM := certtest.NewKeyPairWithKey(t, ecdsaKey, notBefore, notAfter)
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, otherRSAKeyPEM := certtest.NewKeyPairWithKey(t, otherRSAKey, notBefore, notAfter)
+
+	cases := []struct {
+		name     string
+		certPEM  []byte
+		keyPEM   []byte
+		now      time.Time
+		expected X509ErrorReason
+	}{
+		{name: "invalid certificate", certPEM: []byte("invalid"), keyPEM: rsaKeyPEM, now: now, expected: X509ErrorReasonInvalidCertificate},
+		{name: "invalid private key", certPEM: rsaCert, keyPEM: []byte("invalid"), now: now, expected: X509ErrorReasonInvalidPrivateKey},
+		{name: "mismatched key of another type", certPEM: rsaCert, keyPEM: ecdsaKeyPEM, now: now, expected: X509ErrorReasonKeyMismatch},
+		{name: "mismatched key of the same type", certPEM: rsaCert, keyPEM: otherRSAKeyPEM, now: now, expected: X509ErrorReasonKeyMismatch},
+		{name: "not yet valid", certPEM: rsaCert, keyPEM: rsaKeyPEM, now: notBefore.Add(-time.Minute), expected: X509ErrorReasonCertificateNotYetValid},
+		{name: "expired", certPEM: rsaCert, keyPEM: rsaKeyPEM, now: notAfter.Add(time.Minute), expected: X509ErrorReasonCertificateExpired},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := VerifyX509KeyPair(c.certPEM, c.keyPEM, c.now)
+			var x509Err *X509Error
+			require.True(t, errors.As(err, &x509Err), "unexpected error: %v", err)
+			assert.Equal(t, c.expected, x509Err.Reason)
+		})
+	}
+}
+
+func TestVerifyCABundle(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caPEM, _ := certtest.NewKeyPairWithKey(t, key, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	assert.NoError(t, VerifyCABundle(caPEM))
+
+	err = VerifyCABundle([]byte("invalid"))
+	var x509Err *X509Error
+	require.True(t, errors.As(err, &x509Err))
+	assert.Equal(t, X509ErrorReasonInvalidCABundle, x509Err.Reason)
+}
@@ -2,13 +2,17 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -19,6 +23,10 @@ import (
 	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
 	clientauthenticationv1beta1 "k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/metrics"
 )
 
 var (
@@ -32,91 +40,196 @@ var (
 	}
 
 	credentials sync.Map
+
+	// credentialIssuance deduplicates the concurrent issuance by cluster
+	credentialIssuance singleflight.Group
+	// credentialRefreshing tracks the clusters refreshing the credentials
+	// in the background
+	credentialRefreshing sync.Map
+)
+
+const (
+	maxExecStderrLength = 1024
+	// execInfoEnv is the environment variable passing the ExecCredential
+	// to the plugins
+	execInfoEnv = "KUBERNETES_EXEC_INFO"
 )
 
+type clusterInfoContextKey struct{}
+
+// WithClusterInfo returns a context carrying the cluster info, which is passed
+// to the exec plugins with ProvideClusterInfo enabled
+func WithClusterInfo(ctx context.Context, cluster *clientauthentication.Cluster) context.Context {
+	return context.WithValue(ctx, clusterInfoContextKey{}, cluster)
+}
+
+// ClusterInfoFrom returns the cluster info carried by the context, or nil if
+// not present
+func ClusterInfoFrom(ctx context.Context) *clientauthentication.Cluster {
+	cluster, _ := ctx.Value(clusterInfoContextKey{}).(*clientauthentication.Cluster)
+	return cluster
+}
+
 func init() {
 	install.Install(scheme)
 }
 
 func IssueClusterCredential(name string, ec *clientcmdapi.ExecConfig) (*clientauthentication.ExecCredential, error) {
+	return issueCachedClusterCredential(context.TODO(), name, CredentialProviderExec, func(ctx context.Context) (*clientauthentication.ExecCredential, error) {
+		return issueClusterCredential(ctx, ec)
+	})
+}
+
+// issueCachedClusterCredential returns the cached credential of the cluster
+// if it is not expiring, otherwise issues a new one. Only the credentials with
+// expiration are cached, and they are refreshed in the background before
+// expiring. The concurrent issuance for the same cluster is deduplicated.
+func issueCachedClusterCredential(ctx context.Context, name string, provider string, issue credentialIssueFunc) (*clientauthentication.ExecCredential, error) {
 	if name == "" {
 		return nil, errors.New("cluster name not provided")
 	}
-
 	value, found := credentials.Load(name)
 	if found {
 		cred, ok := value.(*clientauthentication.ExecCredential)
 		if !ok {
 			return nil, errors.New("failed to convert item in cache to ExecCredential")
 		}
-
-		now := &metav1.Time{Time: time.Now().Add(time.Minute)} // expires a minute early
-
-		if cred.Status != nil && cred.Status.ExpirationTimestamp.Before(now) {
-			credentials.Delete(name)
-			return IssueClusterCredential(name, ec) // credential expired, calling function again
+		now := time.Now()
+		if cred.Status == nil || cred.Status.ExpirationTimestamp == nil {
+			return cred, nil
 		}
-
-		return cred, nil // credential on cache still valid
+		expiration := cred.Status.ExpirationTimestamp.Time
+		if expiration.After(now.Add(time.Minute)) { // expires a minute early
+			if expiration.Before(now.Add(config.DynamicCredentialRefreshBefore)) {
+				refreshClusterCredential(name, provider, issue)
+			}
+			return cred, nil // credential on cache still valid
+		}
+		credentials.Delete(name) // credential expired
+	}
+	result := credentialIssuance.DoChan(name, func() (interface{}, error) {
+		return issueAndCacheClusterCredential(name, provider, issue)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-result:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*clientauthentication.ExecCredential), nil
 	}
+}
 
-	cred, err := issueClusterCredential(ec)
+type credentialIssueFunc func(ctx context.Context) (*clientauthentication.ExecCredential, error)
+
+// issueAndCacheClusterCredential issues the credential within the timeout,
+// which is not bound to the context of any caller as it is shared
+func issueAndCacheClusterCredential(name string, provider string, issue credentialIssueFunc) (*clientauthentication.ExecCredential, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.DynamicCredentialIssueTimeout)
+	defer cancel()
+	ts := time.Now()
+	cred, err := issue(ctx)
+	metrics.RecordDynamicCredentialIssue(name, provider, time.Since(ts), err)
 	if err != nil {
 		return nil, err
 	}
-
 	if cred.Status != nil && !cred.Status.ExpirationTimestamp.IsZero() {
 		credentials.Store(name, cred) // storing credential in cache
 	}
-
 	return cred, nil
 }
 
-func issueClusterCredential(ec *clientcmdapi.ExecConfig) (*clientauthentication.ExecCredential, error) {
+// refreshClusterCredential issues the credential in the background, the
+// cached one is kept in use until expiring if the refreshing fails
+func refreshClusterCredential(name string, provider string, issue credentialIssueFunc) {
+	if _, refreshing := credentialRefreshing.LoadOrStore(name, struct{}{}); refreshing {
+		return
+	}
+	go func() {
+		defer credentialRefreshing.Delete(name)
+		_, err, _ := credentialIssuance.Do(name, func() (interface{}, error) {
+			return issueAndCacheClusterCredential(name, provider, issue)
+		})
+		if err != nil {
+			klog.Warningf("Failed refreshing the credential of cluster %s: %v", name, err)
+		}
+	}()
+}
+
+// ValidateExecConfig checks the exec config without running the command,
+// i.e. the command is present on the gateway and the apiVersion is known.
+func ValidateExecConfig(ec *clientcmdapi.ExecConfig) error {
 	if ec == nil {
-		return nil, errors.New("exec config not provided")
+		return errors.New("exec config not provided")
 	}
 
 	if ec.Command == "" {
-		return nil, errors.New("missing \"command\" property on exec config object")
+		return errors.New("missing \"command\" property on exec config object")
 	}
 
-	command, err := exec.LookPath(ec.Command)
-	if err != nil {
-		return nil, unwrapExecCommandError(ec.Command, err)
+	if _, err := exec.LookPath(ec.Command); err != nil {
+		return withInstallHint(unwrapExecCommandError(ec.Command, err, nil), ec.InstallHint)
 	}
 
-	cmd := exec.Command(command, ec.Args...)
-	cmd.Env = os.Environ()
-
-	for _, env := range ec.Env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", env.Name, env.Value))
+	if _, err := schema.ParseGroupVersion(ec.APIVersion); err != nil {
+		return fmt.Errorf("failed to parse exec config API version: %v", err)
 	}
 
-	var stderr, stdout bytes.Buffer
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
+	if _, ok := apiVersions[ec.APIVersion]; !ok {
+		return fmt.Errorf("exec plugin: invalid apiVersion %q", ec.APIVersion)
+	}
 
-	if err := cmd.Run(); err != nil {
-		return nil, unwrapExecCommandError(command, err)
+	// the gateway never runs the plugins on a terminal
+	if ec.InteractiveMode == clientcmdapi.AlwaysExecInteractiveMode {
+		return errors.New("exec plugin cannot support interactive mode")
 	}
+	return nil
+}
 
-	ecgv, err := schema.ParseGroupVersion(ec.APIVersion)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse exec config API version: %v", err)
+func issueClusterCredential(ctx context.Context, ec *clientcmdapi.ExecConfig) (*clientauthentication.ExecCredential, error) {
+	if err := ValidateExecConfig(ec); err != nil {
+		return nil, err
 	}
 
+	command, _ := exec.LookPath(ec.Command)
+	ecgv, _ := schema.ParseGroupVersion(ec.APIVersion)
+	gv := apiVersions[ec.APIVersion]
+
 	cred := &clientauthentication.ExecCredential{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: ec.APIVersion,
 			Kind:       "ExecCredential",
 		},
-		Spec: clientauthentication.ExecCredentialSpec{},
+		Spec: clientauthentication.ExecCredentialSpec{
+			Interactive: false,
+		},
+	}
+	if ec.ProvideClusterInfo {
+		cred.Spec.Cluster = ClusterInfoFrom(ctx)
+	}
+	execInfo, err := runtime.Encode(codecs.LegacyCodec(gv), cred)
+	if err != nil {
+		return nil, fmt.Errorf("encode ExecCredentials: %v", err)
+	}
+
+	cmd := exec.CommandContext(ctx, command, ec.Args...)
+	cmd.Env = os.Environ()
+
+	for _, env := range ec.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", env.Name, env.Value))
 	}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", execInfoEnv, execInfo))
+
+	var stderr, stdout bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Stdout = &stdout
 
-	gv, ok := apiVersions[ec.APIVersion]
-	if !ok {
-		return nil, fmt.Errorf("exec plugin: invalid apiVersion %q", ec.APIVersion)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("exec: executable %s timed out%s", command, formatStderr(stderr.Bytes()))
+		}
+		return nil, withInstallHint(unwrapExecCommandError(command, err, stderr.Bytes()), ec.InstallHint)
 	}
 
 	_, gvk, err := codecs.UniversalDecoder(gv).Decode(stdout.Bytes(), nil, cred)
@@ -143,16 +256,38 @@ func issueClusterCredential(ec *clientcmdapi.ExecConfig) (*clientauthentication.
 	return cred, nil
 }
 
-func unwrapExecCommandError(path string, err error) error {
+func unwrapExecCommandError(path string, err error, stderr []byte) error {
 	switch err.(type) {
 	case *exec.Error: // Binary does not exist (see exec.Error).
 		return fmt.Errorf("exec: executable %s not found", path)
 
 	case *exec.ExitError: // Binary execution failed (see exec.Cmd.Run()).
 		e := err.(*exec.ExitError)
-		return fmt.Errorf("exec: executable %s failed with exit code %d", path, e.ProcessState.ExitCode())
+		return fmt.Errorf("exec: executable %s failed with exit code %d%s", path, e.ProcessState.ExitCode(), formatStderr(stderr))
 
 	default:
-		return fmt.Errorf("exec: %v", err)
+		return fmt.Errorf("exec: %v%s", err, formatStderr(stderr))
+	}
+}
+
+// withInstallHint appends the install hint of the plugin to the error, so that
+// the users know how to set up the plugin on the gateway
+func withInstallHint(err error, installHint string) error {
+	if len(installHint) == 0 {
+		return err
+	}
+	return fmt.Errorf("%v\n\n%s", err, installHint)
+}
+
+// formatStderr returns the trimmed stderr of the plugin to be appended to the
+// error, or empty if nothing is written
+func formatStderr(stderr []byte) string {
+	msg := strings.TrimSpace(string(stderr))
+	if len(msg) == 0 {
+		return ""
+	}
+	if len(msg) > maxExecStderrLength {
+		msg = msg[:maxExecStderrLength] + "..."
 	}
+	return ": " + msg
 }
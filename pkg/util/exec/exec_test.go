@@ -3,7 +3,12 @@
 package exec
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,7 +16,10 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/pkg/apis/clientauthentication"
+	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
 )
 
 var (
@@ -60,6 +68,51 @@ func TestIssueClusterCredential(t *testing.T) {
 			expectedError: "exec: executable /usr/bin/false failed with exit code 1",
 		},
 
+		"stderr of failed external command": {
+			clusterName: testClusterName,
+			execConfig: &clientcmdapi.ExecConfig{
+				APIVersion: "client.authentication.k8s.io/v1",
+				Command:    "sh",
+				Args:       []string{"-c", "echo 'token expired' >&2; exit 2"},
+			},
+			expectedError: "exec: executable /usr/bin/sh failed with exit code 2: token expired",
+		},
+
+		"external command timed out": {
+			clusterName: testClusterName,
+			execConfig: &clientcmdapi.ExecConfig{
+				APIVersion: "client.authentication.k8s.io/v1",
+				Command:    "sleep",
+				Args:       []string{"10"},
+			},
+			setup: func(t *testing.T) {
+				timeout := config.DynamicCredentialIssueTimeout
+				config.DynamicCredentialIssueTimeout = 100 * time.Millisecond
+				t.Cleanup(func() { config.DynamicCredentialIssueTimeout = timeout })
+			},
+			expectedError: "exec: executable /usr/bin/sleep timed out",
+		},
+
+		"install hint of missing external command": {
+			clusterName: testClusterName,
+			execConfig: &clientcmdapi.ExecConfig{
+				APIVersion:  "client.authentication.k8s.io/v1",
+				Command:     "/path/to/command/not/found",
+				InstallHint: "install the plugin on the gateway",
+			},
+			expectedError: "exec: executable /path/to/command/not/found not found\n\ninstall the plugin on the gateway",
+		},
+
+		"always interactive mode": {
+			clusterName: testClusterName,
+			execConfig: &clientcmdapi.ExecConfig{
+				APIVersion:      "client.authentication.k8s.io/v1",
+				Command:         "true",
+				InteractiveMode: clientcmdapi.AlwaysExecInteractiveMode,
+			},
+			expectedError: "exec plugin cannot support interactive mode",
+		},
+
 		"missing API version in exec config": {
 			clusterName: testClusterName,
 			execConfig: &clientcmdapi.ExecConfig{
@@ -274,6 +327,109 @@ func TestIssueClusterCredential(t *testing.T) {
 	}
 }
 
+func TestIssueClusterCredentialWithClusterInfo(t *testing.T) {
+	cleanAllCache(t)
+	defer cleanAllCache(t)
+	output := `{"apiVersion": "client.authentication.k8s.io/v1", "kind": "ExecCredential", "status": {"token": "token"}}`
+	cluster := &clientauthentication.Cluster{
+		Server:                   "https://example.com",
+		CertificateAuthorityData: []byte("ca"),
+		ProxyURL:                 "socks5://localhost:1080",
+	}
+
+	for _, provideClusterInfo := range []bool{true, false} {
+		execInfo := filepath.Join(t.TempDir(), "exec-info")
+		ec := &clientcmdapi.ExecConfig{
+			APIVersion:         "client.authentication.k8s.io/v1",
+			Command:            "sh",
+			Args:               []string{"-c", fmt.Sprintf(`printf '%%s' "$KUBERNETES_EXEC_INFO" > %s; echo '%s'`, execInfo, output)},
+			ProvideClusterInfo: provideClusterInfo,
+			InteractiveMode:    clientcmdapi.IfAvailableExecInteractiveMode,
+		}
+		_, err := IssueClusterCredentialWithProvider(WithClusterInfo(context.TODO(), cluster), testClusterName, CredentialProviderExec, mustMarshal(t, ec))
+		assert.NoError(t, err)
+
+		bs, err := os.ReadFile(execInfo)
+		assert.NoError(t, err)
+		passed := &clientauthenticationv1.ExecCredential{}
+		assert.NoError(t, json.Unmarshal(bs, passed))
+		assert.Equal(t, "client.authentication.k8s.io/v1", passed.APIVersion)
+		assert.Equal(t, "ExecCredential", passed.Kind)
+		assert.False(t, passed.Spec.Interactive)
+		if !provideClusterInfo {
+			assert.Nil(t, passed.Spec.Cluster)
+			continue
+		}
+		if assert.NotNil(t, passed.Spec.Cluster) {
+			assert.Equal(t, cluster.Server, passed.Spec.Cluster.Server)
+			assert.Equal(t, cluster.CertificateAuthorityData, passed.Spec.Cluster.CertificateAuthorityData)
+			assert.Equal(t, cluster.ProxyURL, passed.Spec.Cluster.ProxyURL)
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	bs, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return bs
+}
+
+func TestIssueClusterCredentialConcurrently(t *testing.T) {
+	cleanAllCache(t)
+	defer cleanAllCache(t)
+	counter := filepath.Join(t.TempDir(), "counter")
+	ec := &clientcmdapi.ExecConfig{
+		APIVersion: "client.authentication.k8s.io/v1",
+		Command:    "sh",
+		Args: []string{"-c", fmt.Sprintf(`echo x >> %s; sleep 0.2; echo '{"apiVersion": "client.authentication.k8s.io/v1", "kind": "ExecCredential", "status": {"token": "token", "expirationTimestamp": "%s"}}'`,
+			counter, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))},
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cred, err := IssueClusterCredential(testClusterName, ec)
+			assert.NoError(t, err)
+			if assert.NotNil(t, cred) {
+				assert.Equal(t, "token", cred.Status.Token)
+			}
+		}()
+	}
+	wg.Wait()
+	bs, err := os.ReadFile(counter)
+	assert.NoError(t, err)
+	assert.Equal(t, "x\n", string(bs))
+}
+
+func TestIssueClusterCredentialRefresh(t *testing.T) {
+	cleanAllCache(t)
+	defer cleanAllCache(t)
+	credentials.Store(testClusterName, &clientauthentication.ExecCredential{
+		Status: &clientauthentication.ExecCredentialStatus{
+			Token:               "expiring",
+			ExpirationTimestamp: &metav1.Time{Time: time.Now().Add(3 * time.Minute)},
+		},
+	})
+	ec := &clientcmdapi.ExecConfig{
+		APIVersion: "client.authentication.k8s.io/v1",
+		Command:    "echo",
+		Args: []string{"-n", fmt.Sprintf(`{"apiVersion": "client.authentication.k8s.io/v1", "kind": "ExecCredential", "status": {"token": "refreshed", "expirationTimestamp": "%s"}}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339))},
+	}
+
+	// the expiring credential is returned while refreshing in the background
+	cred, err := IssueClusterCredential(testClusterName, ec)
+	assert.NoError(t, err)
+	assert.Equal(t, "expiring", cred.Status.Token)
+	assert.Eventually(t, func() bool {
+		cred, err := IssueClusterCredential(testClusterName, ec)
+		return err == nil && cred.Status.Token == "refreshed"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
 func cleanAllCache(t *testing.T) {
 	t.Helper()
 
@@ -0,0 +1,139 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/apis/clientauthentication"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
+)
+
+// CredentialProvider issues the credentials for accessing the clusters with
+// the Dynamic credential type. The provider is chosen by the credential
+// provider label of the cluster secret, and is configured by the secret data
+// keyed by the name of the provider.
+type CredentialProvider interface {
+	// Name of the provider, also the key of the provider config in the
+	// cluster secret
+	Name() string
+	// Issue returns a credential with either a token or a cert/key pair
+	Issue(ctx context.Context, cluster string, config []byte) (*clientauthentication.ExecCredential, error)
+}
+
+const (
+	// CredentialProviderExec runs a local binary with the ExecConfig
+	CredentialProviderExec = "exec"
+	// CredentialProviderTokenFile reads the token from a file, e.g. the
+	// projected service account token
+	CredentialProviderTokenFile = "token-file"
+	// CredentialProviderTokenExchange requests the token from an HTTP
+	// token-exchange endpoint
+	CredentialProviderTokenExchange = "token-exchange"
+	// CredentialProviderServiceAccount requests a token of a service account
+	// in the hub cluster via the TokenRequest API
+	CredentialProviderServiceAccount = "service-account"
+)
+
+var (
+	credentialProvidersLock sync.RWMutex
+	credentialProviders     = map[string]CredentialProvider{}
+)
+
+func init() {
+	RegisterCredentialProvider(execCredentialProvider{})
+	RegisterCredentialProvider(tokenFileCredentialProvider{})
+	RegisterCredentialProvider(tokenExchangeCredentialProvider{})
+	RegisterCredentialProvider(serviceAccountCredentialProvider{})
+}
+
+// RegisterCredentialProvider adds the provider, replacing the registered one
+// with the same name
+func RegisterCredentialProvider(provider CredentialProvider) {
+	credentialProvidersLock.Lock()
+	defer credentialProvidersLock.Unlock()
+	credentialProviders[provider.Name()] = provider
+}
+
+// GetCredentialProvider returns the registered provider of the name
+func GetCredentialProvider(name string) (CredentialProvider, bool) {
+	credentialProvidersLock.RLock()
+	defer credentialProvidersLock.RUnlock()
+	provider, ok := credentialProviders[name]
+	return provider, ok
+}
+
+// IssueClusterCredentialWithProvider issues the credential of the cluster
+// from the named provider, which shares the expiry-aware cache with
+// IssueClusterCredential. The cluster info set by WithClusterInfo is passed
+// to the provider.
+func IssueClusterCredentialWithProvider(ctx context.Context, name string, providerName string, config []byte) (*clientauthentication.ExecCredential, error) {
+	provider, ok := GetCredentialProvider(providerName)
+	if !ok {
+		return nil, fmt.Errorf("unknown credential provider %q", providerName)
+	}
+	// the issuance is not bound to the context of the caller, so the cluster
+	// info is carried over explicitly
+	clusterInfo := ClusterInfoFrom(ctx)
+	return issueCachedClusterCredential(ctx, name, provider.Name(), func(ctx context.Context) (*clientauthentication.ExecCredential, error) {
+		cred, err := provider.Issue(WithClusterInfo(ctx, clusterInfo), name, config)
+		if err != nil {
+			return nil, err
+		}
+		if err = validateCredential(provider.Name(), cred); err != nil {
+			return nil, err
+		}
+		return cred, nil
+	})
+}
+
+// ValidateCredentialProviderConfig checks the config of the named provider
+// without issuing the credential. Only the exec configs are inspected, the
+// configs of the other providers are checked upon issuing.
+func ValidateCredentialProviderConfig(providerName string, config []byte) error {
+	if _, ok := GetCredentialProvider(providerName); !ok {
+		return fmt.Errorf("unknown credential provider %q", providerName)
+	}
+	if providerName != CredentialProviderExec {
+		return nil
+	}
+	var ec clientcmdapi.ExecConfig
+	if err := json.Unmarshal(config, &ec); err != nil {
+		return fmt.Errorf("failed to decode exec config JSON from secret data: %v", err)
+	}
+	return ValidateExecConfig(&ec)
+}
+
+func validateCredential(provider string, cred *clientauthentication.ExecCredential) error {
+	if cred == nil || cred.Status == nil {
+		return fmt.Errorf("credential provider %s didn't return a status field", provider)
+	}
+	if cred.Status.Token == "" && cred.Status.ClientCertificateData == "" && cred.Status.ClientKeyData == "" {
+		return fmt.Errorf("credential provider %s didn't return a token or cert/key pair", provider)
+	}
+	if (cred.Status.ClientCertificateData == "") != (cred.Status.ClientKeyData == "") {
+		return fmt.Errorf("credential provider %s returned only certificate or key, not both", provider)
+	}
+	return nil
+}
+
+// newTokenCredential builds the credential from the token, the expiration is
+// taken from the "exp" claim if the token is a JWT
+func newTokenCredential(token string, expiration *metav1.Time) *clientauthentication.ExecCredential {
+	if expiration == nil {
+		if exp, ok := cert.JWTExpiration(token); ok {
+			expiration = &metav1.Time{Time: exp}
+		}
+	}
+	return &clientauthentication.ExecCredential{
+		TypeMeta: metav1.TypeMeta{Kind: "ExecCredential"},
+		Status: &clientauthentication.ExecCredentialStatus{
+			Token:               token,
+			ExpirationTimestamp: expiration,
+		},
+	}
+}
@@ -0,0 +1,190 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/client-go/pkg/apis/clientauthentication"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/utils/pointer"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/util/cert"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+const defaultServiceAccountTokenExpirationSeconds = 3600
+
+// execCredentialProvider runs the local binary prescribed by the ExecConfig
+type execCredentialProvider struct{}
+
+func (execCredentialProvider) Name() string {
+	return CredentialProviderExec
+}
+
+func (execCredentialProvider) Issue(ctx context.Context, _ string, config []byte) (*clientauthentication.ExecCredential, error) {
+	var ec clientcmdapi.ExecConfig
+	if err := json.Unmarshal(config, &ec); err != nil {
+		return nil, fmt.Errorf("failed to decode exec config JSON from secret data: %v", err)
+	}
+	return issueClusterCredential(ctx, &ec)
+}
+
+// TokenFileConfig configures the token-file credential provider
+type TokenFileConfig struct {
+	// Path to the token file, which is read upon issuing so that the
+	// rotated tokens are picked up
+	Path string `json:"path"`
+}
+
+// tokenFileCredentialProvider reads the token from the file, e.g. the
+// projected service account token volume
+type tokenFileCredentialProvider struct{}
+
+func (tokenFileCredentialProvider) Name() string {
+	return CredentialProviderTokenFile
+}
+
+func (tokenFileCredentialProvider) Issue(_ context.Context, _ string, config []byte) (*clientauthentication.ExecCredential, error) {
+	cfg := &TokenFileConfig{}
+	if err := json.Unmarshal(config, cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode token-file config JSON from secret data: %v", err)
+	}
+	if cfg.Path == "" {
+		return nil, errors.New("missing \"path\" property on token-file config object")
+	}
+	bs, err := readTokenFile(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %v", err)
+	}
+	return newTokenCredential(strings.TrimSpace(string(bs)), nil), nil
+}
+
+// readTokenFile reads the token file only if it resides in the allowed
+// directories after resolving the symlinks, so that the cluster secrets can't
+// read arbitrary files of the cluster-gateway, e.g. its own service account
+// token.
+func readTokenFile(path string) ([]byte, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("path %q is not absolute", path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range config.DynamicCredentialTokenFileDirs {
+		resolvedDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(resolvedDir, resolved)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return os.ReadFile(resolved)
+	}
+	return nil, fmt.Errorf("path %q is not in the directories allowed by --dynamic-credential-token-file-dirs", path)
+}
+
+// ServiceAccountConfig configures the service-account credential provider
+type ServiceAccountConfig struct {
+	// Namespace of the service account in the hub cluster, defaults to the
+	// namespace of the cluster secrets
+	Namespace string `json:"namespace,omitempty"`
+	// Name of the service account
+	Name string `json:"name"`
+	// Audiences of the requested token, which are required and shouldn't
+	// include the audiences of the hub
+	Audiences []string `json:"audiences,omitempty"`
+	// ExpirationSeconds of the requested token, defaults to an hour
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+}
+
+// serviceAccountCredentialProvider requests the token of a service account in
+// the hub cluster, which is trusted by the managed clusters, e.g. via the
+// service account issuer discovery.
+type serviceAccountCredentialProvider struct{}
+
+func (serviceAccountCredentialProvider) Name() string {
+	return CredentialProviderServiceAccount
+}
+
+func (serviceAccountCredentialProvider) Issue(ctx context.Context, _ string, cfgBs []byte) (*clientauthentication.ExecCredential, error) {
+	cfg := &ServiceAccountConfig{}
+	if err := json.Unmarshal(cfgBs, cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode service-account config JSON from secret data: %v", err)
+	}
+	if cfg.Name == "" {
+		return nil, errors.New("missing \"name\" property on service-account config object")
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = config.SecretNamespace
+	}
+	if err := validateServiceAccountConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.ExpirationSeconds == nil {
+		cfg.ExpirationSeconds = pointer.Int64(defaultServiceAccountTokenExpirationSeconds)
+	}
+	if singleton.GetKubeClient() == nil {
+		return nil, errors.New("loopback clients are not inited")
+	}
+	tr, err := singleton.GetKubeClient().CoreV1().
+		ServiceAccounts(cfg.Namespace).
+		CreateToken(ctx, cfg.Name, &authenticationv1.TokenRequest{
+			Spec: authenticationv1.TokenRequestSpec{
+				Audiences:         cfg.Audiences,
+				ExpirationSeconds: cfg.ExpirationSeconds,
+			},
+		}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token for service account %s/%s: %v", cfg.Namespace, cfg.Name, err)
+	}
+	return newTokenCredential(tr.Status.Token, &tr.Status.ExpirationTimestamp), nil
+}
+
+// inClusterTokenFile is the service account token of the cluster-gateway,
+// which tells its own service account and the audiences of the hub
+var inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// validateServiceAccountConfig restricts the tokens requested by the cluster
+// secrets, which are sent to the endpoints defined by the same secrets. Only
+// the service accounts allowed by --dynamic-credential-service-accounts are
+// requested, except for the cluster-gateway's own one, and the tokens must
+// not be accepted by the hub.
+func validateServiceAccountConfig(cfg *ServiceAccountConfig) error {
+	serviceAccount := cfg.Namespace + "/" + cfg.Name
+	if !sets.NewString(config.DynamicCredentialServiceAccounts...).Has(serviceAccount) {
+		return fmt.Errorf("service account %s is not allowed by --dynamic-credential-service-accounts", serviceAccount)
+	}
+	if len(cfg.Audiences) == 0 {
+		return errors.New("missing \"audiences\" property on service-account config object")
+	}
+	bs, err := os.ReadFile(inClusterTokenFile)
+	if err != nil {
+		// not running inside the hub cluster
+		return nil
+	}
+	subject, hubAudiences, ok := cert.JWTSubject(strings.TrimSpace(string(bs)))
+	if !ok {
+		return nil
+	}
+	if subject == serviceaccount.MakeUsername(cfg.Namespace, cfg.Name) {
+		return fmt.Errorf("service account %s is the cluster-gateway's own", serviceAccount)
+	}
+	for _, audience := range cfg.Audiences {
+		if sets.NewString(hubAudiences...).Has(audience) {
+			return fmt.Errorf("audience %q is accepted by the hub", audience)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+//go:build unix
+
+package exec
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/oam-dev/cluster-gateway/pkg/config"
+	"github.com/oam-dev/cluster-gateway/pkg/util/singleton"
+)
+
+func testJWT(exp time.Time) string {
+	encode := func(v interface{}) string {
+		bs, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(bs)
+	}
+	return encode(map[string]string{"alg": "none"}) + "." + encode(map[string]int64{"exp": exp.Unix()}) + ".signature"
+}
+
+// setTestTokenFileDirs allows the token files in the directories during the
+// test
+func setTestTokenFileDirs(t *testing.T, dirs ...string) {
+	allowed := config.DynamicCredentialTokenFileDirs
+	t.Cleanup(func() { config.DynamicCredentialTokenFileDirs = allowed })
+	config.DynamicCredentialTokenFileDirs = dirs
+}
+
+func TestIssueClusterCredentialWithTokenFile(t *testing.T) {
+	credentials.Delete(testClusterName)
+	defer credentials.Delete(testClusterName)
+	dir := t.TempDir()
+	setTestTokenFileDirs(t, dir)
+	path := filepath.Join(dir, "token")
+	config := []byte(fmt.Sprintf(`{"path": %q}`, path))
+
+	_, err := IssueClusterCredentialWithProvider(context.TODO(), testClusterName, CredentialProviderTokenFile, config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read token file")
+
+	// the files outside the allowed directories are not read, including via
+	// the symlinks
+	outside := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(outside, []byte("outside"), 0600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+	for _, p := range []string{outside, filepath.Join(dir, "link"), filepath.Join(dir, "..", filepath.Base(filepath.Dir(outside)), "token"), "token"} {
+		_, err = IssueClusterCredentialWithProvider(context.TODO(), testClusterName, CredentialProviderTokenFile, []byte(fmt.Sprintf(`{"path": %q}`, p)))
+		require.Error(t, err, p)
+	}
+	_, err = IssueClusterCredentialWithProvider(context.TODO(), testClusterName, CredentialProviderTokenFile, []byte(fmt.Sprintf(`{"path": %q}`, outside)))
+	assert.Contains(t, err.Error(), "not in the directories allowed")
+
+	// opaque tokens are not cached
+	require.NoError(t, os.WriteFile(path, []byte("first\n"), 0600))
+	cred, err := IssueClusterCredentialWithProvider(context.TODO(), testClusterName, CredentialProviderTokenFile, config)
+	require.NoError(t, err)
+	assert.Equal(t, "first", cred.Status.Token)
+	require.NoError(t, os.WriteFile(path, []byte("second"), 0600))
+	cred, err = IssueClusterCredentialWithProvider(context.TODO(), testClusterName, CredentialProviderTokenFile, config)
+	require.NoError(t, err)
+	assert.Equal(t, "second", cred.Status.Token)
+
+	// jwt tokens are cached until expiring
+	token := testJWT(time.Now().Add(time.Hour))
+	require.NoError(t, os.WriteFile(path, []byte(token), 0600))
+	cred, err = IssueClusterCredentialWithProvider(context.TODO(), testClusterName, CredentialProviderTokenFile, config)
+	require.NoError(t, err)
+	assert.Equal(t, token, cred.Status.Token)
+	assert.NotNil(t, cred.Status.ExpirationTimestamp)
+	require.NoError(t, os.WriteFile(path, []byte("third"), 0600))
+	cred, err = IssueClusterCredentialWithProvider(context.TODO(), testClusterName, CredentialProviderTokenFile, config)
+	require.NoError(t, err)
+	assert.Equal(t, token, cred.Status.Token)
+}
+
+func TestIssueClusterCredentialWithTokenExchange(t *testing.T) {
+	requests := int32(0)
+	svr := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		exchangeReq := &tokenExchangeRequest{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(exchangeReq))
+		if req.Header.Get("Authorization") != "Bearer subject" {
+			resp.WriteHeader(http.StatusUnauthorized)
+			_, _ = resp.Write([]byte("unauthorized"))
+			return
+		}
+		switch exchangeReq.Cluster {
+		case "cert":
+			_ = json.NewEncoder(resp).Encode(&tokenExchangeResponse{ClientCertificateData: "cert", ClientKeyData: "key"})
+		case "empty":
+			_ = json.NewEncoder(resp).Encode(&tokenExchangeResponse{})
+		default:
+			_ = json.NewEncoder(resp).Encode(&tokenExchangeResponse{
+				Token:               exchangeReq.Cluster + "@" + exchangeReq.Audience,
+				ExpirationTimestamp: &metav1.Time{Time: time.Now().Add(time.Hour)},
+			})
+		}
+	}))
+	defer svr.Close()
+	subjectTokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(subjectTokenFile, []byte("subject"), 0600))
+	setTestTokenFileDirs(t, filepath.Dir(subjectTokenFile))
+
+	testcases := map[string]struct {
+		Config   string
+		Token    string
+		Cert     string
+		Error    string
+		Requests int32
+	}{
+		"token": {
+			Config:   fmt.Sprintf(`{"url": %q, "audience": "hub", "subjectTokenFile": %q}`, svr.URL, subjectTokenFile),
+			Token:    "token@hub",
+			Requests: 1,
+		},
+		"cert": {
+			Config:   fmt.Sprintf(`{"url": %q, "subjectTokenFile": %q}`, svr.URL, subjectTokenFile),
+			Cert:     "cert",
+			Requests: 2,
+		},
+		"empty": {
+			Config:   fmt.Sprintf(`{"url": %q, "subjectTokenFile": %q}`, svr.URL, subjectTokenFile),
+			Error:    "credential provider token-exchange didn't return a token or cert/key pair",
+			Requests: 2,
+		},
+		"unauthorized": {
+			Config:   fmt.Sprintf(`{"url": %q}`, svr.URL),
+			Error:    "token-exchange responded with status 401: unauthorized",
+			Requests: 2,
+		},
+		"missing-url": {
+			Config: `{}`,
+			Error:  `missing "url" property on token-exchange config object`,
+		},
+	}
+	for name, tt := range testcases {
+		t.Run(name, func(t *testing.T) {
+			defer credentials.Delete(name)
+			atomic.StoreInt32(&requests, 0)
+			for i := 0; i < 2; i++ {
+				cred, err := IssueClusterCredentialWithProvider(context.TODO(), name, CredentialProviderTokenExchange, []byte(tt.Config))
+				if tt.Error != "" {
+					require.Error(t, err)
+					assert.Contains(t, err.Error(), tt.Error)
+					continue
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tt.Token, cred.Status.Token)
+				assert.Equal(t, tt.Cert, cred.Status.ClientCertificateData)
+			}
+			assert.Equal(t, tt.Requests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestIssueClusterCredentialWithServiceAccount(t *testing.T) {
+	credentials.Delete(testClusterName)
+	defer credentials.Delete(testClusterName)
+	client := fake.NewSimpleClientset()
+	requests := int32(0)
+	client.PrependReactor("create", "serviceaccounts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		createAction := action.(clienttesting.CreateAction)
+		if createAction.GetSubresource() != "token" {
+			return false, nil, nil
+		}
+		atomic.AddInt32(&requests, 1)
+		tr := createAction.GetObject().(*authenticationv1.TokenRequest)
+		assert.Equal(t, "hub", action.GetNamespace())
+		assert.Equal(t, []string{"cluster"}, tr.Spec.Audiences)
+		assert.Equal(t, int64(defaultServiceAccountTokenExpirationSeconds), *tr.Spec.ExpirationSeconds)
+		tr.Status = authenticationv1.TokenRequestStatus{
+			Token:               "sa-token",
+			ExpirationTimestamp: metav1.Time{Time: time.Now().Add(time.Hour)},
+		}
+		return true, tr, nil
+	})
+	singleton.SetKubeClient(client)
+	defer singleton.SetKubeClient(nil)
+
+	allowed := config.DynamicCredentialServiceAccounts
+	defer func() { config.DynamicCredentialServiceAccounts = allowed }()
+	config.DynamicCredentialServiceAccounts = []string{"hub/gateway", "hub/cluster-gateway"}
+	tokenFile := inClusterTokenFile
+	defer func() { inClusterTokenFile = tokenFile }()
+	inClusterTokenFile = filepath.Join(t.TempDir(), "token")
+	claims, _ := json.Marshal(map[string]interface{}{"sub": "system:serviceaccount:hub:cluster-gateway", "aud": []string{"https://kubernetes.default.svc"}})
+	require.NoError(t, os.WriteFile(inClusterTokenFile, []byte("e30."+base64.RawURLEncoding.EncodeToString(claims)+".signature"), 0600))
+
+	cfg := []byte(`{"namespace": "hub", "name": "gateway", "audiences": ["cluster"]}`)
+	for i := 0; i < 2; i++ {
+		cred, err := IssueClusterCredentialWithProvider(context.TODO(), testClusterName, CredentialProviderServiceAccount, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, "sa-token", cred.Status.Token)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	for cfg, expected := range map[string]string{
+		`{}`: `missing "name" property`,
+		`{"name": "gateway", "audiences": ["cluster"]}`:                                            "/gateway is not allowed",
+		`{"namespace": "hub", "name": "other", "audiences": ["cluster"]}`:                          "service account hub/other is not allowed",
+		`{"namespace": "hub", "name": "gateway"}`:                                                  `missing "audiences" property`,
+		`{"namespace": "hub", "name": "cluster-gateway", "audiences": ["cluster"]}`:                "is the cluster-gateway's own",
+		`{"namespace": "hub", "name": "gateway", "audiences": ["https://kubernetes.default.svc"]}`: "is accepted by the hub",
+	} {
+		credentials.Delete("another")
+		_, err := IssueClusterCredentialWithProvider(context.TODO(), "another", CredentialProviderServiceAccount, []byte(cfg))
+		require.Error(t, err, cfg)
+		assert.Contains(t, err.Error(), expected)
+	}
+	credentials.Delete("another")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestIssueClusterCredentialWithUnknownProvider(t *testing.T) {
+	_, err := IssueClusterCredentialWithProvider(context.TODO(), testClusterName, "unknown", nil)
+	require.Error(t, err)
+	assert.Equal(t, `unknown credential provider "unknown"`, err.Error())
+}
+
+func TestValidateCredentialProviderConfig(t *testing.T) {
+	assert.NoError(t, ValidateCredentialProviderConfig(CredentialProviderExec, []byte(`{"apiVersion": "client.authentication.k8s.io/v1", "command": "echo"}`)))
+	assert.NoError(t, ValidateCredentialProviderConfig(CredentialProviderTokenFile, []byte(`{"path": "/token"}`)))
+	assert.EqualError(t, ValidateCredentialProviderConfig("unknown", []byte(`{}`)), `unknown credential provider "unknown"`)
+	assert.EqualError(t, ValidateCredentialProviderConfig(CredentialProviderExec, []byte(`{"apiVersion": "client.authentication.k8s.io/v1"}`)),
+		`missing "command" property on exec config object`)
+	assert.EqualError(t, ValidateCredentialProviderConfig(CredentialProviderExec, []byte(`{"apiVersion": "example.org/v1", "command": "echo"}`)),
+		`exec plugin: invalid apiVersion "example.org/v1"`)
+}
@@ -0,0 +1,133 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/apis/clientauthentication"
+	"k8s.io/client-go/transport"
+)
+
+const (
+	defaultTokenExchangeTimeout     = 10 * time.Second
+	maxTokenExchangeErrorBodyLength = 1024
+)
+
+// TokenExchangeConfig configures the token-exchange credential provider
+type TokenExchangeConfig struct {
+	// URL of the token-exchange endpoint
+	URL string `json:"url"`
+	// Audience of the requested token
+	Audience string `json:"audience,omitempty"`
+	// SubjectTokenFile is the path to the token presented as the bearer
+	// token to the endpoint, e.g. the token of cluster-gateway itself
+	SubjectTokenFile string `json:"subjectTokenFile,omitempty"`
+	// CAFile is the path to the CA for verifying the endpoint
+	CAFile string `json:"caFile,omitempty"`
+	// CertFile and KeyFile are the paths to the client certificate
+	// presented to the endpoint
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// InsecureSkipTLSVerify skips verifying the endpoint
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+	// Timeout of the requests to the endpoint, defaults to 10s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// tokenExchangeRequest is posted to the token-exchange endpoint
+type tokenExchangeRequest struct {
+	Cluster  string `json:"cluster"`
+	Audience string `json:"audience,omitempty"`
+}
+
+// tokenExchangeResponse is returned from the token-exchange endpoint
+type tokenExchangeResponse struct {
+	Token                 string       `json:"token,omitempty"`
+	ClientCertificateData string       `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string       `json:"clientKeyData,omitempty"`
+	ExpirationTimestamp   *metav1.Time `json:"expirationTimestamp,omitempty"`
+}
+
+// tokenExchangeCredentialProvider posts the cluster name to the HTTP endpoint
+// and uses the returned token or cert/key pair
+type tokenExchangeCredentialProvider struct{}
+
+func (tokenExchangeCredentialProvider) Name() string {
+	return CredentialProviderTokenExchange
+}
+
+func (tokenExchangeCredentialProvider) Issue(ctx context.Context, cluster string, config []byte) (*clientauthentication.ExecCredential, error) {
+	cfg := &TokenExchangeConfig{}
+	if err := json.Unmarshal(config, cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode token-exchange config JSON from secret data: %v", err)
+	}
+	if cfg.URL == "" {
+		return nil, errors.New("missing \"url\" property on token-exchange config object")
+	}
+	body, err := json.Marshal(tokenExchangeRequest{Cluster: cluster, Audience: cfg.Audience})
+	if err != nil {
+		return nil, err
+	}
+	rt, err := transport.New(&transport.Config{
+		TLS: transport.TLSConfig{
+			CAFile:   cfg.CAFile,
+			CertFile: cfg.CertFile,
+			KeyFile:  cfg.KeyFile,
+			Insecure: cfg.InsecureSkipTLSVerify,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed building client for token-exchange: %v", err)
+	}
+	timeout := defaultTokenExchangeTimeout
+	if cfg.Timeout != nil && cfg.Timeout.Duration > 0 {
+		timeout = cfg.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid url for token-exchange: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if cfg.SubjectTokenFile != "" {
+		subjectToken, err := readTokenFile(cfg.SubjectTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read subject token file: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(subjectToken)))
+	}
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed requesting token-exchange: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxTokenExchangeErrorBodyLength))
+		return nil, fmt.Errorf("token-exchange responded with status %d: %s", resp.StatusCode, string(msg))
+	}
+	exchanged := &tokenExchangeResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(exchanged); err != nil {
+		return nil, fmt.Errorf("failed decoding response from token-exchange: %v", err)
+	}
+	if exchanged.Token != "" {
+		return newTokenCredential(exchanged.Token, exchanged.ExpirationTimestamp), nil
+	}
+	return &clientauthentication.ExecCredential{
+		TypeMeta: metav1.TypeMeta{Kind: "ExecCredential"},
+		Status: &clientauthentication.ExecCredentialStatus{
+			ClientCertificateData: exchanged.ClientCertificateData,
+			ClientKeyData:         exchanged.ClientKeyData,
+			ExpirationTimestamp:   exchanged.ExpirationTimestamp,
+		},
+	}, nil
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/oam-dev/cluster-gateway/pkg/util/scheme"
 )
 
+var restConfig *clientgorest.Config
 var kubeClient kubernetes.Interface
 var ocmClient ocmclient.Interface
 var ctrlClient client.Client
@@ -43,10 +44,22 @@ func GetSecretControl() cert.SecretControl {
 	return secretControl
 }
 
+// GetSecretInformer returns the shared cluster secret informer, which is
+// only available when the SecretCache feature gate is enabled.
+func GetSecretInformer() cache.SharedIndexInformer {
+	return secretInformer
+}
+
 func GetOCMClient() ocmclient.Interface {
 	return ocmClient
 }
 
+// GetRestConfig returns the config of the loopback clients, which is
+// available after the loopback clients are inited.
+func GetRestConfig() *clientgorest.Config {
+	return restConfig
+}
+
 func GetKubeClient() kubernetes.Interface {
 	return kubeClient
 }
@@ -69,6 +82,7 @@ func InitLoopbackClient(ctx server.PostStartHookContext) error {
 	}
 	copiedCfg := clientgorest.CopyConfig(cfg)
 	copiedCfg.RateLimiter = nil
+	restConfig = copiedCfg
 	kubeClient, err = kubernetes.NewForConfig(copiedCfg)
 	if err != nil {
 		return err
@@ -125,6 +139,11 @@ func SetSecretControl(ctrl cert.SecretControl) {
 	secretControl = ctrl
 }
 
+// SetSecretInformer is for test only
+func SetSecretInformer(informer cache.SharedIndexInformer) {
+	secretInformer = informer
+}
+
 // SetOCMClient is for test only
 func SetOCMClient(c ocmclient.Interface) {
 	ocmClient = c
@@ -148,3 +167,10 @@ func setOCMClusterInformer(c ocmclient.Interface, stopCh <-chan struct{}) error
 func GetClusterControl() clusterutil.OCMClusterControl {
 	return clusterControl
 }
+
+// GetClusterInformer returns the OCM ManagedCluster informer, which is only
+// available when the OCMClusterCache feature gate is enabled and the
+// ManagedCluster CRD is installed.
+func GetClusterInformer() cache.SharedIndexInformer {
+	return clusterInformer
+}